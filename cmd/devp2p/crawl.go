@@ -0,0 +1,186 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/groshproject/grosh-core/log"
+	"github.com/groshproject/grosh-core/p2p/enode"
+)
+
+const crawlWorkers = 16
+
+// crawler walks the DHT and checks the liveness of the nodes it finds. Nodes of the
+// input set are re-checked as well, so running the crawler on its previous output
+// keeps the set up to date.
+type crawler struct {
+	input  nodeSet
+	disc   resolver
+	iters  []enode.Iterator
+	ch     chan *enode.Node
+	closed chan struct{}
+
+	mu       sync.Mutex // protects output and inflight
+	output   nodeSet
+	inflight map[enode.ID]struct{}
+
+	// settings
+	revalidateInterval time.Duration
+	now                func() time.Time
+}
+
+type resolver interface {
+	RequestENR(*enode.Node) (*enode.Node, error)
+}
+
+func newCrawler(input nodeSet, disc resolver, iters ...enode.Iterator) *crawler {
+	c := &crawler{
+		input:              input,
+		output:             make(nodeSet, len(input)),
+		inflight:           make(map[enode.ID]struct{}),
+		disc:               disc,
+		iters:              append([]enode.Iterator{enode.IterNodes(input.nodes())}, iters...),
+		ch:                 make(chan *enode.Node),
+		closed:             make(chan struct{}),
+		revalidateInterval: 10 * time.Minute,
+		now:                func() time.Time { return time.Now().Truncate(time.Second) },
+	}
+	for id, n := range input {
+		c.output[id] = n
+	}
+	return c
+}
+
+// run crawls until the timeout expires or all iterators are exhausted, and returns
+// the updated node set.
+func (c *crawler) run(timeout time.Duration) nodeSet {
+	var (
+		timeoutTimer = time.NewTimer(timeout)
+		statusTicker = time.NewTicker(time.Second * 8)
+		doneCh       = make(chan enode.Iterator, len(c.iters))
+		liveIters    = len(c.iters)
+		workers      sync.WaitGroup
+	)
+	defer timeoutTimer.Stop()
+	defer statusTicker.Stop()
+	for _, it := range c.iters {
+		go c.runIterator(doneCh, it)
+	}
+	workers.Add(crawlWorkers)
+	for i := 0; i < crawlWorkers; i++ {
+		go func() {
+			defer workers.Done()
+			for n := range c.ch {
+				c.updateNode(n)
+			}
+		}()
+	}
+
+loop:
+	for {
+		select {
+		case it := <-doneCh:
+			if it == c.iters[0] {
+				log.Info("Revalidation of input set is done", "len", len(c.input))
+			}
+			if liveIters--; liveIters == 0 {
+				break loop
+			}
+		case <-timeoutTimer.C:
+			break loop
+		case <-statusTicker.C:
+			c.mu.Lock()
+			log.Info("Crawling in progress", "nodes", len(c.output))
+			c.mu.Unlock()
+		}
+	}
+
+	close(c.closed)
+	for _, it := range c.iters {
+		it.Close()
+	}
+	for ; liveIters > 0; liveIters-- {
+		<-doneCh
+	}
+	close(c.ch)
+	workers.Wait()
+	return c.output
+}
+
+func (c *crawler) runIterator(done chan<- enode.Iterator, it enode.Iterator) {
+	defer func() { done <- it }()
+	for it.Next() {
+		select {
+		case c.ch <- it.Node():
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// updateNode requests the record of a node and updates its entry in the output set.
+func (c *crawler) updateNode(n *enode.Node) {
+	c.mu.Lock()
+	node, ok := c.output[n.ID()]
+	_, busy := c.inflight[n.ID()]
+	// Skip validation of recently-seen nodes and nodes which are being checked
+	// by another worker.
+	if busy || ok && c.now().Sub(node.LastCheck) < c.revalidateInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.inflight[n.ID()] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, n.ID())
+		c.mu.Unlock()
+	}()
+
+	// Request the node record.
+	nn, err := c.disc.RequestENR(n)
+	node.LastCheck = c.now()
+	if err != nil {
+		if node.Score == 0 {
+			// Node doesn't implement EIP-868.
+			log.Debug("Skipping node", "id", n.ID())
+			return
+		}
+		node.Score /= 2
+	} else {
+		fresh := newNodeJSON(nn)
+		node.N, node.Seq, node.ForkID = fresh.N, fresh.Seq, fresh.ForkID
+		node.Score++
+		if node.FirstResponse.IsZero() {
+			node.FirstResponse = node.LastCheck
+		}
+		node.LastResponse = node.LastCheck
+	}
+
+	// Store/update node in output set.
+	c.mu.Lock()
+	if node.Score <= 0 {
+		log.Info("Removing node", "id", n.ID())
+		delete(c.output, n.ID())
+	} else {
+		log.Info("Updating node", "id", n.ID(), "seq", n.Seq(), "score", node.Score)
+		c.output[n.ID()] = node
+	}
+	c.mu.Unlock()
+}
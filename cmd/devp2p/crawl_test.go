@@ -0,0 +1,200 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/core/forkid"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/enr"
+)
+
+// testResolver answers RequestENR for the nodes it knows about.
+type testResolver struct {
+	mu    sync.Mutex
+	nodes map[enode.ID]*enode.Node
+	calls map[enode.ID]int
+}
+
+func (r *testResolver) RequestENR(n *enode.Node) (*enode.Node, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls[n.ID()]++
+	if nn, ok := r.nodes[n.ID()]; ok {
+		return nn, nil
+	}
+	return nil, errors.New("timeout")
+}
+
+func newTestNode(t *testing.T, seq uint64, entries ...enr.Entry) *enode.Node {
+	key, _ := crypto.GenerateKey()
+	var r enr.Record
+	r.SetSeq(seq)
+	r.Set(enr.IP(net.IP{10, 0, 0, 1}))
+	r.Set(enr.UDP(30303))
+	for _, e := range entries {
+		r.Set(e)
+	}
+	if err := enode.SignV4(&r, key); err != nil {
+		t.Fatal(err)
+	}
+	n, err := enode.New(enode.ValidSchemes, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCrawler(t *testing.T) {
+	var (
+		now     = time.Unix(1000000, 0)
+		eth     = ethEntry{ForkID: forkid.ID{Hash: [4]byte{1, 2, 3, 4}, Next: 5}}
+		live    = newTestNode(t, 1, eth)
+		fresh   = newTestNode(t, 1)
+		dead    = newTestNode(t, 1)
+		recent  = newTestNode(t, 1)
+		unknown = newTestNode(t, 1)
+		res     = &testResolver{
+			nodes: map[enode.ID]*enode.Node{live.ID(): live, fresh.ID(): fresh, recent.ID(): recent},
+			calls: make(map[enode.ID]int),
+		}
+	)
+	input := make(nodeSet)
+	input.add(live, dead, recent)
+	input[live.ID()] = withScore(input[live.ID()], 3, now.Add(-time.Hour))
+	input[dead.ID()] = withScore(input[dead.ID()], 1, now.Add(-time.Hour))
+	input[recent.ID()] = withScore(input[recent.ID()], 2, now.Add(-time.Minute))
+
+	c := newCrawler(input, res, enode.IterNodes([]*enode.Node{fresh, unknown}))
+	c.now = func() time.Time { return now }
+	output := c.run(10 * time.Second)
+
+	if len(output) != 3 {
+		t.Fatalf("wrong output size %d, want 3", len(output))
+	}
+	if n := output[live.ID()]; n.Score != 4 || n.LastResponse != now || n.ForkID == nil || n.ForkID.Next != 5 {
+		t.Errorf("wrong entry for live node: %+v", n)
+	}
+	if n := output[fresh.ID()]; n.Score != 1 || n.FirstResponse != now {
+		t.Errorf("wrong entry for new node: %+v", n)
+	}
+	if _, ok := output[dead.ID()]; ok {
+		t.Error("dead node not removed")
+	}
+	if _, ok := output[unknown.ID()]; ok {
+		t.Error("unresponsive new node was added")
+	}
+	if res.calls[recent.ID()] != 0 {
+		t.Error("recently checked node was checked again")
+	}
+}
+
+func withScore(n nodeJSON, score int, lastCheck time.Time) nodeJSON {
+	n.Score = score
+	n.LastCheck = lastCheck
+	n.FirstResponse, n.LastResponse = lastCheck, lastCheck
+	return n
+}
+
+func TestNodesetFilter(t *testing.T) {
+	var (
+		mainnet = forkid.ID{Hash: [4]byte{0xfc, 0x64, 0xec, 0x04}, Next: 1150000}
+		rinkeby = forkid.ID{Hash: [4]byte{0xaf, 0xec, 0x6b, 0x27}}
+		n1      = newTestNode(t, 1, ethEntry{ForkID: mainnet})
+		n2      = newTestNode(t, 1, ethEntry{ForkID: rinkeby})
+		n3      = newTestNode(t, 1)
+	)
+	ns := make(nodeSet)
+	ns.add(n1, n2, n3)
+
+	tests := []struct {
+		args []string
+		want []enode.ID
+	}{
+		{[]string{"-eth-network", "mainnet"}, []enode.ID{n1.ID()}},
+		{[]string{"-fork-hash", "0xafec6b27"}, []enode.ID{n2.ID()}},
+		{[]string{"-has", "eth"}, []enode.ID{n1.ID(), n2.ID()}},
+		{[]string{"-has", "eth", "-ip", "10.0.0.0/8"}, []enode.ID{n1.ID(), n2.ID()}},
+		{[]string{"-ip", "192.168.0.0/16"}, nil},
+	}
+	for _, test := range tests {
+		filter, err := andFilter(test.args)
+		if err != nil {
+			t.Fatalf("%v: %v", test.args, err)
+		}
+		var got []enode.ID
+		for _, n := range ns.nodes() {
+			if filter(ns[n.ID()]) {
+				got = append(got, n.ID())
+			}
+		}
+		if !sameIDs(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.args, got, test.want)
+		}
+	}
+
+	// Check that the set survives a round trip through the JSON file.
+	dir, err := ioutil.TempDir("", "nodeset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "nodes.json")
+	if err := writeNodesJSON(file, ns); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadNodesJSON(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, ns) {
+		t.Errorf("loaded set differs:\nhave %v\nwant %v", loaded, ns)
+	}
+
+	if _, err := andFilter([]string{"-ip"}); err == nil {
+		t.Error("no error for missing filter argument")
+	}
+	if _, err := andFilter([]string{"-foo"}); err == nil {
+		t.Error("no error for unknown filter")
+	}
+}
+
+func sameIDs(a, b []enode.ID) bool {
+	set := make(map[enode.ID]bool)
+	for _, id := range a {
+		set[id] = true
+	}
+	if len(set) != len(b) || len(a) != len(b) {
+		return false
+	}
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+	}
+	return true
+}
@@ -23,6 +23,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/groshproject/grosh-core/cmd/devp2p/internal/v4test"
 	"github.com/groshproject/grosh-core/crypto"
 	"github.com/groshproject/grosh-core/p2p/discover"
 	"github.com/groshproject/grosh-core/p2p/enode"
@@ -38,6 +39,8 @@ var (
 			discv4PingCommand,
 			discv4RequestRecordCommand,
 			discv4ResolveCommand,
+			discv4TestCommand,
+			discv4CrawlCommand,
 		},
 	}
 	discv4PingCommand = cli.Command{
@@ -56,12 +59,38 @@ var (
 		Action: discv4Resolve,
 		Flags:  []cli.Flag{bootnodesFlag},
 	}
+	discv4CrawlCommand = cli.Command{
+		Name:      "crawl",
+		Usage:     "Updates a nodes.json file with random nodes found in the DHT",
+		ArgsUsage: "<nodes.json>",
+		Action:    discv4Crawl,
+		Flags:     []cli.Flag{bootnodesFlag, crawlTimeoutFlag, revalidateIntervalFlag},
+	}
+	discv4TestCommand = cli.Command{
+		Name:      "test",
+		Usage:     "Runs protocol tests against a node",
+		ArgsUsage: "<node>",
+		Action:    discv4Test,
+		Flags:     []cli.Flag{testPatternFlag},
+	}
 )
 
-var bootnodesFlag = cli.StringFlag{
-	Name:  "bootnodes",
-	Usage: "Comma separated nodes used for bootstrapping",
-}
+var (
+	bootnodesFlag = cli.StringFlag{
+		Name:  "bootnodes",
+		Usage: "Comma separated nodes used for bootstrapping",
+	}
+	crawlTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Time limit for the crawl.",
+		Value: 30 * time.Minute,
+	}
+	revalidateIntervalFlag = cli.DurationFlag{
+		Name:  "revalidate",
+		Usage: "Minimum time between liveness checks of known nodes.",
+		Value: 10 * time.Minute,
+	}
+)
 
 func discv4Ping(ctx *cli.Context) error {
 	n, disc, err := getNodeArgAndStartV4(ctx)
@@ -104,6 +133,42 @@ func discv4Resolve(ctx *cli.Context) error {
 	return nil
 }
 
+func discv4Crawl(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	nodesFile := ctx.Args().First()
+	inputSet, err := loadNodesJSONIfExists(nodesFile)
+	if err != nil {
+		return err
+	}
+	bootnodes, err := parseBootnodes(ctx)
+	if err != nil {
+		return err
+	}
+	disc, err := startV4(append(bootnodes, inputSet.nodes()...))
+	if err != nil {
+		return err
+	}
+	defer disc.Close()
+
+	c := newCrawler(inputSet, disc, disc.RandomNodes())
+	c.revalidateInterval = ctx.Duration(revalidateIntervalFlag.Name)
+	output := c.run(ctx.Duration(crawlTimeoutFlag.Name))
+	return writeNodesJSON(nodesFile, output)
+}
+
+func discv4Test(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("missing node as command-line argument")
+	}
+	n, err := parseNode(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	return runTests(ctx, v4test.Tests(n))
+}
+
 func getNodeArgAndStartV4(ctx *cli.Context) (*enode.Node, *discover.UDPv4, error) {
 	if ctx.NArg() != 1 {
 		return nil, nil, fmt.Errorf("missing node as command-line argument")
@@ -0,0 +1,232 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ethtest contains conformance tests for the eth wire protocol.
+package ethtest
+
+import (
+	"bytes"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/internal/utesting"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/rlp"
+)
+
+// Suite represents a structure used to test the eth protocol of a node.
+type Suite struct {
+	Dest *enode.Node
+}
+
+// NewSuite creates a test suite for the given node.
+func NewSuite(dest *enode.Node) *Suite {
+	return &Suite{Dest: dest}
+}
+
+// AllTests returns all tests of the suite.
+func (s *Suite) AllTests() []utesting.Test {
+	return []utesting.Test{
+		{Name: "Ping", Fn: s.TestPing},
+		{Name: "Status", Fn: s.TestStatus},
+		{Name: "StatusWrongNetworkID", Fn: s.TestStatusWrongNetworkID},
+		{Name: "StatusWrongGenesis", Fn: s.TestStatusWrongGenesis},
+		{Name: "MalformedStatus", Fn: s.TestMalformedStatus},
+		{Name: "GetBlockHeaders", Fn: s.TestGetBlockHeaders},
+		{Name: "MalformedGetBlockHeaders", Fn: s.TestMalformedGetBlockHeaders},
+		{Name: "UnknownMessageCode", Fn: s.TestUnknownMessageCode},
+		{Name: "OversizeMessage", Fn: s.TestOversizeMessage},
+	}
+}
+
+func (s *Suite) dial(t *utesting.T) *Conn {
+	c, err := dial(s.Dest)
+	if err != nil {
+		t.Fatal("dial failed:", err)
+	}
+	return c
+}
+
+// dialAndStatus connects and performs the eth handshake.
+func (s *Suite) dialAndStatus(t *utesting.T) *Conn {
+	c := s.dial(t)
+	if err := c.statusExchange(); err != nil {
+		c.Close()
+		t.Fatal("status exchange failed:", err)
+	}
+	return c
+}
+
+// TestPing checks that the node answers base protocol pings.
+func (s *Suite) TestPing(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	if err := p2p.SendItems(c, pingMsg); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			t.Fatal("no pong received:", err)
+		}
+		msg.Discard()
+		if msg.Code == pongMsg {
+			return
+		}
+		if msg.Code == discMsg {
+			t.Fatal("disconnected:", decodeDisconnect(msg))
+		}
+	}
+}
+
+// TestStatus performs the eth handshake and checks that the connection stays up.
+func (s *Suite) TestStatus(t *utesting.T) {
+	c := s.dialAndStatus(t)
+	defer c.Close()
+
+	if c.status.ProtocolVersion != ethVersion {
+		t.Errorf("wrong protocol version %d in status", c.status.ProtocolVersion)
+	}
+	if c.status.TD == nil || c.status.TD.Sign() <= 0 {
+		t.Errorf("invalid total difficulty %v in status", c.status.TD)
+	}
+	// The node should still serve requests after the handshake.
+	if _, err := c.getBlockHeaders(&getBlockHeaders{Origin: uint64(0), Amount: 1}); err != nil {
+		t.Fatal("request after status failed:", err)
+	}
+}
+
+// TestStatusWrongNetworkID sends a status with a different network ID.
+func (s *Suite) TestStatusWrongNetworkID(t *utesting.T) {
+	s.testBadStatus(t, func(st *status) { st.NetworkID++ })
+}
+
+// TestStatusWrongGenesis sends a status with a different genesis hash.
+func (s *Suite) TestStatusWrongGenesis(t *utesting.T) {
+	s.testBadStatus(t, func(st *status) { st.Genesis = common.Hash{1} })
+}
+
+func (s *Suite) testBadStatus(t *utesting.T, modify func(*status)) {
+	c := s.dial(t)
+	defer c.Close()
+
+	var their status
+	if err := c.readEth(statusMsg, &their); err != nil {
+		t.Fatal("can't read status:", err)
+	}
+	modify(&their)
+	if err := c.writeEth(statusMsg, &their); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMalformedStatus sends a status which isn't valid RLP.
+func (s *Suite) TestMalformedStatus(t *utesting.T) {
+	c := s.dial(t)
+	defer c.Close()
+
+	if err := c.writeEthRaw(statusMsg, []byte{0xc3, 0x01}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGetBlockHeaders requests the genesis and head headers announced in the
+// node's status.
+func (s *Suite) TestGetBlockHeaders(t *utesting.T) {
+	c := s.dialAndStatus(t)
+	defer c.Close()
+
+	tests := []struct {
+		name string
+		req  *getBlockHeaders
+		want common.Hash
+	}{
+		{"genesis by number", &getBlockHeaders{Origin: uint64(0), Amount: 1}, c.status.Genesis},
+		{"genesis by hash", &getBlockHeaders{Origin: c.status.Genesis, Amount: 1}, c.status.Genesis},
+		{"head by hash", &getBlockHeaders{Origin: c.status.Head, Amount: 1}, c.status.Head},
+	}
+	for _, test := range tests {
+		headers, err := c.getBlockHeaders(test.req)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(headers) != 1 {
+			t.Errorf("%s: got %d headers, want 1", test.name, len(headers))
+			continue
+		}
+		if h := headers[0].Hash(); h != test.want {
+			t.Errorf("%s: got header %x, want %x", test.name, h, test.want)
+		}
+	}
+
+	// Headers after the head can't be known to the node.
+	headers, err := c.getBlockHeaders(&getBlockHeaders{Origin: c.status.Head, Amount: 1, Skip: 1 << 20})
+	if err != nil {
+		t.Fatal("request beyond head:", err)
+	}
+	if len(headers) > 1 {
+		t.Errorf("got %d headers for request beyond head", len(headers))
+	}
+}
+
+// TestMalformedGetBlockHeaders sends a header request which can't be decoded.
+func (s *Suite) TestMalformedGetBlockHeaders(t *utesting.T) {
+	c := s.dialAndStatus(t)
+	defer c.Close()
+
+	// Origin is a 33 byte string, neither a hash nor a number.
+	payload, _ := rlp.EncodeToBytes([]interface{}{bytes.Repeat([]byte{1}, 33), uint(1), uint(0), false})
+	if err := c.writeEthRaw(getBlockHeadersMsg, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUnknownMessageCode sends an eth message with an undefined code.
+func (s *Suite) TestUnknownMessageCode(t *utesting.T) {
+	c := s.dialAndStatus(t)
+	defer c.Close()
+
+	if err := c.writeEthRaw(unusedMsg, []byte{0xc0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOversizeMessage sends a message exceeding the eth message size limit.
+func (s *Suite) TestOversizeMessage(t *utesting.T) {
+	c := s.dialAndStatus(t)
+	defer c.Close()
+
+	payload := make([]byte, ethMaxMsgSize+1)
+	if err := c.writeEthRaw(getBlockHeadersMsg, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.expectDisconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/consensus/ethash"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/eth"
+	"github.com/groshproject/grosh-core/internal/utesting"
+	"github.com/groshproject/grosh-core/node"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/params"
+)
+
+// This test runs the suite against an in-process node.
+func TestEthSuite(t *testing.T) {
+	n := runNode(t)
+	defer n.Stop()
+
+	suite := NewSuite(n.Server().Self())
+	for _, result := range utesting.RunTests(suite.AllTests(), nil) {
+		if result.Failed {
+			t.Errorf("%s failed:\n%s", result.Name, result.Output)
+		}
+	}
+}
+
+// Tests that read timeouts aren't mistaken for disconnects.
+func TestIsDisconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	fd, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	remote, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1)
+	fd.SetReadDeadline(time.Now())
+	if _, err := fd.Read(buf); isDisconnect(err) {
+		t.Errorf("timeout counted as disconnect: %v", err)
+	}
+	remote.Close()
+	fd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := fd.Read(buf); !isDisconnect(err) {
+		t.Errorf("remote close not counted as disconnect: %v", err)
+	}
+}
+
+func runNode(t *testing.T) *node.Node {
+	genesis, blocks := generateTestChain()
+	n, err := node.New(&node.Config{
+		P2P: p2p.Config{
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			MaxPeers:    10,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ethservice *eth.Grosh
+	n.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		config := &eth.Config{Genesis: genesis}
+		config.Ethash.PowMode = ethash.ModeFake
+		ethservice, err = eth.New(ctx, config)
+		return ethservice, err
+	})
+	if err := n.Start(); err != nil {
+		t.Fatalf("can't start test node: %v", err)
+	}
+	if _, err := ethservice.BlockChain().InsertChain(blocks); err != nil {
+		n.Stop()
+		t.Fatalf("can't import test blocks: %v", err)
+	}
+	return n
+}
+
+func generateTestChain() (*core.Genesis, []*types.Block) {
+	db := rawdb.NewMemoryDatabase()
+	genesis := &core.Genesis{
+		Config:    params.AllEthashProtocolChanges,
+		ExtraData: []byte("test genesis"),
+		Timestamp: 9000,
+	}
+	gblock := genesis.ToBlock(db)
+	blocks, _ := core.GenerateChain(genesis.Config, gblock, ethash.NewFaker(), db, 10, nil)
+	return genesis, blocks
+}
@@ -0,0 +1,295 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/rlpx"
+	"github.com/groshproject/grosh-core/rlp"
+)
+
+// Base protocol message codes.
+const (
+	helloMsg = 0x00
+	discMsg  = 0x01
+	pingMsg  = 0x02
+	pongMsg  = 0x03
+
+	baseProtocolVersion = 5
+	baseProtocolLength  = 16
+)
+
+// eth protocol message codes, relative to the offset of the eth capability.
+const (
+	statusMsg          = 0x00
+	getBlockHeadersMsg = 0x03
+	blockHeadersMsg    = 0x04
+	unusedMsg          = 0x08
+
+	ethVersion       = 63
+	ethMaxMsgSize    = 10 * 1024 * 1024
+	handshakeTimeout = 5 * time.Second
+	responseTimeout  = 20 * time.Second
+)
+
+// hello is the RLPx protocol handshake.
+type hello struct {
+	Version    uint64
+	Name       string
+	Caps       []p2p.Cap
+	ListenPort uint64
+	ID         []byte         // secp256k1 public key
+	Rest       []rlp.RawValue `rlp:"tail"`
+}
+
+// status is the eth protocol handshake.
+type status struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+}
+
+// getBlockHeaders requests headers starting at Origin, which is either a hash or
+// a block number.
+type getBlockHeaders struct {
+	Origin  interface{}
+	Amount  uint64
+	Skip    uint64
+	Reverse bool
+}
+
+// Conn is a connection to the node under test.
+type Conn struct {
+	*rlpx.Conn
+	remote      *enode.Node
+	remoteHello *hello
+	status      *status // remote status, set after statusExchange
+}
+
+// dial connects to the node and performs the encryption and protocol handshake.
+func dial(n *enode.Node) (*Conn, error) {
+	fd, err := net.Dial("tcp", fmt.Sprintf("%v:%d", n.IP(), n.TCP()))
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{Conn: rlpx.NewConn(fd), remote: n}
+	key, _ := crypto.GenerateKey()
+	c.SetDeadline(time.Now().Add(handshakeTimeout))
+	if _, err := c.Handshake(key, n.Pubkey()); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("encryption handshake failed: %v", err)
+	}
+	if err := c.exchangeHello(key); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// ReadMsg reads a message from the connection. Message codes are not offset by
+// the base protocol length.
+func (c *Conn) ReadMsg() (p2p.Msg, error) {
+	c.SetReadDeadline(time.Now().Add(responseTimeout))
+	code, data, _, err := c.Read()
+	if err != nil {
+		return p2p.Msg{}, err
+	}
+	return p2p.Msg{Code: code, Size: uint32(len(data)), Payload: bytes.NewReader(data)}, nil
+}
+
+// WriteMsg writes a message to the connection.
+func (c *Conn) WriteMsg(msg p2p.Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	c.SetWriteDeadline(time.Now().Add(responseTimeout))
+	_, err = c.Write(msg.Code, payload)
+	return err
+}
+
+func (c *Conn) exchangeHello(key *ecdsa.PrivateKey) error {
+	our := &hello{
+		Version: baseProtocolVersion,
+		Name:    "devp2p-ethtest",
+		Caps:    []p2p.Cap{{Name: "eth", Version: ethVersion}},
+		ID:      crypto.FromECDSAPub(&key.PublicKey)[1:],
+	}
+	if err := p2p.Send(c, helloMsg, our); err != nil {
+		return fmt.Errorf("can't write hello: %v", err)
+	}
+	msg, err := c.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("can't read hello: %v", err)
+	}
+	defer msg.Discard()
+	switch msg.Code {
+	case helloMsg:
+	case discMsg:
+		return fmt.Errorf("disconnected during handshake: %v", decodeDisconnect(msg))
+	default:
+		return fmt.Errorf("expected hello, got message code %d", msg.Code)
+	}
+	var their hello
+	if err := msg.Decode(&their); err != nil {
+		return fmt.Errorf("invalid hello: %v", err)
+	}
+	if !hasCap(their.Caps, "eth", ethVersion) {
+		return fmt.Errorf("node doesn't support eth/%d (caps %v)", ethVersion, their.Caps)
+	}
+	c.remoteHello = &their
+	c.SetSnappy(their.Version >= baseProtocolVersion)
+	return nil
+}
+
+func hasCap(caps []p2p.Cap, name string, version uint) bool {
+	for _, cap := range caps {
+		if cap.Name == name && cap.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEth sends an eth protocol message.
+func (c *Conn) writeEth(code uint64, data interface{}) error {
+	return p2p.Send(c, baseProtocolLength+code, data)
+}
+
+// writeEthRaw sends an eth protocol message with the given payload.
+func (c *Conn) writeEthRaw(code uint64, payload []byte) error {
+	return c.WriteMsg(p2p.Msg{
+		Code:    baseProtocolLength + code,
+		Size:    uint32(len(payload)),
+		Payload: bytes.NewReader(payload),
+	})
+}
+
+// readEth waits for an eth protocol message with the given code. Ping messages are
+// answered and other eth messages are skipped.
+func (c *Conn) readEth(code uint64, data interface{}) error {
+	deadline := time.Now().Add(responseTimeout)
+	for time.Now().Before(deadline) {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch {
+		case msg.Code == pingMsg:
+			msg.Discard()
+			p2p.SendItems(c, pongMsg)
+		case msg.Code == discMsg:
+			return fmt.Errorf("disconnected: %v", decodeDisconnect(msg))
+		case msg.Code == baseProtocolLength+code:
+			defer msg.Discard()
+			if err := msg.Decode(data); err != nil {
+				return fmt.Errorf("invalid message code %d: %v", code, err)
+			}
+			return nil
+		default:
+			msg.Discard()
+		}
+	}
+	return errors.New("timeout")
+}
+
+// expectDisconnect waits for the node to drop the connection.
+func (c *Conn) expectDisconnect() error {
+	deadline := time.Now().Add(responseTimeout)
+	for time.Now().Before(deadline) {
+		msg, err := c.ReadMsg()
+		if err != nil {
+			if isDisconnect(err) {
+				return nil
+			}
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				break
+			}
+			return fmt.Errorf("read error: %v", err)
+		}
+		msg.Discard()
+		if msg.Code == discMsg {
+			return nil
+		}
+	}
+	return errors.New("node didn't disconnect")
+}
+
+// statusExchange reads the node's status and replies with a matching status.
+func (c *Conn) statusExchange() error {
+	var their status
+	if err := c.readEth(statusMsg, &their); err != nil {
+		return fmt.Errorf("can't read status: %v", err)
+	}
+	c.status = &their
+	return c.writeEth(statusMsg, &their)
+}
+
+// getBlockHeaders requests headers and waits for the response.
+func (c *Conn) getBlockHeaders(req *getBlockHeaders) ([]*types.Header, error) {
+	if err := c.writeEth(getBlockHeadersMsg, req); err != nil {
+		return nil, err
+	}
+	var headers []*types.Header
+	if err := c.readEth(blockHeadersMsg, &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+func decodeDisconnect(msg p2p.Msg) p2p.DiscReason {
+	var reason [1]p2p.DiscReason
+	rlp.Decode(msg.Payload, &reason)
+	return reason[0]
+}
+
+// isDisconnect reports whether a read error means that the remote end closed the
+// connection. Timeouts don't count, the node must actively drop us.
+func isDisconnect(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return false
+	}
+	if oerr, ok := err.(*net.OpError); ok {
+		err = oerr.Err
+	}
+	if serr, ok := err.(*os.SyscallError); ok {
+		err = serr.Err
+	}
+	return err == syscall.ECONNRESET || err == syscall.EPIPE
+}
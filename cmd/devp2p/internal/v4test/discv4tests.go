@@ -0,0 +1,187 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+// Package v4test contains conformance tests for the Node Discovery v4 protocol.
+package v4test
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/groshproject/grosh-core/internal/utesting"
+	"github.com/groshproject/grosh-core/p2p/enode"
+)
+
+// Tests returns the discv4 test suite for the given node.
+func Tests(remote *enode.Node) []utesting.Test {
+	return []utesting.Test{
+		{Name: "Ping", Fn: withEnv(remote, testPing)},
+		{Name: "PingExtraData", Fn: withEnv(remote, testPingExtraData)},
+		{Name: "PingWrongFrom", Fn: withEnv(remote, testPingWrongFrom)},
+		{Name: "PingExpired", Fn: withEnv(remote, testPingExpired)},
+		{Name: "PingInvalidRLP", Fn: withEnv(remote, testPingInvalidRLP)},
+		{Name: "UnknownPacketType", Fn: withEnv(remote, testUnknownPacketType)},
+		{Name: "FindnodeWithoutEndpointProof", Fn: withEnv(remote, testFindnodeWithoutProof)},
+		{Name: "FindnodeAfterBond", Fn: withEnv(remote, testFindnodeAfterBond)},
+	}
+}
+
+func withEnv(remote *enode.Node, fn func(*utesting.T, *testenv)) func(*utesting.T) {
+	return func(t *utesting.T) {
+		te, err := newTestEnv(remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer te.close()
+		fn(t, te)
+	}
+}
+
+func (te *testenv) newPing() *ping {
+	return &ping{
+		Version:    4,
+		From:       te.localEndpoint(),
+		To:         te.remoteEndpoint(),
+		Expiration: futureExpiration(),
+	}
+}
+
+// expectPong reads the reply to a ping and checks that it echoes the ping hash and
+// our UDP envelope address.
+func (te *testenv) expectPong(t *utesting.T, hash []byte) {
+	p, err := te.read(expiration)
+	if err != nil {
+		t.Fatal("no pong received:", err)
+	}
+	reply, ok := p.data.(*pong)
+	if !ok {
+		t.Fatalf("expected pong, got packet type %d", p.ptype)
+	}
+	if !bytes.Equal(reply.ReplyTok, hash) {
+		t.Fatalf("pong reply token mismatch: got %x, want %x", reply.ReplyTok, hash)
+	}
+	local := te.conn.LocalAddr().(*net.UDPAddr)
+	if int(reply.To.UDP) != local.Port {
+		t.Errorf("pong has wrong UDP port %d, want %d", reply.To.UDP, local.Port)
+	}
+}
+
+// testPing sends a regular ping and expects a pong.
+func testPing(t *utesting.T, te *testenv) {
+	hash, err := te.send(pingPacket, te.newPing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.expectPong(t, hash)
+}
+
+// testPingExtraData sends a ping with additional list elements, which must be
+// ignored for forward compatibility.
+func testPingExtraData(t *utesting.T, te *testenv) {
+	req := struct {
+		Version    uint
+		From, To   endpoint
+		Expiration uint64
+		Extra1     uint
+		Extra2     []byte
+	}{4, te.localEndpoint(), te.remoteEndpoint(), futureExpiration(), 42, []byte{1, 2, 3}}
+	hash, err := te.send(pingPacket, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.expectPong(t, hash)
+}
+
+// testPingWrongFrom sends a ping with a bogus 'from' endpoint. The node must reply
+// to the UDP envelope address instead.
+func testPingWrongFrom(t *utesting.T, te *testenv) {
+	req := te.newPing()
+	req.From = endpoint{IP: net.IP{1, 2, 3, 4}, UDP: 1, TCP: 1}
+	hash, err := te.send(pingPacket, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.expectPong(t, hash)
+}
+
+// testPingExpired sends a ping with an expiration timestamp in the past, which must
+// be ignored.
+func testPingExpired(t *utesting.T, te *testenv) {
+	req := te.newPing()
+	req.Expiration = uint64(time.Now().Add(-expiration).Unix())
+	if _, err := te.send(pingPacket, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := te.expectNoReply(); err != nil {
+		t.Fatal("expired ping:", err)
+	}
+}
+
+// testPingInvalidRLP sends a ping with undecodable content, which must be ignored.
+func testPingInvalidRLP(t *utesting.T, te *testenv) {
+	if _, err := te.send(pingPacket, []byte{0xc2, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	if err := te.expectNoReply(); err != nil {
+		t.Fatal("invalid ping:", err)
+	}
+}
+
+// testUnknownPacketType sends a packet of an undefined type, which must be ignored.
+func testUnknownPacketType(t *utesting.T, te *testenv) {
+	if _, err := te.send(0xff, te.newPing()); err != nil {
+		t.Fatal(err)
+	}
+	if err := te.expectNoReply(); err != nil {
+		t.Fatal("unknown packet type:", err)
+	}
+}
+
+// testFindnodeWithoutProof sends findnode before the endpoint proof is done. The
+// node must not answer because the request could have a spoofed source address.
+func testFindnodeWithoutProof(t *utesting.T, te *testenv) {
+	req := &findnode{Target: encodePubkey(&te.key.PublicKey), Expiration: futureExpiration()}
+	if _, err := te.send(findnodePacket, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := te.expectNoReply(); err != nil {
+		t.Fatal("findnode without endpoint proof:", err)
+	}
+}
+
+// testFindnodeAfterBond performs the endpoint proof and then expects neighbors in
+// response to findnode.
+func testFindnodeAfterBond(t *utesting.T, te *testenv) {
+	if err := te.bond(); err != nil {
+		t.Fatal("bond failed:", err)
+	}
+	req := &findnode{Target: encodePubkey(&te.key.PublicKey), Expiration: futureExpiration()}
+	if _, err := te.send(findnodePacket, req); err != nil {
+		t.Fatal(err)
+	}
+	p, err := te.readReply(expiration)
+	if err != nil {
+		t.Fatal("no neighbors received:", err)
+	}
+	reply, ok := p.data.(*neighbors)
+	if !ok {
+		t.Fatalf("expected neighbors, got packet type %d", p.ptype)
+	}
+	if reply.Expiration < uint64(time.Now().Unix()) {
+		t.Errorf("neighbors packet is expired")
+	}
+}
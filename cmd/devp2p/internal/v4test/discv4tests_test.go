@@ -0,0 +1,52 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package v4test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/internal/utesting"
+	"github.com/groshproject/grosh-core/p2p/discover"
+	"github.com/groshproject/grosh-core/p2p/enode"
+)
+
+// This test runs the suite against the discv4 implementation in package p2p/discover.
+func TestSuite(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+	ln := enode.NewLocalNode(db, key)
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.SetStaticIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(socket.LocalAddr().(*net.UDPAddr).Port)
+	disc, err := discover.ListenUDP(socket, ln, discover.Config{PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+
+	for _, result := range utesting.RunTests(Tests(disc.Self()), nil) {
+		if result.Failed {
+			t.Errorf("%s failed:\n%s", result.Name, result.Output)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package v4test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/rlp"
+)
+
+// This file contains a minimal implementation of the discv4 wire protocol. It is
+// separate from package p2p/discover because the tests need to send packets which
+// a correct implementation would never produce.
+
+const (
+	macSize  = 32
+	sigSize  = crypto.SignatureLength
+	headSize = macSize + sigSize
+
+	expiration  = 20 * time.Second
+	waitTime    = 300 * time.Millisecond
+	maxPacketSz = 1280
+)
+
+// Packet types.
+const (
+	pingPacket = iota + 1
+	pongPacket
+	findnodePacket
+	neighborsPacket
+	enrRequestPacket
+	enrResponsePacket
+)
+
+type (
+	ping struct {
+		Version    uint
+		From, To   endpoint
+		Expiration uint64
+		Rest       []rlp.RawValue `rlp:"tail"`
+	}
+
+	pong struct {
+		To         endpoint
+		ReplyTok   []byte
+		Expiration uint64
+		Rest       []rlp.RawValue `rlp:"tail"`
+	}
+
+	findnode struct {
+		Target     encPubkey
+		Expiration uint64
+		Rest       []rlp.RawValue `rlp:"tail"`
+	}
+
+	neighbors struct {
+		Nodes      []node
+		Expiration uint64
+		Rest       []rlp.RawValue `rlp:"tail"`
+	}
+
+	endpoint struct {
+		IP  net.IP
+		UDP uint16
+		TCP uint16
+	}
+
+	node struct {
+		IP  net.IP
+		UDP uint16
+		TCP uint16
+		ID  encPubkey
+	}
+
+	encPubkey [64]byte
+)
+
+// packet is a decoded discv4 packet.
+type packet struct {
+	ptype byte
+	data  interface{}
+	hash  []byte
+}
+
+func encodePubkey(key *ecdsa.PublicKey) (e encPubkey) {
+	copy(e[:], crypto.FromECDSAPub(key)[1:])
+	return e
+}
+
+func futureExpiration() uint64 {
+	return uint64(time.Now().Add(expiration).Unix())
+}
+
+// encodePacket creates a signed packet. The payload is written as-is when it is a
+// byte slice, which allows sending invalid RLP.
+func encodePacket(priv *ecdsa.PrivateKey, ptype byte, data interface{}) (packet, hash []byte, err error) {
+	b := new(bytes.Buffer)
+	b.Write(make([]byte, headSize))
+	b.WriteByte(ptype)
+	if raw, ok := data.([]byte); ok {
+		b.Write(raw)
+	} else if err := rlp.Encode(b, data); err != nil {
+		return nil, nil, err
+	}
+	packet = b.Bytes()
+	sig, err := crypto.Sign(crypto.Keccak256(packet[headSize:]), priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	copy(packet[macSize:], sig)
+	hash = crypto.Keccak256(packet[macSize:])
+	copy(packet, hash)
+	return packet, hash, nil
+}
+
+// decodePacket verifies the hash and signature of a packet and decodes its content.
+func decodePacket(buf []byte) (*packet, *ecdsa.PublicKey, error) {
+	if len(buf) < headSize+1 {
+		return nil, nil, errors.New("packet too small")
+	}
+	hash, sig, sigdata := buf[:macSize], buf[macSize:headSize], buf[headSize:]
+	if !bytes.Equal(hash, crypto.Keccak256(buf[macSize:])) {
+		return nil, nil, errors.New("bad hash")
+	}
+	key, err := crypto.SigToPub(crypto.Keccak256(sigdata), sig)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &packet{ptype: sigdata[0], hash: hash}
+	switch p.ptype {
+	case pingPacket:
+		p.data = new(ping)
+	case pongPacket:
+		p.data = new(pong)
+	case findnodePacket:
+		p.data = new(findnode)
+	case neighborsPacket:
+		p.data = new(neighbors)
+	default:
+		// ENR packets and unknown types are returned without content.
+		return p, key, nil
+	}
+	if err := rlp.DecodeBytes(sigdata[1:], p.data); err != nil {
+		return nil, key, fmt.Errorf("invalid packet type %d: %v", p.ptype, err)
+	}
+	return p, key, nil
+}
+
+// testenv is the connection to the node under test.
+type testenv struct {
+	conn       *net.UDPConn
+	key        *ecdsa.PrivateKey
+	remote     *enode.Node
+	remoteAddr *net.UDPAddr
+}
+
+func newTestEnv(remote *enode.Node) (*testenv, error) {
+	if remote.IP() == nil || remote.UDP() == 0 {
+		return nil, errors.New("node has no UDP endpoint")
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := crypto.GenerateKey()
+	return &testenv{
+		conn:       conn,
+		key:        key,
+		remote:     remote,
+		remoteAddr: &net.UDPAddr{IP: remote.IP(), Port: remote.UDP()},
+	}, nil
+}
+
+func (te *testenv) close() {
+	te.conn.Close()
+}
+
+func (te *testenv) localEndpoint() endpoint {
+	addr := te.conn.LocalAddr().(*net.UDPAddr)
+	return endpoint{IP: addr.IP, UDP: uint16(addr.Port)}
+}
+
+func (te *testenv) remoteEndpoint() endpoint {
+	return endpoint{IP: te.remote.IP(), UDP: uint16(te.remote.UDP()), TCP: uint16(te.remote.TCP())}
+}
+
+// send sends a packet to the node under test and returns its hash.
+func (te *testenv) send(ptype byte, data interface{}) ([]byte, error) {
+	pkt, hash, err := encodePacket(te.key, ptype, data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := te.conn.WriteToUDP(pkt, te.remoteAddr); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// read waits for the next packet from the node under test.
+func (te *testenv) read(timeout time.Duration) (*packet, error) {
+	buf := make([]byte, maxPacketSz)
+	te.conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, from, err := te.conn.ReadFromUDP(buf)
+		if err != nil {
+			return nil, err
+		}
+		if !from.IP.Equal(te.remoteAddr.IP) || from.Port != te.remoteAddr.Port {
+			continue
+		}
+		p, key, err := decodePacket(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		if enode.PubkeyToIDV4(key) != te.remote.ID() {
+			return nil, fmt.Errorf("packet signed by wrong key %x", crypto.FromECDSAPub(key))
+		}
+		return p, nil
+	}
+}
+
+// readReply reads the next packet which isn't a ping. After bonding, the node may
+// ping the test node again at any time to revalidate it, these pings are answered.
+func (te *testenv) readReply(timeout time.Duration) (*packet, error) {
+	for {
+		p, err := te.read(timeout)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.data.(*ping); !ok {
+			return p, nil
+		}
+		_, err = te.send(pongPacket, &pong{
+			To:         te.remoteEndpoint(),
+			ReplyTok:   p.hash,
+			Expiration: futureExpiration(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// expectNoReply checks that the node doesn't respond within the wait time.
+func (te *testenv) expectNoReply() error {
+	p, err := te.read(waitTime)
+	if err == nil {
+		return fmt.Errorf("unexpected reply of type %d", p.ptype)
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return nil
+	}
+	return err
+}
+
+// bond performs the endpoint proof: it pings the node, waits for the pong and
+// answers the node's ping.
+func (te *testenv) bond() error {
+	hash, err := te.send(pingPacket, &ping{
+		Version:    4,
+		From:       te.localEndpoint(),
+		To:         te.remoteEndpoint(),
+		Expiration: futureExpiration(),
+	})
+	if err != nil {
+		return err
+	}
+	var gotPong, gotPing bool
+	for !gotPong || !gotPing {
+		p, err := te.read(expiration)
+		if err != nil {
+			return err
+		}
+		switch data := p.data.(type) {
+		case *pong:
+			if !bytes.Equal(data.ReplyTok, hash) {
+				return fmt.Errorf("pong reply token mismatch")
+			}
+			gotPong = true
+		case *ping:
+			gotPing = true
+			_, err := te.send(pongPacket, &pong{
+				To:         te.remoteEndpoint(),
+				ReplyTok:   p.hash,
+				Expiration: futureExpiration(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// Give the node some time to process the pong.
+	time.Sleep(waitTime)
+	return nil
+}
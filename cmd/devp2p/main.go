@@ -57,6 +57,8 @@ func init() {
 	app.Commands = []cli.Command{
 		enrdumpCommand,
 		discv4Command,
+		rlpxCommand,
+		nodesetCommand,
 	}
 }
 
@@ -0,0 +1,161 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core/forkid"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/rlp"
+)
+
+const jsonIndent = "    "
+
+// nodeSet is the nodes.json file format. It holds a set of node records
+// as a JSON object.
+type nodeSet map[enode.ID]nodeJSON
+
+type nodeJSON struct {
+	Seq uint64      `json:"seq"`
+	N   *enode.Node `json:"record"`
+
+	// The score tracks how many liveness checks were performed. It is incremented by one
+	// every time the node passes a check, and halved every time it doesn't.
+	Score int `json:"score,omitempty"`
+	// These two track the time of last successful contact.
+	FirstResponse time.Time `json:"firstResponse,omitempty"`
+	LastResponse  time.Time `json:"lastResponse,omitempty"`
+	// This one tracks the time of our last attempt to contact the node.
+	LastCheck time.Time `json:"lastCheck,omitempty"`
+
+	// ForkID is the content of the "eth" entry in the record, if present.
+	ForkID *forkIDJSON `json:"forkID,omitempty"`
+}
+
+type forkIDJSON struct {
+	Hash hexutil.Bytes `json:"hash"`
+	Next uint64        `json:"next"`
+}
+
+// ethEntry is the "eth" ENR entry. Only the fork ID is decoded.
+type ethEntry struct {
+	ForkID forkid.ID
+	Tail   []rlp.RawValue `rlp:"tail"`
+}
+
+func (ethEntry) ENRKey() string { return "eth" }
+
+// loadForkID reads the fork ID from the "eth" entry of a node record.
+func loadForkID(n *enode.Node) (forkid.ID, bool) {
+	var eth ethEntry
+	if n.Load(&eth) != nil {
+		return forkid.ID{}, false
+	}
+	return eth.ForkID, true
+}
+
+// newNodeJSON creates an entry for the given record.
+func newNodeJSON(n *enode.Node) nodeJSON {
+	e := nodeJSON{N: n, Seq: n.Seq()}
+	if id, ok := loadForkID(n); ok {
+		e.ForkID = &forkIDJSON{Hash: id.Hash[:], Next: id.Next}
+	}
+	return e
+}
+
+func loadNodesJSON(file string) (nodeSet, error) {
+	var nodes nodeSet
+	if err := common.LoadJSON(file, &nodes); err != nil {
+		return nil, err
+	}
+	if err := nodes.verify(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return nodes, nil
+}
+
+// loadNodesJSONIfExists is like loadNodesJSON, but returns an empty set if the
+// file doesn't exist.
+func loadNodesJSONIfExists(file string) (nodeSet, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return make(nodeSet), nil
+	}
+	return loadNodesJSON(file)
+}
+
+// writeNodesJSON writes the set to file, or to stdout if file is "-".
+func writeNodesJSON(file string, nodes nodeSet) error {
+	nodesJSON, err := json.MarshalIndent(nodes, "", jsonIndent)
+	if err != nil {
+		return err
+	}
+	if file == "-" {
+		_, err := os.Stdout.Write(append(nodesJSON, '\n'))
+		return err
+	}
+	return ioutil.WriteFile(file, nodesJSON, 0644)
+}
+
+// nodes returns the node records contained in the set.
+func (ns nodeSet) nodes() []*enode.Node {
+	result := make([]*enode.Node, 0, len(ns))
+	for _, n := range ns {
+		result = append(result, n.N)
+	}
+	// Sort by ID.
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].ID().Bytes(), result[j].ID().Bytes()) < 0
+	})
+	return result
+}
+
+// add ensures the given nodes are present in the set.
+func (ns nodeSet) add(nodes ...*enode.Node) {
+	for _, n := range nodes {
+		v := ns[n.ID()]
+		if v.N == nil || n.Seq() > v.Seq {
+			fresh := newNodeJSON(n)
+			v.N, v.Seq, v.ForkID = fresh.N, fresh.Seq, fresh.ForkID
+		}
+		ns[n.ID()] = v
+	}
+}
+
+// verify checks that all records in the set are valid.
+func (ns nodeSet) verify() error {
+	for id, n := range ns {
+		if n.N == nil {
+			return fmt.Errorf("invalid node %v: missing record", id)
+		}
+		if n.N.ID() != id {
+			return fmt.Errorf("invalid node %v: ID does not match ID %v in record", id, n.N.ID())
+		}
+		if n.N.Seq() != n.Seq {
+			return fmt.Errorf("invalid node %v: 'seq' does not match seq %d from record", id, n.N.Seq())
+		}
+	}
+	return nil
+}
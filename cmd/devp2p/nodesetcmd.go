@@ -0,0 +1,189 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of go-grosh.
+//
+// go-grosh is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-grosh is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-grosh. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core/forkid"
+	"github.com/groshproject/grosh-core/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	nodesetCommand = cli.Command{
+		Name:  "nodeset",
+		Usage: "Node set tools",
+		Subcommands: []cli.Command{
+			nodesetFilterCommand,
+		},
+	}
+	nodesetFilterCommand = cli.Command{
+		Name:      "filter",
+		Usage:     "Filters a node set",
+		ArgsUsage: "<nodes.json> filters..",
+		Action:    nodesetFilter,
+		Description: `Selects the nodes of a node set which match all filters and writes
+them to stdout. The following filters are supported:
+
+   -ip <CIDR>              nodes with an IP address in the given range
+   -min-age <duration>     nodes which were first seen at least this long ago
+   -eth-network <name>     nodes announcing a fork ID of mainnet, ropsten, rinkeby or goerli
+   -fork-hash <hex>        nodes announcing the given fork hash
+   -has <key>              nodes whose record contains the given ENR key`,
+	}
+)
+
+type nodeFilter func(nodeJSON) bool
+
+type nodeFilterC struct {
+	narg int
+	fn   func([]string) (nodeFilter, error)
+}
+
+var filterFlags = map[string]nodeFilterC{
+	"-ip":          {1, ipFilter},
+	"-min-age":     {1, minAgeFilter},
+	"-eth-network": {1, ethFilter},
+	"-fork-hash":   {1, forkHashFilter},
+	"-has":         {1, hasKeyFilter},
+}
+
+func nodesetFilter(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	ns, err := loadNodesJSON(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	filter, err := andFilter(ctx.Args().Tail())
+	if err != nil {
+		return err
+	}
+
+	result := make(nodeSet)
+	for id, n := range ns {
+		if filter(n) {
+			result[id] = n
+		}
+	}
+	return writeNodesJSON("-", result)
+}
+
+// andFilter parses the filter arguments and combines them into a single filter.
+func andFilter(args []string) (nodeFilter, error) {
+	var filters []nodeFilter
+	for len(args) > 0 {
+		fc, ok := filterFlags[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q", args[0])
+		}
+		if len(args)-1 < fc.narg {
+			return nil, fmt.Errorf("filter %q wants %d arguments, have %d", args[0], fc.narg, len(args)-1)
+		}
+		filter, err := fc.fn(args[1 : 1+fc.narg])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", args[0], err)
+		}
+		filters = append(filters, filter)
+		args = args[1+fc.narg:]
+	}
+	return func(n nodeJSON) bool {
+		for _, filter := range filters {
+			if !filter(n) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func ipFilter(args []string) (nodeFilter, error) {
+	_, cidr, err := net.ParseCIDR(args[0])
+	if err != nil {
+		return nil, err
+	}
+	f := func(n nodeJSON) bool { return cidr.Contains(n.N.IP()) }
+	return f, nil
+}
+
+func minAgeFilter(args []string) (nodeFilter, error) {
+	minage, err := time.ParseDuration(args[0])
+	if err != nil {
+		return nil, err
+	}
+	f := func(n nodeJSON) bool {
+		if n.FirstResponse.IsZero() {
+			return false
+		}
+		return time.Since(n.FirstResponse) >= minage
+	}
+	return f, nil
+}
+
+func ethFilter(args []string) (nodeFilter, error) {
+	var filter func(forkid.ID) error
+	switch args[0] {
+	case "mainnet":
+		filter = forkid.NewStaticFilter(params.MainnetChainConfig, params.MainnetGenesisHash)
+	case "ropsten", "testnet":
+		filter = forkid.NewStaticFilter(params.TestnetChainConfig, params.TestnetGenesisHash)
+	case "rinkeby":
+		filter = forkid.NewStaticFilter(params.RinkebyChainConfig, params.RinkebyGenesisHash)
+	case "goerli":
+		filter = forkid.NewStaticFilter(params.GoerliChainConfig, params.GoerliGenesisHash)
+	default:
+		return nil, fmt.Errorf("unknown network %q", args[0])
+	}
+
+	f := func(n nodeJSON) bool {
+		id, ok := loadForkID(n.N)
+		return ok && filter(id) == nil
+	}
+	return f, nil
+}
+
+func forkHashFilter(args []string) (nodeFilter, error) {
+	hash, err := hexutil.Decode(args[0])
+	if err != nil || len(hash) != 4 {
+		return nil, fmt.Errorf("invalid fork hash %q, need 4 hex bytes", args[0])
+	}
+	f := func(n nodeJSON) bool {
+		id, ok := loadForkID(n.N)
+		return ok && bytes.Equal(id.Hash[:], hash)
+	}
+	return f, nil
+}
+
+func hasKeyFilter(args []string) (nodeFilter, error) {
+	key := args[0]
+	f := func(n nodeJSON) bool {
+		kv := n.N.Record().AppendElements(nil)[1:]
+		for i := 0; i < len(kv); i += 2 {
+			if k, ok := kv[i].(string); ok && k == key {
+				return true
+			}
+		}
+		return false
+	}
+	return f, nil
+}
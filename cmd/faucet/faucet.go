@@ -54,7 +54,6 @@ import (
 	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/node"
 	"github.com/groshproject/grosh-core/p2p"
-	"github.com/groshproject/grosh-core/p2p/discv5"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/nat"
 	"github.com/groshproject/grosh-core/params"
@@ -150,9 +149,9 @@ func main() {
 		log.Crit("Failed to parse genesis block json", "err", err)
 	}
 	// Convert the bootnodes to internal enode representations
-	var enodes []*discv5.Node
+	var enodes []*enode.Node
 	for _, boot := range strings.Split(*bootFlag, ",") {
-		if url, err := discv5.ParseNode(boot); err == nil {
+		if url, err := enode.Parse(enode.ValidSchemes, boot); err == nil {
 			enodes = append(enodes, url)
 		} else {
 			log.Error("Failed to parse bootnode URL", "url", boot, "err", err)
@@ -217,7 +216,7 @@ type faucet struct {
 	lock sync.RWMutex // Lock protecting the faucet's internals
 }
 
-func newFaucet(genesis *core.Genesis, port int, enodes []*discv5.Node, network uint64, stats string, ks *keystore.KeyStore, index []byte) (*faucet, error) {
+func newFaucet(genesis *core.Genesis, port int, enodes []*enode.Node, network uint64, stats string, ks *keystore.KeyStore, index []byte) (*faucet, error) {
 	// Assemble the raw devp2p protocol stack
 	stack, err := node.New(&node.Config{
 		Name:    "grosh",
@@ -260,10 +259,7 @@ func newFaucet(genesis *core.Genesis, port int, enodes []*discv5.Node, network u
 		return nil, err
 	}
 	for _, boot := range enodes {
-		old, err := enode.Parse(enode.ValidSchemes, boot.String())
-		if err == nil {
-			stack.Server().AddPeer(old)
-		}
+		stack.Server().AddPeer(boot)
 	}
 	// Attach to the client and retrieve and interesting metadatas
 	api, err := stack.Attach()
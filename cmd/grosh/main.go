@@ -146,6 +146,14 @@ var (
 		utils.NoCompactionFlag,
 		utils.GpoBlocksFlag,
 		utils.GpoPercentileFlag,
+		utils.GpoHalfLifeFlag,
+		utils.GpoMaxHistoryFlag,
+		utils.BloomServiceThreadsFlag,
+		utils.BloomFilterThreadsFlag,
+		utils.BloomRetrievalBatchFlag,
+		utils.BloomRetrievalWaitFlag,
+		utils.BloomCacheFlag,
+		utils.LogIndexFlag,
 		utils.EWASMInterpreterFlag,
 		utils.EVMInterpreterFlag,
 		configFileFlag,
@@ -162,16 +170,31 @@ var (
 		utils.GraphQLPortFlag,
 		utils.GraphQLCORSDomainFlag,
 		utils.GraphQLVirtualHostsFlag,
+		utils.GraphQLPrefixFlag,
+		utils.GraphQLTracingFlag,
 		utils.RPCApiFlag,
 		utils.WSEnabledFlag,
 		utils.WSListenAddrFlag,
 		utils.WSPortFlag,
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
+		utils.AuthRPCEnabledFlag,
+		utils.AuthRPCListenAddrFlag,
+		utils.AuthRPCPortFlag,
+		utils.AuthRPCApiFlag,
+		utils.AuthRPCVirtualHostsFlag,
+		utils.AuthRPCJWTSecretFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCap,
+		utils.RPCBatchLimitFlag,
+		utils.RPCResponseSizeLimitFlag,
+		utils.RPCConcurrencyLimitFlag,
+		utils.RPCClientConcurrencyLimitFlag,
+		utils.RPCRateLimitFlag,
+		utils.RPCRateBurstFlag,
+		utils.RPCMethodRateLimitFlag,
 	}
 
 	whisperFlags = []cli.Flag{
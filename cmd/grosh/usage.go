@@ -171,6 +171,13 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
 			utils.RPCGlobalGasCap,
+			utils.RPCBatchLimitFlag,
+			utils.RPCResponseSizeLimitFlag,
+			utils.RPCConcurrencyLimitFlag,
+			utils.RPCClientConcurrencyLimitFlag,
+			utils.RPCRateLimitFlag,
+			utils.RPCRateBurstFlag,
+			utils.RPCMethodRateLimitFlag,
 			utils.RPCCORSDomainFlag,
 			utils.RPCVirtualHostsFlag,
 			utils.WSEnabledFlag,
@@ -178,11 +185,19 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.WSPortFlag,
 			utils.WSApiFlag,
 			utils.WSAllowedOriginsFlag,
+			utils.AuthRPCEnabledFlag,
+			utils.AuthRPCListenAddrFlag,
+			utils.AuthRPCPortFlag,
+			utils.AuthRPCApiFlag,
+			utils.AuthRPCVirtualHostsFlag,
+			utils.AuthRPCJWTSecretFlag,
 			utils.GraphQLEnabledFlag,
 			utils.GraphQLListenAddrFlag,
 			utils.GraphQLPortFlag,
 			utils.GraphQLCORSDomainFlag,
 			utils.GraphQLVirtualHostsFlag,
+			utils.GraphQLPrefixFlag,
+			utils.GraphQLTracingFlag,
 			utils.JSpathFlag,
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
@@ -225,6 +240,19 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.GpoBlocksFlag,
 			utils.GpoPercentileFlag,
+			utils.GpoHalfLifeFlag,
+			utils.GpoMaxHistoryFlag,
+		},
+	},
+	{
+		Name: "LOG FILTERING",
+		Flags: []cli.Flag{
+			utils.BloomServiceThreadsFlag,
+			utils.BloomFilterThreadsFlag,
+			utils.BloomRetrievalBatchFlag,
+			utils.BloomRetrievalWaitFlag,
+			utils.BloomCacheFlag,
+			utils.LogIndexFlag,
 		},
 	},
 	{
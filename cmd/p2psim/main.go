@@ -34,6 +34,11 @@
 //     $ p2psim node connect node01 node02
 //     Connected node01 to node02
 //
+// Experiments can be scripted as scenarios, see package p2p/simulations/scenario for
+// the file format:
+//
+//     $ p2psim run --report report.json scenario.json
+//
 package main
 
 import (
@@ -41,6 +46,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 	"text/tabwriter"
@@ -50,6 +56,7 @@ import (
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/simulations"
 	"github.com/groshproject/grosh-core/p2p/simulations/adapters"
+	"github.com/groshproject/grosh-core/p2p/simulations/scenario"
 	"github.com/groshproject/grosh-core/rpc"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -103,6 +110,19 @@ func main() {
 			Usage:  "load a network snapshot from stdin",
 			Action: loadSnapshot,
 		},
+		{
+			Name:      "run",
+			ArgsUsage: "<scenario.json>",
+			Usage:     "run a scenario and report the results of its checks",
+			Action:    runScenario,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "report",
+					Value: "",
+					Usage: "write the report as JSON to the given file",
+				},
+			},
+		},
 		{
 			Name:   "node",
 			Usage:  "manage simulation nodes",
@@ -249,6 +269,35 @@ func loadSnapshot(ctx *cli.Context) error {
 	return client.LoadSnapshot(snap)
 }
 
+func runScenario(ctx *cli.Context) error {
+	args := ctx.Args()
+	if len(args) != 1 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	s, err := scenario.Load(args[0])
+	if err != nil {
+		return err
+	}
+	report, err := scenario.Run(context.Background(), client, s)
+	report.Write(ctx.App.Writer)
+	if file := ctx.String("report"); file != "" {
+		out, jsonErr := json.MarshalIndent(report, "", "  ")
+		if jsonErr != nil {
+			return jsonErr
+		}
+		if writeErr := ioutil.WriteFile(file, out, 0644); writeErr != nil {
+			return writeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(report.Results))
+	}
+	return nil
+}
+
 func listNodes(ctx *cli.Context) error {
 	if len(ctx.Args()) != 0 {
 		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
@@ -49,6 +49,7 @@ import (
 	"github.com/groshproject/grosh-core/grodb"
 	"github.com/groshproject/grosh-core/grostats"
 	"github.com/groshproject/grosh-core/graphql"
+	"github.com/groshproject/grosh-core/internal/ethapi"
 	"github.com/groshproject/grosh-core/les"
 	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/metrics"
@@ -56,7 +57,6 @@ import (
 	"github.com/groshproject/grosh-core/miner"
 	"github.com/groshproject/grosh-core/node"
 	"github.com/groshproject/grosh-core/p2p"
-	"github.com/groshproject/grosh-core/p2p/discv5"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/nat"
 	"github.com/groshproject/grosh-core/p2p/netutil"
@@ -551,6 +551,34 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: "",
 	}
+	RPCBatchLimitFlag = cli.IntFlag{
+		Name:  "rpc.batchlimit",
+		Usage: "Maximum number of requests in an HTTP/WS-RPC batch (0 = unlimited)",
+	}
+	RPCResponseSizeLimitFlag = cli.IntFlag{
+		Name:  "rpc.responsesizelimit",
+		Usage: "Maximum size in bytes of an HTTP/WS-RPC response or batch of responses (0 = unlimited)",
+	}
+	RPCConcurrencyLimitFlag = cli.IntFlag{
+		Name:  "rpc.concurrencylimit",
+		Usage: "Maximum number of concurrently processed requests per HTTP/WS-RPC connection (0 = unlimited)",
+	}
+	RPCClientConcurrencyLimitFlag = cli.IntFlag{
+		Name:  "rpc.clientconcurrencylimit",
+		Usage: "Maximum number of concurrently processed HTTP/WS-RPC requests per client IP (0 = unlimited)",
+	}
+	RPCRateLimitFlag = cli.Float64Flag{
+		Name:  "rpc.ratelimit",
+		Usage: "Maximum HTTP/WS-RPC requests per second per client IP (0 = unlimited)",
+	}
+	RPCRateBurstFlag = cli.IntFlag{
+		Name:  "rpc.rateburst",
+		Usage: "Number of HTTP/WS-RPC requests a client may send in a burst (default = rate limit)",
+	}
+	RPCMethodRateLimitFlag = cli.StringFlag{
+		Name:  "rpc.methodratelimit",
+		Usage: "Comma separated per client IP method rate limits, e.g. eth_getLogs=2:5 (requests per second[:burst])",
+	}
 	WSEnabledFlag = cli.BoolFlag{
 		Name:  "ws",
 		Usage: "Enable the WS-RPC server",
@@ -575,6 +603,34 @@ var (
 		Usage: "Origins from which to accept websockets requests",
 		Value: "",
 	}
+	AuthRPCEnabledFlag = cli.BoolFlag{
+		Name:  "authrpc",
+		Usage: "Enable the JWT authenticated RPC server (HTTP and WS)",
+	}
+	AuthRPCListenAddrFlag = cli.StringFlag{
+		Name:  "authrpc.addr",
+		Usage: "Authenticated RPC server listening interface",
+		Value: node.DefaultAuthHost,
+	}
+	AuthRPCPortFlag = cli.IntFlag{
+		Name:  "authrpc.port",
+		Usage: "Authenticated RPC server listening port",
+		Value: node.DefaultAuthPort,
+	}
+	AuthRPCApiFlag = cli.StringFlag{
+		Name:  "authrpc.api",
+		Usage: "API's offered over the authenticated RPC interface (private modules allowed)",
+		Value: "",
+	}
+	AuthRPCVirtualHostsFlag = cli.StringFlag{
+		Name:  "authrpc.vhosts",
+		Usage: "Comma separated list of virtual hostnames from which to accept authenticated requests (server enforced). Accepts '*' wildcard.",
+		Value: strings.Join(node.DefaultConfig.AuthVirtualHosts, ","),
+	}
+	AuthRPCJWTSecretFlag = cli.StringFlag{
+		Name:  "authrpc.jwtsecret",
+		Usage: "Path to a hex encoded JWT secret for the authenticated RPC server (generated if missing)",
+	}
 	GraphQLEnabledFlag = cli.BoolFlag{
 		Name:  "graphql",
 		Usage: "Enable the GraphQL server",
@@ -594,6 +650,14 @@ var (
 		Usage: "Comma separated list of domains from which to accept cross origin requests (browser enforced)",
 		Value: "",
 	}
+	GraphQLPrefixFlag = cli.StringFlag{
+		Name:  "graphql.prefix",
+		Usage: "Serve GraphQL on the HTTP-RPC server under this path prefix (e.g. /graphql) instead of its own port",
+	}
+	GraphQLTracingFlag = cli.BoolFlag{
+		Name:  "graphql.tracing",
+		Usage: "Enable transaction tracing over GraphQL (re-executes transactions, expensive)",
+	}
 	GraphQLVirtualHostsFlag = cli.StringFlag{
 		Name:  "graphql.vhosts",
 		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
@@ -649,7 +713,7 @@ var (
 	}
 	NATFlag = cli.StringFlag{
 		Name:  "nat",
-		Usage: "NAT port mapping mechanism (any|none|upnp|pmp|extip:<IP>)",
+		Usage: "NAT port mapping mechanism (any|none|upnp|pmp|stun|extip:<IP>)",
 		Value: "any",
 	}
 	NoDiscoverFlag = cli.BoolFlag{
@@ -683,6 +747,46 @@ var (
 		Usage: "Suggested gas price is the given percentile of a set of recent transaction gas prices",
 		Value: eth.DefaultConfig.GPO.Percentile,
 	}
+	GpoHalfLifeFlag = cli.IntFlag{
+		Name:  "gpohalflife",
+		Usage: "Age in blocks at which the gas prices of a block count half for the suggestion (0 = equal weights)",
+		Value: eth.DefaultConfig.GPO.HalfLife,
+	}
+	GpoMaxHistoryFlag = cli.IntFlag{
+		Name:  "gpomaxhistory",
+		Usage: "Maximum number of blocks served by a fee history query",
+		Value: eth.DefaultConfig.GPO.MaxHistory,
+	}
+	// Log filtering settings
+	BloomServiceThreadsFlag = cli.IntFlag{
+		Name:  "bloom.servicethreads",
+		Usage: "Number of goroutines servicing bloom bit retrievals for all log queries",
+		Value: eth.DefaultConfig.Bloom.ServiceThreads,
+	}
+	BloomFilterThreadsFlag = cli.IntFlag{
+		Name:  "bloom.filterthreads",
+		Usage: "Number of goroutines per log query multiplexing bloom bit retrievals",
+		Value: eth.DefaultConfig.Bloom.FilterThreads,
+	}
+	BloomRetrievalBatchFlag = cli.IntFlag{
+		Name:  "bloom.batch",
+		Usage: "Maximum number of bloom bit retrievals serviced in a single batch",
+		Value: eth.DefaultConfig.Bloom.RetrievalBatch,
+	}
+	BloomRetrievalWaitFlag = cli.DurationFlag{
+		Name:  "bloom.wait",
+		Usage: "Maximum time to wait for a bloom bit retrieval batch to fill up",
+		Value: eth.DefaultConfig.Bloom.RetrievalWait,
+	}
+	BloomCacheFlag = cli.IntFlag{
+		Name:  "bloom.cache",
+		Usage: "Megabytes of memory used to cache decompressed bloom bit vectors (0 = disabled)",
+		Value: eth.DefaultConfig.Bloom.Cache,
+	}
+	LogIndexFlag = cli.BoolFlag{
+		Name:  "logindex",
+		Usage: "Maintain an exact address and topic index of the logs for faster filtering (uses additional disk space)",
+	}
 	WhisperEnabledFlag = cli.BoolFlag{
 		Name:  "shh",
 		Usage: "Enable Whisper",
@@ -863,10 +967,10 @@ func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
 		return // already set, don't apply defaults.
 	}
 
-	cfg.BootstrapNodesV5 = make([]*discv5.Node, 0, len(urls))
+	cfg.BootstrapNodesV5 = make([]*enode.Node, 0, len(urls))
 	for _, url := range urls {
 		if url != "" {
-			node, err := discv5.ParseNode(url)
+			node, err := enode.Parse(enode.ValidSchemes, url)
 			if err != nil {
 				log.Error("Bootstrap URL invalid", "enode", url, "err", err)
 				continue
@@ -928,6 +1032,67 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setRPCLimits configures the HTTP and WS RPC limits from the command line flags.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchLimitFlag.Name) {
+		cfg.RPCLimits.BatchItems = ctx.GlobalInt(RPCBatchLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCResponseSizeLimitFlag.Name) {
+		cfg.RPCLimits.ResponseSize = ctx.GlobalInt(RPCResponseSizeLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCConcurrencyLimitFlag.Name) {
+		cfg.RPCLimits.ConcurrentRequests = ctx.GlobalInt(RPCConcurrencyLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCClientConcurrencyLimitFlag.Name) {
+		cfg.RPCLimits.ClientConcurrentRequests = ctx.GlobalInt(RPCClientConcurrencyLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+		cfg.RPCLimits.ClientRate.Rate = ctx.GlobalFloat64(RPCRateLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateBurstFlag.Name) {
+		cfg.RPCLimits.ClientRate.Burst = ctx.GlobalInt(RPCRateBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMethodRateLimitFlag.Name) {
+		rates, err := parseMethodRates(ctx.GlobalString(RPCMethodRateLimitFlag.Name))
+		if err != nil {
+			Fatalf("Invalid --%s: %v", RPCMethodRateLimitFlag.Name, err)
+		}
+		cfg.RPCLimits.MethodRates = rates
+	}
+}
+
+// parseMethodRates parses a list of method rate limits in the form
+// "method=rate[:burst],...".
+func parseMethodRates(input string) (map[string]rpc.RateLimit, error) {
+	rates := make(map[string]rpc.RateLimit)
+	for _, entry := range splitAndTrim(input) {
+		if entry == "" {
+			continue
+		}
+		eq := strings.IndexByte(entry, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid entry %q, want method=rate[:burst]", entry)
+		}
+		var (
+			method = entry[:eq]
+			spec   = entry[eq+1:]
+			limit  rpc.RateLimit
+			err    error
+		)
+		if colon := strings.IndexByte(spec, ':'); colon >= 0 {
+			if limit.Burst, err = strconv.Atoi(spec[colon+1:]); err != nil || limit.Burst < 0 {
+				return nil, fmt.Errorf("invalid burst in %q", entry)
+			}
+			spec = spec[:colon]
+		}
+		if limit.Rate, err = strconv.ParseFloat(spec, 64); err != nil || limit.Rate < 0 {
+			return nil, fmt.Errorf("invalid rate in %q", entry)
+		}
+		rates[method] = limit
+	}
+	return rates, nil
+}
+
 // setGraphQL creates the GraphQL listener interface string from the set
 // command line flags, returning empty if the GraphQL endpoint is disabled.
 func setGraphQL(ctx *cli.Context, cfg *node.Config) {
@@ -944,6 +1109,12 @@ func setGraphQL(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(GraphQLVirtualHostsFlag.Name) {
 		cfg.GraphQLVirtualHosts = splitAndTrim(ctx.GlobalString(GraphQLVirtualHostsFlag.Name))
 	}
+	if ctx.GlobalIsSet(GraphQLPrefixFlag.Name) {
+		cfg.GraphQLPrefix = ctx.GlobalString(GraphQLPrefixFlag.Name)
+	}
+	if ctx.GlobalIsSet(GraphQLTracingFlag.Name) {
+		cfg.GraphQLTracing = ctx.GlobalBool(GraphQLTracingFlag.Name)
+	}
 }
 
 // setWS creates the WebSocket RPC listener interface string from the set
@@ -966,6 +1137,29 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setAuthRPC creates the authenticated RPC listener interface string from the set
+// command line flags, returning empty if the authenticated endpoint is disabled.
+func setAuthRPC(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalBool(AuthRPCEnabledFlag.Name) && cfg.AuthHost == "" {
+		cfg.AuthHost = "127.0.0.1"
+		if ctx.GlobalIsSet(AuthRPCListenAddrFlag.Name) {
+			cfg.AuthHost = ctx.GlobalString(AuthRPCListenAddrFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(AuthRPCPortFlag.Name) {
+		cfg.AuthPort = ctx.GlobalInt(AuthRPCPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthRPCApiFlag.Name) {
+		cfg.AuthModules = splitAndTrim(ctx.GlobalString(AuthRPCApiFlag.Name))
+	}
+	if ctx.GlobalIsSet(AuthRPCVirtualHostsFlag.Name) {
+		cfg.AuthVirtualHosts = splitAndTrim(ctx.GlobalString(AuthRPCVirtualHostsFlag.Name))
+	}
+	if ctx.GlobalIsSet(AuthRPCJWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.GlobalString(AuthRPCJWTSecretFlag.Name)
+	}
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -1177,6 +1371,8 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setHTTP(ctx, cfg)
 	setGraphQL(ctx, cfg)
 	setWS(ctx, cfg)
+	setAuthRPC(ctx, cfg)
+	setRPCLimits(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
 	setSmartCard(ctx, cfg)
@@ -1241,6 +1437,30 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoPercentileFlag.Name) {
 		cfg.Percentile = ctx.GlobalInt(GpoPercentileFlag.Name)
 	}
+	if ctx.GlobalIsSet(GpoHalfLifeFlag.Name) {
+		cfg.HalfLife = ctx.GlobalInt(GpoHalfLifeFlag.Name)
+	}
+	if ctx.GlobalIsSet(GpoMaxHistoryFlag.Name) {
+		cfg.MaxHistory = ctx.GlobalInt(GpoMaxHistoryFlag.Name)
+	}
+}
+
+func setBloom(ctx *cli.Context, cfg *eth.BloomConfig) {
+	if ctx.GlobalIsSet(BloomServiceThreadsFlag.Name) {
+		cfg.ServiceThreads = ctx.GlobalInt(BloomServiceThreadsFlag.Name)
+	}
+	if ctx.GlobalIsSet(BloomFilterThreadsFlag.Name) {
+		cfg.FilterThreads = ctx.GlobalInt(BloomFilterThreadsFlag.Name)
+	}
+	if ctx.GlobalIsSet(BloomRetrievalBatchFlag.Name) {
+		cfg.RetrievalBatch = ctx.GlobalInt(BloomRetrievalBatchFlag.Name)
+	}
+	if ctx.GlobalIsSet(BloomRetrievalWaitFlag.Name) {
+		cfg.RetrievalWait = ctx.GlobalDuration(BloomRetrievalWaitFlag.Name)
+	}
+	if ctx.GlobalIsSet(BloomCacheFlag.Name) {
+		cfg.Cache = ctx.GlobalInt(BloomCacheFlag.Name)
+	}
 }
 
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
@@ -1430,6 +1650,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	}
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO)
+	setBloom(ctx, &cfg.Bloom)
 	setTxPool(ctx, &cfg.TxPool)
 	setEthash(ctx, cfg)
 	setMiner(ctx, &cfg.Miner)
@@ -1442,6 +1663,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
+	if ctx.GlobalIsSet(LogIndexFlag.Name) {
+		cfg.LogIndex = ctx.GlobalBool(LogIndexFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheDatabaseFlag.Name) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
 	}
@@ -1591,17 +1815,25 @@ func RegisterGrostatsService(stack *node.Node, url string) {
 }
 
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
-func RegisterGraphQLService(stack *node.Node, endpoint string, cors, vhosts []string, timeouts rpc.HTTPTimeouts) {
+// If prefix is set, GraphQL is served on the node's HTTP RPC endpoint under that
+// prefix instead of the given endpoint. Tracing enables tracing of transactions.
+func RegisterGraphQLService(stack *node.Node, endpoint, prefix string, cors, vhosts []string, timeouts rpc.HTTPTimeouts, tracing bool) {
+	newService := func(backend ethapi.Backend) (node.Service, error) {
+		if prefix != "" {
+			return graphql.NewMounted(backend, prefix, cors, vhosts, tracing)
+		}
+		return graphql.New(backend, endpoint, cors, vhosts, timeouts, tracing)
+	}
 	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
 		// Try to construct the GraphQL service backed by a full node
 		var ethServ *eth.Grosh
 		if err := ctx.Service(&ethServ); err == nil {
-			return graphql.New(ethServ.APIBackend, endpoint, cors, vhosts, timeouts)
+			return newService(ethServ.APIBackend)
 		}
 		// Try to construct the GraphQL service backed by a light node
 		var lesServ *les.LightGrosh
 		if err := ctx.Service(&lesServ); err == nil {
-			return graphql.New(lesServ.ApiBackend, endpoint, cors, vhosts, timeouts)
+			return newService(lesServ.ApiBackend)
 		}
 		// Well, this should not have happened, bail out
 		return nil, errors.New("no Grosh service")
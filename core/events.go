@@ -24,6 +24,29 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// TxDropReason describes why a transaction left the transaction pool without being
+// included in a block.
+type TxDropReason string
+
+const (
+	TxReplaced    TxDropReason = "replaced"    // replaced by a transaction with the same nonce
+	TxUnderpriced TxDropReason = "underpriced" // evicted by better paying transactions when the pool was full
+	TxUnpayable   TxDropReason = "unpayable"   // balance too low or gas above the block gas limit
+	TxCapped      TxDropReason = "capped"      // exceeded the account or global pool limits
+	TxExpired     TxDropReason = "expired"     // queued for longer than the pool lifetime
+)
+
+// DroppedTxsEvent is posted when transactions are dropped from the transaction pool.
+// Transactions removed because they were included in a block are not reported.
+type DroppedTxsEvent struct {
+	Txs    []*types.Transaction
+	Reason TxDropReason
+
+	// Replacement is the transaction which replaced the dropped one. It is only set
+	// if the reason is TxReplaced.
+	Replacement *types.Transaction
+}
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs []*types.Log
@@ -92,6 +92,14 @@ func NewFilter(chain *core.BlockChain) func(id ID) error {
 	)
 }
 
+// NewStaticFilter creates a filter at block zero. It accepts the fork IDs of all
+// nodes on the same chain and can be used without access to a local chain, e.g.
+// to classify nodes found by a crawler.
+func NewStaticFilter(config *params.ChainConfig, genesis common.Hash) func(id ID) error {
+	head := func() uint64 { return 0 }
+	return newFilter(config, genesis, head)
+}
+
 // newFilter is the internal version of NewFilter, taking closures as its arguments
 // instead of a chain. The reason is to allow testing it without having to simulate
 // an entire blockchain.
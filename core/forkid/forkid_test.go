@@ -181,6 +181,26 @@ func TestValidation(t *testing.T) {
 	}
 }
 
+func TestStaticFilter(t *testing.T) {
+	filter := NewStaticFilter(params.MainnetChainConfig, params.MainnetGenesisHash)
+	tests := []struct {
+		id  ID
+		err error
+	}{
+		// Mainnet genesis, aware of Homestead.
+		{ID{Hash: checksumToBytes(0xfc64ec04), Next: 1150000}, nil},
+		// Mainnet Petersburg.
+		{ID{Hash: checksumToBytes(0x668db0af), Next: 0}, nil},
+		// Rinkeby Petersburg.
+		{ID{Hash: checksumToBytes(0xafec6b27), Next: 0}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
 // Tests that IDs are properly RLP encoded (specifically important because we
 // use uint32 to store the hash, but we need to encode it as [4]byte).
 func TestEncoding(t *testing.T) {
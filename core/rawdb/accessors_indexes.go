@@ -17,9 +17,11 @@
 package rawdb
 
 import (
+	"encoding/binary"
 	"math/big"
 
 	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
 	"github.com/groshproject/grosh-core/core/types"
 	"github.com/groshproject/grosh-core/grodb"
 	"github.com/groshproject/grosh-core/log"
@@ -129,3 +131,48 @@ func WriteBloomBits(db grodb.KeyValueWriter, bit uint, section uint64, head comm
 		log.Crit("Failed to store bloom bits", "err", err)
 	}
 }
+
+// LogIndexAddress is the position under which the log index stores the postings
+// of emitting contract addresses. Topics are stored under their index in the log.
+const LogIndexAddress = byte(0xff)
+
+// ReadLogIndex retrieves the block offsets within the given section that contain
+// a log with the given address or topic at the given position.
+func ReadLogIndex(db grodb.KeyValueReader, position byte, value []byte, section uint64, head common.Hash) []uint64 {
+	data, _ := db.Get(logIndexKey(position, value, section, head))
+	if len(data) == 0 {
+		return nil
+	}
+	var (
+		offsets []uint64
+		last    uint64
+	)
+	for len(data) > 0 {
+		delta, n := binary.Uvarint(data)
+		if n <= 0 {
+			log.Error("Invalid log index entry", "position", position, "value", hexutil.Bytes(value), "section", section)
+			return nil
+		}
+		last += delta
+		offsets = append(offsets, last)
+		data = data[n:]
+	}
+	return offsets
+}
+
+// WriteLogIndex stores the ascending block offsets within the given section that
+// contain a log with the given address or topic at the given position.
+func WriteLogIndex(db grodb.KeyValueWriter, position byte, value []byte, section uint64, head common.Hash, offsets []uint64) {
+	var (
+		enc  = make([]byte, 0, len(offsets)*2)
+		buf  = make([]byte, binary.MaxVarintLen64)
+		last uint64
+	)
+	for _, offset := range offsets {
+		enc = append(enc, buf[:binary.PutUvarint(buf, offset-last)]...)
+		last = offset
+	}
+	if err := db.Put(logIndexKey(position, value, section, head), enc); err != nil {
+		log.Crit("Failed to store log index", "err", err)
+	}
+}
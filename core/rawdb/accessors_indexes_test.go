@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/groshproject/grosh-core/common"
@@ -106,3 +107,36 @@ func TestLookupStorage(t *testing.T) {
 		})
 	}
 }
+
+// Tests that log index postings can be stored and retrieved.
+func TestLogIndexStorage(t *testing.T) {
+	var (
+		db      = NewMemoryDatabase()
+		addr    = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		topic   = common.HexToHash("0x2222")
+		head    = common.Hash{0x01}
+		offsets = []uint64{0, 1, 5, 300, 4095}
+	)
+	if entry := ReadLogIndex(db, LogIndexAddress, addr.Bytes(), 0, head); entry != nil {
+		t.Fatalf("non existent entry returned: %v", entry)
+	}
+	WriteLogIndex(db, LogIndexAddress, addr.Bytes(), 0, head, offsets)
+	WriteLogIndex(db, 0, topic.Bytes(), 0, head, offsets[:2])
+
+	if entry := ReadLogIndex(db, LogIndexAddress, addr.Bytes(), 0, head); !reflect.DeepEqual(entry, offsets) {
+		t.Fatalf("address entry mismatch: have %v, want %v", entry, offsets)
+	}
+	if entry := ReadLogIndex(db, 0, topic.Bytes(), 0, head); !reflect.DeepEqual(entry, offsets[:2]) {
+		t.Fatalf("topic entry mismatch: have %v, want %v", entry, offsets[:2])
+	}
+	// Entries are keyed by position, section and section head.
+	if entry := ReadLogIndex(db, 1, topic.Bytes(), 0, head); entry != nil {
+		t.Fatalf("entry returned for wrong position: %v", entry)
+	}
+	if entry := ReadLogIndex(db, LogIndexAddress, addr.Bytes(), 1, head); entry != nil {
+		t.Fatalf("entry returned for wrong section: %v", entry)
+	}
+	if entry := ReadLogIndex(db, LogIndexAddress, addr.Bytes(), 0, common.Hash{0x02}); entry != nil {
+		t.Fatalf("entry returned for wrong head: %v", entry)
+	}
+}
@@ -242,6 +242,7 @@ func InspectDatabase(db grodb.Database) error {
 		txlookupSize    common.StorageSize
 		preimageSize    common.StorageSize
 		bloomBitsSize   common.StorageSize
+		logIndexSize    common.StorageSize
 		cliqueSnapsSize common.StorageSize
 
 		// Ancient store statistics
@@ -285,6 +286,8 @@ func InspectDatabase(db grodb.Database) error {
 			preimageSize += size
 		case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
 			bloomBitsSize += size
+		case bytes.HasPrefix(key, logIndexPrefix) && (len(key) == len(logIndexPrefix)+1+common.AddressLength+8+common.HashLength || len(key) == len(logIndexPrefix)+1+common.HashLength+8+common.HashLength):
+			logIndexSize += size
 		case bytes.HasPrefix(key, []byte("clique-")) && len(key) == 7+common.HashLength:
 			cliqueSnapsSize += size
 		case bytes.HasPrefix(key, []byte("cht-")) && len(key) == 4+common.HashLength:
@@ -330,6 +333,7 @@ func InspectDatabase(db grodb.Database) error {
 		{"Key-Value store", "Block hash->number", hashNumPairing.String()},
 		{"Key-Value store", "Transaction index", txlookupSize.String()},
 		{"Key-Value store", "Bloombit index", bloomBitsSize.String()},
+		{"Key-Value store", "Log index", logIndexSize.String()},
 		{"Key-Value store", "Trie nodes", trieSize.String()},
 		{"Key-Value store", "Trie preimages", preimageSize.String()},
 		{"Key-Value store", "Clique snapshots", cliqueSnapsSize.String()},
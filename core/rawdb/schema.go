@@ -52,12 +52,14 @@ var (
 
 	txLookupPrefix  = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
+	logIndexPrefix  = []byte("L") // logIndexPrefix + position + address/topic + section (uint64 big endian) + hash -> block offsets
 
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("grosh-config-") // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	LogIndexPrefix       = []byte("iL") // LogIndexPrefix is the data table of the log indexer to track its progress
 
 	preimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
@@ -155,6 +157,14 @@ func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	return key
 }
 
+// logIndexKey = logIndexPrefix + position + address/topic + section (uint64 big endian) + hash
+func logIndexKey(position byte, value []byte, section uint64, hash common.Hash) []byte {
+	key := make([]byte, 0, len(logIndexPrefix)+1+len(value)+8+common.HashLength)
+	key = append(append(append(key, logIndexPrefix...), position), value...)
+	key = append(key, encodeBlockNumber(section)...)
+	return append(key, hash.Bytes()...)
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
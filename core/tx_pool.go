@@ -213,6 +213,7 @@ type TxPool struct {
 	chain       blockChain
 	gasPrice    *big.Int
 	txFeed      event.Feed
+	dropFeed    event.Feed
 	scope       event.SubscriptionScope
 	signer      types.Signer
 	mu          sync.RWMutex
@@ -231,6 +232,7 @@ type TxPool struct {
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
+	dropped []DroppedTxsEvent            // Dropped transactions not yet announced
 
 	chainHeadCh     chan ChainHeadEvent
 	chainHeadSub    event.Subscription
@@ -357,13 +359,18 @@ func (pool *TxPool) loop() {
 				}
 				// Any non-locals old enough should be removed
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
-					for _, tx := range pool.queue[addr].Flatten() {
+					txs := pool.queue[addr].Flatten()
+					for _, tx := range txs {
 						pool.removeTx(tx.Hash(), true)
 					}
+					pool.drop(TxExpired, nil, txs)
 				}
 			}
+			dropped := pool.takeDropped()
 			pool.mu.Unlock()
 
+			pool.sendDropped(dropped)
+
 		// Handle local transaction journal rotation
 		case <-journal.C:
 			if pool.journal != nil {
@@ -398,6 +405,12 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeDroppedTxsEvent registers a subscription of DroppedTxsEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeDroppedTxsEvent(ch chan<- DroppedTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.dropFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -589,6 +602,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			underpricedTxMeter.Mark(1)
 			pool.removeTx(tx.Hash(), false)
 		}
+		pool.drop(TxUnderpriced, nil, drop)
 	}
 
 	// Try to replace an existing transaction in the pending pool
@@ -605,6 +619,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
+			pool.drop(TxReplaced, tx, []*types.Transaction{old})
 		}
 		pool.all.Add(tx)
 		pool.priced.Put(tx)
@@ -656,6 +671,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
+		pool.drop(TxReplaced, tx, []*types.Transaction{old})
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
@@ -697,6 +713,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed(1)
 
 		pendingDiscardMeter.Mark(1)
+		pool.drop(TxReplaced, list.txs.Get(tx.Nonce()), []*types.Transaction{tx})
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -705,6 +722,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed(1)
 
 		pendingReplaceMeter.Mark(1)
+		pool.drop(TxReplaced, tx, []*types.Transaction{old})
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
@@ -1026,9 +1044,10 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		txs := list.Flatten() // Heavy but will be cached and is needed by the miner anyway
 		pool.pendingNonces.set(addr, txs[len(txs)-1].Nonce()+1)
 	}
+	dropped := pool.takeDropped()
 	pool.mu.Unlock()
 
-	// Notify subsystems for newly added transactions
+	// Notify subsystems for newly added and dropped transactions
 	if len(events) > 0 {
 		var txs []*types.Transaction
 		for _, set := range events {
@@ -1036,6 +1055,34 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		}
 		pool.txFeed.Send(NewTxsEvent{txs})
 	}
+	pool.sendDropped(dropped)
+}
+
+// drop records transactions which were removed from the pool without being included
+// in a block. The events are sent in the next reorg run, after the pool lock is
+// released.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) drop(reason TxDropReason, replacement *types.Transaction, txs []*types.Transaction) {
+	if len(txs) > 0 {
+		pool.dropped = append(pool.dropped, DroppedTxsEvent{Txs: txs, Reason: reason, Replacement: replacement})
+	}
+}
+
+// takeDropped returns the recorded drop events and clears them.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) takeDropped() []DroppedTxsEvent {
+	dropped := pool.dropped
+	pool.dropped = nil
+	return dropped
+}
+
+// sendDropped notifies subsystems about dropped transactions.
+func (pool *TxPool) sendDropped(dropped []DroppedTxsEvent) {
+	for _, ev := range dropped {
+		pool.dropFeed.Send(ev)
+	}
 }
 
 // reset retrieves the current state of the blockchain and ensures the content
@@ -1154,6 +1201,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			log.Trace("Removed unpayable queued transaction", "hash", hash)
 		}
 		queuedNofundsMeter.Mark(int64(len(drops)))
+		pool.drop(TxUnpayable, nil, drops)
 
 		// Gather all executable transactions and promote them
 		readies := list.Ready(pool.pendingNonces.get(addr))
@@ -1176,6 +1224,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 			queuedRateLimitMeter.Mark(int64(len(caps)))
+			pool.drop(TxCapped, nil, caps)
 		}
 		// Mark all the items dropped as removed
 		pool.priced.Removed(len(forwards) + len(drops) + len(caps))
@@ -1240,6 +1289,7 @@ func (pool *TxPool) truncatePending() {
 						log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 					}
 					pool.priced.Removed(len(caps))
+					pool.drop(TxCapped, nil, caps)
 					pendingGauge.Dec(int64(len(caps)))
 					if pool.locals.contains(offenders[i]) {
 						localGauge.Dec(int64(len(caps)))
@@ -1267,6 +1317,7 @@ func (pool *TxPool) truncatePending() {
 					log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 				}
 				pool.priced.Removed(len(caps))
+				pool.drop(TxCapped, nil, caps)
 				pendingGauge.Dec(int64(len(caps)))
 				if pool.locals.contains(addr) {
 					localGauge.Dec(int64(len(caps)))
@@ -1306,9 +1357,11 @@ func (pool *TxPool) truncateQueue() {
 
 		// Drop all transactions if they are less than the overflow
 		if size := uint64(list.Len()); size <= drop {
-			for _, tx := range list.Flatten() {
+			txs := list.Flatten()
+			for _, tx := range txs {
 				pool.removeTx(tx.Hash(), true)
 			}
+			pool.drop(TxCapped, nil, txs)
 			drop -= size
 			queuedRateLimitMeter.Mark(int64(size))
 			continue
@@ -1317,6 +1370,7 @@ func (pool *TxPool) truncateQueue() {
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
 			pool.removeTx(txs[i].Hash(), true)
+			pool.drop(TxCapped, nil, txs[i:i+1])
 			drop--
 			queuedRateLimitMeter.Mark(1)
 		}
@@ -1347,6 +1401,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		}
 		pool.priced.Removed(len(olds) + len(drops))
 		pendingNofundsMeter.Mark(int64(len(drops)))
+		pool.drop(TxUnpayable, nil, drops)
 
 		for _, tx := range invalids {
 			hash := tx.Hash()
@@ -1518,6 +1518,69 @@ func TestTransactionReplacement(t *testing.T) {
 	}
 }
 
+// Tests that transactions leaving the pool without being included are announced
+// together with the reason.
+func TestTransactionDroppedEvents(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	account, _ := deriveSender(transaction(0, 0, key))
+	pool.currentState.AddBalance(account, big.NewInt(1000000))
+
+	events := make(chan DroppedTxsEvent, 32)
+	sub := pool.SubscribeDroppedTxsEvent(events)
+	defer sub.Unsubscribe()
+
+	expect := func(reason TxDropReason, replacement *types.Transaction, txs ...*types.Transaction) {
+		t.Helper()
+		select {
+		case ev := <-events:
+			if ev.Reason != reason {
+				t.Fatalf("wrong drop reason: have %s, want %s", ev.Reason, reason)
+			}
+			if len(ev.Txs) != len(txs) {
+				t.Fatalf("wrong number of dropped transactions: have %d, want %d", len(ev.Txs), len(txs))
+			}
+			for i, tx := range txs {
+				if ev.Txs[i].Hash() != tx.Hash() {
+					t.Fatalf("dropped transaction %d mismatch: have %x, want %x", i, ev.Txs[i].Hash(), tx.Hash())
+				}
+			}
+			if (ev.Replacement == nil) != (replacement == nil) || (replacement != nil && ev.Replacement.Hash() != replacement.Hash()) {
+				t.Fatalf("replacement mismatch: have %v, want %v", ev.Replacement, replacement)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s event not fired", reason)
+		}
+	}
+	// Replace a pending and a queued transaction
+	var (
+		pending  = pricedTransaction(0, 100000, big.NewInt(1), key)
+		pending2 = pricedTransaction(0, 100000, big.NewInt(2), key)
+		queued   = pricedTransaction(2, 100000, big.NewInt(1), key)
+		queued2  = pricedTransaction(2, 100000, big.NewInt(2), key)
+	)
+	pool.AddRemotesSync([]*types.Transaction{pending, queued})
+	pool.AddRemotesSync([]*types.Transaction{pending2})
+	expect(TxReplaced, pending2, pending)
+	pool.AddRemotesSync([]*types.Transaction{queued2})
+	expect(TxReplaced, queued2, queued)
+
+	// Transactions which can't be paid for anymore are dropped
+	pool.currentState.AddBalance(account, big.NewInt(-999999))
+	<-pool.requestReset(nil, nil)
+	expect(TxUnpayable, nil, queued2)
+	expect(TxUnpayable, nil, pending2)
+
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event: %s %v", ev.Reason, ev.Txs)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
 // Tests that local transactions are journaled to disk, but remote transactions
 // get discarded between restarts.
 func TestTransactionJournaling(t *testing.T)         { testTransactionJournaling(t, false) }
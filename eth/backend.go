@@ -47,6 +47,7 @@ import (
 	"github.com/groshproject/grosh-core/miner"
 	"github.com/groshproject/grosh-core/node"
 	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/enr"
 	"github.com/groshproject/grosh-core/params"
 	"github.com/groshproject/grosh-core/rlp"
@@ -74,6 +75,7 @@ type Grosh struct {
 	blockchain      *core.BlockChain
 	protocolManager *ProtocolManager
 	lesServer       LesServer
+	dialCandidates  *enode.FairMix // Discovery results filtered on the eth ENR entry
 
 	// DB interfaces
 	chainDb grodb.Database // Block chain database
@@ -84,6 +86,7 @@ type Grosh struct {
 
 	bloomRequests chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer  *core.ChainIndexer             // Bloom indexer operating during block imports
+	logIndexer    *core.ChainIndexer             // Exact log indexer operating during block imports (nil if disabled)
 
 	APIBackend *EthAPIBackend
 
@@ -128,6 +131,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Grosh, error) {
 		config.TrieCleanCache += config.TrieDirtyCache
 		config.TrieDirtyCache = 0
 	}
+	config.Bloom = config.Bloom.sanitize()
 	log.Info("Allocated trie memory caches", "clean", common.StorageSize(config.TrieCleanCache)*1024*1024, "dirty", common.StorageSize(config.TrieDirtyCache)*1024*1024)
 
 	// Assemble the Grosh object
@@ -153,6 +157,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Grosh, error) {
 		etherbase:      config.Miner.Etherbase,
 		bloomRequests:  make(chan chan *bloombits.Retrieval),
 		bloomIndexer:   NewBloomIndexer(chainDb, params.BloomBitsBlocks, params.BloomConfirms),
+		dialCandidates: enode.NewFairMix(0),
 	}
 
 	bcVersion := rawdb.ReadDatabaseVersion(chainDb)
@@ -195,6 +200,10 @@ func New(ctx *node.ServiceContext, config *Config) (*Grosh, error) {
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	if config.LogIndex {
+		eth.logIndexer = NewLogIndexer(chainDb, params.BloomBitsBlocks, params.BloomConfirms)
+		eth.logIndexer.Start(eth.blockchain)
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = ctx.ResolvePath(config.TxPool.Journal)
@@ -509,7 +518,8 @@ func (s *Grosh) Protocols() []p2p.Protocol {
 	protos := make([]p2p.Protocol, len(ProtocolVersions))
 	for i, vsn := range ProtocolVersions {
 		protos[i] = s.protocolManager.makeProtocol(vsn)
-		protos[i].Attributes = []enr.Entry{s.currentEthEntry()}
+		protos[i].Attributes = []enr.Entry{currentEthEntry(s.blockchain)}
+		protos[i].DialCandidates = s.dialCandidates
 	}
 	if s.lesServer != nil {
 		protos = append(protos, s.lesServer.Protocols()...)
@@ -521,6 +531,7 @@ func (s *Grosh) Protocols() []p2p.Protocol {
 // Grosh protocol implementation.
 func (s *Grosh) Start(srvr *p2p.Server) error {
 	s.startEthEntryUpdate(srvr.LocalNode())
+	s.setupDiscovery(srvr)
 
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers(params.BloomBitsBlocks)
@@ -547,7 +558,11 @@ func (s *Grosh) Start(srvr *p2p.Server) error {
 // Stop implements node.Service, terminating all internal goroutines used by the
 // Grosh protocol.
 func (s *Grosh) Stop() error {
+	s.dialCandidates.Close()
 	s.bloomIndexer.Close()
+	if s.logIndexer != nil {
+		s.logIndexer.Close()
+	}
 	s.blockchain.Stop()
 	s.engine.Close()
 	s.protocolManager.Stop()
@@ -18,6 +18,7 @@ package eth
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/groshproject/grosh-core/common"
@@ -27,30 +28,75 @@ import (
 	"github.com/groshproject/grosh-core/core/rawdb"
 	"github.com/groshproject/grosh-core/core/types"
 	"github.com/groshproject/grosh-core/grodb"
+	"github.com/groshproject/grosh-core/metrics"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 const (
-	// bloomServiceThreads is the number of goroutines used globally by an Grosh
-	// instance to service bloombits lookups for all running filters.
+	// bloomServiceThreads is the default number of goroutines used globally by an
+	// Grosh instance to service bloombits lookups for all running filters.
 	bloomServiceThreads = 16
 
-	// bloomFilterThreads is the number of goroutines used locally per filter to
-	// multiplex requests onto the global servicing goroutines.
+	// bloomFilterThreads is the default number of goroutines used locally per filter
+	// to multiplex requests onto the global servicing goroutines.
 	bloomFilterThreads = 3
 
-	// bloomRetrievalBatch is the maximum number of bloom bit retrievals to service
-	// in a single batch.
+	// bloomRetrievalBatch is the default maximum number of bloom bit retrievals to
+	// service in a single batch.
 	bloomRetrievalBatch = 16
 
-	// bloomRetrievalWait is the maximum time to wait for enough bloom bit requests
-	// to accumulate request an entire batch (avoiding hysteresis).
+	// bloomRetrievalWait is the default maximum time to wait for enough bloom bit
+	// requests to accumulate request an entire batch (avoiding hysteresis).
 	bloomRetrievalWait = time.Duration(0)
+
+	// bloomCacheSize is the default amount of memory in megabytes used to cache
+	// decompressed bloom bit vectors.
+	bloomCacheSize = 64
+)
+
+var (
+	bloomCacheHitMeter    = metrics.NewRegisteredMeter("eth/bloombits/cache/hit", nil)
+	bloomCacheMissMeter   = metrics.NewRegisteredMeter("eth/bloombits/cache/miss", nil)
+	bloomCacheSharedMeter = metrics.NewRegisteredMeter("eth/bloombits/cache/shared", nil)
+	bloomRetrievalTimer   = metrics.NewRegisteredTimer("eth/bloombits/retrieval", nil)
 )
 
+// BloomConfig contains the settings for servicing the bloombits lookups of log
+// filters. The servicing goroutines and the vector cache are shared by all
+// concurrently running filters.
+type BloomConfig struct {
+	ServiceThreads int           // Number of goroutines servicing bloom bit retrievals
+	FilterThreads  int           // Number of goroutines per filter multiplexing retrievals
+	RetrievalBatch int           // Maximum number of bloom bit retrievals serviced in a batch
+	RetrievalWait  time.Duration // Maximum time to wait for a retrieval batch to fill up
+	Cache          int           // Megabytes of memory used to cache decompressed bit vectors
+}
+
+// sanitize replaces invalid values with the defaults.
+func (c BloomConfig) sanitize() BloomConfig {
+	if c.ServiceThreads <= 0 {
+		c.ServiceThreads = bloomServiceThreads
+	}
+	if c.FilterThreads <= 0 {
+		c.FilterThreads = bloomFilterThreads
+	}
+	if c.RetrievalBatch <= 0 {
+		c.RetrievalBatch = bloomRetrievalBatch
+	}
+	if c.RetrievalWait < 0 {
+		c.RetrievalWait = bloomRetrievalWait
+	}
+	if c.Cache < 0 {
+		c.Cache = 0
+	}
+	return c
+}
+
 // startBloomHandlers starts a batch of goroutines to accept bloom bit database
 // retrievals from possibly a range of filters and serving the data to satisfy.
 func (eth *Grosh) startBloomHandlers(sectionSize uint64) {
-	for i := 0; i < bloomServiceThreads; i++ {
+	cache := newBloomVectorCache(eth.chainDb, sectionSize, eth.config.Bloom.Cache)
+	for i := 0; i < eth.config.Bloom.ServiceThreads; i++ {
 		go func() {
 			for {
 				select {
@@ -59,19 +105,16 @@ func (eth *Grosh) startBloomHandlers(sectionSize uint64) {
 
 				case request := <-eth.bloomRequests:
 					task := <-request
+					start := time.Now()
 					task.Bitsets = make([][]byte, len(task.Sections))
 					for i, section := range task.Sections {
-						head := rawdb.ReadCanonicalHash(eth.chainDb, (section+1)*sectionSize-1)
-						if compVector, err := rawdb.ReadBloomBits(eth.chainDb, task.Bit, section, head); err == nil {
-							if blob, err := bitutil.DecompressBytes(compVector, int(sectionSize/8)); err == nil {
-								task.Bitsets[i] = blob
-							} else {
-								task.Error = err
-							}
+						if blob, err := cache.get(task.Bit, section); err == nil {
+							task.Bitsets[i] = blob
 						} else {
 							task.Error = err
 						}
 					}
+					bloomRetrievalTimer.UpdateSince(start)
 					request <- task
 				}
 			}
@@ -79,6 +122,89 @@ func (eth *Grosh) startBloomHandlers(sectionSize uint64) {
 	}
 }
 
+// bloomVectorKey identifies a bit vector of a section. The section head is part
+// of the key, so vectors of a reorged section are never served.
+type bloomVectorKey struct {
+	bit     uint
+	section uint64
+	head    common.Hash
+}
+
+// bloomVectorLoad is a bit vector being loaded from the database. Concurrent
+// retrievals of the same vector wait for the first one instead of hitting the
+// database again.
+type bloomVectorLoad struct {
+	done chan struct{}
+	blob []byte
+	err  error
+}
+
+// bloomVectorCache caches decompressed bloom bit vectors for all filters. The
+// cached vectors are shared, the matcher only ever reads them.
+type bloomVectorCache struct {
+	db          grodb.Database
+	sectionSize uint64
+	cache       *lru.Cache // nil if caching is disabled
+
+	lock    sync.Mutex
+	loading map[bloomVectorKey]*bloomVectorLoad
+}
+
+// newBloomVectorCache creates a vector cache using the given megabytes of memory.
+func newBloomVectorCache(db grodb.Database, sectionSize uint64, megabytes int) *bloomVectorCache {
+	c := &bloomVectorCache{
+		db:          db,
+		sectionSize: sectionSize,
+		loading:     make(map[bloomVectorKey]*bloomVectorLoad),
+	}
+	if items := megabytes * 1024 * 1024 / int(sectionSize/8); items > 0 {
+		c.cache, _ = lru.New(items)
+	}
+	return c
+}
+
+// get returns the decompressed bit vector of a canonical section.
+func (c *bloomVectorCache) get(bit uint, section uint64) ([]byte, error) {
+	key := bloomVectorKey{bit, section, rawdb.ReadCanonicalHash(c.db, (section+1)*c.sectionSize-1)}
+	if c.cache != nil {
+		if blob, ok := c.cache.Get(key); ok {
+			bloomCacheHitMeter.Mark(1)
+			return blob.([]byte), nil
+		}
+	}
+	c.lock.Lock()
+	if load := c.loading[key]; load != nil {
+		c.lock.Unlock()
+		<-load.done
+		bloomCacheSharedMeter.Mark(1)
+		return load.blob, load.err
+	}
+	load := &bloomVectorLoad{done: make(chan struct{})}
+	c.loading[key] = load
+	c.lock.Unlock()
+
+	bloomCacheMissMeter.Mark(1)
+	load.blob, load.err = c.load(key)
+	if load.err == nil && c.cache != nil {
+		c.cache.Add(key, load.blob)
+	}
+	c.lock.Lock()
+	delete(c.loading, key)
+	c.lock.Unlock()
+	close(load.done)
+
+	return load.blob, load.err
+}
+
+// load reads and decompresses a bit vector from the database.
+func (c *bloomVectorCache) load(key bloomVectorKey) ([]byte, error) {
+	compVector, err := rawdb.ReadBloomBits(c.db, key.bit, key.section, key.head)
+	if err != nil {
+		return nil, err
+	}
+	return bitutil.DecompressBytes(compVector, int(c.sectionSize/8))
+}
+
 const (
 	// bloomThrottling is the time to wait between processing two consecutive index
 	// sections. It's useful during chain upgrades to prevent disk overload.
@@ -0,0 +1,90 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/bitutil"
+	"github.com/groshproject/grosh-core/core/rawdb"
+)
+
+func TestBloomVectorCache(t *testing.T) {
+	var (
+		db          = rawdb.NewMemoryDatabase()
+		sectionSize = uint64(4096)
+		head        = common.Hash{1}
+		vector      = make([]byte, sectionSize/8)
+	)
+	vector[10], vector[100] = 0x81, 0xff
+	rawdb.WriteCanonicalHash(db, head, sectionSize-1)
+	rawdb.WriteBloomBits(db, 5, 0, head, bitutil.CompressBytes(vector))
+
+	cache := newBloomVectorCache(db, sectionSize, 1)
+	if cache.cache == nil {
+		t.Fatal("cache not enabled")
+	}
+	// Concurrent retrievals all return the vector, it is loaded into the cache once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blob, err := cache.get(5, 0)
+			if err != nil || !bytes.Equal(blob, vector) {
+				t.Errorf("wrong vector %x, err %v", blob, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if cache.cache.Len() != 1 {
+		t.Fatalf("wrong number of cached vectors: have %d, want 1", cache.cache.Len())
+	}
+	if len(cache.loading) != 0 {
+		t.Fatalf("loads not cleaned up: %d", len(cache.loading))
+	}
+	// A reorged section head isn't served from the cache.
+	rawdb.WriteCanonicalHash(db, common.Hash{2}, sectionSize-1)
+	if _, err := cache.get(5, 0); err == nil {
+		t.Fatal("vector of reorged section returned")
+	}
+	// Missing vectors are errors and aren't cached.
+	if _, err := cache.get(6, 0); err == nil {
+		t.Fatal("missing vector returned")
+	}
+	// A disabled cache still serves vectors.
+	rawdb.WriteCanonicalHash(db, head, sectionSize-1)
+	if blob, err := newBloomVectorCache(db, sectionSize, 0).get(5, 0); err != nil || !bytes.Equal(blob, vector) {
+		t.Fatalf("wrong vector from uncached retrieval %x, err %v", blob, err)
+	}
+}
+
+func TestBloomConfigSanitize(t *testing.T) {
+	config := BloomConfig{RetrievalWait: -1, Cache: -1}.sanitize()
+	want := BloomConfig{
+		ServiceThreads: bloomServiceThreads,
+		FilterThreads:  bloomFilterThreads,
+		RetrievalBatch: bloomRetrievalBatch,
+		RetrievalWait:  bloomRetrievalWait,
+	}
+	if config != want {
+		t.Fatalf("wrong sanitized config: have %+v, want %+v", config, want)
+	}
+}
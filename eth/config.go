@@ -57,9 +57,17 @@ var DefaultConfig = Config{
 		Recommit: 3 * time.Second,
 	},
 	TxPool: core.DefaultTxPoolConfig,
+	Bloom: BloomConfig{
+		ServiceThreads: bloomServiceThreads,
+		FilterThreads:  bloomFilterThreads,
+		RetrievalBatch: bloomRetrievalBatch,
+		RetrievalWait:  bloomRetrievalWait,
+		Cache:          bloomCacheSize,
+	},
 	GPO: gasprice.Config{
 		Blocks:     20,
 		Percentile: 60,
+		MaxHistory: gasprice.DefaultMaxHistory,
 	},
 }
 
@@ -131,6 +139,10 @@ type Config struct {
 	// Transaction pool options
 	TxPool core.TxPoolConfig
 
+	// Log filtering options
+	Bloom    BloomConfig
+	LogIndex bool // Maintain an exact address and topic index of the logs
+
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
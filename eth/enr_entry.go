@@ -17,8 +17,12 @@
 package eth
 
 import (
+	"sync"
+
+	"github.com/groshproject/grosh-core/common/hexutil"
 	"github.com/groshproject/grosh-core/core"
 	"github.com/groshproject/grosh-core/core/forkid"
+	"github.com/groshproject/grosh-core/p2p"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/rlp"
 )
@@ -26,7 +30,8 @@ import (
 // ethEntry is the "eth" ENR entry which advertises eth protocol
 // on the discovery network.
 type ethEntry struct {
-	ForkID forkid.ID // Fork identifier per EIP-2124
+	ForkID   forkid.ID // Fork identifier per EIP-2124
+	Versions []uint    // Supported eth protocol versions, may be empty
 
 	// Ignore additional fields (for forward compatibility).
 	Rest []rlp.RawValue `rlp:"tail"`
@@ -37,6 +42,62 @@ func (e ethEntry) ENRKey() string {
 	return "eth"
 }
 
+// DecodeRLP implements rlp.Decoder. The version list is optional because
+// older nodes only publish the fork ID.
+func (e *ethEntry) DecodeRLP(s *rlp.Stream) error {
+	if _, err := s.List(); err != nil {
+		return err
+	}
+	if err := s.Decode(&e.ForkID); err != nil {
+		return err
+	}
+	e.Versions, e.Rest = nil, nil
+	if err := s.Decode(&e.Versions); err != nil && err != rlp.EOL {
+		return err
+	}
+	for {
+		var v rlp.RawValue
+		if err := s.Decode(&v); err == rlp.EOL {
+			break
+		} else if err != nil {
+			return err
+		}
+		e.Rest = append(e.Rest, v)
+	}
+	return s.ListEnd()
+}
+
+// supports reports whether the entry announces any of the given protocol versions.
+// Entries without a version list are assumed to support all versions.
+func (e *ethEntry) supports(versions []uint) bool {
+	if len(e.Versions) == 0 {
+		return true
+	}
+	for _, have := range e.Versions {
+		for _, want := range versions {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ethEntryInfo is the JSON representation of the eth ENR entry in admin_nodeInfo.
+type ethEntryInfo struct {
+	ForkHash hexutil.Bytes `json:"forkHash"`
+	ForkNext uint64        `json:"forkNext"`
+	Versions []uint        `json:"versions"`
+}
+
+func (e *ethEntry) info() *ethEntryInfo {
+	return &ethEntryInfo{
+		ForkHash: e.ForkID.Hash[:],
+		ForkNext: e.ForkID.Next,
+		Versions: e.Versions,
+	}
+}
+
 func (eth *Grosh) startEthEntryUpdate(ln *enode.LocalNode) {
 	var newHead = make(chan core.ChainHeadEvent, 10)
 	sub := eth.blockchain.SubscribeChainHeadEvent(newHead)
@@ -46,7 +107,7 @@ func (eth *Grosh) startEthEntryUpdate(ln *enode.LocalNode) {
 		for {
 			select {
 			case <-newHead:
-				ln.Set(eth.currentEthEntry())
+				ln.Set(currentEthEntry(eth.blockchain))
 			case <-sub.Err():
 				// Would be nice to sync with eth.Stop, but there is no
 				// good way to do that.
@@ -56,6 +117,136 @@ func (eth *Grosh) startEthEntryUpdate(ln *enode.LocalNode) {
 	}()
 }
 
-func (eth *Grosh) currentEthEntry() *ethEntry {
-	return &ethEntry{ForkID: forkid.NewID(eth.blockchain)}
+func currentEthEntry(chain *core.BlockChain) *ethEntry {
+	return &ethEntry{
+		ForkID:   forkid.NewID(chain),
+		Versions: ProtocolVersions,
+	}
+}
+
+// setupDiscovery adds the discovery v4 table as a source of eth dial candidates.
+// Nodes are filtered on their eth entry, so the dialer doesn't attempt to connect
+// to nodes which would fail the handshake anyway.
+func (eth *Grosh) setupDiscovery(srv *p2p.Server) {
+	disc := srv.DiscoveryV4()
+	if disc == nil {
+		return
+	}
+	it := newENRResolveIter(disc.RandomNodes(), disc.RequestENR, enrResolveWorkers)
+	eth.dialCandidates.AddSource(enode.Filter(it, newNodeFilter(eth.blockchain)))
+}
+
+// newNodeFilter returns a function which reports whether a node advertises a fork ID
+// and protocol version compatible with the local chain.
+func newNodeFilter(chain *core.BlockChain) func(*enode.Node) bool {
+	filter := forkid.NewFilter(chain)
+	return func(n *enode.Node) bool {
+		var entry ethEntry
+		if err := n.Load(&entry); err != nil {
+			return false
+		}
+		if err := filter(entry.ForkID); err != nil {
+			return false
+		}
+		return entry.supports(ProtocolVersions)
+	}
+}
+
+// enrResolveWorkers is the number of concurrent ENR requests made for dial
+// candidates.
+const enrResolveWorkers = 16
+
+// enrResolveIter fetches the current record of nodes which don't have an eth entry.
+// Nodes found by discovery v4 lookups only carry their endpoint, the full record
+// needs to be requested from the node before it can be filtered. Records are
+// requested by a bounded number of workers, so unresponsive nodes don't hold up
+// the other candidates.
+type enrResolveIter struct {
+	resolve func(*enode.Node) (*enode.Node, error)
+	nodes   chan *enode.Node
+	closing chan struct{}
+	node    *enode.Node
+
+	srcMu     sync.Mutex // serializes access to src
+	src       enode.Iterator
+	closeOnce sync.Once
+}
+
+func newENRResolveIter(src enode.Iterator, resolve func(*enode.Node) (*enode.Node, error), workers int) *enrResolveIter {
+	it := &enrResolveIter{
+		src:     src,
+		resolve: resolve,
+		nodes:   make(chan *enode.Node),
+		closing: make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			it.worker()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(it.nodes)
+	}()
+	return it
+}
+
+// worker takes nodes from the source and resolves those without an eth entry.
+func (it *enrResolveIter) worker() {
+	for {
+		n := it.nextSource()
+		if n == nil {
+			return
+		}
+		var entry ethEntry
+		if n.Load(&entry) != nil {
+			if resolved, err := it.resolve(n); err == nil {
+				n = resolved
+			}
+		}
+		select {
+		case it.nodes <- n:
+		case <-it.closing:
+			return
+		}
+	}
+}
+
+// nextSource returns the next node of the source iterator, or nil when it is done.
+func (it *enrResolveIter) nextSource() *enode.Node {
+	it.srcMu.Lock()
+	defer it.srcMu.Unlock()
+
+	if !it.src.Next() {
+		return nil
+	}
+	return it.src.Node()
+}
+
+// Next moves to the next node.
+func (it *enrResolveIter) Next() bool {
+	select {
+	case n, ok := <-it.nodes:
+		it.node = n
+		return ok
+	case <-it.closing:
+		it.node = nil
+		return false
+	}
+}
+
+// Node returns the current node.
+func (it *enrResolveIter) Node() *enode.Node {
+	return it.node
+}
+
+// Close ends the iterator and the source iterator.
+func (it *enrResolveIter) Close() {
+	it.closeOnce.Do(func() {
+		close(it.closing)
+		it.src.Close()
+	})
 }
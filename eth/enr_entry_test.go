@@ -0,0 +1,139 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/core/forkid"
+	"github.com/groshproject/grosh-core/eth/downloader"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/enr"
+	"github.com/groshproject/grosh-core/rlp"
+)
+
+// Tests that the eth entry decodes records published by older nodes, which
+// only contain the fork ID, as well as records with additional fields.
+func TestEthEntryDecode(t *testing.T) {
+	id := forkid.ID{Hash: [4]byte{1, 2, 3, 4}, Next: 5}
+	tests := []struct {
+		input interface{}
+		want  ethEntry
+	}{
+		{
+			input: []interface{}{id},
+			want:  ethEntry{ForkID: id},
+		},
+		{
+			input: []interface{}{id, []uint{63, 64}},
+			want:  ethEntry{ForkID: id, Versions: []uint{63, 64}},
+		},
+		{
+			input: []interface{}{id, []uint{63}, uint(1), "extra"},
+			want: ethEntry{
+				ForkID:   id,
+				Versions: []uint{63},
+				Rest:     []rlp.RawValue{{0x01}, {0x85, 'e', 'x', 't', 'r', 'a'}},
+			},
+		},
+	}
+	for i, test := range tests {
+		enc, err := rlp.EncodeToBytes(test.input)
+		if err != nil {
+			t.Fatalf("test %d: encoding failed: %v", i, err)
+		}
+		var entry ethEntry
+		if err := rlp.DecodeBytes(enc, &entry); err != nil {
+			t.Fatalf("test %d: decoding failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(entry, test.want) {
+			t.Errorf("test %d: wrong entry:\nhave %+v\nwant %+v", i, entry, test.want)
+		}
+	}
+}
+
+// Tests that dial candidates are filtered on the eth entry.
+func TestNodeFilter(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	local := currentEthEntry(pm.blockchain)
+	filter := newNodeFilter(pm.blockchain)
+	tests := []struct {
+		entry *ethEntry
+		want  bool
+	}{
+		{entry: nil, want: false},
+		{entry: local, want: true},
+		{entry: &ethEntry{ForkID: local.ForkID}, want: true},
+		{entry: &ethEntry{ForkID: local.ForkID, Versions: []uint{1}}, want: false},
+		{entry: &ethEntry{ForkID: forkid.ID{Hash: [4]byte{0xff}}, Versions: ProtocolVersions}, want: false},
+	}
+	for i, test := range tests {
+		var r enr.Record
+		if test.entry != nil {
+			r.Set(test.entry)
+		}
+		n := enode.SignNull(&r, enode.ID{byte(i)})
+		if ok := filter(n); ok != test.want {
+			t.Errorf("test %d: filter returned %t, want %t", i, ok, test.want)
+		}
+	}
+}
+
+// Tests that ENRs are requested concurrently, so a node which doesn't answer
+// doesn't block the other candidates.
+func TestENRResolveIter(t *testing.T) {
+	local := &ethEntry{ForkID: forkid.ID{Hash: [4]byte{1}}}
+	var nodes []*enode.Node
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, enode.SignNull(new(enr.Record), enode.ID{byte(i)}))
+	}
+	var (
+		hang    = make(chan struct{})
+		resolve = func(n *enode.Node) (*enode.Node, error) {
+			if n.ID() == (enode.ID{0}) {
+				<-hang // the first node never answers
+			}
+			var r enr.Record
+			r.Set(local)
+			return enode.SignNull(&r, n.ID()), nil
+		}
+	)
+	defer close(hang)
+
+	it := newENRResolveIter(enode.IterNodes(nodes), resolve, 4)
+	defer it.Close()
+	done := make(chan []*enode.Node)
+	go func() { done <- enode.ReadNodes(it, len(nodes)-1) }()
+	select {
+	case got := <-done:
+		if len(got) != len(nodes)-1 {
+			t.Fatalf("got %d nodes, want %d", len(got), len(nodes)-1)
+		}
+		for _, n := range got {
+			var entry ethEntry
+			if err := n.Load(&entry); err != nil || entry.ForkID != local.ForkID {
+				t.Fatalf("node %v not resolved", n.ID())
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolving blocked on unresponsive node")
+	}
+}
@@ -28,9 +28,12 @@ import (
 	grosh "github.com/groshproject/grosh-core"
 	"github.com/groshproject/grosh-core/common"
 	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core"
 	"github.com/groshproject/grosh-core/core/types"
 	"github.com/groshproject/grosh-core/grodb"
 	"github.com/groshproject/grosh-core/event"
+	"github.com/groshproject/grosh-core/internal/ethapi"
+	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/rpc"
 )
 
@@ -104,7 +107,7 @@ func (api *PublicFilterAPI) timeoutLoop() {
 // https://github.com/grosh/wiki/wiki/JSON-RPC#eth_newpendingtransactionfilter
 func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 	var (
-		pendingTxs   = make(chan []common.Hash)
+		pendingTxs   = make(chan []*types.Transaction)
 		pendingTxSub = api.events.SubscribePendingTxs(pendingTxs)
 	)
 
@@ -115,10 +118,12 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 	go func() {
 		for {
 			select {
-			case ph := <-pendingTxs:
+			case txs := <-pendingTxs:
 				api.filtersMu.Lock()
 				if f, found := api.filters[pendingTxSub.ID]; found {
-					f.hashes = append(f.hashes, ph...)
+					for _, tx := range txs {
+						f.hashes = append(f.hashes, tx.Hash())
+					}
 				}
 				api.filtersMu.Unlock()
 			case <-pendingTxSub.Err():
@@ -135,25 +140,40 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 
 // NewPendingTransactions creates a subscription that is triggered each time a transaction
 // enters the transaction pool and was signed from one of the transactions this nodes manages.
-func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+// If fullTx is true, the full transaction is sent instead of the hash. The optional
+// criteria restrict the delivered transactions.
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context, fullTx *bool, crit *PendingTxCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
+	if crit != nil {
+		if err := crit.validate(); err != nil {
+			return nil, err
+		}
+	}
 
-	rpcSub := notifier.CreateSubscription()
+	var (
+		rpcSub       = notifier.CreateSubscription()
+		pendingTxs   = make(chan []*types.Transaction, 128)
+		pendingTxSub = api.events.SubscribePendingTxs(pendingTxs)
+	)
 
 	go func() {
-		txHashes := make(chan []common.Hash, 128)
-		pendingTxSub := api.events.SubscribePendingTxs(txHashes)
-
 		for {
 			select {
-			case hashes := <-txHashes:
+			case txs := <-pendingTxs:
 				// To keep the original behaviour, send a single tx hash in one notification.
 				// TODO(rjl493456442) Send a batch of tx hashes in one notification
-				for _, h := range hashes {
-					notifier.Notify(rpcSub.ID, h)
+				for _, tx := range txs {
+					if !crit.matches(tx) {
+						continue
+					}
+					if fullTx != nil && *fullTx {
+						notifier.Notify(rpcSub.ID, ethapi.NewRPCPendingTransaction(tx))
+					} else {
+						notifier.Notify(rpcSub.ID, tx.Hash())
+					}
 				}
 			case <-rpcSub.Err():
 				pendingTxSub.Unsubscribe()
@@ -168,6 +188,49 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	return rpcSub, nil
 }
 
+// DroppedTransactions creates a subscription that is triggered each time a transaction
+// is dropped from the transaction pool without being included in a block, e.g. because
+// it was replaced or evicted. If fullTx is true, the notifications contain the full
+// transaction. The optional criteria restrict the delivered transactions.
+func (api *PublicFilterAPI) DroppedTransactions(ctx context.Context, fullTx *bool, crit *PendingTxCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if crit != nil {
+		if err := crit.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		rpcSub       = notifier.CreateSubscription()
+		droppedTxs   = make(chan core.DroppedTxsEvent, 128)
+		droppedTxSub = api.events.SubscribeDroppedTxs(droppedTxs)
+	)
+
+	go func() {
+		for {
+			select {
+			case ev := <-droppedTxs:
+				for _, tx := range ev.Txs {
+					if crit.matches(tx) {
+						notifier.Notify(rpcSub.ID, newRPCDroppedTransaction(tx, ev, fullTx != nil && *fullTx))
+					}
+				}
+			case <-rpcSub.Err():
+				droppedTxSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				droppedTxSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
 // It is part of the filter package since polling goes with eth_getFilterChanges.
 //
@@ -234,7 +297,14 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 }
 
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
-func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
+//
+// If a numeric fromBlock or a cursor is given, the matching historical logs are
+// delivered before any new logs. A cursor identifies the last block the client has
+// processed. If that block was reorged while the client was away, the logs of the
+// reorged blocks are delivered first with the removed flag set. If the replay fails,
+// the subscription is closed and eth_unsubscribe returns an error for it. The reason
+// is sent in a final notification with an "error" member (see package rpc).
+func (api *PublicFilterAPI) Logs(ctx context.Context, crit LogsCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
@@ -245,19 +315,62 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 		matchedLogs = make(chan []*types.Log)
 	)
 
-	logsSub, err := api.events.SubscribeLogs(grosh.FilterQuery(crit), matchedLogs)
+	logsSub, err := api.events.SubscribeLogs(grosh.FilterQuery(crit.FilterCriteria), matchedLogs)
 	if err != nil {
 		return nil, err
 	}
+	// The live subscription is installed, replaying history from here on can't miss
+	// any blocks.
+	replay, err := newLogsReplay(ctx, api.backend, crit)
+	if err != nil {
+		logsSub.Unsubscribe()
+		return nil, err
+	}
 
 	go func() {
-
+		var (
+			replayCtx, cancel = context.WithCancel(context.Background())
+			replayDone        chan error
+			buffered          []*types.Log
+		)
+		defer cancel()
+
+		if replay != nil {
+			replayDone = make(chan error, 1)
+			go func() {
+				replayDone <- replay.run(replayCtx, func(log *types.Log) {
+					notifier.Notify(rpcSub.ID, log)
+				})
+			}()
+		}
 		for {
 			select {
 			case logs := <-matchedLogs:
+				// Hold back new logs until the replay is done.
+				if replay != nil {
+					if len(buffered)+len(logs) > maxReplayBufferedLogs {
+						log.Debug("Logs replay failed", "err", errReplayBufferFull)
+						logsSub.Unsubscribe()
+						notifier.Fail(rpcSub.ID, errReplayBufferFull)
+						return
+					}
+					buffered = append(buffered, logs...)
+					continue
+				}
 				for _, log := range logs {
 					notifier.Notify(rpcSub.ID, &log)
 				}
+			case err := <-replayDone:
+				if err != nil {
+					log.Debug("Logs replay failed", "err", err)
+					logsSub.Unsubscribe()
+					notifier.Fail(rpcSub.ID, err)
+					return
+				}
+				for _, log := range replay.filterLive(buffered) {
+					notifier.Notify(rpcSub.ID, log)
+				}
+				replay, replayDone, buffered = nil, nil, nil
 			case <-rpcSub.Err(): // client send an unsubscribe request
 				logsSub.Unsubscribe()
 				return
@@ -341,6 +454,9 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 		// Construct the range filter
 		filter = NewRangeFilter(api.backend, begin, end, crit.Addresses, crit.Topics)
 	}
+	if err := limitResponse(ctx, filter); err != nil {
+		return nil, err
+	}
 	// Run the filter and return all the logs
 	logs, err := filter.Logs(ctx)
 	if err != nil {
@@ -349,6 +465,20 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 	return returnLogs(logs), err
 }
 
+// limitResponse makes the filter fail once its logs exceed the response size budget
+// of the RPC call.
+func limitResponse(ctx context.Context, filter *Filter) error {
+	budget, ok := rpc.ResponseBudget(ctx)
+	if !ok {
+		return nil
+	}
+	if budget <= 0 {
+		return rpc.ErrResponseTooLarge
+	}
+	filter.SetSizeLimit(budget)
+	return nil
+}
+
 // UninstallFilter removes the filter with the given filter id.
 //
 // https://github.com/grosh/wiki/wiki/JSON-RPC#eth_uninstallfilter
@@ -396,6 +526,9 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 		// Construct the range filter
 		filter = NewRangeFilter(api.backend, begin, end, f.crit.Addresses, f.crit.Topics)
 	}
+	if err := limitResponse(ctx, filter); err != nil {
+		return nil, err
+	}
 	// Run the filter and return all the logs
 	logs, err := filter.Logs(ctx)
 	if err != nil {
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"time"
 
 	"github.com/groshproject/grosh-core/common"
 	"github.com/groshproject/grosh-core/core"
@@ -30,6 +31,22 @@ import (
 	"github.com/groshproject/grosh-core/rpc"
 )
 
+const (
+	// logFetchThreads is the number of blocks whose logs are retrieved concurrently
+	// by a single range filter.
+	logFetchThreads = 8
+)
+
+// errLimitReached stops a search once the limit of the filter is reached.
+var errLimitReached = errors.New("log limit reached")
+
+// Estimated size of a log in JSON-RPC responses, rounded down. The base size is the
+// size of a log without topics and data.
+const (
+	logJSONBaseSize  = 325
+	logJSONTopicSize = 2*common.HashLength + 4
+)
+
 type Backend interface {
 	ChainDb() grodb.Database
 	EventMux() *event.TypeMux
@@ -39,11 +56,13 @@ type Backend interface {
 	GetLogs(ctx context.Context, blockHash common.Hash) ([][]*types.Log, error)
 
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
+	SubscribeDroppedTxsEvent(chan<- core.DroppedTxsEvent) event.Subscription
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 
 	BloomStatus() (uint64, uint64)
+	LogIndexStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
 }
 
@@ -58,6 +77,12 @@ type Filter struct {
 	block      common.Hash // Block hash if filtering a single block
 	begin, end int64       // Range interval if filtering multiple blocks
 
+	limit int // Number of logs after which the search stops, 0 if unlimited
+	found int // Number of logs found so far
+
+	sizeLimit int // Response size after which the search fails, 0 if unlimited
+	size      int // Estimated response size of the logs found so far
+
 	matcher *bloombits.Matcher
 }
 
@@ -114,9 +139,31 @@ func newFilter(backend Backend, addresses []common.Address, topics [][]common.Ha
 	}
 }
 
+// SetLimit makes the search stop once at least limit logs were found. The logs
+// of a block are always returned completely, so the results can exceed the limit.
+func (f *Filter) SetLimit(limit int) {
+	f.limit = limit
+}
+
+// SetSizeLimit makes the search fail with rpc.ErrResponseTooLarge once the logs
+// found would take more than limit bytes in a JSON-RPC response.
+func (f *Filter) SetSizeLimit(limit int) {
+	f.sizeLimit = limit
+}
+
 // Logs searches the blockchain for matching log entries, returning all from the
 // first block that contains matches, updating the start of the filter accordingly.
 func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
+	logs, err := f.logs(ctx)
+	if err == errLimitReached {
+		err = nil
+	}
+	return logs, err
+}
+
+// logs searches for matching log entries, see Logs. It fails with errLimitReached
+// if the search was stopped because of the limit.
+func (f *Filter) logs(ctx context.Context) ([]*types.Log, error) {
 	// If we're doing singleton block filtering, execute and return
 	if f.block != (common.Hash{}) {
 		header, err := f.backend.HeaderByHash(ctx, f.block)
@@ -126,7 +173,14 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		if header == nil {
 			return nil, errors.New("unknown block")
 		}
-		return f.blockLogs(ctx, header)
+		logs, err := f.blockLogs(ctx, header)
+		if err != nil {
+			return logs, err
+		}
+		if err := f.addSize(logs); err != nil {
+			return nil, err
+		}
+		return logs, nil
 	}
 	// Figure out the limits of the filter range
 	header, _ := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
@@ -142,18 +196,37 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	if f.end == -1 {
 		end = head
 	}
-	// Gather all indexed logs, and finish with non indexed ones
+	defer filterQueryTimer.UpdateSince(time.Now())
+	if int64(end) >= f.begin {
+		filterBlocksMeter.Mark(int64(end) - f.begin + 1)
+	}
+	// Gather all exactly indexed logs, then the bloom indexed ones, and finish with
+	// non indexed ones
 	var (
 		logs []*types.Log
 		err  error
 	)
+	if size, sections := f.backend.LogIndexStatus(); f.constrained() {
+		if indexed := sections * size; indexed > uint64(f.begin) {
+			if indexed > end {
+				logs, err = f.logIndexedLogs(ctx, size, end)
+			} else {
+				logs, err = f.logIndexedLogs(ctx, size, indexed-1)
+			}
+			if err != nil {
+				return logs, err
+			}
+		}
+	}
 	size, sections := f.backend.BloomStatus()
-	if indexed := sections * size; indexed > uint64(f.begin) {
+	if indexed := sections * size; indexed > uint64(f.begin) && uint64(f.begin) <= end {
+		var found []*types.Log
 		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
+			found, err = f.indexedLogs(ctx, end)
 		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
+			found, err = f.indexedLogs(ctx, indexed-1)
 		}
+		logs = append(logs, found...)
 		if err != nil {
 			return logs, err
 		}
@@ -177,56 +250,121 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 
 	f.backend.ServiceFilter(ctx, session)
 
-	// Iterate over the matches until exhausted or context closed
-	var logs []*types.Log
+	// Retrieve the suggested blocks and pull any truly matching logs
+	logs, err := f.fetchLogs(ctx, matches, f.checkMatches)
+	if err == nil {
+		if err = session.Error(); err == nil {
+			f.begin = int64(end) + 1
+		}
+	}
+	return logs, err
+}
 
-	for {
-		select {
-		case number, ok := <-matches:
-			// Abort if all matches have been fulfilled
-			if !ok {
-				err := session.Error()
-				if err == nil {
-					f.begin = int64(end) + 1
-				}
-				return logs, err
+// unindexedLogs returns the logs matching the filter criteria based on raw block
+// iteration and bloom matching.
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	numbers := make(chan uint64)
+	go func() {
+		defer close(numbers)
+		for number := uint64(f.begin); number <= end; number++ {
+			select {
+			case numbers <- number:
+			case <-ctx.Done():
+				return
 			}
-			f.begin = int64(number) + 1
+		}
+	}()
+	return f.fetchLogs(ctx, numbers, f.blockLogs)
+}
 
-			// Retrieve the suggested block and pull any truly matching logs
-			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
-			if header == nil || err != nil {
-				return logs, err
+// fetchResult is the outcome of checking a single block for matching logs.
+type fetchResult struct {
+	number  uint64
+	logs    []*types.Log
+	missing bool // header not found
+	err     error
+	done    chan struct{}
+}
+
+// fetchLogs checks the blocks delivered on the numbers channel for matching logs.
+// Blocks are checked concurrently, but the logs are returned in the order of the
+// block numbers. The start of the filter range is moved past every block that was
+// checked completely.
+func (f *Filter) fetchLogs(ctx context.Context, numbers <-chan uint64, check func(context.Context, *types.Header) ([]*types.Log, error)) ([]*types.Log, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Start checking blocks, but never have more than logFetchThreads results
+	// waiting for collection.
+	results := make(chan *fetchResult, logFetchThreads)
+	go func() {
+		defer close(results)
+		for {
+			var res *fetchResult
+			select {
+			case number, ok := <-numbers:
+				if !ok {
+					return
+				}
+				res = &fetchResult{number: number, done: make(chan struct{})}
+			case <-ctx.Done():
+				return
 			}
-			found, err := f.checkMatches(ctx, header)
-			if err != nil {
-				return logs, err
+			select {
+			case results <- res:
+			case <-ctx.Done():
+				return
 			}
-			logs = append(logs, found...)
+			go func() {
+				defer close(res.done)
 
-		case <-ctx.Done():
-			return logs, ctx.Err()
+				header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(res.number))
+				if header == nil || err != nil {
+					res.missing, res.err = header == nil, err
+					return
+				}
+				res.logs, res.err = check(ctx, header)
+			}()
 		}
-	}
-}
-
-// indexedLogs returns the logs matching the filter criteria based on raw block
-// iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	}()
+	// Collect the results in order
 	var logs []*types.Log
-
-	for ; f.begin <= int64(end); f.begin++ {
-		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
-		if header == nil || err != nil {
-			return logs, err
+	for res := range results {
+		<-res.done
+		if res.err != nil || res.missing {
+			return logs, res.err
 		}
-		found, err := f.blockLogs(ctx, header)
-		if err != nil {
-			return logs, err
+		if err := f.addSize(res.logs); err != nil {
+			return nil, err
+		}
+		f.begin = int64(res.number) + 1
+		logs = append(logs, res.logs...)
+
+		if f.limit > 0 {
+			if f.found += len(res.logs); f.found >= f.limit {
+				return logs, errLimitReached
+			}
 		}
-		logs = append(logs, found...)
 	}
-	return logs, nil
+	return logs, ctx.Err()
+}
+
+// addSize adds the response size of the given logs to the size of the result and
+// fails if it exceeds the size limit.
+func (f *Filter) addSize(logs []*types.Log) error {
+	if f.sizeLimit <= 0 {
+		return nil
+	}
+	for _, log := range logs {
+		f.size += logJSONBaseSize + len(log.Topics)*logJSONTopicSize + 2*len(log.Data)
+	}
+	if f.size > f.sizeLimit {
+		return rpc.ErrResponseTooLarge
+	}
+	return nil
 }
 
 // blockLogs returns the logs matching the filter criteria within a single block.
@@ -244,6 +382,13 @@ func (f *Filter) blockLogs(ctx context.Context, header *types.Header) (logs []*t
 // checkMatches checks if the receipts belonging to the given header contain any log events that
 // match the filter criteria. This function is called when the bloom filter signals a potential match.
 func (f *Filter) checkMatches(ctx context.Context, header *types.Header) (logs []*types.Log, err error) {
+	filterCandidatesMeter.Mark(1)
+	defer func() {
+		if err == nil && len(logs) == 0 {
+			filterFalsePositivesMeter.Mark(1)
+		}
+		filterResultsMeter.Mark(int64(len(logs)))
+	}()
 	// Get the logs of the block
 	logsList, err := f.backend.GetLogs(ctx, header.Hash())
 	if err != nil {
@@ -18,6 +18,7 @@ package filters
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"math/big"
 	"os"
@@ -31,6 +32,7 @@ import (
 	"github.com/groshproject/grosh-core/crypto"
 	"github.com/groshproject/grosh-core/event"
 	"github.com/groshproject/grosh-core/params"
+	"github.com/groshproject/grosh-core/rpc"
 )
 
 func makeReceipt(addr common.Address) *types.Receipt {
@@ -56,7 +58,7 @@ func BenchmarkFilters(b *testing.B) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr1      = crypto.PubkeyToAddress(key1.PublicKey)
 		addr2      = common.BytesToAddress([]byte("jeff"))
@@ -115,7 +117,7 @@ func TestFilters(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed)}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr       = crypto.PubkeyToAddress(key1.PublicKey)
 
@@ -234,3 +236,69 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+func TestFilterLogsOrder(t *testing.T) {
+	backend, _, _ := newReplayTestBackend(t)
+
+	// More blocks than fetch threads, all of them matching.
+	logs, err := NewRangeFilter(backend, 0, -1, []common.Address{replayTestAddr}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 10 {
+		t.Fatalf("wrong number of logs: have %d, want 10", len(logs))
+	}
+	for i, log := range logs {
+		if log.BlockNumber != uint64(i+1) {
+			t.Errorf("log %d: wrong block number %d", i, log.BlockNumber)
+		}
+	}
+	// Cancelled queries return an error.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewRangeFilter(backend, 0, -1, []common.Address{replayTestAddr}, nil).Logs(ctx); err == nil {
+		t.Fatal("cancelled query succeeded")
+	}
+}
+
+func TestFilterLimit(t *testing.T) {
+	backend, _, _ := newReplayTestBackend(t)
+
+	filter := NewRangeFilter(backend, 0, -1, []common.Address{replayTestAddr}, nil)
+	filter.SetLimit(3)
+	logs, err := filter.Logs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("wrong number of logs: have %d, want 3", len(logs))
+	}
+	// The search continues after the last returned block.
+	if filter.begin != 4 {
+		t.Errorf("wrong filter start: have %d, want 4", filter.begin)
+	}
+}
+
+func TestFilterSizeLimit(t *testing.T) {
+	backend, _, _ := newReplayTestBackend(t)
+
+	filter := NewRangeFilter(backend, 0, -1, []common.Address{replayTestAddr}, nil)
+	filter.SetSizeLimit(1 << 20)
+	logs, err := filter.Logs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The estimate must not exceed the actual size.
+	enc, _ := json.Marshal(logs)
+	if filter.size > len(enc) {
+		t.Errorf("estimated size %d larger than encoded size %d", filter.size, len(enc))
+	}
+
+	filter = NewRangeFilter(backend, 0, -1, []common.Address{replayTestAddr}, nil)
+	filter.SetSizeLimit(len(enc) / 2)
+	if logs, err := filter.Logs(context.Background()); err != rpc.ErrResponseTooLarge {
+		t.Fatalf("wrong error: have %v, want %v", err, rpc.ErrResponseTooLarge)
+	} else if logs != nil {
+		t.Errorf("logs returned with error: %d", len(logs))
+	}
+}
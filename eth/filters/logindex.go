@@ -0,0 +1,142 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+)
+
+// constrained reports whether the filter restricts the addresses or any of the
+// topics, i.e. whether the log index can narrow down the blocks to check.
+func (f *Filter) constrained() bool {
+	if len(f.addresses) > 0 {
+		return true
+	}
+	for _, sub := range f.topics {
+		if len(sub) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// logIndexedLogs returns the logs matching the filter criteria based on the exact
+// address and topic index available locally.
+func (f *Filter) logIndexedLogs(ctx context.Context, size, end uint64) ([]*types.Log, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		begin   = uint64(f.begin)
+		numbers = make(chan uint64)
+	)
+	go func() {
+		defer close(numbers)
+		for section := begin / size; section*size <= end; section++ {
+			for _, offset := range f.logIndexMatches(section, size) {
+				number := section*size + offset
+				if number < begin || number > end {
+					continue
+				}
+				select {
+				case numbers <- number:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	logs, err := f.fetchLogs(ctx, numbers, f.checkMatches)
+	if err == nil {
+		f.begin = int64(end) + 1
+	}
+	return logs, err
+}
+
+// logIndexMatches returns the block offsets within a section that contain logs
+// matching the address constraint and every topic constraint of the filter.
+func (f *Filter) logIndexMatches(section, size uint64) []uint64 {
+	var (
+		head    = rawdb.ReadCanonicalHash(f.db, (section+1)*size-1)
+		matches []uint64
+		first   = true
+	)
+	restrict := func(position byte, values [][]byte) {
+		var union []uint64
+		for _, value := range values {
+			union = unionOffsets(union, rawdb.ReadLogIndex(f.db, position, value, section, head))
+		}
+		if first {
+			matches, first = union, false
+		} else {
+			matches = intersectOffsets(matches, union)
+		}
+	}
+	if len(f.addresses) > 0 {
+		values := make([][]byte, len(f.addresses))
+		for i, address := range f.addresses {
+			values[i] = address.Bytes()
+		}
+		restrict(rawdb.LogIndexAddress, values)
+	}
+	for i, sub := range f.topics {
+		if len(sub) == 0 {
+			continue
+		}
+		values := make([][]byte, len(sub))
+		for j, topic := range sub {
+			values[j] = topic.Bytes()
+		}
+		restrict(byte(i), values)
+	}
+	return matches
+}
+
+// unionOffsets merges two ascending lists of block offsets.
+func unionOffsets(a, b []uint64) []uint64 {
+	res := make([]uint64, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			res, a = append(res, a[0]), a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			res, b = append(res, b[0]), b[1:]
+		default:
+			res, a, b = append(res, a[0]), a[1:], b[1:]
+		}
+	}
+	return res
+}
+
+// intersectOffsets returns the block offsets contained in both ascending lists.
+func intersectOffsets(a, b []uint64) []uint64 {
+	var res []uint64
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case b[0] < a[0]:
+			b = b[1:]
+		default:
+			res, a, b = append(res, a[0]), a[1:], b[1:]
+		}
+	}
+	return res
+}
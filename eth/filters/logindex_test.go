@@ -0,0 +1,91 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/core/rawdb"
+)
+
+// logIndexTestBackend reports a number of log index sections of four blocks.
+type logIndexTestBackend struct {
+	*testBackend
+	sections uint64
+}
+
+func (b *logIndexTestBackend) LogIndexStatus() (uint64, uint64) {
+	return 4, b.sections
+}
+
+func TestFilterLogIndex(t *testing.T) {
+	backend, chain, _ := newReplayTestBackend(t)
+
+	// Index the first two sections, leaving out block 3 to tell indexed results
+	// apart from scanned ones.
+	db := backend.ChainDb()
+	rawdb.WriteLogIndex(db, rawdb.LogIndexAddress, replayTestAddr.Bytes(), 0, chain[2].Hash(), []uint64{1, 2})
+	rawdb.WriteLogIndex(db, rawdb.LogIndexAddress, replayTestAddr.Bytes(), 1, chain[6].Hash(), []uint64{0, 1, 2, 3})
+
+	tests := []struct {
+		sections   uint64
+		begin, end int64
+		addresses  []common.Address
+		want       []uint64
+	}{
+		{0, 0, -1, []common.Address{replayTestAddr}, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{2, 0, -1, []common.Address{replayTestAddr}, []uint64{1, 2, 4, 5, 6, 7, 8, 9, 10}},
+		{2, 2, 5, []common.Address{replayTestAddr}, []uint64{2, 4, 5}},
+		{1, 0, 5, []common.Address{replayTestAddr}, []uint64{1, 2, 4, 5}},
+		{2, 0, -1, []common.Address{{1}}, nil},
+		// Unconstrained filters can't use the index.
+		{2, 0, -1, nil, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+	}
+	for i, test := range tests {
+		filter := NewRangeFilter(&logIndexTestBackend{backend, test.sections}, test.begin, test.end, test.addresses, nil)
+		logs, err := filter.Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		var have []uint64
+		for _, log := range logs {
+			have = append(have, log.BlockNumber)
+		}
+		if fmt.Sprint(have) != fmt.Sprint(test.want) {
+			t.Errorf("test %d: block mismatch: have %v, want %v", i, have, test.want)
+		}
+	}
+}
+
+func TestLogIndexOffsets(t *testing.T) {
+	var (
+		a = []uint64{1, 3, 5, 7}
+		b = []uint64{2, 3, 7, 8}
+	)
+	if have := unionOffsets(a, b); fmt.Sprint(have) != "[1 2 3 5 7 8]" {
+		t.Errorf("union mismatch: have %v", have)
+	}
+	if have := intersectOffsets(a, b); fmt.Sprint(have) != "[3 7]" {
+		t.Errorf("intersection mismatch: have %v", have)
+	}
+	if have := intersectOffsets(a, nil); len(have) != 0 {
+		t.Errorf("intersection with empty list: have %v", have)
+	}
+}
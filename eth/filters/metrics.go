@@ -0,0 +1,29 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"github.com/groshproject/grosh-core/metrics"
+)
+
+var (
+	filterQueryTimer          = metrics.NewRegisteredTimer("eth/filters/logs/duration", nil)       // Time spent per range query
+	filterBlocksMeter         = metrics.NewRegisteredMeter("eth/filters/logs/blocks", nil)         // Blocks covered by range queries
+	filterCandidatesMeter     = metrics.NewRegisteredMeter("eth/filters/logs/candidates", nil)     // Blocks whose logs were retrieved
+	filterFalsePositivesMeter = metrics.NewRegisteredMeter("eth/filters/logs/falsepositives", nil) // Retrieved blocks without matching logs
+	filterResultsMeter        = metrics.NewRegisteredMeter("eth/filters/logs/results", nil)        // Matching logs returned
+)
@@ -0,0 +1,110 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/internal/ethapi"
+)
+
+// PendingTxCriteria restricts the transactions delivered by the pending and dropped
+// transaction subscriptions. Empty fields match all transactions, a transaction has
+// to match all given fields.
+type PendingTxCriteria struct {
+	From        []common.Address `json:"from"`        // sender is one of these
+	To          []common.Address `json:"to"`          // recipient is one of these, never matches contract creations
+	Selectors   []hexutil.Bytes  `json:"selectors"`   // input starts with one of these 4 byte method selectors
+	MinGasPrice *hexutil.Big     `json:"minGasPrice"` // gas price is at least this
+}
+
+// validate checks the criteria for malformed values.
+func (crit *PendingTxCriteria) validate() error {
+	for _, sel := range crit.Selectors {
+		if len(sel) != 4 {
+			return fmt.Errorf("invalid method selector %v, need 4 bytes", sel)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the transaction matches the criteria.
+func (crit *PendingTxCriteria) matches(tx *types.Transaction) bool {
+	if crit == nil {
+		return true
+	}
+	if crit.MinGasPrice != nil && tx.GasPrice().Cmp(crit.MinGasPrice.ToInt()) < 0 {
+		return false
+	}
+	if len(crit.To) > 0 && (tx.To() == nil || !includes(crit.To, *tx.To())) {
+		return false
+	}
+	if len(crit.Selectors) > 0 {
+		data, found := tx.Data(), false
+		for _, sel := range crit.Selectors {
+			if bytes.HasPrefix(data, sel) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	// Recovering the sender is the most expensive check, do it last.
+	if len(crit.From) > 0 && !includes(crit.From, txSender(tx)) {
+		return false
+	}
+	return true
+}
+
+// txSender returns the sender of a transaction. The transaction pool has already
+// validated the signature, so the sender is usually cached.
+func txSender(tx *types.Transaction) common.Address {
+	var signer types.Signer = types.FrontierSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, _ := types.Sender(signer, tx)
+	return from
+}
+
+// RPCDroppedTransaction is the notification sent for transactions dropped from the
+// transaction pool.
+type RPCDroppedTransaction struct {
+	Hash        common.Hash            `json:"hash"`
+	Reason      core.TxDropReason      `json:"reason"`
+	ReplacedBy  *common.Hash           `json:"replacedBy,omitempty"`
+	Transaction *ethapi.RPCTransaction `json:"transaction,omitempty"`
+}
+
+func newRPCDroppedTransaction(tx *types.Transaction, ev core.DroppedTxsEvent, fullTx bool) *RPCDroppedTransaction {
+	dropped := &RPCDroppedTransaction{Hash: tx.Hash(), Reason: ev.Reason}
+	if ev.Replacement != nil {
+		hash := ev.Replacement.Hash()
+		dropped.ReplacedBy = &hash
+	}
+	if fullTx {
+		dropped.Transaction = ethapi.NewRPCPendingTransaction(tx)
+	}
+	return dropped
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/event"
+	"github.com/groshproject/grosh-core/internal/ethapi"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+var (
+	pendingTestKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	pendingTestFrom   = crypto.PubkeyToAddress(pendingTestKey.PublicKey)
+	pendingTestTo     = common.HexToAddress("0x2222222222222222222222222222222222222222")
+)
+
+func pendingTestTx(t *testing.T, nonce uint64, to common.Address, gasPrice int64, data []byte) *types.Transaction {
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(0), 100000, big.NewInt(gasPrice), data), signer, pendingTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func newPendingTestClient(t *testing.T) (*testBackend, *rpc.Client) {
+	backend := &testBackend{new(event.TypeMux), rawdb.NewMemoryDatabase(), 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", NewPublicFilterAPI(backend, false)); err != nil {
+		t.Fatal(err)
+	}
+	return backend, rpc.DialInProc(server)
+}
+
+func TestPendingTxCriteria(t *testing.T) {
+	selector := hexutil.Bytes{0xa9, 0x05, 0x9c, 0xbb}
+	var (
+		match   = pendingTestTx(t, 0, pendingTestTo, 10, append(selector, 1, 2, 3))
+		lowGas  = pendingTestTx(t, 1, pendingTestTo, 9, append(selector, 1, 2, 3))
+		otherTo = pendingTestTx(t, 2, common.Address{1}, 10, append(selector, 1, 2, 3))
+		noSel   = pendingTestTx(t, 3, pendingTestTo, 10, []byte{0xa9, 0x05})
+		create  = types.NewContractCreation(4, big.NewInt(0), 100000, big.NewInt(10), nil)
+	)
+	tests := []struct {
+		crit *PendingTxCriteria
+		txs  []*types.Transaction
+		want []bool
+	}{
+		{nil, []*types.Transaction{match, lowGas, create}, []bool{true, true, true}},
+		{&PendingTxCriteria{}, []*types.Transaction{match, create}, []bool{true, true}},
+		{
+			&PendingTxCriteria{To: []common.Address{pendingTestTo}},
+			[]*types.Transaction{match, otherTo, create},
+			[]bool{true, false, false},
+		},
+		{
+			&PendingTxCriteria{Selectors: []hexutil.Bytes{selector}},
+			[]*types.Transaction{match, noSel},
+			[]bool{true, false},
+		},
+		{
+			&PendingTxCriteria{MinGasPrice: (*hexutil.Big)(big.NewInt(10))},
+			[]*types.Transaction{match, lowGas},
+			[]bool{true, false},
+		},
+		{
+			&PendingTxCriteria{From: []common.Address{pendingTestFrom}},
+			[]*types.Transaction{match},
+			[]bool{true},
+		},
+		{
+			&PendingTxCriteria{From: []common.Address{pendingTestTo}},
+			[]*types.Transaction{match},
+			[]bool{false},
+		},
+	}
+	for i, test := range tests {
+		for j, tx := range test.txs {
+			if have := test.crit.matches(tx); have != test.want[j] {
+				t.Errorf("test %d, tx %d: match mismatch: have %v, want %v", i, j, have, test.want[j])
+			}
+		}
+	}
+	if err := (&PendingTxCriteria{Selectors: []hexutil.Bytes{{1, 2, 3}}}).validate(); err == nil {
+		t.Error("short selector accepted")
+	}
+}
+
+func TestFullPendingTransactions(t *testing.T) {
+	backend, client := newPendingTestClient(t)
+	defer client.Close()
+
+	var (
+		txs = []*types.Transaction{
+			pendingTestTx(t, 0, pendingTestTo, 10, nil),
+			pendingTestTx(t, 1, common.Address{1}, 10, nil),
+			pendingTestTx(t, 2, pendingTestTo, 1, nil),
+		}
+		ch   = make(chan *ethapi.RPCTransaction, 10)
+		crit = map[string]interface{}{"to": []common.Address{pendingTestTo}, "minGasPrice": "0x5"}
+	)
+	sub, err := client.EthSubscribe(context.Background(), ch, "newPendingTransactions", true, crit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	backend.txFeed.Send(core.NewTxsEvent{Txs: txs})
+	select {
+	case tx := <-ch:
+		if tx.Hash != txs[0].Hash() || tx.From != pendingTestFrom || tx.Nonce != 0 {
+			t.Fatalf("wrong transaction: %+v", tx)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case tx := <-ch:
+		t.Fatalf("unexpected transaction %x", tx.Hash)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Without arguments, only hashes are sent.
+	hashes := make(chan common.Hash, 10)
+	sub2, err := client.EthSubscribe(context.Background(), hashes, "newPendingTransactions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub2.Unsubscribe()
+	backend.txFeed.Send(core.NewTxsEvent{Txs: txs[:1]})
+	select {
+	case hash := <-hashes:
+		if hash != txs[0].Hash() {
+			t.Fatalf("wrong hash %x", hash)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestDroppedTransactions(t *testing.T) {
+	backend, client := newPendingTestClient(t)
+	defer client.Close()
+
+	var (
+		old         = pendingTestTx(t, 0, pendingTestTo, 10, nil)
+		replacement = pendingTestTx(t, 0, pendingTestTo, 20, nil)
+		other       = pendingTestTx(t, 1, common.Address{1}, 10, nil)
+		ch          = make(chan *RPCDroppedTransaction, 10)
+	)
+	sub, err := client.EthSubscribe(context.Background(), ch, "droppedTransactions", true, map[string]interface{}{"to": []common.Address{pendingTestTo}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	backend.dropFeed.Send(core.DroppedTxsEvent{Txs: []*types.Transaction{other}, Reason: core.TxCapped})
+	backend.dropFeed.Send(core.DroppedTxsEvent{Txs: []*types.Transaction{old}, Reason: core.TxReplaced, Replacement: replacement})
+	select {
+	case dropped := <-ch:
+		if dropped.Hash != old.Hash() || dropped.Reason != core.TxReplaced {
+			t.Fatalf("wrong dropped transaction: %+v", dropped)
+		}
+		if dropped.ReplacedBy == nil || *dropped.ReplacedBy != replacement.Hash() {
+			t.Fatalf("wrong replacement: %v", dropped.ReplacedBy)
+		}
+		if dropped.Transaction == nil || dropped.Transaction.Hash != old.Hash() {
+			t.Fatalf("wrong transaction: %+v", dropped.Transaction)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case dropped := <-ch:
+		t.Fatalf("unexpected dropped transaction %x", dropped.Hash)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+const (
+	// replayChunkSize is the number of blocks searched at once while replaying
+	// historical logs.
+	replayChunkSize = 2048
+
+	// replayReorgWindow is how far below the head blocks delivered during replay are
+	// remembered. Reorgs deeper than this during a replay may lead to duplicate
+	// or missing removed logs.
+	replayReorgWindow = 1024
+
+	// maxCursorReorgDepth limits how far back the chain is walked to find the
+	// common ancestor of a resume cursor which is no longer canonical.
+	maxCursorReorgDepth = 1024
+)
+
+var (
+	// maxReplayBlocks is the largest block range a subscription may replay.
+	maxReplayBlocks uint64 = 100000
+
+	// maxReplayBufferedLogs is the number of live logs held back while a replay runs.
+	// The subscription is closed if more logs arrive before the replay is done.
+	maxReplayBufferedLogs = 10000
+
+	errReplayBufferFull = errors.New("too many live logs during replay")
+)
+
+// LogsCursor identifies the last block a logs subscriber has processed. It is
+// usually taken from the last log received.
+type LogsCursor struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+}
+
+// LogsCriteria are the arguments of a logs subscription. In addition to the filter
+// criteria, either a numeric fromBlock or a cursor may be given to replay historical
+// logs before live logs are delivered.
+type LogsCriteria struct {
+	FilterCriteria
+	Cursor *LogsCursor
+}
+
+// UnmarshalJSON sets *args fields with given data.
+func (args *LogsCriteria) UnmarshalJSON(data []byte) error {
+	if err := args.FilterCriteria.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	var raw struct {
+		Cursor *LogsCursor `json:"cursor"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Cursor != nil && (args.FromBlock != nil || args.BlockHash != nil) {
+		return errors.New("cannot specify both cursor and fromBlock/blockHash")
+	}
+	args.Cursor = raw.Cursor
+	return nil
+}
+
+// logsReplay delivers the historical logs of a subscription.
+type logsReplay struct {
+	backend   Backend
+	addresses []common.Address
+	topics    [][]common.Hash
+
+	cursor   bool         // whether the client has seen the blocks before the range
+	removed  []*types.Log // logs of reorged blocks the client has seen
+	from, to uint64       // block range to replay
+	head     uint64       // head block number when the live subscription started
+
+	delivered map[common.Hash]bool // blocks with logs delivered by the replay
+}
+
+// newLogsReplay checks whether the criteria request a replay of historical logs
+// and prepares it. It returns nil if there is nothing to replay. It must be called
+// after the live subscription is installed, so no blocks are missed.
+func newLogsReplay(ctx context.Context, backend Backend, crit LogsCriteria) (*logsReplay, error) {
+	fromCursor := crit.Cursor != nil
+	if !fromCursor && (crit.FromBlock == nil || crit.FromBlock.Sign() < 0) {
+		return nil, nil
+	}
+	header, err := backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, nil
+	}
+	r := &logsReplay{
+		backend:   backend,
+		cursor:    fromCursor,
+		addresses: crit.Addresses,
+		topics:    crit.Topics,
+		head:      header.Number.Uint64(),
+		to:        header.Number.Uint64(),
+		delivered: make(map[common.Hash]bool),
+	}
+	if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 && crit.ToBlock.Uint64() < r.to {
+		r.to = crit.ToBlock.Uint64()
+	}
+	if fromCursor {
+		if r.from, r.removed, err = r.rewindCursor(ctx, crit.Cursor); err != nil {
+			return nil, err
+		}
+	} else {
+		r.from = crit.FromBlock.Uint64()
+	}
+	if r.from <= r.to && r.to-r.from >= maxReplayBlocks {
+		return nil, fmt.Errorf("replay range exceeds %d blocks", maxReplayBlocks)
+	}
+	return r, nil
+}
+
+// rewindCursor finds the first block to replay after the cursor. If the cursor
+// block is no longer canonical, the logs of the reorged blocks are collected so
+// they can be delivered as removed.
+func (r *logsReplay) rewindCursor(ctx context.Context, cursor *LogsCursor) (uint64, []*types.Log, error) {
+	header, err := r.backend.HeaderByHash(ctx, cursor.BlockHash)
+	if err != nil {
+		return 0, nil, err
+	}
+	if header == nil {
+		return 0, nil, fmt.Errorf("unknown cursor block %x", cursor.BlockHash)
+	}
+	if header.Number.Uint64() != uint64(cursor.BlockNumber) {
+		return 0, nil, fmt.Errorf("cursor block %x has number %d, not %d", cursor.BlockHash, header.Number, uint64(cursor.BlockNumber))
+	}
+	var removed []*types.Log
+	for depth := 0; ; depth++ {
+		canon, err := r.backend.HeaderByNumber(ctx, rpc.BlockNumber(header.Number.Int64()))
+		if err != nil {
+			return 0, nil, err
+		}
+		if canon != nil && canon.Hash() == header.Hash() {
+			return header.Number.Uint64() + 1, removed, nil
+		}
+		if depth == maxCursorReorgDepth {
+			return 0, nil, errors.New("cursor block too far away from canonical chain")
+		}
+		// The block was reorged, the client needs to drop its logs.
+		logs, err := NewBlockFilter(r.backend, header.Hash(), r.addresses, r.topics).Logs(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		for i := len(logs) - 1; i >= 0; i-- {
+			rm := *logs[i]
+			rm.Removed = true
+			removed = append(removed, &rm)
+		}
+		if header, err = r.backend.HeaderByHash(ctx, header.ParentHash); err != nil {
+			return 0, nil, err
+		}
+		if header == nil {
+			return 0, nil, errors.New("missing ancestor of cursor block")
+		}
+	}
+}
+
+// run delivers the removed logs of a reorged cursor and the historical logs in the
+// replay range.
+func (r *logsReplay) run(ctx context.Context, send func(*types.Log)) error {
+	for _, log := range r.removed {
+		send(log)
+	}
+	for begin := r.from; begin <= r.to; begin += replayChunkSize {
+		end := begin + replayChunkSize - 1
+		if end > r.to {
+			end = r.to
+		}
+		logs, err := NewRangeFilter(r.backend, int64(begin), int64(end), r.addresses, r.topics).Logs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			if log.BlockNumber+replayReorgWindow > r.head {
+				r.delivered[log.BlockHash] = true
+			}
+			send(log)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterLive returns the live logs which arrived during the replay and weren't
+// covered by it. Logs of blocks delivered by the replay are skipped, removed logs are
+// only passed on for blocks the client has seen.
+func (r *logsReplay) filterLive(logs []*types.Log) []*types.Log {
+	var ret []*types.Log
+	for _, log := range logs {
+		seen := r.delivered[log.BlockHash] || (r.cursor && log.BlockNumber < r.from)
+		if log.Removed == seen {
+			if !log.Removed && log.BlockHash != (common.Hash{}) {
+				r.delivered[log.BlockHash] = true
+			}
+			ret = append(ret, log)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/consensus/ethash"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/event"
+	"github.com/groshproject/grosh-core/params"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+var replayTestAddr = common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+// newReplayTestBackend creates a backend with a canonical chain of ten blocks and a
+// side chain of two blocks forking off after block five. Every block contains one
+// log whose data is the block number, side chain logs have the number plus 100.
+func newReplayTestBackend(t *testing.T) (*testBackend, []*types.Block, []*types.Block) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{new(event.TypeMux), db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed)}
+		genesis = core.GenesisBlockForTesting(db, replayTestAddr, big.NewInt(1000000))
+	)
+	addLog := func(gen *core.BlockGen, data byte) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: replayTestAddr, Data: []byte{data}}}
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(data), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+	}
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {
+		addLog(gen, byte(i+1))
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	side, sideReceipts := core.GenerateChain(params.TestChainConfig, chain[4], ethash.NewFaker(), db, 2, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(common.Address{1})
+		addLog(gen, byte(i+106))
+	})
+	for i, block := range side {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), sideReceipts[i])
+	}
+	return backend, chain, side
+}
+
+// subscribeLogs subscribes to logs through an in-process RPC client.
+func subscribeLogs(t *testing.T, backend *testBackend, args map[string]interface{}) (chan types.Log, *rpc.ClientSubscription) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", NewPublicFilterAPI(backend, false)); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	logs := make(chan types.Log, 100)
+	sub, err := client.EthSubscribe(context.Background(), logs, "logs", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logs, sub
+}
+
+// expectLogs reads logs from the subscription and checks their data and removed flag.
+// Removed logs are given as negative numbers.
+func expectLogs(t *testing.T, logs chan types.Log, want ...int) {
+	t.Helper()
+	for i, w := range want {
+		select {
+		case log := <-logs:
+			got := int(log.Data[0])
+			if log.Removed {
+				got = -got
+			}
+			if got != w {
+				t.Fatalf("log %d: got %d, want %d", i, got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("log %d: timeout, want %d", i, w)
+		}
+	}
+	select {
+	case log := <-logs:
+		t.Fatalf("unexpected log %v", log)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLogsReplayFromBlock(t *testing.T) {
+	backend, _, _ := newReplayTestBackend(t)
+	logs, sub := subscribeLogs(t, backend, map[string]interface{}{"fromBlock": "0x7"})
+	defer sub.Unsubscribe()
+
+	expectLogs(t, logs, 7, 8, 9, 10)
+
+	// New logs are delivered after the replay.
+	backend.logsFeed.Send([]*types.Log{{Address: replayTestAddr, Topics: []common.Hash{}, Data: []byte{11}, BlockNumber: 11, BlockHash: common.Hash{11}}})
+	expectLogs(t, logs, 11)
+
+	// A replay limited by toBlock doesn't deliver anything beyond it.
+	logs, sub = subscribeLogs(t, backend, map[string]interface{}{"fromBlock": "0x2", "toBlock": "0x3"})
+	defer sub.Unsubscribe()
+	expectLogs(t, logs, 2, 3)
+}
+
+func TestLogsReplayCursor(t *testing.T) {
+	backend, chain, side := newReplayTestBackend(t)
+
+	// A canonical cursor resumes after the cursor block.
+	logs, sub := subscribeLogs(t, backend, map[string]interface{}{
+		"cursor": LogsCursor{BlockNumber: 8, BlockHash: chain[7].Hash()},
+	})
+	defer sub.Unsubscribe()
+	expectLogs(t, logs, 9, 10)
+
+	// A reorged cursor first removes the logs of the side chain blocks, then replays
+	// from the common ancestor.
+	logs, sub = subscribeLogs(t, backend, map[string]interface{}{
+		"cursor": LogsCursor{BlockNumber: 7, BlockHash: side[1].Hash()},
+	})
+	defer sub.Unsubscribe()
+	expectLogs(t, logs, -107, -106, 6, 7, 8, 9, 10)
+}
+
+func TestLogsReplayInvalidCursor(t *testing.T) {
+	backend, chain, _ := newReplayTestBackend(t)
+	server := rpc.NewServer()
+	server.RegisterName("eth", NewPublicFilterAPI(backend, false))
+	client := rpc.DialInProc(server)
+
+	tests := []map[string]interface{}{
+		{"cursor": LogsCursor{BlockNumber: 3, BlockHash: common.Hash{1}}},
+		{"cursor": LogsCursor{BlockNumber: 4, BlockHash: chain[2].Hash()}},
+		{"cursor": LogsCursor{BlockNumber: 3, BlockHash: chain[2].Hash()}, "fromBlock": "0x1"},
+	}
+	for i, args := range tests {
+		if _, err := client.EthSubscribe(context.Background(), make(chan types.Log), "logs", args); err == nil {
+			t.Errorf("test %d: expected error", i)
+		}
+	}
+}
+
+func TestLogsReplayRangeLimit(t *testing.T) {
+	defer func(old uint64) { maxReplayBlocks = old }(maxReplayBlocks)
+	maxReplayBlocks = 5
+
+	backend, chain, _ := newReplayTestBackend(t)
+	server := rpc.NewServer()
+	server.RegisterName("eth", NewPublicFilterAPI(backend, false))
+	client := rpc.DialInProc(server)
+
+	tests := []struct {
+		args map[string]interface{}
+		ok   bool
+	}{
+		{map[string]interface{}{"fromBlock": "0x6"}, true},
+		{map[string]interface{}{"fromBlock": "0x5"}, false},
+		{map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x4"}, true},
+		{map[string]interface{}{"cursor": LogsCursor{BlockNumber: 5, BlockHash: chain[4].Hash()}}, true},
+		{map[string]interface{}{"cursor": LogsCursor{BlockNumber: 4, BlockHash: chain[3].Hash()}}, false},
+	}
+	for i, test := range tests {
+		sub, err := client.EthSubscribe(context.Background(), make(chan types.Log, 10), "logs", test.args)
+		if test.ok && err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("test %d: expected error", i)
+		}
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+	}
+}
+
+func TestLogsReplayFilterLive(t *testing.T) {
+	var (
+		hash  = func(n byte) common.Hash { return common.Hash{n} }
+		mklog = func(n byte, removed bool) *types.Log {
+			return &types.Log{BlockNumber: uint64(n), BlockHash: hash(n), Removed: removed}
+		}
+		replay = &logsReplay{cursor: true, from: 5, to: 10, head: 10, delivered: map[common.Hash]bool{hash(9): true, hash(10): true}}
+	)
+	live := []*types.Log{
+		mklog(10, false), // delivered by replay
+		mklog(11, false), // new block
+		mklog(10, true),  // reorged after replay delivered it
+		mklog(11, true),  // reorged after being delivered live
+		mklog(8, true),   // not delivered, client doesn't know it
+		mklog(4, true),   // before the cursor, client knows it
+		mklog(12, true),  // never delivered
+	}
+	var got []string
+	for _, log := range replay.filterLive(live) {
+		got = append(got, fmt.Sprintf("%d/%v", log.BlockNumber, log.Removed))
+	}
+	want := []string{"11/false", "10/true", "11/true", "4/true"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("wrong live logs: got %v, want %v", got, want)
+	}
+}
+
+func TestUnmarshalLogsCriteria(t *testing.T) {
+	var crit LogsCriteria
+	if err := json.Unmarshal([]byte(`{"address":"0x1111111111111111111111111111111111111111","cursor":{"blockNumber":"0x5","blockHash":"0x0100000000000000000000000000000000000000000000000000000000000000"}}`), &crit); err != nil {
+		t.Fatal(err)
+	}
+	if crit.Cursor == nil || crit.Cursor.BlockNumber != hexutil.Uint64(5) || crit.Cursor.BlockHash != (common.Hash{1}) {
+		t.Fatalf("wrong cursor %+v", crit.Cursor)
+	}
+	if len(crit.Addresses) != 1 || crit.Addresses[0] != replayTestAddr {
+		t.Fatalf("wrong addresses %v", crit.Addresses)
+	}
+	if err := json.Unmarshal([]byte(`{"blockHash":"0x0100000000000000000000000000000000000000000000000000000000000000","cursor":{"blockNumber":"0x5","blockHash":"0x0100000000000000000000000000000000000000000000000000000000000000"}}`), &crit); err == nil {
+		t.Fatal("expected error for cursor with blockHash")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+// maxFeeHistoryWorkers is the number of blocks processed concurrently by a fee
+// history query.
+const maxFeeHistoryWorkers = 4
+
+// blockFees holds the fee history data of a single block.
+type blockFees struct {
+	number       uint64
+	reward       []*big.Int
+	gasUsedRatio float64
+	err          error
+}
+
+// FeeHistory returns the gas used ratio and the gas prices at the given percentiles
+// of the blocks in a range ending with lastBlock. The percentiles are weighted by
+// the gas used by the transactions, so the price at 50 is the one paid by the
+// transaction spending the median unit of gas in the block. The pending block is
+// not served, requests for it end with the latest block.
+//
+// The number of returned blocks can be lower than requested if the range reaches
+// the genesis block or exceeds the configured history limit. The first result is
+// the number of the oldest block returned.
+func (gpo *Oracle) FeeHistory(ctx context.Context, blocks int, lastBlock rpc.BlockNumber, percentiles []float64) (*big.Int, [][]*big.Int, []float64, error) {
+	if blocks < 1 {
+		return new(big.Int), nil, nil, nil
+	}
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, nil, nil, fmt.Errorf("invalid reward percentile %f", p)
+		}
+		if i > 0 && p < percentiles[i-1] {
+			return nil, nil, nil, fmt.Errorf("reward percentiles not ascending: #%d:%f > #%d:%f", i-1, percentiles[i-1], i, p)
+		}
+	}
+	if blocks > gpo.maxHistory {
+		blocks = gpo.maxHistory
+	}
+	// Resolve the newest block of the range.
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	last := head.Number.Uint64()
+	if lastBlock >= 0 {
+		if uint64(lastBlock) > last {
+			return nil, nil, nil, fmt.Errorf("request beyond head block: requested %d, head %d", lastBlock, last)
+		}
+		last = uint64(lastBlock)
+	}
+	if uint64(blocks) > last+1 {
+		blocks = int(last + 1)
+	}
+	oldest := last + 1 - uint64(blocks)
+
+	// Process the blocks concurrently, collecting the results in order.
+	var (
+		next    = make(chan uint64, blocks)
+		results = make(chan *blockFees, blocks)
+	)
+	for number := oldest; number <= last; number++ {
+		next <- number
+	}
+	close(next)
+
+	workers := maxFeeHistoryWorkers
+	if workers > blocks {
+		workers = blocks
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for number := range next {
+				results <- gpo.blockFees(ctx, number, percentiles)
+			}
+		}()
+	}
+	var (
+		reward       = make([][]*big.Int, blocks)
+		gasUsedRatio = make([]float64, blocks)
+	)
+	for i := 0; i < blocks; i++ {
+		fees := <-results
+		if fees.err != nil {
+			return nil, nil, nil, fees.err
+		}
+		reward[fees.number-oldest] = fees.reward
+		gasUsedRatio[fees.number-oldest] = fees.gasUsedRatio
+	}
+	if len(percentiles) == 0 {
+		reward = nil
+	}
+	return new(big.Int).SetUint64(oldest), reward, gasUsedRatio, nil
+}
+
+// blockFees retrieves and processes the fee history data of a single block.
+func (gpo *Oracle) blockFees(ctx context.Context, number uint64, percentiles []float64) *blockFees {
+	fees := &blockFees{number: number}
+	if len(percentiles) == 0 {
+		// Only the gas used ratio is needed, the header is enough.
+		header, err := gpo.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if header == nil {
+			fees.err = errMissingBlock(number, err)
+			return fees
+		}
+		fees.gasUsedRatio = float64(header.GasUsed) / float64(header.GasLimit)
+		return fees
+	}
+	block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+	if block == nil {
+		fees.err = errMissingBlock(number, err)
+		return fees
+	}
+	fees.gasUsedRatio = float64(block.GasUsed()) / float64(block.GasLimit())
+
+	fees.reward = make([]*big.Int, len(percentiles))
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		for i := range fees.reward {
+			fees.reward[i] = new(big.Int)
+		}
+		return fees
+	}
+	receipts, err := gpo.backend.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		fees.err = err
+		return fees
+	}
+	if len(receipts) != len(txs) {
+		fees.err = fmt.Errorf("receipts of block %d missing", number)
+		return fees
+	}
+	// Transactions of the miner are skipped, it can include its own transactions at
+	// any price.
+	var (
+		signer  = types.MakeSigner(gpo.backend.ChainConfig(), block.Number())
+		sorted  = make([]txGasAndPrice, 0, len(txs))
+		gasUsed uint64
+	)
+	for i, tx := range txs {
+		if sender, err := types.Sender(signer, tx); err == nil && sender == block.Coinbase() {
+			continue
+		}
+		sorted = append(sorted, txGasAndPrice{receipts[i].GasUsed, tx.GasPrice()})
+		gasUsed += receipts[i].GasUsed
+	}
+	if len(sorted) == 0 {
+		for i := range fees.reward {
+			fees.reward[i] = new(big.Int)
+		}
+		return fees
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].price.Cmp(sorted[j].price) < 0 })
+
+	var (
+		index   int
+		sumUsed = sorted[0].gasUsed
+	)
+	for i, p := range percentiles {
+		threshold := uint64(float64(gasUsed) * p / 100)
+		for sumUsed < threshold && index < len(sorted)-1 {
+			index++
+			sumUsed += sorted[index].gasUsed
+		}
+		fees.reward[i] = new(big.Int).Set(sorted[index].price)
+	}
+	return fees
+}
+
+// txGasAndPrice is the gas used and the gas price of a transaction.
+type txGasAndPrice struct {
+	gasUsed uint64
+	price   *big.Int
+}
+
+func errMissingBlock(number uint64, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("block %d not found", number)
+}
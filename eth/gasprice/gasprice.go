@@ -18,11 +18,14 @@ package gasprice
 
 import (
 	"context"
+	"math"
 	"math/big"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/mclock"
 	"github.com/groshproject/grosh-core/core/types"
 	"github.com/groshproject/grosh-core/internal/ethapi"
 	"github.com/groshproject/grosh-core/params"
@@ -34,9 +37,18 @@ var maxPrice = big.NewInt(500 * params.GWei)
 type Config struct {
 	Blocks     int
 	Percentile int
+	HalfLife   int      // age in blocks at which a block's price counts half, zero weights all blocks equally
+	MaxHistory int      // maximum number of blocks served by a single fee history query
 	Default    *big.Int `toml:",omitempty"`
 }
 
+// DefaultMaxHistory is the fee history limit used when none is configured.
+const DefaultMaxHistory = 1024
+
+// poolPriceTTL is the time for which the price derived from the transaction pool
+// is reused as long as the head doesn't change.
+const poolPriceTTL = 2 * time.Second
+
 // Oracle recommends gas prices based on the content of recent
 // blocks. Suitable for both light and full clients.
 type Oracle struct {
@@ -46,8 +58,16 @@ type Oracle struct {
 	cacheLock sync.RWMutex
 	fetchLock sync.Mutex
 
+	poolLock  sync.Mutex
+	poolHead  common.Hash
+	poolTime  mclock.AbsTime
+	poolPrice *big.Int
+	clock     mclock.Clock
+
 	checkBlocks, maxEmpty, maxBlocks int
 	percentile                       int
+	halfLife                         int
+	maxHistory                       int
 }
 
 // NewOracle returns a new oracle.
@@ -63,6 +83,14 @@ func NewOracle(backend ethapi.Backend, params Config) *Oracle {
 	if percent > 100 {
 		percent = 100
 	}
+	halfLife := params.HalfLife
+	if halfLife < 0 {
+		halfLife = 0
+	}
+	maxHistory := params.MaxHistory
+	if maxHistory < 1 {
+		maxHistory = DefaultMaxHistory
+	}
 	return &Oracle{
 		backend:     backend,
 		lastPrice:   params.Default,
@@ -70,17 +98,43 @@ func NewOracle(backend ethapi.Backend, params Config) *Oracle {
 		maxEmpty:    blocks / 2,
 		maxBlocks:   blocks * 5,
 		percentile:  percent,
+		halfLife:    halfLife,
+		maxHistory:  maxHistory,
+		clock:       mclock.System{},
 	}
 }
 
-// SuggestPrice returns the recommended gas price.
+// SuggestPrice returns the recommended gas price. It is the configured percentile
+// of the lowest prices paid in recent blocks, ignoring the transactions of the
+// miners themselves. All blocks are weighted equally unless a half-life is
+// configured, which weights recent blocks more heavily. If the transaction pool
+// holds more than a block worth of transactions, the suggestion is raised to the
+// price needed to make it into the next block.
 func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	price, err := gpo.historyPrice(ctx, head)
+	if err != nil {
+		return price, err
+	}
+	// The pool changes between blocks, so its price is only cached briefly instead
+	// of along with the price of the recent blocks.
+	if pending := gpo.cachedPendingPrice(head); pending != nil && (price == nil || pending.Cmp(price) > 0) {
+		price = pending
+	}
+	if price != nil && price.Cmp(maxPrice) > 0 {
+		price = new(big.Int).Set(maxPrice)
+	}
+	return price, nil
+}
+
+// historyPrice returns the price suggested by the blocks preceding the given head,
+// caching it until the head changes.
+func (gpo *Oracle) historyPrice(ctx context.Context, head *types.Header) (*big.Int, error) {
 	gpo.cacheLock.RLock()
 	lastHead := gpo.lastHead
 	lastPrice := gpo.lastPrice
 	gpo.cacheLock.RUnlock()
 
-	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	headHash := head.Hash()
 	if headHash == lastHead {
 		return lastPrice, nil
@@ -102,7 +156,7 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	ch := make(chan getBlockPricesResult, gpo.checkBlocks)
 	sent := 0
 	exp := 0
-	var blockPrices []*big.Int
+	var blockPrices []weightedPrice
 	for sent < gpo.checkBlocks && blockNum > 0 {
 		go gpo.getBlockPrices(ctx, types.MakeSigner(gpo.backend.ChainConfig(), big.NewInt(int64(blockNum))), blockNum, ch)
 		sent++
@@ -117,7 +171,7 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 		}
 		exp--
 		if res.price != nil {
-			blockPrices = append(blockPrices, res.price)
+			blockPrices = append(blockPrices, weightedPrice{res.price, gpo.weight(head.Number.Uint64() - res.number)})
 			continue
 		}
 		if maxEmpty > 0 {
@@ -133,11 +187,7 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	}
 	price := lastPrice
 	if len(blockPrices) > 0 {
-		sort.Sort(bigIntArray(blockPrices))
-		price = blockPrices[(len(blockPrices)-1)*gpo.percentile/100]
-	}
-	if price.Cmp(maxPrice) > 0 {
-		price = new(big.Int).Set(maxPrice)
+		price = weightedPercentile(blockPrices, gpo.percentile)
 	}
 
 	gpo.cacheLock.Lock()
@@ -148,8 +198,9 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 }
 
 type getBlockPricesResult struct {
-	price *big.Int
-	err   error
+	number uint64
+	price  *big.Int
+	err    error
 }
 
 type transactionsByGasPrice []*types.Transaction
@@ -163,7 +214,7 @@ func (t transactionsByGasPrice) Less(i, j int) bool { return t[i].GasPrice().Cmp
 func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, blockNum uint64, ch chan getBlockPricesResult) {
 	block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
 	if block == nil {
-		ch <- getBlockPricesResult{nil, err}
+		ch <- getBlockPricesResult{blockNum, nil, err}
 		return
 	}
 
@@ -175,15 +226,80 @@ func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, bloc
 	for _, tx := range txs {
 		sender, err := types.Sender(signer, tx)
 		if err == nil && sender != block.Coinbase() {
-			ch <- getBlockPricesResult{tx.GasPrice(), nil}
+			ch <- getBlockPricesResult{blockNum, tx.GasPrice(), nil}
 			return
 		}
 	}
-	ch <- getBlockPricesResult{nil, nil}
+	ch <- getBlockPricesResult{blockNum, nil, nil}
 }
 
-type bigIntArray []*big.Int
+// weightedPrice is a price sample along with its weight.
+type weightedPrice struct {
+	price  *big.Int
+	weight float64
+}
 
-func (s bigIntArray) Len() int           { return len(s) }
-func (s bigIntArray) Less(i, j int) bool { return s[i].Cmp(s[j]) < 0 }
-func (s bigIntArray) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+// weight returns the weight of the price of a block with the given distance from
+// the head, halving with every half-life.
+func (gpo *Oracle) weight(age uint64) float64 {
+	if gpo.halfLife == 0 {
+		return 1
+	}
+	return math.Exp2(-float64(age) / float64(gpo.halfLife))
+}
+
+// weightedPercentile returns the lowest price such that the samples priced up to
+// it make up at least the given percentage of the total weight.
+func weightedPercentile(samples []weightedPrice, percentile int) *big.Int {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].price.Cmp(samples[j].price) < 0 })
+
+	var total float64
+	for _, s := range samples {
+		total += s.weight
+	}
+	var (
+		threshold = total * float64(percentile) / 100
+		sum       float64
+	)
+	for _, s := range samples {
+		if sum += s.weight; sum >= threshold {
+			return s.price
+		}
+	}
+	return samples[len(samples)-1].price
+}
+
+// cachedPendingPrice returns the pool price for the block after the given head. It
+// is recomputed when the head changes or the cached price is older than poolPriceTTL.
+func (gpo *Oracle) cachedPendingPrice(head *types.Header) *big.Int {
+	gpo.poolLock.Lock()
+	defer gpo.poolLock.Unlock()
+
+	now := gpo.clock.Now()
+	if hash := head.Hash(); hash != gpo.poolHead || time.Duration(now-gpo.poolTime) >= poolPriceTTL {
+		gpo.poolHead, gpo.poolTime = hash, now
+		gpo.poolPrice = gpo.pendingPrice(head.GasLimit)
+	}
+	return gpo.poolPrice
+}
+
+// pendingPrice returns the lowest price among the transaction pool's most
+// profitable transactions filling a block of the given gas limit. If the pool
+// can't fill a block, any price makes it in and nil is returned.
+func (gpo *Oracle) pendingPrice(gasLimit uint64) *big.Int {
+	txs, err := gpo.backend.GetPoolTransactions()
+	if err != nil || len(txs) == 0 {
+		return nil
+	}
+	sorted := make([]*types.Transaction, len(txs))
+	copy(sorted, txs)
+	sort.Sort(sort.Reverse(transactionsByGasPrice(sorted)))
+
+	var gas uint64
+	for _, tx := range sorted {
+		if gas += tx.Gas(); gas > gasLimit {
+			return tx.GasPrice()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/mclock"
+	"github.com/groshproject/grosh-core/consensus/ethash"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/core/vm"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/internal/ethapi"
+	"github.com/groshproject/grosh-core/params"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+var (
+	senderKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	senderAddr   = crypto.PubkeyToAddress(senderKey.PublicKey)
+	minerKey, _  = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	minerAddr    = crypto.PubkeyToAddress(minerKey.PublicKey)
+)
+
+// testBackend serves the oracle from an in-memory chain. Only the methods used
+// by the oracle are implemented.
+type testBackend struct {
+	ethapi.Backend
+	chain *core.BlockChain
+	pool  types.Transactions
+}
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber {
+		return b.chain.CurrentBlock().Header(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.LatestBlockNumber {
+		return b.chain.CurrentBlock(), nil
+	}
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+
+func (b *testBackend) ChainConfig() *params.ChainConfig {
+	return b.chain.Config()
+}
+
+func (b *testBackend) GetPoolTransactions() (types.Transactions, error) {
+	return b.pool, nil
+}
+
+// newTestBackend creates a chain of 32 blocks. Block i contains a transaction
+// paying i gwei and one of the miner paying a single wei.
+func newTestBackend(t *testing.T) *testBackend {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		config = params.AllEthashProtocolChanges
+		gspec  = &core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				senderAddr: {Balance: big.NewInt(params.Ether)},
+				minerAddr:  {Balance: big.NewInt(params.Ether)},
+			},
+		}
+		signer = types.HomesteadSigner{}
+	)
+	genesis := gspec.MustCommit(db)
+	blocks, _ := core.GenerateChain(config, genesis, ethash.NewFaker(), db, 32, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(minerAddr)
+
+		price := new(big.Int).Mul(big.NewInt(int64(i+1)), big.NewInt(params.GWei))
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(senderAddr), common.Address{0xaa}, common.Big1, params.TxGas, price, nil), signer, senderKey)
+		b.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(b.TxNonce(minerAddr), common.Address{0xaa}, common.Big1, params.TxGas, common.Big1, nil), signer, minerKey)
+		b.AddTx(tx)
+	})
+	chain, err := core.NewBlockChain(db, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("can't create blockchain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("can't import test blocks: %v", err)
+	}
+	return &testBackend{chain: chain}
+}
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.GWei))
+}
+
+func TestSuggestPrice(t *testing.T) {
+	backend := newTestBackend(t)
+	gasLimit := backend.chain.CurrentBlock().GasLimit()
+
+	tests := []struct {
+		halfLife int
+		pool     []int64 // gas prices of pool transactions, each using half a block
+		want     *big.Int
+	}{
+		// Equal weights: the 60th percentile of the prices of blocks 13-32.
+		{halfLife: 0, want: gwei(24)},
+		// Recent blocks dominate.
+		{halfLife: 1, want: gwei(32)},
+		// The pool fills the next block with higher prices.
+		{halfLife: 0, pool: []int64{70, 50, 60}, want: gwei(60)},
+		// The pool can't fill a block, it doesn't affect the price.
+		{halfLife: 0, pool: []int64{70}, want: gwei(24)},
+		// The pool fills the next block with lower prices.
+		{halfLife: 0, pool: []int64{10, 10, 10}, want: gwei(24)},
+	}
+	for i, test := range tests {
+		backend.pool = nil
+		for _, price := range test.pool {
+			backend.pool = append(backend.pool, types.NewTransaction(0, common.Address{}, nil, gasLimit/2+1, gwei(price), nil))
+		}
+		oracle := NewOracle(backend, Config{Blocks: 20, Percentile: 60, HalfLife: test.halfLife, Default: big.NewInt(1)})
+		price, err := oracle.SuggestPrice(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if price.Cmp(test.want) != 0 {
+			t.Errorf("test %d: price mismatch: have %v, want %v", i, price, test.want)
+		}
+	}
+}
+
+func TestSuggestPricePoolChange(t *testing.T) {
+	backend := newTestBackend(t)
+	gasLimit := backend.chain.CurrentBlock().GasLimit()
+	oracle := NewOracle(backend, Config{Blocks: 20, Percentile: 60, Default: big.NewInt(1)})
+	clock := new(mclock.Simulated)
+	oracle.clock = clock
+
+	for i, want := range []*big.Int{gwei(24), gwei(24), gwei(60), gwei(24)} {
+		// The pool fills the next block from the second query on, but the pool
+		// price is only recomputed once the cached one has expired. The head is
+		// the same for all queries.
+		backend.pool = nil
+		if i == 1 || i == 2 {
+			for _, price := range []int64{70, 50, 60} {
+				backend.pool = append(backend.pool, types.NewTransaction(0, common.Address{}, nil, gasLimit/2+1, gwei(price), nil))
+			}
+		}
+		if i >= 2 {
+			clock.Run(poolPriceTTL)
+		}
+		price, err := oracle.SuggestPrice(context.Background())
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		if price.Cmp(want) != 0 {
+			t.Errorf("query %d: price mismatch: have %v, want %v", i, price, want)
+		}
+	}
+}
+
+func TestFeeHistory(t *testing.T) {
+	backend := newTestBackend(t)
+	ratio := float64(2*params.TxGas) / float64(backend.chain.GetHeaderByNumber(10).GasLimit)
+
+	tests := []struct {
+		maxHistory  int
+		count       int
+		last        rpc.BlockNumber
+		percentiles []float64
+		oldest      uint64
+		blocks      int
+		err         bool
+	}{
+		{count: 4, last: 10, percentiles: []float64{0, 75, 100}, oldest: 7, blocks: 4},
+		{count: 4, last: rpc.LatestBlockNumber, oldest: 29, blocks: 4},
+		{count: 4, last: rpc.PendingBlockNumber, oldest: 29, blocks: 4},
+		{count: 100, last: 10, oldest: 0, blocks: 11},
+		{maxHistory: 3, count: 10, last: 10, oldest: 8, blocks: 3},
+		{count: 0, last: 10},
+		{count: 1, last: 33, err: true},
+		{count: 1, last: 10, percentiles: []float64{101}, err: true},
+		{count: 1, last: 10, percentiles: []float64{50, 10}, err: true},
+	}
+	for i, test := range tests {
+		oracle := NewOracle(backend, Config{Blocks: 20, Percentile: 60, MaxHistory: test.maxHistory})
+		oldest, reward, gasUsedRatio, err := oracle.FeeHistory(context.Background(), test.count, test.last, test.percentiles)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if oldest.Uint64() != test.oldest {
+			t.Errorf("test %d: oldest block mismatch: have %v, want %d", i, oldest, test.oldest)
+		}
+		if len(gasUsedRatio) != test.blocks {
+			t.Errorf("test %d: history length mismatch: have %d, want %d", i, len(gasUsedRatio), test.blocks)
+		}
+		if len(test.percentiles) == 0 {
+			if reward != nil {
+				t.Errorf("test %d: unexpected rewards: %v", i, reward)
+			}
+			continue
+		}
+		for j := range gasUsedRatio {
+			number := int64(test.oldest) + int64(j)
+			if gasUsedRatio[j] != ratio {
+				t.Errorf("test %d, block %d: gas used ratio mismatch: have %f, want %f", i, number, gasUsedRatio[j], ratio)
+			}
+			// The transaction of the miner is ignored.
+			want := fmt.Sprint([]*big.Int{gwei(number), gwei(number), gwei(number)})
+			if have := fmt.Sprint(reward[j]); have != want {
+				t.Errorf("test %d, block %d: reward mismatch: have %v, want %v", i, number, have, want)
+			}
+		}
+	}
+}
@@ -41,6 +41,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Miner                   miner.Config
 		Ethash                  ethash.Config
 		TxPool                  core.TxPoolConfig
+		Bloom                   BloomConfig
+		LogIndex                bool
 		GPO                     gasprice.Config
 		EnablePreimageRecording bool
 		DocRoot                 string `toml:"-"`
@@ -74,6 +76,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Miner = c.Miner
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
+	enc.Bloom = c.Bloom
+	enc.LogIndex = c.LogIndex
 	enc.GPO = c.GPO
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
 	enc.DocRoot = c.DocRoot
@@ -111,6 +115,8 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Miner                   *miner.Config
 		Ethash                  *ethash.Config
 		TxPool                  *core.TxPoolConfig
+		Bloom                   *BloomConfig
+		LogIndex                *bool
 		GPO                     *gasprice.Config
 		EnablePreimageRecording *bool
 		DocRoot                 *string `toml:"-"`
@@ -193,6 +199,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TxPool != nil {
 		c.TxPool = *dec.TxPool
 	}
+	if dec.Bloom != nil {
+		c.Bloom = *dec.Bloom
+	}
+	if dec.LogIndex != nil {
+		c.LogIndex = *dec.LogIndex
+	}
 	if dec.GPO != nil {
 		c.GPO = *dec.GPO
 	}
@@ -58,8 +58,18 @@ var (
 	syncChallengeTimeout = 15 * time.Second // Time allowance for a node to reply to the sync progress challenge
 )
 
+// protocolError is returned for messages which violate the protocol.
+type protocolError struct {
+	code errCode
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return fmt.Sprintf("%v - %v", e.code, e.msg)
+}
+
 func errResp(code errCode, format string, v ...interface{}) error {
-	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+	return &protocolError{code, fmt.Sprintf(format, v...)}
 }
 
 type ProtocolManager struct {
@@ -149,7 +159,7 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 	if atomic.LoadUint32(&manager.fastSync) == 1 {
 		stateBloom = trie.NewSyncBloom(uint64(cacheLimit), chaindb)
 	}
-	manager.downloader = downloader.New(manager.checkpointNumber, chaindb, stateBloom, manager.eventMux, blockchain, nil, manager.removePeer)
+	manager.downloader = downloader.New(manager.checkpointNumber, chaindb, stateBloom, manager.eventMux, blockchain, nil, manager.dropPeer)
 
 	// Construct the fetcher (short sync)
 	validator := func(header *types.Header) error {
@@ -184,7 +194,7 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 		}
 		return n, err
 	}
-	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
+	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.dropPeer)
 
 	return manager, nil
 }
@@ -222,6 +232,14 @@ func (pm *ProtocolManager) makeProtocol(version uint) p2p.Protocol {
 	}
 }
 
+// dropPeer lowers the reputation score of a misbehaving peer and disconnects it.
+func (pm *ProtocolManager) dropPeer(id string) {
+	if peer := pm.peers.Peer(id); peer != nil {
+		peer.Report(p2p.ScoreBad)
+	}
+	pm.removePeer(id)
+}
+
 func (pm *ProtocolManager) removePeer(id string) {
 	// Short circuit if the peer was already removed
 	peer := pm.peers.Peer(id)
@@ -306,6 +324,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	)
 	if err := p.Handshake(pm.networkID, td, hash, genesis.Hash()); err != nil {
 		p.Log().Debug("Grosh handshake failed", "err", err)
+		p.Report(p2p.ScoreBad)
 		return err
 	}
 	if rw, ok := p.rw.(*meteredMsgReadWriter); ok {
@@ -335,7 +354,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		// Start a timer to disconnect if the peer doesn't reply in time
 		p.syncDrop = time.AfterFunc(syncChallengeTimeout, func() {
 			p.Log().Warn("Checkpoint challenge timed out, dropping", "addr", p.RemoteAddr(), "type", p.Name())
-			pm.removePeer(p.id)
+			pm.dropPeer(p.id)
 		})
 		// Make sure it's cleaned up if the peer dies off
 		defer func() {
@@ -355,6 +374,9 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	for {
 		if err := pm.handleMsg(p); err != nil {
 			p.Log().Debug("Grosh message handling failed", "err", err)
+			if _, ok := err.(*protocolError); ok {
+				p.Report(p2p.ScoreInvalid)
+			}
 			return err
 		}
 	}
@@ -517,6 +539,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			err := pm.downloader.DeliverHeaders(p.id, headers)
 			if err != nil {
 				log.Debug("Failed to deliver headers", "err", err)
+			} else if len(headers) > 0 {
+				p.Report(p2p.ScoreGood)
 			}
 		}
 
@@ -570,6 +594,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			err := pm.downloader.DeliverBodies(p.id, transactions, uncles)
 			if err != nil {
 				log.Debug("Failed to deliver bodies", "err", err)
+			} else if len(transactions) > 0 {
+				p.Report(p2p.ScoreGood)
 			}
 		}
 
@@ -609,6 +635,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Deliver all to the downloader
 		if err := pm.downloader.DeliverNodeData(p.id, data); err != nil {
 			log.Debug("Failed to deliver node state data", "err", err)
+		} else if len(data) > 0 {
+			p.Report(p2p.ScoreGood)
 		}
 
 	case p.version >= eth63 && msg.Code == GetReceiptsMsg:
@@ -656,6 +684,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Deliver all to the downloader
 		if err := pm.downloader.DeliverReceipts(p.id, receipts); err != nil {
 			log.Debug("Failed to deliver receipts", "err", err)
+		} else if len(receipts) > 0 {
+			p.Report(p2p.ScoreGood)
 		}
 
 	case msg.Code == NewBlockHashesMsg:
@@ -829,6 +859,7 @@ type NodeInfo struct {
 	Genesis    common.Hash         `json:"genesis"`    // SHA3 hash of the host's genesis block
 	Config     *params.ChainConfig `json:"config"`     // Chain configuration for the fork rules
 	Head       common.Hash         `json:"head"`       // SHA3 hash of the host's best owned block
+	ENR        *ethEntryInfo       `json:"enr"`        // Contents of the eth ENR entry
 }
 
 // NodeInfo retrieves some protocol metadata about the running host node.
@@ -840,5 +871,6 @@ func (pm *ProtocolManager) NodeInfo() *NodeInfo {
 		Genesis:    pm.blockchain.Genesis().Hash(),
 		Config:     pm.blockchain.Config(),
 		Head:       currentBlock.Hash(),
+		ENR:        currentEthEntry(pm.blockchain).info(),
 	}
 }
@@ -0,0 +1,141 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/grodb"
+)
+
+const (
+	// logIndexThrottling is the time to wait between processing two consecutive
+	// log index sections.
+	logIndexThrottling = 100 * time.Millisecond
+)
+
+// logIndexEntry identifies a single postings list of a log index section.
+type logIndexEntry struct {
+	position byte   // rawdb.LogIndexAddress or the topic index
+	value    string // address or topic bytes
+}
+
+// LogIndexer implements a core.ChainIndexer, building up an exact index from log
+// addresses and topics to the blocks containing them.
+//
+// Postings lists are keyed by the section head just like the bloombits, so data
+// of a section rolled back by a reorg is never read again and is overwritten when
+// the section is reprocessed. Receipts are read through the ancient-aware database
+// accessors, so sections below the freezer boundary are indexed the same way as
+// recent ones.
+type LogIndexer struct {
+	size     uint64                     // section size to generate the index for
+	db       grodb.Database             // database instance to read receipts from and write index data into
+	section  uint64                     // Section is the section number being processed currently
+	head     common.Hash                // Head is the hash of the last header processed
+	postings map[logIndexEntry][]uint64 // Block offsets collected for the current section
+}
+
+// NewLogIndexer returns a chain indexer that generates an address and topic index
+// of the logs in the canonical chain for exact log filtering.
+func NewLogIndexer(db grodb.Database, size, confirms uint64) *core.ChainIndexer {
+	backend := &LogIndexer{
+		db:   db,
+		size: size,
+	}
+	table := rawdb.NewTable(db, string(rawdb.LogIndexPrefix))
+
+	return core.NewChainIndexer(db, table, backend, size, confirms, logIndexThrottling, "logindex")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new log index section.
+func (l *LogIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	l.section, l.head = section, common.Hash{}
+	l.postings = make(map[logIndexEntry][]uint64)
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, adding the logs of a new header
+// into the index.
+func (l *LogIndexer) Process(ctx context.Context, header *types.Header) error {
+	var (
+		hash   = header.Hash()
+		number = header.Number.Uint64()
+	)
+	l.head = hash
+	if header.Bloom == (types.Bloom{}) {
+		return nil
+	}
+	receipts := rawdb.ReadRawReceipts(l.db, hash, number)
+	if receipts == nil {
+		return fmt.Errorf("missing receipts for block #%d [%x]", number, hash)
+	}
+	offset := number - l.section*l.size
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			l.add(logIndexEntry{rawdb.LogIndexAddress, string(log.Address.Bytes())}, offset)
+			for i, topic := range log.Topics {
+				l.add(logIndexEntry{byte(i), string(topic.Bytes())}, offset)
+			}
+		}
+	}
+	return nil
+}
+
+// add appends a block offset to a postings list unless it's already there. Blocks
+// are processed in order, so only the last offset needs to be checked.
+func (l *LogIndexer) add(entry logIndexEntry, offset uint64) {
+	offsets := l.postings[entry]
+	if n := len(offsets); n > 0 && offsets[n-1] == offset {
+		return
+	}
+	l.postings[entry] = append(offsets, offset)
+}
+
+// Commit implements core.ChainIndexerBackend, finalizing the log index section
+// and writing it out into the database.
+func (l *LogIndexer) Commit() error {
+	// Write the entries in key order to make the batch cheaper to apply.
+	entries := make([]logIndexEntry, 0, len(l.postings))
+	for entry := range l.postings {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].position != entries[j].position {
+			return entries[i].position < entries[j].position
+		}
+		return entries[i].value < entries[j].value
+	})
+	batch := l.db.NewBatch()
+	for _, entry := range entries {
+		rawdb.WriteLogIndex(batch, entry.position, []byte(entry.value), l.section, l.head, l.postings[entry])
+		if batch.ValueSize() >= grodb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return batch.Write()
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/consensus/ethash"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/params"
+)
+
+func TestLogIndexer(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		addr1   = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		addr2   = common.HexToAddress("0x2222222222222222222222222222222222222222")
+		topic1  = common.HexToHash("0x01")
+		topic2  = common.HexToHash("0x02")
+		genesis = core.GenesisBlockForTesting(db, addr1, big.NewInt(1000000))
+	)
+	// Block 1 has two logs of addr1, block 2 none, block 3 one of addr2 with topic1
+	// at the second position, block 5 (second section) one of addr1.
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 5, func(i int, gen *core.BlockGen) {
+		var logs []*types.Log
+		switch i + 1 {
+		case 1:
+			logs = []*types.Log{{Address: addr1, Topics: []common.Hash{topic1}}, {Address: addr1, Topics: []common.Hash{topic2}}}
+		case 3:
+			logs = []*types.Log{{Address: addr2, Topics: []common.Hash{topic2, topic1}}}
+		case 5:
+			logs = []*types.Log{{Address: addr1}}
+		default:
+			return
+		}
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = logs
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	indexer := &LogIndexer{db: db, size: 4}
+	if err := indexer.Reset(context.Background(), 0, common.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range []*types.Header{genesis.Header(), chain[0].Header(), chain[1].Header(), chain[2].Header()} {
+		if err := indexer.Process(context.Background(), header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := indexer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	head := chain[2].Hash()
+	tests := []struct {
+		position byte
+		value    []byte
+		want     []uint64
+	}{
+		{rawdb.LogIndexAddress, addr1.Bytes(), []uint64{1}},
+		{rawdb.LogIndexAddress, addr2.Bytes(), []uint64{3}},
+		{0, topic1.Bytes(), []uint64{1}},
+		{0, topic2.Bytes(), []uint64{1, 3}},
+		{1, topic1.Bytes(), []uint64{3}},
+		{1, topic2.Bytes(), nil},
+	}
+	for i, test := range tests {
+		if have := rawdb.ReadLogIndex(db, test.position, test.value, 0, head); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("test %d: postings mismatch: have %v, want %v", i, have, test.want)
+		}
+	}
+	// Blocks with logs but without receipts can't be indexed.
+	rawdb.DeleteReceipts(db, chain[4].Hash(), chain[4].NumberU64())
+	indexer.Reset(context.Background(), 1, head)
+	if err := indexer.Process(context.Background(), chain[4].Header()); err == nil {
+		t.Fatal("block with missing receipts indexed")
+	}
+}
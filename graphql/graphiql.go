@@ -32,7 +32,10 @@ import (
 // This handler returns GraphiQL when requested.
 //
 // For more information, see https://github.com/graphql/graphiql.
-type GraphiQL struct{}
+type GraphiQL struct {
+	// Endpoint is the path queries are sent to. It defaults to /graphql.
+	Endpoint string
+}
 
 func respond(w http.ResponseWriter, body []byte, code int) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -53,6 +56,10 @@ func (h GraphiQL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/html")
+	if h.Endpoint != "" {
+		w.Write(bytes.Replace(graphiql, []byte(`fetch("/graphql"`), []byte(fmt.Sprintf("fetch(%q", h.Endpoint)), 1))
+		return
+	}
 	w.Write(graphiql)
 }
 
@@ -20,6 +20,7 @@ package graphql
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/groshproject/grosh-core"
@@ -38,6 +39,13 @@ import (
 var (
 	errOnlyOnMainChain = errors.New("this operation is only available for blocks on the canonical chain")
 	errBlockInvariant  = errors.New("block objects must be instantiated with at least one of num or hash")
+	errTooManyBlocks   = fmt.Errorf("block range exceeds %d blocks, use blocksPage", maxBlocksResults)
+	errTooManyLogs     = fmt.Errorf("query matches more than %d logs, use logsPage", maxLogsResults)
+)
+
+const (
+	maxBlocksResults = 1000  // maximum number of blocks returned by the blocks query
+	maxLogsResults   = 10000 // maximum number of logs returned by the logs query
 )
 
 // Account represents an Grosh account at a particular block.
@@ -153,6 +161,15 @@ func (t *Transaction) Hash(ctx context.Context) common.Hash {
 	return t.hash
 }
 
+// Raw returns the RLP encoding of the transaction.
+func (t *Transaction) Raw(ctx context.Context) (hexutil.Bytes, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return hexutil.Bytes{}, err
+	}
+	return rlp.EncodeToBytes(tx)
+}
+
 func (t *Transaction) InputData(ctx context.Context) (hexutil.Bytes, error) {
 	tx, err := t.resolve(ctx)
 	if err != nil || tx == nil {
@@ -315,6 +332,69 @@ func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
 	return &ret, nil
 }
 
+// Receipt represents the receipt of a transaction included in a block. All
+// fields are mandatory.
+type Receipt struct {
+	backend     ethapi.Backend
+	transaction *Transaction
+	receipt     *types.Receipt
+}
+
+func (r *Receipt) Transaction(ctx context.Context) *Transaction {
+	return r.transaction
+}
+
+func (r *Receipt) Status(ctx context.Context) *hexutil.Uint64 {
+	if len(r.receipt.PostState) > 0 {
+		return nil
+	}
+	ret := hexutil.Uint64(r.receipt.Status)
+	return &ret
+}
+
+func (r *Receipt) Root(ctx context.Context) *common.Hash {
+	if len(r.receipt.PostState) == 0 {
+		return nil
+	}
+	root := common.BytesToHash(r.receipt.PostState)
+	return &root
+}
+
+func (r *Receipt) GasUsed(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(r.receipt.GasUsed)
+}
+
+func (r *Receipt) CumulativeGasUsed(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(r.receipt.CumulativeGasUsed)
+}
+
+func (r *Receipt) CreatedContract(ctx context.Context, args BlockNumberArgs) *Account {
+	if r.receipt.ContractAddress == (common.Address{}) {
+		return nil
+	}
+	return &Account{
+		backend:     r.backend,
+		address:     r.receipt.ContractAddress,
+		blockNumber: args.Number(),
+	}
+}
+
+func (r *Receipt) Logs(ctx context.Context) []*Log {
+	ret := make([]*Log, 0, len(r.receipt.Logs))
+	for _, log := range r.receipt.Logs {
+		ret = append(ret, &Log{
+			backend:     r.backend,
+			transaction: r.transaction,
+			log:         log,
+		})
+	}
+	return ret
+}
+
+func (r *Receipt) LogsBloom(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(r.receipt.Bloom.Bytes())
+}
+
 type BlockType int
 
 const (
@@ -427,6 +507,15 @@ func (b *Block) Number(ctx context.Context) (hexutil.Uint64, error) {
 	return hexutil.Uint64(*b.num), nil
 }
 
+// Raw returns the RLP encoding of the block.
+func (b *Block) Raw(ctx context.Context) (hexutil.Bytes, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return hexutil.Bytes{}, err
+	}
+	return rlp.EncodeToBytes(block)
+}
+
 func (b *Block) Hash(ctx context.Context) (common.Hash, error) {
 	if b.hash == (common.Hash{}) {
 		header, err := b.resolveHeader(ctx)
@@ -673,6 +762,36 @@ func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (
 	}, nil
 }
 
+func (b *Block) Receipts(ctx context.Context) (*[]*Receipt, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	receipts, err := b.resolveReceipts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipts length mismatch: %d receipts for %d transactions", len(receipts), len(txs))
+	}
+	ret := make([]*Receipt, 0, len(receipts))
+	for i, receipt := range receipts {
+		ret = append(ret, &Receipt{
+			backend: b.backend,
+			transaction: &Transaction{
+				backend: b.backend,
+				hash:    txs[i].Hash(),
+				tx:      txs[i],
+				block:   b,
+				index:   uint64(i),
+			},
+			receipt: receipt,
+		})
+	}
+	return &ret, nil
+}
+
 func (b *Block) OmmerAt(ctx context.Context, args struct{ Index int32 }) (*Block, error) {
 	block, err := b.resolve(ctx)
 	if err != nil || block == nil {
@@ -961,6 +1080,9 @@ func (r *Resolver) Blocks(ctx context.Context, args struct {
 	if to < from {
 		return []*Block{}, nil
 	}
+	if to-from >= maxBlocksResults {
+		return nil, errTooManyBlocks
+	}
 	ret := make([]*Block, 0, to-from+1)
 	for i := from; i <= to; i++ {
 		num := i
@@ -1031,17 +1153,28 @@ func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria
 	if args.Filter.ToBlock != nil {
 		end = int64(*args.Filter.ToBlock)
 	}
+	// Construct the range filter
+	addresses, topics := args.Filter.criteria()
+	filter := filters.NewRangeFilter(filters.Backend(r.backend), begin, end, addresses, topics)
+	filter.SetLimit(maxLogsResults + 1)
+	logs, err := runFilter(ctx, r.backend, filter)
+	if len(logs) > maxLogsResults {
+		return nil, errTooManyLogs
+	}
+	return logs, err
+}
+
+// criteria returns the address and topic restrictions of the filter.
+func (c *FilterCriteria) criteria() ([]common.Address, [][]common.Hash) {
 	var addresses []common.Address
-	if args.Filter.Addresses != nil {
-		addresses = *args.Filter.Addresses
+	if c.Addresses != nil {
+		addresses = *c.Addresses
 	}
 	var topics [][]common.Hash
-	if args.Filter.Topics != nil {
-		topics = *args.Filter.Topics
+	if c.Topics != nil {
+		topics = *c.Topics
 	}
-	// Construct the range filter
-	filter := filters.NewRangeFilter(filters.Backend(r.backend), begin, end, addresses, topics)
-	return runFilter(ctx, r.backend, filter)
+	return addresses, topics
 }
 
 func (r *Resolver) GasPrice(ctx context.Context) (hexutil.Big, error) {
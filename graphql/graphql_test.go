@@ -17,12 +17,685 @@
 package graphql
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/consensus/ethash"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/state"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/core/vm"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/event"
+	"github.com/groshproject/grosh-core/grodb"
+	"github.com/groshproject/grosh-core/grodb/memorydb"
+	"github.com/groshproject/grosh-core/internal/ethapi"
+	"github.com/groshproject/grosh-core/params"
+	"github.com/groshproject/grosh-core/rlp"
+	"github.com/groshproject/grosh-core/rpc"
+	"github.com/groshproject/grosh-core/trie"
 )
 
 func TestBuildSchema(t *testing.T) {
 	// Make sure the schema can be parsed and matched up to the object model.
-	if _, err := newHandler(nil); err != nil {
-		t.Errorf("Could not construct GraphQL handler: %v", err)
+	for _, tracing := range []bool{false, true} {
+		if _, _, err := newHandler(nil, nil, tracing); err != nil {
+			t.Errorf("Could not construct GraphQL handler (tracing %v): %v", tracing, err)
+		}
+	}
+}
+
+func TestMountedHandler(t *testing.T) {
+	h, _, err := newMountedHandler(nil, "/gql", nil, false)
+	if err != nil {
+		t.Fatalf("Could not construct GraphQL handler: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/gql/ui", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `fetch("/gql"`) {
+		t.Errorf("query browser not served or not pointing to prefix (status %d)", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("wrong status %d for path outside of prefix", rec.Code)
+	}
+	if _, err := NewMounted(nil, "graphql", nil, nil, false); err == nil {
+		t.Error("invalid prefix accepted")
+	}
+}
+
+// testBackend implements the backend methods used by the tests.
+type testBackend struct {
+	ethapi.Backend
+	head      *types.Block
+	chainFeed event.Feed
+	logsFeed  event.Feed
+	txFeed    event.Feed
+}
+
+func (b *testBackend) CurrentBlock() *types.Block {
+	return b.head
+}
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	return b.head.Header(), nil
+}
+
+func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
+	return b.chainFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return b.logsFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.txFeed.Subscribe(ch)
+}
+
+func newTestBlock(number int64) *types.Block {
+	return types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)})
+}
+
+func TestSubscriptionAsQuery(t *testing.T) {
+	tests := []struct {
+		doc, name string
+		want      string
+		sub       bool
+	}{
+		{doc: `{ block { number } }`},
+		{doc: `query { block { number } }`},
+		{doc: `mutation M { sendRawTransaction(data: "0x") }`},
+		{doc: `subscription { newBlocks { number } }`, want: `query        { newBlocks { number } }`, sub: true},
+		{doc: `# subscription
+subscription S($a: [Address!]) { logs(filter: {addresses: $a}) { index } }`, want: `# subscription
+query        S($a: [Address!]) { logs(filter: {addresses: $a}) { index } }`, sub: true},
+		{doc: `query Q { block { number } } subscription S { newBlocks { number } }`, name: "Q"},
+		{doc: `query Q { block { number } } subscription S { newBlocks { number } }`, name: "S", want: `query Q { block { number } } query        S { newBlocks { number } }`, sub: true},
+		{doc: `fragment F on Block { number } subscription { newBlocks { ...F } }`, want: `fragment F on Block { number } query        { newBlocks { ...F } }`, sub: true},
+		{doc: `query { block(hash: "subscription { x }") { number } }`},
+	}
+	for i, test := range tests {
+		have, sub := subscriptionAsQuery(test.doc, test.name)
+		if sub != test.sub {
+			t.Errorf("test %d: subscription mismatch: have %v, want %v", i, sub, test.sub)
+		}
+		if !test.sub {
+			test.want = test.doc
+		}
+		if have != test.want {
+			t.Errorf("test %d: document mismatch:\nhave %q\nwant %q", i, have, test.want)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	number, index, err := decodeCursor(*encodeCursor(1234, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 1234 || index != 5 {
+		t.Errorf("cursor mismatch: have %d:%d, want 1234:5", number, index)
+	}
+	for _, cursor := range []string{"", "!!", "MTIzNA"} {
+		if _, _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("invalid cursor %q accepted", cursor)
+		}
+	}
+}
+
+func TestBlocksPage(t *testing.T) {
+	backend := &testBackend{head: newTestBlock(10)}
+	s, err := graphql.ParseSchema(schema, &Resolver{backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type page struct {
+		BlocksPage struct {
+			Nodes    []struct{ Number string }
+			PageInfo struct {
+				EndCursor   *string
+				HasNextPage bool
+			}
+		}
+	}
+	query := func(args string) (numbers []string, cursor *string, more bool) {
+		resp := s.Exec(context.Background(), "{ blocksPage("+args+") { nodes { number } pageInfo { endCursor hasNextPage } } }", "", nil)
+		if len(resp.Errors) > 0 {
+			t.Fatalf("query failed: %v", resp.Errors)
+		}
+		var p page
+		if err := json.Unmarshal(resp.Data, &p); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range p.BlocksPage.Nodes {
+			numbers = append(numbers, node.Number)
+		}
+		return numbers, p.BlocksPage.PageInfo.EndCursor, p.BlocksPage.PageInfo.HasNextPage
+	}
+	numbers, cursor, more := query("from: 6, first: 3")
+	if strings.Join(numbers, ",") != "0x6,0x7,0x8" || !more {
+		t.Fatalf("first page mismatch: have %v (more %v)", numbers, more)
+	}
+	numbers, _, more = query(`from: 6, first: 3, after: "` + *cursor + `"`)
+	if strings.Join(numbers, ",") != "0x9,0xa" || more {
+		t.Fatalf("last page mismatch: have %v (more %v)", numbers, more)
+	}
+	if resp := s.Exec(context.Background(), `{ blocks(from: 0, to: 5000) { number } }`, "", nil); len(resp.Errors) == 0 {
+		t.Error("block range over the cap accepted")
+	}
+	if resp := s.Exec(context.Background(), `{ blocksPage(from: 6, first: 0) { nodes { number } } }`, "", nil); len(resp.Errors) == 0 {
+		t.Error("empty page size accepted")
+	}
+}
+
+// wsTestClient is a graphql-ws client of a test server.
+type wsTestClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func newWSTestClient(t *testing.T, backend ethapi.Backend) (*wsTestClient, func()) {
+	_, ws, err := newHandler(backend, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(ws)
+
+	dialer := websocket.Dialer{Subprotocols: []string{wsProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return &wsTestClient{t, conn}, func() {
+		conn.Close()
+		srv.Close()
+	}
+}
+
+func (c *wsTestClient) send(msg *wsMessage) {
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next message.
+func (c *wsTestClient) next() *wsMessage {
+	var msg wsMessage
+	if err := c.conn.ReadJSON(&msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return &msg
+}
+
+// read returns the next message of the given type, skipping keep-alives.
+func (c *wsTestClient) read(typ string) *wsMessage {
+	for {
+		msg := c.next()
+		if msg.Type == typ {
+			return msg
+		}
+		if msg.Type != gqlConnectionKeepAlive && msg.Type != gqlConnectionAck {
+			c.t.Fatalf("unexpected message %s: %s", msg.Type, msg.Payload)
+		}
+	}
+}
+
+func (c *wsTestClient) start(id, query string) {
+	payload, _ := json.Marshal(&wsRequest{Query: query})
+	c.send(&wsMessage{ID: id, Type: gqlStart, Payload: payload})
+}
+
+func (c *wsTestClient) stop(id string) {
+	c.send(&wsMessage{ID: id, Type: gqlStop})
+	if msg := c.read(gqlComplete); msg.ID != id {
+		c.t.Fatalf("completed wrong operation %s", msg.ID)
+	}
+}
+
+// expect reads data messages of the operation, checking that each contains the
+// given text.
+func (c *wsTestClient) expect(id string, want ...string) {
+	for _, text := range want {
+		msg := c.read(gqlData)
+		if msg.ID != id || !strings.Contains(string(msg.Payload), text) {
+			c.t.Fatalf("result mismatch, want %s: %s", text, msg.Payload)
+		}
+	}
+}
+
+// waitSend sends the event until the feed has a subscriber.
+func waitSend(feed *event.Feed, ev interface{}) {
+	for feed.Send(ev) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewBlocksSubscription(t *testing.T) {
+	backend := &testBackend{head: newTestBlock(0)}
+	client, closer := newWSTestClient(t, backend)
+	defer closer()
+
+	// A repeated init is acknowledged, but doesn't start another keep-alive.
+	client.send(&wsMessage{Type: gqlConnectionInit})
+	client.send(&wsMessage{Type: gqlConnectionInit})
+	for _, want := range []string{gqlConnectionAck, gqlConnectionKeepAlive, gqlConnectionAck} {
+		if msg := client.next(); msg.Type != want {
+			t.Fatalf("wrong message type %s, want %s", msg.Type, want)
+		}
+	}
+	// Queries are answered once.
+	client.start("1", `{ block { number } }`)
+	if msg := client.next(); msg.Type != gqlData || msg.ID != "1" || !strings.Contains(string(msg.Payload), `"number":"0x0"`) {
+		t.Fatalf("query result mismatch: %s %s", msg.Type, msg.Payload)
+	}
+	client.read(gqlComplete)
+
+	// Subscriptions deliver every new block until stopped.
+	client.start("2", `subscription { newBlocks { number } }`)
+	waitSend(&backend.chainFeed, core.ChainEvent{Block: newTestBlock(1)})
+	backend.chainFeed.Send(core.ChainEvent{Block: newTestBlock(2)})
+	client.expect("2", `"number":"0x1"`, `"number":"0x2"`)
+	client.stop("2")
+}
+
+func TestLogsSubscription(t *testing.T) {
+	backend := &testBackend{head: newTestBlock(0)}
+	client, closer := newWSTestClient(t, backend)
+	defer closer()
+
+	client.send(&wsMessage{Type: gqlConnectionInit})
+	client.start("1", `subscription { logs(filter: {addresses: ["`+testContract.Hex()+`"], topics: [[], ["0x0000000000000000000000000000000000000000000000000000000000000002"]]}) { index data } }`)
+
+	topics := []common.Hash{{0x01}, common.HexToHash("0x02")}
+	waitSend(&backend.logsFeed, []*types.Log{
+		{Address: testContract, Topics: topics, Data: []byte{0x01}, Index: 1},
+		{Address: common.Address{0xee}, Topics: topics, Data: []byte{0x02}, Index: 2},
+		{Address: testContract, Topics: topics[:1], Data: []byte{0x03}, Index: 3},
+		{Address: testContract, Topics: topics, Data: []byte{0x04}, Index: 4, Removed: true},
+	})
+	backend.logsFeed.Send([]*types.Log{{Address: testContract, Topics: topics, Data: []byte{0x05}, Index: 5}})
+	client.expect("1", `{"index":1,"data":"0x01"}`, `{"index":5,"data":"0x05"}`)
+	client.stop("1")
+}
+
+func TestPendingTransactionsSubscription(t *testing.T) {
+	backend := &testBackend{head: newTestBlock(0)}
+	client, closer := newWSTestClient(t, backend)
+	defer closer()
+
+	client.send(&wsMessage{Type: gqlConnectionInit})
+	client.start("1", `subscription { pendingTransactions { hash nonce } }`)
+
+	txs := []*types.Transaction{
+		types.NewTransaction(1, common.Address{}, nil, 0, nil, nil),
+		types.NewTransaction(2, common.Address{}, nil, 0, nil, nil),
+	}
+	waitSend(&backend.txFeed, core.NewTxsEvent{Txs: txs})
+	client.expect("1", txs[0].Hash().Hex(), txs[1].Hash().Hex())
+	client.stop("1")
+}
+
+var (
+	testKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr     = crypto.PubkeyToAddress(testKey.PublicKey)
+	testContract = common.Address{0xcc}
+	testLogger   = common.Address{0xdd}
+)
+
+// chainBackend serves the resolvers from an in-memory chain.
+type chainBackend struct {
+	ethapi.Backend
+	db    grodb.Database
+	chain *core.BlockChain
+}
+
+func (b *chainBackend) ChainDb() grodb.Database {
+	return b.db
+}
+
+func (b *chainBackend) CurrentBlock() *types.Block {
+	return b.chain.CurrentBlock()
+}
+
+func (b *chainBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *chainBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+
+func (b *chainBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	receipts := b.chain.GetReceiptsByHash(hash)
+	logs := make([][]*types.Log, len(receipts))
+	for i, receipt := range receipts {
+		logs[i] = receipt.Logs
+	}
+	return logs, nil
+}
+
+func (b *chainBackend) BloomStatus() (uint64, uint64) {
+	return params.BloomBitsBlocks, 0
+}
+
+func (b *chainBackend) LogIndexStatus() (uint64, uint64) {
+	return params.BloomBitsBlocks, 0
+}
+
+func (b *chainBackend) ChainConfig() *params.ChainConfig {
+	return b.chain.Config()
+}
+
+func (b *chainBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber {
+		return b.chain.CurrentHeader(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *chainBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.LatestBlockNumber {
+		return b.chain.CurrentBlock(), nil
+	}
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *chainBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.chain.GetBlockByHash(hash), nil
+}
+
+func (b *chainBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	header, _ := b.HeaderByNumber(ctx, number)
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *chainBackend) StateAtTransaction(ctx context.Context, block *types.Block, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, error) {
+	statedb, err := b.chain.StateAt(b.chain.GetHeaderByHash(block.ParentHash()).Root)
+	if err != nil {
+		return nil, vm.Context{}, nil, err
+	}
+	signer := types.MakeSigner(b.chain.Config(), block.Number())
+	for idx, tx := range block.Transactions() {
+		msg, _ := tx.AsMessage(signer)
+		context := core.NewEVMContext(msg, block.Header(), b.chain, nil)
+		if idx == txIndex {
+			return msg, context, statedb, nil
+		}
+		vmenv := vm.NewEVM(context, statedb, b.chain.Config(), vm.Config{})
+		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
+			return nil, vm.Context{}, nil, err
+		}
+		statedb.Finalise(true)
+	}
+	return nil, vm.Context{}, nil, errors.New("transaction not found")
+}
+
+// newChainBackend creates a chain with a contract holding two storage slots. The
+// first block transfers a wei to the contract, the three following ones call a
+// contract emitting a log twice.
+func newChainBackend(t *testing.T) *chainBackend {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		config = params.AllEthashProtocolChanges
+		gspec  = &core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				testAddr: {Balance: big.NewInt(params.Ether)},
+				testContract: {
+					Code:    []byte{0x00}, // STOP
+					Balance: common.Big1,
+					Storage: map[common.Hash]common.Hash{
+						common.HexToHash("0x01"): common.HexToHash("0x11"),
+						common.HexToHash("0x02"): common.HexToHash("0x22"),
+					},
+				},
+				testLogger: {
+					Code:    []byte{0x60, 0x00, 0x60, 0x00, 0xa0}, // PUSH1 0 PUSH1 0 LOG0
+					Balance: common.Big0,
+				},
+			},
+		}
+	)
+	genesis := gspec.MustCommit(db)
+	blocks, _ := core.GenerateChain(config, genesis, ethash.NewFaker(), db, 4, func(i int, b *core.BlockGen) {
+		if i == 0 {
+			tx, _ := types.SignTx(types.NewTransaction(0, testContract, common.Big1, 100000, common.Big1, nil), types.HomesteadSigner{}, testKey)
+			b.AddTx(tx)
+			return
+		}
+		for j := 0; j < 2; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(testAddr), testLogger, common.Big0, 100000, common.Big1, nil), types.HomesteadSigner{}, testKey)
+			b.AddTx(tx)
+		}
+	})
+	chain, err := core.NewBlockChain(db, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("can't create blockchain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("can't import test blocks: %v", err)
+	}
+	return &chainBackend{db: db, chain: chain}
+}
+
+func exec(t *testing.T, s *graphql.Schema, query string, result interface{}) {
+	t.Helper()
+	resp := s.Exec(context.Background(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("query failed: %v", resp.Errors)
+	}
+	if err := json.Unmarshal(resp.Data, result); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccountProof(t *testing.T) {
+	backend := newChainBackend(t)
+	s, err := graphql.ParseSchema(schema, &Resolver{backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Block struct {
+			Account struct {
+				Proof struct {
+					AccountProof []hexutil.Bytes
+					StorageHash  common.Hash
+					StorageProof []struct {
+						Key   common.Hash
+						Value common.Hash
+						Proof []hexutil.Bytes
+					}
+				}
+			}
+		}
+	}
+	exec(t, s, `{ block { account(address: "`+testContract.Hex()+`") { proof(slots: ["0x0000000000000000000000000000000000000000000000000000000000000002"]) {
+		accountProof storageHash storageProof { key value proof } } } } }`, &result)
+
+	proof := result.Block.Account.Proof
+	verify := func(root common.Hash, key []byte, nodes []hexutil.Bytes) []byte {
+		db := memorydb.New()
+		for _, node := range nodes {
+			db.Put(crypto.Keccak256(node), node)
+		}
+		value, _, err := trie.VerifyProof(root, crypto.Keccak256(key), db)
+		if err != nil {
+			t.Fatalf("invalid proof: %v", err)
+		}
+		return value
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(verify(backend.chain.CurrentBlock().Root(), testContract.Bytes(), proof.AccountProof), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Root != proof.StorageHash {
+		t.Errorf("storage hash mismatch: have %x, want %x", proof.StorageHash, account.Root)
+	}
+	if len(proof.StorageProof) != 1 || proof.StorageProof[0].Value != common.HexToHash("0x22") {
+		t.Fatalf("storage proof mismatch: %+v", proof.StorageProof)
+	}
+	slot := proof.StorageProof[0]
+	if value, _, _ := rlp.SplitString(verify(proof.StorageHash, slot.Key.Bytes(), slot.Proof)); common.BytesToHash(value) != slot.Value {
+		t.Errorf("proven storage value mismatch: have %x, want %x", value, slot.Value)
+	}
+}
+
+func TestStorageRange(t *testing.T) {
+	s, err := graphql.ParseSchema(schema, &Resolver{newChainBackend(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type storageRange struct {
+		Block struct {
+			Account struct {
+				StorageRange struct {
+					Entries []struct{ HashedKey, Value common.Hash }
+					NextKey *common.Hash
+				}
+			}
+		}
+	}
+	var (
+		values []common.Hash
+		start  = "null"
+	)
+	for i := 0; i < 2; i++ {
+		var result storageRange
+		exec(t, s, `{ block { account(address: "`+testContract.Hex()+`") { storageRange(start: `+start+`, limit: 1) { entries { hashedKey value } nextKey } } } }`, &result)
+
+		r := result.Block.Account.StorageRange
+		if len(r.Entries) != 1 {
+			t.Fatalf("page %d: wrong number of entries %d", i, len(r.Entries))
+		}
+		values = append(values, r.Entries[0].Value)
+		if (r.NextKey == nil) != (i == 1) {
+			t.Fatalf("page %d: wrong next key %v", i, r.NextKey)
+		}
+		if r.NextKey != nil {
+			start = `"` + r.NextKey.Hex() + `"`
+		}
+	}
+	if values[0] == values[1] {
+		t.Errorf("slot listed twice: %x", values[0])
+	}
+	for _, value := range values {
+		if value != common.HexToHash("0x11") && value != common.HexToHash("0x22") {
+			t.Errorf("unexpected slot value %x", value)
+		}
+	}
+}
+
+func TestRawAndTrace(t *testing.T) {
+	backend := newChainBackend(t)
+	s, err := graphql.ParseSchema(withTracing(schema), &Resolver{backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Block struct {
+			Raw          hexutil.Bytes
+			Transactions []struct {
+				Raw         hexutil.Bytes
+				Trace       json.RawMessage
+				CallTrace   json.RawMessage
+				CustomTrace json.RawMessage
+			}
+		}
+	}
+	exec(t, s, `{ block(number: 1) { raw transactions { raw trace callTrace: trace(tracer: "callTracer")
+		customTrace: trace(tracer: "{n: 0, step: function() { this.n++ }, fault: function() {}, result: function() { return this.n }}") } } }`, &result)
+
+	block := backend.chain.GetBlockByNumber(1)
+	if want, _ := rlp.EncodeToBytes(block); string(result.Block.Raw) != string(want) {
+		t.Errorf("raw block mismatch")
+	}
+	if len(result.Block.Transactions) != 1 {
+		t.Fatalf("wrong number of transactions %d", len(result.Block.Transactions))
+	}
+	tx := result.Block.Transactions[0]
+	if want, _ := rlp.EncodeToBytes(block.Transactions()[0]); string(tx.Raw) != string(want) {
+		t.Errorf("raw transaction mismatch")
+	}
+	var trace ethapi.ExecutionResult
+	if err := json.Unmarshal(tx.Trace, &trace); err != nil {
+		t.Fatal(err)
+	}
+	if trace.Gas != params.TxGas || trace.Failed || len(trace.StructLogs) != 1 || trace.StructLogs[0].Op != "STOP" {
+		t.Errorf("struct log trace mismatch: %s", tx.Trace)
+	}
+	if !strings.Contains(string(tx.CallTrace), `"type":"CALL"`) {
+		t.Errorf("call trace mismatch: %s", tx.CallTrace)
+	}
+	if string(tx.CustomTrace) != "1" {
+		t.Errorf("custom trace mismatch: %s", tx.CustomTrace)
+	}
+	// Tracing is only available if enabled.
+	s, err = graphql.ParseSchema(schema, &Resolver{backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := s.Exec(context.Background(), `{ block(number: 1) { transactions { trace } } }`, "", nil); len(resp.Errors) == 0 {
+		t.Error("trace field available with tracing disabled")
+	}
+}
+
+func TestLogsPage(t *testing.T) {
+	s, err := graphql.ParseSchema(schema, &Resolver{newChainBackend(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type page struct {
+		LogsPage struct {
+			Nodes []struct {
+				Index       int
+				Transaction struct{ Block struct{ Number string } }
+			}
+			PageInfo struct {
+				EndCursor   *string
+				HasNextPage bool
+			}
+		}
+	}
+	// Page through the six logs of blocks 2-4, three at a time.
+	var (
+		logs  []string
+		after = ""
+	)
+	for i, more := 0, true; more; i++ {
+		if i == 3 {
+			t.Fatal("too many pages")
+		}
+		var result page
+		exec(t, s, `{ logsPage(filter: {fromBlock: 0, addresses: ["`+testLogger.Hex()+`"]}, first: 3`+after+`) {
+			nodes { index transaction { block { number } } } pageInfo { endCursor hasNextPage } } }`, &result)
+		for _, node := range result.LogsPage.Nodes {
+			logs = append(logs, fmt.Sprintf("%s:%d", node.Transaction.Block.Number, node.Index))
+		}
+		more = result.LogsPage.PageInfo.HasNextPage
+		if more {
+			after = `, after: "` + *result.LogsPage.PageInfo.EndCursor + `"`
+		}
+	}
+	if have, want := strings.Join(logs, ","), "0x2:0,0x2:1,0x3:0,0x3:1,0x4:0,0x4:1"; have != want {
+		t.Errorf("logs mismatch: have %s, want %s", have, want)
 	}
 }
@@ -0,0 +1,224 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/eth/filters"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+const (
+	defaultPageSize = 100  // number of items in a page if first is not given
+	maxPageSize     = 1000 // maximum number of items in a page
+	logsPageWindow  = 1024 // number of blocks searched for logs at once
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// PageInfo describes the position of a page within a paginated list.
+type PageInfo struct {
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (p *PageInfo) EndCursor() *string {
+	return p.endCursor
+}
+
+func (p *PageInfo) HasNextPage() bool {
+	return p.hasNextPage
+}
+
+// BlockPage is a page of blocks.
+type BlockPage struct {
+	nodes    []*Block
+	pageInfo *PageInfo
+}
+
+func (p *BlockPage) Nodes() []*Block {
+	return p.nodes
+}
+
+func (p *BlockPage) PageInfo() *PageInfo {
+	return p.pageInfo
+}
+
+// LogPage is a page of logs.
+type LogPage struct {
+	nodes    []*Log
+	pageInfo *PageInfo
+}
+
+func (p *LogPage) Nodes() []*Log {
+	return p.nodes
+}
+
+func (p *LogPage) PageInfo() *PageInfo {
+	return p.pageInfo
+}
+
+// pageSize returns the number of items requested for a page, capped at the
+// maximum page size. Empty pages are rejected because a client following the
+// cursors would never get past them.
+func pageSize(first *int32) (int, error) {
+	if first == nil {
+		return defaultPageSize, nil
+	}
+	if *first < 1 {
+		return 0, fmt.Errorf("invalid page size %d", *first)
+	}
+	if *first > maxPageSize {
+		return maxPageSize, nil
+	}
+	return int(*first), nil
+}
+
+// A cursor is the opaque position of an item in a paginated list, consisting of
+// the number of the block and, for logs, the index of the log in the block.
+func encodeCursor(number uint64, index uint) *string {
+	cursor := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", number, index)))
+	return &cursor
+}
+
+func decodeCursor(cursor string) (uint64, uint, error) {
+	blob, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, errInvalidCursor
+	}
+	var (
+		number uint64
+		index  uint
+	)
+	if n, err := fmt.Sscanf(string(blob), "%d:%d", &number, &index); n != 2 || err != nil {
+		return 0, 0, errInvalidCursor
+	}
+	return number, index, nil
+}
+
+func (r *Resolver) BlocksPage(ctx context.Context, args struct {
+	From  hexutil.Uint64
+	To    *hexutil.Uint64
+	First *int32
+	After *string
+}) (*BlockPage, error) {
+	size, err := pageSize(args.First)
+	if err != nil {
+		return nil, err
+	}
+	from := uint64(args.From)
+	if args.After != nil {
+		number, _, err := decodeCursor(*args.After)
+		if err != nil {
+			return nil, err
+		}
+		if number >= from {
+			from = number + 1
+		}
+	}
+	to := r.backend.CurrentBlock().NumberU64()
+	if args.To != nil {
+		to = uint64(*args.To)
+	}
+	page := &BlockPage{nodes: []*Block{}, pageInfo: new(PageInfo)}
+	for number := from; number <= to && len(page.nodes) < size; number++ {
+		num := rpc.BlockNumber(number)
+		page.nodes = append(page.nodes, &Block{
+			backend:   r.backend,
+			num:       &num,
+			canonical: isCanonical,
+		})
+		page.pageInfo.endCursor = encodeCursor(number, 0)
+	}
+	page.pageInfo.hasNextPage = from+uint64(len(page.nodes)) <= to
+	return page, nil
+}
+
+func (r *Resolver) LogsPage(ctx context.Context, args struct {
+	Filter FilterCriteria
+	First  *int32
+	After  *string
+}) (*LogPage, error) {
+	size, err := pageSize(args.First)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve the range to block numbers, so the search can be split up.
+	head := r.backend.CurrentBlock().NumberU64()
+	begin, end := head, head
+	if args.Filter.FromBlock != nil {
+		begin = uint64(*args.Filter.FromBlock)
+	}
+	if args.Filter.ToBlock != nil {
+		end = uint64(*args.Filter.ToBlock)
+	}
+	// Continue with the block of the cursor, skipping the logs already delivered.
+	var (
+		skipBlock uint64
+		skipIndex uint
+		skipping  bool
+	)
+	if args.After != nil {
+		if skipBlock, skipIndex, err = decodeCursor(*args.After); err != nil {
+			return nil, err
+		}
+		if skipBlock >= begin {
+			begin, skipping = skipBlock, true
+		}
+	}
+	addresses, topics := args.Filter.criteria()
+
+	page := &LogPage{nodes: []*Log{}, pageInfo: new(PageInfo)}
+	for from := begin; from <= end; from += logsPageWindow {
+		to := from + logsPageWindow - 1
+		if to > end || to < from {
+			to = end
+		}
+		// Stop searching once the page is full and more logs are known to exist,
+		// counting the logs of the cursor block that are skipped.
+		filter := filters.NewRangeFilter(filters.Backend(r.backend), int64(from), int64(to), addresses, topics)
+		limit := size - len(page.nodes) + 1
+		if skipping && from <= skipBlock {
+			limit += int(skipIndex) + 1
+		}
+		filter.SetLimit(limit)
+		logs, err := runFilter(ctx, r.backend, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			if skipping && log.log.BlockNumber == skipBlock && log.log.Index <= skipIndex {
+				continue
+			}
+			if len(page.nodes) == size {
+				page.pageInfo.hasNextPage = true
+				return page, nil
+			}
+			page.nodes = append(page.nodes, log)
+			page.pageInfo.endCursor = encodeCursor(log.log.BlockNumber, log.log.Index)
+		}
+		if to == end {
+			break
+		}
+	}
+	return page, nil
+}
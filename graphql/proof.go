@@ -0,0 +1,209 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/rlp"
+	"github.com/groshproject/grosh-core/trie"
+)
+
+const (
+	defaultStorageRange = 256  // number of slots in a storage range if limit is not given
+	maxStorageRange     = 1024 // maximum number of slots in a storage range
+)
+
+// AccountProof is the Merkle proof of an account and some of its storage slots.
+type AccountProof struct {
+	accountProof []hexutil.Bytes
+	storageHash  common.Hash
+	codeHash     common.Hash
+	storageProof []*StorageProof
+}
+
+func (p *AccountProof) AccountProof() []hexutil.Bytes {
+	return p.accountProof
+}
+
+func (p *AccountProof) StorageHash() common.Hash {
+	return p.storageHash
+}
+
+func (p *AccountProof) CodeHash() common.Hash {
+	return p.codeHash
+}
+
+func (p *AccountProof) StorageProof() []*StorageProof {
+	return p.storageProof
+}
+
+// StorageProof is the Merkle proof of a storage slot.
+type StorageProof struct {
+	key   common.Hash
+	value common.Hash
+	proof []hexutil.Bytes
+}
+
+func (p *StorageProof) Key() common.Hash {
+	return p.key
+}
+
+func (p *StorageProof) Value() common.Hash {
+	return p.value
+}
+
+func (p *StorageProof) Proof() []hexutil.Bytes {
+	return p.proof
+}
+
+func toBytesList(nodes [][]byte) []hexutil.Bytes {
+	list := make([]hexutil.Bytes, len(nodes))
+	for i, node := range nodes {
+		list[i] = node
+	}
+	return list
+}
+
+func (a *Account) Proof(ctx context.Context, args struct{ Slots *[]common.Hash }) (*AccountProof, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	proof := &AccountProof{
+		storageHash:  types.EmptyRootHash,
+		codeHash:     state.GetCodeHash(a.address),
+		storageProof: []*StorageProof{},
+	}
+	// A missing storage trie means the account doesn't exist, so the slots are empty.
+	storageTrie := state.StorageTrie(a.address)
+	if storageTrie != nil {
+		proof.storageHash = storageTrie.Hash()
+	} else {
+		proof.codeHash = crypto.Keccak256Hash(nil)
+	}
+	if args.Slots != nil {
+		for _, slot := range *args.Slots {
+			result := &StorageProof{key: slot, proof: []hexutil.Bytes{}}
+			if storageTrie != nil {
+				nodes, err := state.GetStorageProof(a.address, slot)
+				if err != nil {
+					return nil, err
+				}
+				result.value, result.proof = state.GetState(a.address, slot), toBytesList(nodes)
+			}
+			proof.storageProof = append(proof.storageProof, result)
+		}
+	}
+	nodes, err := state.GetProof(a.address)
+	if err != nil {
+		return nil, err
+	}
+	proof.accountProof = toBytesList(nodes)
+	return proof, state.Error()
+}
+
+// StorageRange is a range of storage slots of an account.
+type StorageRange struct {
+	entries []*StorageEntry
+	nextKey *common.Hash
+}
+
+func (r *StorageRange) Entries() []*StorageEntry {
+	return r.entries
+}
+
+func (r *StorageRange) NextKey() *common.Hash {
+	return r.nextKey
+}
+
+// StorageEntry is a storage slot of an account.
+type StorageEntry struct {
+	hashedKey common.Hash
+	key       *common.Hash
+	value     common.Hash
+}
+
+func (e *StorageEntry) HashedKey() common.Hash {
+	return e.hashedKey
+}
+
+func (e *StorageEntry) Key() *common.Hash {
+	return e.key
+}
+
+func (e *StorageEntry) Value() common.Hash {
+	return e.value
+}
+
+func (a *Account) StorageRange(ctx context.Context, args struct {
+	Start *common.Hash
+	Limit *int32
+}) (*StorageRange, error) {
+	limit := defaultStorageRange
+	if args.Limit != nil {
+		if *args.Limit < 0 {
+			return nil, fmt.Errorf("invalid storage range limit %d", *args.Limit)
+		}
+		if limit = int(*args.Limit); limit > maxStorageRange {
+			limit = maxStorageRange
+		}
+	}
+	state, err := a.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &StorageRange{entries: []*StorageEntry{}}
+
+	storageTrie := state.StorageTrie(a.address)
+	if storageTrie == nil {
+		return result, state.Error()
+	}
+	var start []byte
+	if args.Start != nil {
+		start = args.Start.Bytes()
+	}
+	it := trie.NewIterator(storageTrie.NodeIterator(start))
+	for len(result.entries) < limit && it.Next() {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return nil, err
+		}
+		entry := &StorageEntry{
+			hashedKey: common.BytesToHash(it.Key),
+			value:     common.BytesToHash(content),
+		}
+		if preimage := storageTrie.GetKey(it.Key); preimage != nil {
+			key := common.BytesToHash(preimage)
+			entry.key = &key
+		}
+		result.entries = append(result.entries, entry)
+	}
+	if it.Next() {
+		next := common.BytesToHash(it.Key)
+		result.nextKey = &next
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+	return result, state.Error()
+}
@@ -16,7 +16,25 @@
 
 package graphql
 
+import "strings"
+
 const schema string = `
+    schema {
+        query: Query
+        mutation: Mutation
+        subscription: Subscription
+    }
+` + schemaTypes
+
+// subscriptionSchema roots the types at Subscription instead of Query. The
+// selections of a subscription are executed on it like a query, once per event.
+const subscriptionSchema string = `
+    schema {
+        query: Subscription
+    }
+` + schemaTypes
+
+const schemaTypes string = `
     # Bytes32 is a 32 byte binary string, represented as 0x-prefixed hexadecimal.
     scalar Bytes32
     # Address is a 20 byte Grosh address, represented as 0x-prefixed hexadecimal.
@@ -30,11 +48,8 @@ const schema string = `
     scalar BigInt
     # Long is a 64 bit unsigned integer.
     scalar Long
-
-    schema {
-        query: Query
-        mutation: Mutation
-    }
+    # JSON is an arbitrary JSON value. It is only used for output.
+    scalar JSON
 
     # Account is an Grosh account at a particular block.
     type Account {
@@ -52,6 +67,54 @@ const schema string = `
         # Storage provides access to the storage of a contract account, indexed
         # by its 32 byte slot identifier.
         storage(slot: Bytes32!): Bytes32!
+        # Proof is the Merkle proof of the account and of the given storage
+        # slots, as returned by eth_getProof.
+        proof(slots: [Bytes32!]): AccountProof!
+        # StorageRange lists up to limit (default 256, at most 1024) storage
+        # slots of the account in the order of their hashes, starting at the
+        # slot with the given hash.
+        storageRange(start: Bytes32, limit: Int): StorageRange!
+    }
+
+    # AccountProof is the Merkle proof of an account and some of its storage slots.
+    type AccountProof {
+        # AccountProof is the list of state trie nodes from the root to the account.
+        accountProof: [Bytes!]!
+        # StorageHash is the root hash of the storage trie of the account.
+        storageHash: Bytes32!
+        # CodeHash is the hash of the code of the account.
+        codeHash: Bytes32!
+        # StorageProof contains the proofs of the requested storage slots.
+        storageProof: [StorageProof!]!
+    }
+
+    # StorageProof is the Merkle proof of a storage slot.
+    type StorageProof {
+        # Key is the storage slot.
+        key: Bytes32!
+        # Value is the content of the storage slot.
+        value: Bytes32!
+        # Proof is the list of storage trie nodes from the root to the slot.
+        proof: [Bytes!]!
+    }
+
+    # StorageRange is a range of storage slots of an account.
+    type StorageRange {
+        # Entries are the storage slots in the range.
+        entries: [StorageEntry!]!
+        # NextKey is the hash of the slot following the range, null if the range
+        # ends with the last slot.
+        nextKey: Bytes32
+    }
+
+    # StorageEntry is a storage slot of an account.
+    type StorageEntry {
+        # HashedKey is the keccak256 hash of the slot, its key in the storage trie.
+        hashedKey: Bytes32!
+        # Key is the slot, null if its preimage is unknown.
+        key: Bytes32
+        # Value is the content of the slot.
+        value: Bytes32!
     }
 
     # Log is an Grosh event log.
@@ -92,6 +155,8 @@ const schema string = `
         gas: Long!
         # InputData is the data supplied to the target of the transaction.
         inputData: Bytes!
+        # Raw is the RLP encoding of the transaction.
+        raw: Bytes!
         # Block is the block this transaction was mined in. This will be null if
         # the transaction has not yet been mined.
         block: Block
@@ -117,6 +182,31 @@ const schema string = `
         logs: [Log!]
     }
 
+    # Receipt is the outcome of executing a transaction included in a block.
+    type Receipt {
+        # Transaction is the transaction this receipt belongs to.
+        transaction: Transaction!
+        # Status is the return status of the transaction, 1 if it succeeded or 0
+        # if it failed. This is null for receipts created before the Byzantium
+        # fork, which carry a root instead.
+        status: Long
+        # Root is the intermediate state root after executing the transaction.
+        # This is null for receipts created after the Byzantium fork.
+        root: Bytes32
+        # GasUsed is the amount of gas that was used processing the transaction.
+        gasUsed: Long!
+        # CumulativeGasUsed is the total gas used in the block up to and including
+        # the transaction.
+        cumulativeGasUsed: Long!
+        # CreatedContract is the account that was created by a contract creation
+        # transaction. For other transactions this field will be null.
+        createdContract(block: Long): Account
+        # Logs is a list of log entries emitted by the transaction.
+        logs: [Log!]!
+        # LogsBloom is a bloom filter of the log entries emitted by the transaction.
+        logsBloom: Bytes!
+    }
+
     # BlockFilterCriteria encapsulates log filter criteria for a filter applied
     # to a single block.
     input BlockFilterCriteria {
@@ -143,6 +233,8 @@ const schema string = `
         number: Long!
         # Hash is the block hash of this block.
         hash: Bytes32!
+        # Raw is the RLP encoding of the block.
+        raw: Bytes!
         # Parent is the parent block of this block.
         parent: Block
         # Nonce is the block nonce, an 8 byte sequence determined by the miner.
@@ -197,6 +289,10 @@ const schema string = `
         # transactions are unavailable for this block, or if the index is out of
         # bounds, this field will be null.
         transactionAt(index: Int!): Transaction
+        # Receipts is the list of receipts of all transactions in this block, in
+        # the order of the transactions. If receipts are unavailable for this
+        # block, this field will be null.
+        receipts: [Receipt!]
         # Logs returns a filtered set of logs from this block.
         logs(filter: BlockFilterCriteria!): [Log!]!
         # Account fetches an Grosh account at the current block's state.
@@ -296,14 +392,25 @@ const schema string = `
         # supplied, the most recent known block is returned.
         block(number: Long, hash: Bytes32): Block
         # Blocks returns all the blocks between two numbers, inclusive. If
-        # to is not supplied, it defaults to the most recent known block.
+        # to is not supplied, it defaults to the most recent known block. At most
+        # 1000 blocks are returned, use blocksPage for longer ranges.
         blocks(from: Long!, to: Long): [Block!]!
         # Pending returns the current pending state.
         pending: Pending!
         # Transaction returns a transaction specified by its hash.
         transaction(hash: Bytes32!): Transaction
-        # Logs returns log entries matching the provided filter.
+        # BlocksPage returns a page of at most first (at least 1, default 100,
+        # at most 1000) blocks between two numbers, inclusive, starting after the
+        # given cursor. If to is not supplied, it defaults to the most recent
+        # known block.
+        blocksPage(from: Long!, to: Long, first: Int, after: String): BlockPage!
+        # Logs returns log entries matching the provided filter. Queries matching
+        # more than 10000 entries fail, use logsPage for those.
         logs(filter: FilterCriteria!): [Log!]!
+        # LogsPage returns a page of at most first (at least 1, default 100,
+        # at most 1000) log entries matching the provided filter, starting after
+        # the given cursor.
+        logsPage(filter: FilterCriteria!, first: Int, after: String): LogPage!
         # GasPrice returns the node's estimate of a gas price sufficient to
         # ensure a transaction is mined in a timely fashion.
         gasPrice: BigInt!
@@ -313,8 +420,67 @@ const schema string = `
         syncing: SyncState
     }
 
+    # PageInfo describes the position of a page within a paginated list.
+    type PageInfo {
+        # EndCursor is the cursor of the last item of the page, to be passed as
+        # after to fetch the next page. It is null if the page is empty.
+        endCursor: String
+        # HasNextPage is true if more items follow this page.
+        hasNextPage: Boolean!
+    }
+
+    # BlockPage is a page of blocks.
+    type BlockPage {
+        # Nodes is the list of blocks in this page.
+        nodes: [Block!]!
+        # PageInfo describes the position of this page.
+        pageInfo: PageInfo!
+    }
+
+    # LogPage is a page of log entries.
+    type LogPage {
+        # Nodes is the list of log entries in this page.
+        nodes: [Log!]!
+        # PageInfo describes the position of this page.
+        pageInfo: PageInfo!
+    }
+
     type Mutation {
         # SendRawTransaction sends an RLP-encoded transaction to the network.
         sendRawTransaction(data: Bytes!): Bytes32!
     }
+
+    # Subscription delivers events over the graphql-ws WebSocket protocol. A
+    # subscription selects exactly one of its fields, which is resolved once per
+    # event.
+    type Subscription {
+        # NewBlocks delivers the blocks added to the canonical chain.
+        newBlocks: Block
+        # Logs delivers the log entries matching the filter, emitted by the blocks
+        # added to the canonical chain.
+        logs(filter: BlockFilterCriteria): Log
+        # PendingTransactions delivers the transactions entering the transaction
+        # pool.
+        pendingTransactions: Transaction
+    }
 `
+
+// traceFields are the fields added to the Transaction type if tracing is enabled.
+const traceFields string = `
+        # Trace re-executes the transaction and returns the trace generated by
+        # the given JavaScript tracer, or the name of a built in one. Without a
+        # tracer the structured EVM logs are returned, as by debug_traceTransaction,
+        # without memory and storage and limited to 10000 entries. The timeout
+        # applies to JavaScript tracers, it defaults to 5s and is capped at 10s.
+        # If the transaction has not yet been mined, this field will be null.
+        trace(tracer: String, timeout: String): JSON
+`
+
+// withTracing adds the tracing fields to the schema.
+func withTracing(schema string) string {
+	const anchor = "    type Transaction {\n"
+	if strings.Count(schema, anchor) != 1 {
+		panic("transaction type not found in schema")
+	}
+	return strings.Replace(schema, anchor, anchor+strings.TrimPrefix(traceFields, "\n"), 1)
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 
 	"github.com/groshproject/grosh-core/internal/ethapi"
 	"github.com/groshproject/grosh-core/log"
@@ -32,22 +33,42 @@ import (
 // Service encapsulates a GraphQL service.
 type Service struct {
 	endpoint string           // The host:port endpoint for this service.
+	prefix   string           // Path prefix on the node's HTTP endpoint, if mounted there.
 	cors     []string         // Allowed CORS domains
 	vhosts   []string         // Recognised vhosts
 	timeouts rpc.HTTPTimeouts // Timeout settings for HTTP requests.
 	backend  ethapi.Backend   // The backend that queries will operate onn.
+	tracing  bool             // Whether transactions can be traced.
 	handler  http.Handler     // The `http.Handler` used to answer queries.
 	listener net.Listener     // The listening socket.
 }
 
-// New constructs a new GraphQL service instance.
-func New(backend ethapi.Backend, endpoint string, cors, vhosts []string, timeouts rpc.HTTPTimeouts) (*Service, error) {
+// New constructs a new GraphQL service instance. Tracing enables the trace field
+// of transactions, which re-executes them.
+func New(backend ethapi.Backend, endpoint string, cors, vhosts []string, timeouts rpc.HTTPTimeouts, tracing bool) (*Service, error) {
 	return &Service{
 		endpoint: endpoint,
 		cors:     cors,
 		vhosts:   vhosts,
 		timeouts: timeouts,
 		backend:  backend,
+		tracing:  tracing,
+	}, nil
+}
+
+// NewMounted constructs a GraphQL service which is served on the node's HTTP RPC
+// endpoint under the given path prefix instead of opening its own listener. Queries
+// are answered on the prefix, the query browser is served on <prefix>/ui.
+func NewMounted(backend ethapi.Backend, prefix string, cors, vhosts []string, tracing bool) (*Service, error) {
+	if !strings.HasPrefix(prefix, "/") || prefix == "/" {
+		return nil, fmt.Errorf("invalid GraphQL path prefix %q", prefix)
+	}
+	return &Service{
+		prefix:  strings.TrimSuffix(prefix, "/"),
+		cors:    cors,
+		vhosts:  vhosts,
+		backend: backend,
+		tracing: tracing,
 	}, nil
 }
 
@@ -60,35 +81,91 @@ func (s *Service) APIs() []rpc.API { return nil }
 // Start is called after all services have been constructed and the networking
 // layer was also initialized to spawn any goroutines required by the service.
 func (s *Service) Start(server *p2p.Server) error {
-	var err error
-	s.handler, err = newHandler(s.backend)
+	if s.prefix != "" {
+		// The node serves the handler, see HTTPHandler.
+		handler, ws, err := newMountedHandler(s.backend, s.prefix, s.cors, s.tracing)
+		if err != nil {
+			return err
+		}
+		s.handler = rpc.NewHTTPWSHandler(rpc.NewHTTPHandler(s.cors, s.vhosts, handler), ws)
+		return nil
+	}
+	handler, ws, err := newHandler(s.backend, s.cors, s.tracing)
 	if err != nil {
 		return err
 	}
 	if s.listener, err = net.Listen("tcp", s.endpoint); err != nil {
 		return err
 	}
-	go rpc.NewHTTPServer(s.cors, s.vhosts, s.timeouts, s.handler).Serve(s.listener)
+	// Subscriptions bypass the HTTP wrappers, the gzip handler can't be upgraded.
+	srv := rpc.NewHTTPServer(s.cors, s.vhosts, s.timeouts, handler)
+	srv.Handler = rpc.NewHTTPWSHandler(srv.Handler, ws)
+	s.handler = srv.Handler
+	go srv.Serve(s.listener)
 	log.Info("GraphQL endpoint opened", "url", fmt.Sprintf("http://%s", s.endpoint))
 	return nil
 }
 
-// newHandler returns a new `http.Handler` that will answer GraphQL queries.
-// It additionally exports an interactive query browser on the / endpoint.
-func newHandler(backend ethapi.Backend) (http.Handler, error) {
-	q := Resolver{backend}
+// HTTPHandler returns the handler to be served on the node's HTTP endpoint if the
+// service was created by NewMounted.
+func (s *Service) HTTPHandler() (string, http.Handler) {
+	if s.prefix == "" {
+		return "", nil
+	}
+	return s.prefix, s.handler
+}
+
+// parseSchemas parses the schema answering requests and the one executing
+// subscriptions, including the tracing fields if enabled.
+func parseSchemas(backend ethapi.Backend, tracing bool) (*graphql.Schema, *graphql.Schema, error) {
+	sdl, events := schema, subscriptionSchema
+	if tracing {
+		sdl, events = withTracing(sdl), withTracing(events)
+	}
+	s, err := graphql.ParseSchema(sdl, &Resolver{backend})
+	if err != nil {
+		return nil, nil, err
+	}
+	e, err := graphql.ParseSchema(events, &subscriptionResolver{backend})
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, e, nil
+}
 
-	s, err := graphql.ParseSchema(schema, &q)
+// newHandler returns a new `http.Handler` that will answer GraphQL queries.
+// It additionally exports an interactive query browser on the / endpoint. The
+// second handler serves subscriptions to WebSocket clients from the given origins.
+func newHandler(backend ethapi.Backend, origins []string, tracing bool) (http.Handler, http.Handler, error) {
+	s, events, err := parseSchemas(backend, tracing)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	ws := newWSHandler(backend, s, events, origins)
 	h := &relay.Handler{Schema: s}
 
 	mux := http.NewServeMux()
 	mux.Handle("/", GraphiQL{})
 	mux.Handle("/graphql", h)
 	mux.Handle("/graphql/", h)
-	return mux, nil
+	return mux, ws, nil
+}
+
+// newMountedHandler returns a handler that answers GraphQL queries on the prefix and
+// serves the query browser on <prefix>/ui, along with the WebSocket handler.
+func newMountedHandler(backend ethapi.Backend, prefix string, origins []string, tracing bool) (http.Handler, http.Handler, error) {
+	s, events, err := parseSchemas(backend, tracing)
+	if err != nil {
+		return nil, nil, err
+	}
+	ws := newWSHandler(backend, s, events, origins)
+	h := &relay.Handler{Schema: s}
+
+	mux := http.NewServeMux()
+	mux.Handle(prefix, h)
+	mux.Handle(prefix+"/", h)
+	mux.Handle(prefix+"/ui", GraphiQL{Endpoint: prefix})
+	return mux, ws, nil
 }
 
 // Stop terminates all goroutines belonging to the service, blocking until they
@@ -0,0 +1,642 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/event"
+	"github.com/groshproject/grosh-core/internal/ethapi"
+	"github.com/groshproject/grosh-core/log"
+)
+
+// The subscriptions are served using the graphql-ws protocol of the
+// subscriptions-transport-ws library, which most GraphQL clients support.
+const wsProtocol = "graphql-ws"
+
+// Message types of the graphql-ws protocol.
+const (
+	gqlConnectionInit      = "connection_init"
+	gqlConnectionAck       = "connection_ack"
+	gqlConnectionError     = "connection_error"
+	gqlConnectionKeepAlive = "ka"
+	gqlConnectionTerminate = "connection_terminate"
+	gqlStart               = "start"
+	gqlStop                = "stop"
+	gqlData                = "data"
+	gqlError               = "error"
+	gqlComplete            = "complete"
+)
+
+const (
+	wsKeepAliveInterval  = 30 * time.Second
+	wsWriteTimeout       = 10 * time.Second
+	wsMaxMessageSize     = 128 * 1024
+	maxSubscriptions     = 100  // maximum number of active operations per connection
+	subscriptionChanSize = 64   // buffer of the event feeds
+	maxPendingEvents     = 1024 // events queued for a subscriber before it is dropped
+)
+
+var (
+	errTooManySubscriptions = errors.New("too many active subscriptions")
+	errSubscriberTooSlow    = errors.New("subscriber too slow, events dropped")
+	errSubscriptionFields   = errors.New("a subscription must select exactly one field")
+	errDuplicateOperation   = errors.New("operation id already in use")
+)
+
+// wsMessage is a message of the graphql-ws protocol.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsRequest is the payload of a start message.
+type wsRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// wsHandler serves GraphQL subscriptions, queries and mutations to WebSocket
+// clients.
+type wsHandler struct {
+	backend  ethapi.Backend
+	schema   *graphql.Schema // schema with the query, mutation and subscription roots
+	events   *graphql.Schema // schema executing subscriptions once per event
+	upgrader websocket.Upgrader
+}
+
+func newWSHandler(backend ethapi.Backend, schema, events *graphql.Schema, origins []string) *wsHandler {
+	return &wsHandler{
+		backend: backend,
+		schema:  schema,
+		events:  events,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			Subprotocols:    []string{wsProtocol},
+			CheckOrigin:     originChecker(origins),
+		},
+	}
+}
+
+// originChecker returns a function verifying the origin of WebSocket handshakes
+// against the allowed CORS domains.
+func originChecker(origins []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true // not a browser, the check doesn't add security
+		}
+		for _, allowed := range origins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug("GraphQL WebSocket upgrade failed", "err", err)
+		return
+	}
+	// The HTTP server may have set deadlines for the request, remove them.
+	conn.UnderlyingConn().SetDeadline(time.Time{})
+	newWSConn(h, conn).serve()
+}
+
+// wsConn is a WebSocket connection of a GraphQL client.
+type wsConn struct {
+	h    *wsHandler
+	conn *websocket.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	writeLock sync.Mutex
+	opsLock   sync.Mutex
+	ops       map[string]context.CancelFunc
+
+	keepAliveOnce sync.Once
+}
+
+func newWSConn(h *wsHandler, conn *websocket.Conn) *wsConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &wsConn{
+		h:      h,
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+		ops:    make(map[string]context.CancelFunc),
+	}
+}
+
+// serve reads the messages of the client until the connection is closed.
+func (c *wsConn) serve() {
+	defer c.close()
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			log.Trace("GraphQL WebSocket read failed", "err", err)
+			return
+		}
+		switch msg.Type {
+		case gqlConnectionInit:
+			c.write(&wsMessage{Type: gqlConnectionAck})
+			c.keepAliveOnce.Do(func() {
+				c.write(&wsMessage{Type: gqlConnectionKeepAlive})
+				go c.keepAlive()
+			})
+		case gqlStart:
+			var req wsRequest
+			if err := json.Unmarshal(msg.Payload, &req); err != nil {
+				c.writeError(msg.ID, err)
+				continue
+			}
+			c.start(msg.ID, &req)
+		case gqlStop:
+			c.stop(msg.ID)
+		case gqlConnectionTerminate:
+			return
+		default:
+			payload, _ := json.Marshal(map[string]string{"message": "unknown message type " + msg.Type})
+			c.write(&wsMessage{ID: msg.ID, Type: gqlConnectionError, Payload: payload})
+		}
+	}
+}
+
+// close ends all operations and the connection.
+func (c *wsConn) close() {
+	c.cancel()
+	c.conn.Close()
+}
+
+// keepAlive sends keep-alive messages until the connection is closed.
+func (c *wsConn) keepAlive() {
+	ticker := time.NewTicker(wsKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(&wsMessage{Type: gqlConnectionKeepAlive}); err != nil {
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// write sends a message to the client. Writes failing because the client is too
+// slow close the connection.
+func (c *wsConn) write(msg *wsMessage) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	err := c.conn.WriteJSON(msg)
+	if err != nil {
+		c.close()
+	}
+	return err
+}
+
+func (c *wsConn) writeError(id string, err error) {
+	payload, _ := json.Marshal(map[string]string{"message": err.Error()})
+	c.write(&wsMessage{ID: id, Type: gqlError, Payload: payload})
+}
+
+func (c *wsConn) writeData(id string, resp *graphql.Response) error {
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return c.write(&wsMessage{ID: id, Type: gqlData, Payload: payload})
+}
+
+// start begins executing an operation. Queries and mutations are answered once,
+// subscriptions deliver a result per event until stopped. All operations count
+// towards the limit of the connection while they are running.
+func (c *wsConn) start(id string, req *wsRequest) {
+	c.opsLock.Lock()
+	defer c.opsLock.Unlock()
+
+	if _, ok := c.ops[id]; ok {
+		c.writeError(id, errDuplicateOperation)
+		return
+	}
+	if len(c.ops) >= maxSubscriptions {
+		c.writeError(id, errTooManySubscriptions)
+		return
+	}
+	query, isSubscription := subscriptionAsQuery(req.Query, req.OperationName)
+	if !isSubscription {
+		ctx, cancel := context.WithCancel(c.ctx)
+		c.ops[id] = cancel
+		go c.runQuery(ctx, id, req)
+		return
+	}
+	// Validate the subscription and find out what it is subscribing to.
+	if errs := c.h.schema.Validate(req.Query); len(errs) > 0 {
+		c.writeData(id, &graphql.Response{Errors: errs})
+		c.write(&wsMessage{ID: id, Type: gqlComplete})
+		return
+	}
+	setup := new(subscriptionSetup)
+	resp := c.h.events.Exec(context.WithValue(c.ctx, subscriptionSetupKey{}, setup), query, req.OperationName, req.Variables)
+	if len(resp.Errors) > 0 {
+		c.writeData(id, resp)
+		c.write(&wsMessage{ID: id, Type: gqlComplete})
+		return
+	}
+	if len(setup.fields) != 1 {
+		c.writeError(id, errSubscriptionFields)
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.ops[id] = cancel
+
+	events := make(chan interface{}, maxPendingEvents)
+	sub := c.subscribe(setup, events)
+	go c.runSubscription(ctx, id, query, req, sub, events)
+}
+
+// runQuery executes a query or mutation and sends its result, unless it was
+// stopped in the meantime.
+func (c *wsConn) runQuery(ctx context.Context, id string, req *wsRequest) {
+	defer c.remove(id)
+
+	resp := c.h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	if ctx.Err() == nil {
+		c.writeData(id, resp)
+	}
+	if c.ctx.Err() == nil {
+		c.write(&wsMessage{ID: id, Type: gqlComplete})
+	}
+}
+
+// remove ends an operation and releases its slot.
+func (c *wsConn) remove(id string) {
+	c.opsLock.Lock()
+	defer c.opsLock.Unlock()
+
+	if cancel, ok := c.ops[id]; ok {
+		cancel()
+		delete(c.ops, id)
+	}
+}
+
+// stop ends an operation.
+func (c *wsConn) stop(id string) {
+	c.opsLock.Lock()
+	cancel, ok := c.ops[id]
+	c.opsLock.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// runSubscription executes the subscription for every event until it is stopped.
+func (c *wsConn) runSubscription(ctx context.Context, id string, query string, req *wsRequest, sub event.Subscription, events chan interface{}) {
+	defer func() {
+		sub.Unsubscribe()
+		c.remove(id)
+	}()
+	for {
+		select {
+		case ev := <-events:
+			if err, ok := ev.(error); ok {
+				c.writeError(id, err)
+				return
+			}
+			resp := c.h.events.Exec(context.WithValue(ctx, subscriptionEventKey{}, ev), query, req.OperationName, req.Variables)
+			if err := c.writeData(id, resp); err != nil {
+				return
+			}
+		case err := <-sub.Err():
+			if err != nil {
+				c.writeError(id, err)
+			}
+			return
+		case <-ctx.Done():
+			if c.ctx.Err() == nil {
+				c.write(&wsMessage{ID: id, Type: gqlComplete})
+			}
+			return
+		}
+	}
+}
+
+// subscribe subscribes to the events of the backend needed by the subscription
+// and queues them for execution. A subscriber falling too far behind is dropped,
+// so it can't hold up the event feeds.
+func (c *wsConn) subscribe(setup *subscriptionSetup, events chan interface{}) event.Subscription {
+	var (
+		dropped bool
+		queue   = func(ev interface{}) bool {
+			if dropped {
+				return false
+			}
+			select {
+			case events <- ev:
+				return true
+			default:
+				// Make room for the error, the subscription ends with it.
+				dropped = true
+				select {
+				case <-events:
+				default:
+				}
+				events <- errSubscriberTooSlow
+				return false
+			}
+		}
+		backend = c.h.backend
+	)
+	switch setup.fields[0] {
+	case "newBlocks":
+		ch := make(chan core.ChainEvent, subscriptionChanSize)
+		return forward(backend.SubscribeChainEvent(ch), func(quit <-chan struct{}) bool {
+			select {
+			case ev := <-ch:
+				return queue(ev.Block)
+			case <-quit:
+				return false
+			}
+		})
+	case "logs":
+		ch := make(chan []*types.Log, subscriptionChanSize)
+		addresses, topics := setup.filter.criteria()
+		return forward(backend.SubscribeLogsEvent(ch), func(quit <-chan struct{}) bool {
+			select {
+			case logs := <-ch:
+				for _, log := range logs {
+					if !log.Removed && matchLog(log, addresses, topics) && !queue(log) {
+						return false
+					}
+				}
+				return true
+			case <-quit:
+				return false
+			}
+		})
+	case "pendingTransactions":
+		ch := make(chan core.NewTxsEvent, subscriptionChanSize)
+		return forward(backend.SubscribeNewTxsEvent(ch), func(quit <-chan struct{}) bool {
+			select {
+			case ev := <-ch:
+				for _, tx := range ev.Txs {
+					if !queue(tx) {
+						return false
+					}
+				}
+				return true
+			case <-quit:
+				return false
+			}
+		})
+	}
+	panic("unknown subscription field " + setup.fields[0])
+}
+
+// forward runs the given step function for the feed subscription until it is
+// unsubscribed or the step function returns false.
+func forward(sub event.Subscription, step func(quit <-chan struct{}) bool) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for step(quit) {
+		}
+		// Wait for the consumer to tear down the subscription.
+		<-quit
+		return nil
+	})
+}
+
+// matchLog reports whether the log matches the address and topic restrictions.
+func matchLog(log *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		found := false
+		for _, addr := range addresses {
+			if log.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(topics) > len(log.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		if len(sub) == 0 {
+			continue // empty rule set == wildcard
+		}
+		found := false
+		for _, topic := range sub {
+			if log.Topics[i] == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// subscriptionAsQuery finds the operation to execute in the document and reports
+// whether it is a subscription. If so, the document is returned with the
+// operation turned into a query, which can be executed on the subscription schema.
+// The keyword is padded with spaces to keep the positions of errors intact.
+func subscriptionAsQuery(doc string, operationName string) (string, bool) {
+	var (
+		depth  int
+		ops    []int // offsets of the operation keywords at the top level
+		names  []string
+		expect bool // whether the next top level name is an operation name
+	)
+	for i := 0; i < len(doc); i++ {
+		switch ch := doc[i]; {
+		case ch == '#':
+			for i < len(doc) && doc[i] != '\n' && doc[i] != '\r' {
+				i++
+			}
+		case ch == '"':
+			if strings.HasPrefix(doc[i:], `"""`) {
+				end := strings.Index(doc[i+3:], `"""`)
+				if end < 0 {
+					return doc, false
+				}
+				i += end + 5
+				continue
+			}
+			for i++; i < len(doc) && doc[i] != '"'; i++ {
+				if doc[i] == '\\' {
+					i++
+				}
+			}
+		case ch == '{' || ch == '(' || ch == '[':
+			if depth == 0 && expect {
+				names = append(names, "")
+				expect = false
+			}
+			if depth == 0 && ch == '{' && len(ops) == len(names) {
+				// Shorthand query without keyword.
+				ops, names = append(ops, -1), append(names, "")
+			}
+			depth++
+		case ch == '}' || ch == ')' || ch == ']':
+			depth--
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			start := i
+			for i+1 < len(doc) && (doc[i+1] == '_' || doc[i+1] >= 'a' && doc[i+1] <= 'z' || doc[i+1] >= 'A' && doc[i+1] <= 'Z' || doc[i+1] >= '0' && doc[i+1] <= '9') {
+				i++
+			}
+			if depth > 0 {
+				continue
+			}
+			switch word := doc[start : i+1]; {
+			case expect:
+				names, expect = append(names, word), false
+			case word == "query" || word == "mutation" || word == "subscription":
+				ops, expect = append(ops, start), true
+			case word == "fragment":
+				// Fragments have a name, but aren't operations.
+				ops, expect = append(ops, -2), true
+			}
+		}
+	}
+	if expect {
+		names = append(names, "")
+	}
+	for i, offset := range ops {
+		if offset < 0 || i >= len(names) {
+			continue
+		}
+		if operationName != "" && names[i] != operationName {
+			continue
+		}
+		if !strings.HasPrefix(doc[offset:], "subscription") {
+			return doc, false
+		}
+		return doc[:offset] + "query       " + doc[offset+len("subscription"):], true
+	}
+	return doc, false
+}
+
+// subscriptionSetupKey is the context key of the recorder of the fields selected
+// by a subscription.
+type subscriptionSetupKey struct{}
+
+// subscriptionEventKey is the context key of the event a subscription is
+// executed for.
+type subscriptionEventKey struct{}
+
+// subscriptionSetup records the fields and arguments selected by a subscription.
+type subscriptionSetup struct {
+	lock   sync.Mutex
+	fields []string
+	filter FilterCriteria
+}
+
+func (s *subscriptionSetup) record(field string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.fields = append(s.fields, field)
+}
+
+// subscriptionResolver is the root of the subscription schema. When executing a
+// subscription for the first time, it records the selected field. Afterwards it
+// resolves the field to the event the subscription is executed for.
+type subscriptionResolver struct {
+	backend ethapi.Backend
+}
+
+func (r *subscriptionResolver) NewBlocks(ctx context.Context) *Block {
+	if setup, ok := ctx.Value(subscriptionSetupKey{}).(*subscriptionSetup); ok {
+		setup.record("newBlocks")
+		return nil
+	}
+	block, ok := ctx.Value(subscriptionEventKey{}).(*types.Block)
+	if !ok {
+		return nil
+	}
+	return &Block{
+		backend: r.backend,
+		hash:    block.Hash(),
+		header:  block.Header(),
+		block:   block,
+	}
+}
+
+func (r *subscriptionResolver) Logs(ctx context.Context, args struct{ Filter *BlockFilterCriteria }) *Log {
+	if setup, ok := ctx.Value(subscriptionSetupKey{}).(*subscriptionSetup); ok {
+		setup.record("logs")
+		if args.Filter != nil {
+			setup.filter = FilterCriteria{Addresses: args.Filter.Addresses, Topics: args.Filter.Topics}
+		}
+		return nil
+	}
+	log, ok := ctx.Value(subscriptionEventKey{}).(*types.Log)
+	if !ok {
+		return nil
+	}
+	return &Log{
+		backend:     r.backend,
+		transaction: &Transaction{backend: r.backend, hash: log.TxHash},
+		log:         log,
+	}
+}
+
+func (r *subscriptionResolver) PendingTransactions(ctx context.Context) *Transaction {
+	if setup, ok := ctx.Value(subscriptionSetupKey{}).(*subscriptionSetup); ok {
+		setup.record("pendingTransactions")
+		return nil
+	}
+	tx, ok := ctx.Value(subscriptionEventKey{}).(*types.Transaction)
+	if !ok {
+		return nil
+	}
+	return &Transaction{
+		backend: r.backend,
+		hash:    tx.Hash(),
+		tx:      tx,
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/groshproject/grosh-core/core/vm"
+	"github.com/groshproject/grosh-core/eth"
+)
+
+const (
+	// traceReexec is the number of blocks re-executed to regenerate missing
+	// historical state for tracing. It is kept low, as tracing over GraphQL
+	// is not limited to trusted callers like the debug API.
+	traceReexec = 16
+
+	// defaultTraceTimeout is the time a JavaScript tracer may run if no timeout
+	// is given, maxTraceTimeout the longest time a caller may ask for.
+	defaultTraceTimeout = 5 * time.Second
+	maxTraceTimeout     = 10 * time.Second
+
+	// maxTraceLogs is the maximum number of structured logs of a trace.
+	maxTraceLogs = 10000
+)
+
+var errTracePending = errors.New("pending transactions can't be traced")
+
+// JSON is an arbitrary JSON value, used for results without a fixed schema.
+type JSON json.RawMessage
+
+func (JSON) ImplementsGraphQLType(name string) bool { return name == "JSON" }
+
+func (j *JSON) UnmarshalGraphQL(input interface{}) error {
+	return errors.New("JSON values are only used for output")
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == nil {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// Trace re-executes the transaction with tracing enabled. The field is only part
+// of the schema if tracing was enabled for the service.
+func (t *Transaction) Trace(ctx context.Context, args struct {
+	Tracer  *string
+	Timeout *string
+}) (*JSON, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, errTracePending
+	}
+	block, err := t.block.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block of transaction %#x not found", t.hash)
+	}
+	timeout := defaultTraceTimeout
+	if args.Timeout != nil {
+		if timeout, err = time.ParseDuration(*args.Timeout); err != nil {
+			return nil, err
+		}
+		if timeout > maxTraceTimeout {
+			timeout = maxTraceTimeout
+		}
+	}
+	config := &eth.TraceConfig{
+		LogConfig: &vm.LogConfig{DisableMemory: true, DisableStorage: true, Limit: maxTraceLogs},
+		Tracer:    args.Tracer,
+		Timeout:   new(string),
+	}
+	*config.Timeout = timeout.String()
+
+	msg, vmctx, statedb, err := t.backend.StateAtTransaction(ctx, block, int(t.index), traceReexec)
+	if err != nil {
+		return nil, err
+	}
+	res, err := eth.TraceTx(ctx, msg, vmctx, statedb, t.backend.ChainConfig(), config)
+	if err != nil {
+		return nil, err
+	}
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	var result json.RawMessage
+	if raw, ok := res.(json.RawMessage); ok {
+		result = raw
+	} else if result, err = json.Marshal(res); err != nil {
+		return nil, err
+	}
+	return (*JSON)(&result), nil
+}
@@ -28,10 +28,18 @@ import (
 	"github.com/groshproject/grosh-core/common"
 	"github.com/groshproject/grosh-core/common/hexutil"
 	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/event"
 	"github.com/groshproject/grosh-core/rlp"
 	"github.com/groshproject/grosh-core/rpc"
 )
 
+// Subscription is a subscription which survives connection loss in reconnecting
+// mode. Gaps receives a *rpc.SubscriptionGapError for every interruption.
+type Subscription interface {
+	grosh.Subscription
+	Gaps() <-chan error
+}
+
 // Client defines typed wrappers for the Grosh RPC API.
 type Client struct {
 	c *rpc.Client
@@ -50,6 +58,16 @@ func DialContext(ctx context.Context, rawurl string) (*Client, error) {
 	return NewClient(c), nil
 }
 
+// DialReconnecting connects a client to the given URL. The underlying RPC client
+// reconnects in reconnecting mode, re-establishing subscriptions on connection loss.
+func DialReconnecting(ctx context.Context, rawurl string, config rpc.ReconnectConfig) (*Client, error) {
+	c, err := rpc.DialReconnecting(ctx, rawurl, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c), nil
+}
+
 // NewClient creates a client that uses the given RPC client.
 func NewClient(c *rpc.Client) *Client {
 	return &Client{c}
@@ -180,6 +198,59 @@ func (ec *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.H
 	return head, err
 }
 
+// BlockNumber returns the most recent block number.
+func (ec *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	var result hexutil.Uint64
+	err := ec.c.CallContext(ctx, &result, "eth_blockNumber")
+	return uint64(result), err
+}
+
+// UncleByBlockHashAndIndex returns the header of the uncle at index in the given block.
+func (ec *Client) UncleByBlockHashAndIndex(ctx context.Context, blockHash common.Hash, index uint) (*types.Header, error) {
+	var head *types.Header
+	err := ec.c.CallContext(ctx, &head, "eth_getUncleByBlockHashAndIndex", blockHash, hexutil.Uint(index))
+	if err == nil && head == nil {
+		err = grosh.NotFound
+	}
+	return head, err
+}
+
+// UncleByBlockNumberAndIndex returns the header of the uncle at index in the given
+// canonical block. If number is nil, the latest known block is used.
+func (ec *Client) UncleByBlockNumberAndIndex(ctx context.Context, number *big.Int, index uint) (*types.Header, error) {
+	var head *types.Header
+	err := ec.c.CallContext(ctx, &head, "eth_getUncleByBlockNumberAndIndex", toBlockNumArg(number), hexutil.Uint(index))
+	if err == nil && head == nil {
+		err = grosh.NotFound
+	}
+	return head, err
+}
+
+// UncleCountByBlockHash returns the number of uncles in the given block.
+func (ec *Client) UncleCountByBlockHash(ctx context.Context, blockHash common.Hash) (uint, error) {
+	var num *hexutil.Uint
+	if err := ec.c.CallContext(ctx, &num, "eth_getUncleCountByBlockHash", blockHash); err != nil {
+		return 0, err
+	}
+	if num == nil {
+		return 0, grosh.NotFound
+	}
+	return uint(*num), nil
+}
+
+// UncleCountByBlockNumber returns the number of uncles in the given canonical block.
+// If number is nil, the latest known block is used.
+func (ec *Client) UncleCountByBlockNumber(ctx context.Context, number *big.Int) (uint, error) {
+	var num *hexutil.Uint
+	if err := ec.c.CallContext(ctx, &num, "eth_getUncleCountByBlockNumber", toBlockNumArg(number)); err != nil {
+		return 0, err
+	}
+	if num == nil {
+		return 0, grosh.NotFound
+	}
+	return uint(*num), nil
+}
+
 type rpcTransaction struct {
 	tx *types.Transaction
 	txExtraInfo
@@ -278,6 +349,37 @@ func (ec *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*
 	return r, err
 }
 
+// RawTransactionByHash returns the RLP encoding of the transaction with the given hash.
+func (ec *Client) RawTransactionByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	var raw hexutil.Bytes
+	err := ec.c.CallContext(ctx, &raw, "eth_getRawTransactionByHash", hash)
+	if err == nil && len(raw) == 0 {
+		err = grosh.NotFound
+	}
+	return raw, err
+}
+
+// RawTransactionInBlock returns the RLP encoding of the transaction at index in the
+// given block.
+func (ec *Client) RawTransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) ([]byte, error) {
+	var raw hexutil.Bytes
+	err := ec.c.CallContext(ctx, &raw, "eth_getRawTransactionByBlockHashAndIndex", blockHash, hexutil.Uint(index))
+	if err == nil && len(raw) == 0 {
+		err = grosh.NotFound
+	}
+	return raw, err
+}
+
+// BlockReceipts returns the receipts of all transactions in the given block.
+func (ec *Client) BlockReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error) {
+	var receipts types.Receipts
+	err := ec.c.CallContext(ctx, &receipts, "eth_getBlockReceipts", blockHash)
+	if err == nil && receipts == nil {
+		err = grosh.NotFound
+	}
+	return receipts, err
+}
+
 func toBlockNumArg(number *big.Int) string {
 	if number == nil {
 		return "latest"
@@ -318,6 +420,69 @@ func (ec *Client) SyncProgress(ctx context.Context) (*grosh.SyncProgress, error)
 	}, nil
 }
 
+// SubscribeSyncStatus subscribes to notifications about the sync status of the node.
+// The progress is sent when a sync starts, nil is sent when it ends.
+func (ec *Client) SubscribeSyncStatus(ctx context.Context, ch chan<- *grosh.SyncProgress) (Subscription, error) {
+	return ec.subscribeConverted(ctx, func(raw json.RawMessage, quit <-chan struct{}) error {
+		var status struct {
+			Syncing bool
+			Status  grosh.SyncProgress
+		}
+		var progress *grosh.SyncProgress
+		if err := json.Unmarshal(raw, &status.Syncing); err != nil {
+			if err := json.Unmarshal(raw, &status); err != nil {
+				return err
+			}
+		}
+		if status.Syncing {
+			progress = &status.Status
+		}
+		select {
+		case ch <- progress:
+		case <-quit:
+		}
+		return nil
+	}, "syncing")
+}
+
+// subscribeConverted creates a subscription whose raw notifications are decoded
+// and delivered by the given function. Delivery must return early when quit is
+// closed. A decoding error ends the subscription.
+func (ec *Client) subscribeConverted(ctx context.Context, deliver func(raw json.RawMessage, quit <-chan struct{}) error, args ...interface{}) (Subscription, error) {
+	raws := make(chan json.RawMessage)
+	sub, err := ec.c.EthSubscribe(ctx, raws, args...)
+	if err != nil {
+		return nil, err
+	}
+	converted := event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case raw := <-raws:
+				if err := deliver(raw, quit); err != nil {
+					return err
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	})
+	return &convertedSubscription{converted, sub}, nil
+}
+
+// convertedSubscription is a subscription delivering decoded notifications, which
+// reports the gaps of the underlying RPC subscription.
+type convertedSubscription struct {
+	event.Subscription
+	raw *rpc.ClientSubscription
+}
+
+func (sub *convertedSubscription) Gaps() <-chan error {
+	return sub.raw.Gaps()
+}
+
 // SubscribeNewHead subscribes to notifications about the current blockchain head
 // on the given channel.
 func (ec *Client) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (grosh.Subscription, error) {
@@ -452,7 +617,11 @@ func (ec *Client) PendingTransactionCount(ctx context.Context) (uint, error) {
 	return uint(num), err
 }
 
-// TODO: SubscribePendingTransactions (needs server side)
+// SubscribePendingTransactions subscribes to the hashes of transactions entering
+// the transaction pool of the node.
+func (ec *Client) SubscribePendingTransactions(ctx context.Context, ch chan<- common.Hash) (Subscription, error) {
+	return ec.c.EthSubscribe(ctx, ch, "newPendingTransactions")
+}
 
 // Contract Calling
 
@@ -492,6 +661,34 @@ func (ec *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
 	return (*big.Int)(&hex), nil
 }
 
+type feeHistoryResultMarshaling struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// FeeHistory retrieves the fee market history of the blockCount blocks ending with
+// lastBlock, along with the gas prices paid at the given percentiles of the gas
+// used in each block. If lastBlock is nil, the history ends with the latest block.
+func (ec *Client) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*grosh.FeeHistory, error) {
+	var res feeHistoryResultMarshaling
+	if err := ec.c.CallContext(ctx, &res, "eth_feeHistory", hexutil.Uint(blockCount), toBlockNumArg(lastBlock), rewardPercentiles); err != nil {
+		return nil, err
+	}
+	reward := make([][]*big.Int, len(res.Reward))
+	for i, r := range res.Reward {
+		reward[i] = make([]*big.Int, len(r))
+		for j, r := range r {
+			reward[i][j] = (*big.Int)(r)
+		}
+	}
+	return &grosh.FeeHistory{
+		OldestBlock:  (*big.Int)(res.OldestBlock),
+		Reward:       reward,
+		GasUsedRatio: res.GasUsedRatio,
+	}, nil
+}
+
 // EstimateGas tries to estimate the gas needed to execute a specific transaction based on
 // the current pending state of the backend blockchain. There is no guarantee that this is
 // the true gas limit requirement as other transactions may be added or removed by miners,
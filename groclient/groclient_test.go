@@ -17,11 +17,17 @@
 package groclient
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -33,8 +39,10 @@ import (
 	"github.com/groshproject/grosh-core/core/types"
 	"github.com/groshproject/grosh-core/crypto"
 	"github.com/groshproject/grosh-core/eth"
+	"github.com/groshproject/grosh-core/eth/downloader"
 	"github.com/groshproject/grosh-core/node"
 	"github.com/groshproject/grosh-core/params"
+	"github.com/groshproject/grosh-core/rpc"
 )
 
 // Verify that Client implements the grosh interfaces.
@@ -170,8 +178,11 @@ var (
 
 func newTestBackend(t *testing.T) (*node.Node, []*types.Block) {
 	// Generate test chain.
-	genesis, blocks := generateTestChain()
+	genesis, blocks := generateTestChain(false)
+	return startTestBackend(t, genesis, blocks)
+}
 
+func startTestBackend(t *testing.T, genesis *core.Genesis, blocks []*types.Block) (*node.Node, []*types.Block) {
 	// Start Grosh service.
 	var ethservice *eth.Grosh
 	n, err := node.New(&node.Config{})
@@ -192,7 +203,9 @@ func newTestBackend(t *testing.T) (*node.Node, []*types.Block) {
 	return n, blocks
 }
 
-func generateTestChain() (*core.Genesis, []*types.Block) {
+// generateTestChain creates a chain of one block on top of the genesis. If withTx
+// is set, the block contains a transfer from the test account.
+func generateTestChain(withTx bool) (*core.Genesis, []*types.Block) {
 	db := rawdb.NewMemoryDatabase()
 	config := params.AllEthashProtocolChanges
 	genesis := &core.Genesis{
@@ -204,6 +217,10 @@ func generateTestChain() (*core.Genesis, []*types.Block) {
 	generate := func(i int, g *core.BlockGen) {
 		g.OffsetTime(5)
 		g.SetExtra([]byte("test"))
+		if withTx {
+			tx, _ := types.SignTx(types.NewTransaction(0, common.Address{1}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+			g.AddTx(tx)
+		}
 	}
 	gblock := genesis.ToBlock(db)
 	engine := ethash.NewFaker()
@@ -335,3 +352,264 @@ func TestChainID(t *testing.T) {
 		t.Fatalf("ChainID returned wrong number: %+v", id)
 	}
 }
+
+func TestBlockWrappers(t *testing.T) {
+	backend, chain := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+	ec := NewClient(client)
+
+	number, err := ec.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if number != chain[len(chain)-1].NumberU64() {
+		t.Fatalf("BlockNumber returned wrong number: %d", number)
+	}
+	count, err := ec.UncleCountByBlockHash(context.Background(), chain[1].Hash())
+	if err != nil || count != 0 {
+		t.Fatalf("UncleCountByBlockHash = %d, %v", count, err)
+	}
+	if _, err := ec.UncleCountByBlockHash(context.Background(), common.Hash{1}); err != grosh.NotFound {
+		t.Fatalf("UncleCountByBlockHash of unknown block: %v", err)
+	}
+	if _, err := ec.UncleByBlockNumberAndIndex(context.Background(), nil, 0); err != grosh.NotFound {
+		t.Fatalf("UncleByBlockNumberAndIndex of missing uncle: %v", err)
+	}
+	receipts, err := ec.BlockReceipts(context.Background(), chain[1].Hash())
+	if err != nil || len(receipts) != 0 {
+		t.Fatalf("BlockReceipts = %v, %v", receipts, err)
+	}
+	if _, err := ec.RawTransactionByHash(context.Background(), common.Hash{1}); err != grosh.NotFound {
+		t.Fatalf("RawTransactionByHash of unknown transaction: %v", err)
+	}
+}
+
+func TestBlockReceipts(t *testing.T) {
+	genesis, blocks := generateTestChain(true)
+	backend, chain := startTestBackend(t, genesis, blocks)
+	defer backend.Stop()
+	client, _ := backend.Attach()
+	defer client.Close()
+	ec := NewClient(client)
+
+	receipts, err := ec.BlockReceipts(context.Background(), chain[1].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 1 {
+		t.Fatalf("wrong number of receipts: have %d, want 1", len(receipts))
+	}
+	want, err := ec.TransactionReceipt(context.Background(), chain[1].Transactions()[0].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, _ := json.Marshal(receipts[0])
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(have, wantJSON) {
+		t.Fatalf("receipt mismatch:\nhave %s\nwant %s", have, wantJSON)
+	}
+	// Select the block by number and require canonical hashes.
+	var raw []map[string]interface{}
+	if err := client.Call(&raw, "eth_getBlockReceipts", "0x1"); err != nil || len(raw) != 1 {
+		t.Fatalf("receipts by number: %v, %v", raw, err)
+	}
+	arg := map[string]interface{}{"blockHash": chain[1].Hash(), "requireCanonical": true}
+	if err := client.Call(&raw, "eth_getBlockReceipts", arg); err != nil || len(raw) != 1 {
+		t.Fatalf("receipts by canonical hash: %v, %v", raw, err)
+	}
+	if _, err := ec.BlockReceipts(context.Background(), common.Hash{1}); err != grosh.NotFound {
+		t.Fatalf("receipts of unknown block: %v", err)
+	}
+	if err := client.Call(&raw, "eth_getBlockReceipts", "pending"); err == nil {
+		t.Fatal("expected error for pending block receipts")
+	}
+}
+
+func TestFeeHistory(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+	ec := NewClient(client)
+
+	history, err := ec.FeeHistory(context.Background(), 2, nil, []float64{25, 75})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &grosh.FeeHistory{
+		OldestBlock:  big.NewInt(0),
+		Reward:       [][]*big.Int{{big.NewInt(0), big.NewInt(0)}, {big.NewInt(0), big.NewInt(0)}},
+		GasUsedRatio: []float64{0, 0},
+	}
+	if fmt.Sprintf("%+v", history) != fmt.Sprintf("%+v", want) {
+		t.Fatalf("FeeHistory mismatch: have %+v, want %+v", history, want)
+	}
+	if _, err := ec.FeeHistory(context.Background(), 1, nil, []float64{101}); err == nil {
+		t.Fatal("expected error for invalid percentile")
+	}
+}
+
+func TestSubscribePendingTransactions(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+	ec := NewClient(client)
+
+	hashes := make(chan common.Hash, 1)
+	sub, err := ec.SubscribePendingTransactions(context.Background(), hashes)
+	if err != nil {
+		t.Fatalf("can't subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	signer := types.NewEIP155Signer(params.AllEthashProtocolChanges.ChainID)
+	tx, err := types.SignTx(types.NewTransaction(0, common.Address{1}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("can't send transaction: %v", err)
+	}
+	select {
+	case hash := <-hashes:
+		if hash != tx.Hash() {
+			t.Fatalf("wrong transaction hash: have %x, want %x", hash, tx.Hash())
+		}
+	case err := <-sub.Err():
+		t.Fatalf("subscription failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pending transaction")
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	defer backend.Stop()
+	handler, err := backend.RPCHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Serve websocket connections, keeping track of them to be able to break them.
+	var (
+		connMu sync.Mutex
+		conns  []net.Conn
+	)
+	srv := httptest.NewUnstartedServer(handler.WebsocketHandler([]string{"*"}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateHijacked {
+			connMu.Lock()
+			conns = append(conns, conn)
+			connMu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	config := rpc.ReconnectConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	ec, err := DialReconnecting(context.Background(), "ws://"+srv.Listener.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ec.Close()
+
+	hashes := make(chan common.Hash, 1)
+	txSub, err := ec.SubscribePendingTransactions(context.Background(), hashes)
+	if err != nil {
+		t.Fatalf("can't subscribe to transactions: %v", err)
+	}
+	defer txSub.Unsubscribe()
+	syncSub, err := ec.SubscribeSyncStatus(context.Background(), make(chan *grosh.SyncProgress))
+	if err != nil {
+		t.Fatalf("can't subscribe to sync status: %v", err)
+	}
+	defer syncSub.Unsubscribe()
+
+	// Drop the connection, both subscriptions must report the gap.
+	connMu.Lock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	connMu.Unlock()
+	for name, sub := range map[string]Subscription{"transactions": txSub, "sync status": syncSub} {
+		select {
+		case err := <-sub.Gaps():
+			if _, ok := err.(*rpc.SubscriptionGapError); !ok {
+				t.Fatalf("%s: wrong gap error type %T", name, err)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("%s: subscription ended: %v", name, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: subscription not re-established", name)
+		}
+	}
+	// Notifications are delivered on the new connection.
+	signer := types.NewEIP155Signer(params.AllEthashProtocolChanges.ChainID)
+	tx, err := types.SignTx(types.NewTransaction(0, common.Address{1}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("can't send transaction: %v", err)
+	}
+	select {
+	case hash := <-hashes:
+		if hash != tx.Hash() {
+			t.Fatalf("wrong transaction hash: have %x, want %x", hash, tx.Hash())
+		}
+	case err := <-txSub.Err():
+		t.Fatalf("subscription failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pending transaction")
+	}
+}
+
+func TestSubscribeSyncStatus(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Stop()
+	defer client.Close()
+	ec := NewClient(client)
+
+	var ethservice *eth.Grosh
+	if err := backend.Service(&ethservice); err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(chan *grosh.SyncProgress)
+	sub, err := ec.SubscribeSyncStatus(context.Background(), statuses)
+	if err != nil {
+		t.Fatalf("can't subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	// The node installs the subscription asynchronously, keep posting until the
+	// first status arrives.
+	var status *grosh.SyncProgress
+	for i := 0; status == nil; i++ {
+		if i == 50 {
+			t.Fatal("timeout waiting for sync start")
+		}
+		ethservice.EventMux().Post(downloader.StartEvent{})
+		select {
+		case status = <-statuses:
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	ethservice.EventMux().Post(downloader.DoneEvent{})
+	for {
+		select {
+		case status = <-statuses:
+			if status == nil {
+				return
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for sync end")
+		}
+	}
+}
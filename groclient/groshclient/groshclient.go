@@ -0,0 +1,228 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package groshclient provides typed wrappers for the RPC APIs specific to grosh
+// nodes, complementing the standard API wrappers of package groclient.
+package groshclient
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/groshproject/grosh-core"
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+// Client is a wrapper around rpc.Client that implements grosh-specific functionality.
+//
+// If you want to use the standardized Grosh RPC functionality, use groclient.Client instead.
+type Client struct {
+	c *rpc.Client
+}
+
+// New creates a client that uses the given RPC client.
+func New(c *rpc.Client) *Client {
+	return &Client{c}
+}
+
+// AccountResult is the result of a GetProof operation.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *big.Int        `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        uint64          `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult provides a proof for a key-value pair.
+type StorageResult struct {
+	Key   string   `json:"key"`
+	Value *big.Int `json:"value"`
+	Proof []string `json:"proof"`
+}
+
+// GetProof returns the account and storage values of the specified account including
+// the Merkle-proof. The block number can be nil, in which case the value is taken
+// from the latest known block.
+func (gc *Client) GetProof(ctx context.Context, account common.Address, keys []string, blockNumber *big.Int) (*AccountResult, error) {
+	type storageResult struct {
+		Key   string       `json:"key"`
+		Value *hexutil.Big `json:"value"`
+		Proof []string     `json:"proof"`
+	}
+	type accountResult struct {
+		Address      common.Address  `json:"address"`
+		AccountProof []string        `json:"accountProof"`
+		Balance      *hexutil.Big    `json:"balance"`
+		CodeHash     common.Hash     `json:"codeHash"`
+		Nonce        hexutil.Uint64  `json:"nonce"`
+		StorageHash  common.Hash     `json:"storageHash"`
+		StorageProof []storageResult `json:"storageProof"`
+	}
+	// Avoid sending "null" for an empty key list.
+	if keys == nil {
+		keys = []string{}
+	}
+	var res *accountResult
+	if err := gc.c.CallContext(ctx, &res, "eth_getProof", account, keys, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, grosh.NotFound
+	}
+	storageResults := make([]StorageResult, len(res.StorageProof))
+	for i, st := range res.StorageProof {
+		storageResults[i] = StorageResult{
+			Key:   st.Key,
+			Value: (*big.Int)(st.Value),
+			Proof: st.Proof,
+		}
+	}
+	return &AccountResult{
+		Address:      res.Address,
+		AccountProof: res.AccountProof,
+		Balance:      (*big.Int)(res.Balance),
+		CodeHash:     res.CodeHash,
+		Nonce:        uint64(res.Nonce),
+		StorageHash:  res.StorageHash,
+		StorageProof: storageResults,
+	}, nil
+}
+
+// TraceConfig holds the options of the transaction tracing calls.
+type TraceConfig struct {
+	DisableStorage bool    `json:"disableStorage,omitempty"` // omit storage captures
+	DisableMemory  bool    `json:"disableMemory,omitempty"`  // omit memory captures
+	DisableStack   bool    `json:"disableStack,omitempty"`   // omit stack captures
+	Limit          int     `json:"limit,omitempty"`          // maximum number of struct logs, zero means unlimited
+	Timeout        *string `json:"timeout,omitempty"`        // tracing timeout in Go duration format, e.g. "10s"
+	Reexec         *uint64 `json:"reexec,omitempty"`         // number of blocks to re-execute for missing state
+}
+
+// ExecutionResult is the result of tracing a transaction with the default struct
+// logger.
+type ExecutionResult struct {
+	Gas         uint64      `json:"gas"`
+	Failed      bool        `json:"failed"`
+	ReturnValue string      `json:"returnValue"`
+	StructLogs  []StructLog `json:"structLogs"`
+}
+
+// StructLog is a single step of the EVM captured by the struct logger.
+type StructLog struct {
+	Pc      uint64             `json:"pc"`
+	Op      string             `json:"op"`
+	Gas     uint64             `json:"gas"`
+	GasCost uint64             `json:"gasCost"`
+	Depth   int                `json:"depth"`
+	Error   string             `json:"error,omitempty"`
+	Stack   *[]string          `json:"stack,omitempty"`
+	Memory  *[]string          `json:"memory,omitempty"`
+	Storage *map[string]string `json:"storage,omitempty"`
+}
+
+// TraceTransaction re-executes the given transaction with the default struct logger
+// and returns the captured execution steps.
+func (gc *Client) TraceTransaction(ctx context.Context, hash common.Hash, config *TraceConfig) (*ExecutionResult, error) {
+	var result *ExecutionResult
+	if err := gc.c.CallContext(ctx, &result, "debug_traceTransaction", hash, config); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, grosh.NotFound
+	}
+	return result, nil
+}
+
+// TraceTransactionWithTracer re-executes the given transaction with the named or
+// JavaScript tracer and returns its tracer specific output.
+func (gc *Client) TraceTransactionWithTracer(ctx context.Context, hash common.Hash, tracer string, config *TraceConfig) (json.RawMessage, error) {
+	arg := struct {
+		*TraceConfig
+		Tracer string `json:"tracer"`
+	}{config, tracer}
+	if arg.TraceConfig == nil {
+		arg.TraceConfig = new(TraceConfig)
+	}
+	var result json.RawMessage
+	err := gc.c.CallContext(ctx, &result, "debug_traceTransaction", hash, arg)
+	return result, err
+}
+
+// SubscribeFullPendingTransactions subscribes to the full transactions entering the
+// transaction pool of the node.
+func (gc *Client) SubscribeFullPendingTransactions(ctx context.Context, ch chan<- *types.Transaction) (grosh.Subscription, error) {
+	return gc.c.EthSubscribe(ctx, ch, "newPendingTransactions", true)
+}
+
+// NodeInfo retrieves the information about the host node.
+func (gc *Client) NodeInfo(ctx context.Context) (*p2p.NodeInfo, error) {
+	var result *p2p.NodeInfo
+	err := gc.c.CallContext(ctx, &result, "admin_nodeInfo")
+	return result, err
+}
+
+// Peers retrieves the information about the connected peers.
+func (gc *Client) Peers(ctx context.Context) ([]*p2p.PeerInfo, error) {
+	var result []*p2p.PeerInfo
+	err := gc.c.CallContext(ctx, &result, "admin_peers")
+	return result, err
+}
+
+// AddPeer requests connecting to the remote node given as an enode URL, and
+// maintaining the connection at all times, even reconnecting if it is lost.
+func (gc *Client) AddPeer(ctx context.Context, url string) error {
+	return gc.c.CallContext(ctx, nil, "admin_addPeer", url)
+}
+
+// RemovePeer disconnects from the remote node given as an enode URL and removes
+// it from the list of static peers.
+func (gc *Client) RemovePeer(ctx context.Context, url string) error {
+	return gc.c.CallContext(ctx, nil, "admin_removePeer", url)
+}
+
+// AddTrustedPeer allows the remote node given as an enode URL to always connect,
+// even if the peer slots are full.
+func (gc *Client) AddTrustedPeer(ctx context.Context, url string) error {
+	return gc.c.CallContext(ctx, nil, "admin_addTrustedPeer", url)
+}
+
+// RemoveTrustedPeer removes the remote node given as an enode URL from the trusted
+// peer set.
+func (gc *Client) RemoveTrustedPeer(ctx context.Context, url string) error {
+	return gc.c.CallContext(ctx, nil, "admin_removeTrustedPeer", url)
+}
+
+// Datadir retrieves the data directory of the node.
+func (gc *Client) Datadir(ctx context.Context) (string, error) {
+	var result string
+	err := gc.c.CallContext(ctx, &result, "admin_datadir")
+	return result, err
+}
+
+func toBlockNumArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(number)
+}
@@ -0,0 +1,239 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package groshclient
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/consensus/ethash"
+	"github.com/groshproject/grosh-core/core"
+	"github.com/groshproject/grosh-core/core/rawdb"
+	"github.com/groshproject/grosh-core/core/types"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/eth"
+	"github.com/groshproject/grosh-core/groclient"
+	"github.com/groshproject/grosh-core/grodb/memorydb"
+	"github.com/groshproject/grosh-core/node"
+	"github.com/groshproject/grosh-core/params"
+	"github.com/groshproject/grosh-core/rlp"
+	"github.com/groshproject/grosh-core/trie"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testBalance = big.NewInt(2e15)
+	testTo      = common.Address{0x11}
+)
+
+func newTestBackend(t *testing.T) (*node.Node, []*types.Block) {
+	// Generate test chain.
+	genesis, blocks := generateTestChain()
+
+	// Start Grosh service.
+	var ethservice *eth.Grosh
+	n, err := node.New(&node.Config{})
+	if err != nil {
+		t.Fatalf("can't create new node: %v", err)
+	}
+	n.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		config := &eth.Config{Genesis: genesis}
+		config.Ethash.PowMode = ethash.ModeFake
+		ethservice, err = eth.New(ctx, config)
+		return ethservice, err
+	})
+
+	// Import the test chain.
+	if err := n.Start(); err != nil {
+		t.Fatalf("can't start test node: %v", err)
+	}
+	if _, err := ethservice.BlockChain().InsertChain(blocks[1:]); err != nil {
+		t.Fatalf("can't import test blocks: %v", err)
+	}
+	return n, blocks
+}
+
+func generateTestChain() (*core.Genesis, []*types.Block) {
+	db := rawdb.NewMemoryDatabase()
+	config := params.AllEthashProtocolChanges
+	genesis := &core.Genesis{
+		Config:    config,
+		Alloc:     core.GenesisAlloc{testAddr: {Balance: testBalance}},
+		ExtraData: []byte("test genesis"),
+		Timestamp: 9000,
+	}
+	generate := func(i int, g *core.BlockGen) {
+		g.OffsetTime(5)
+		g.SetExtra([]byte("test"))
+		tx, _ := types.SignTx(types.NewTransaction(0, testTo, big.NewInt(1), params.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+		g.AddTx(tx)
+	}
+	gblock := genesis.ToBlock(db)
+	engine := ethash.NewFaker()
+	blocks, _ := core.GenerateChain(config, gblock, engine, db, 1, generate)
+	blocks = append([]*types.Block{gblock}, blocks...)
+	return genesis, blocks
+}
+
+func TestGetProof(t *testing.T) {
+	backend, chain := newTestBackend(t)
+	defer backend.Stop()
+	client, _ := backend.Attach()
+	defer client.Close()
+	gc := New(client)
+
+	result, err := gc.GetProof(context.Background(), testAddr, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Address != testAddr {
+		t.Fatalf("wrong address: have %x, want %x", result.Address, testAddr)
+	}
+	// The sender paid one wei and the fee of the transfer.
+	want := new(big.Int).Sub(testBalance, big.NewInt(1+int64(params.TxGas)))
+	if result.Balance.Cmp(want) != 0 {
+		t.Fatalf("wrong balance: have %v, want %v", result.Balance, want)
+	}
+	if result.Nonce != 1 {
+		t.Fatalf("wrong nonce: have %d, want 1", result.Nonce)
+	}
+	// Verify the account proof against the state root of the head block.
+	proof := memorydb.New()
+	for _, node := range result.AccountProof {
+		blob, err := hexutil.Decode(node)
+		if err != nil {
+			t.Fatalf("invalid proof node %q: %v", node, err)
+		}
+		proof.Put(crypto.Keccak256(blob), blob)
+	}
+	value, _, err := trie.VerifyProof(chain[1].Root(), crypto.Keccak256(testAddr.Bytes()), proof)
+	if err != nil {
+		t.Fatalf("proof verification failed: %v", err)
+	}
+	var account struct {
+		Nonce    uint64
+		Balance  *big.Int
+		Root     common.Hash
+		CodeHash []byte
+	}
+	if err := rlp.DecodeBytes(value, &account); err != nil {
+		t.Fatalf("invalid account in proof: %v", err)
+	}
+	if account.Balance.Cmp(want) != 0 || !bytes.Equal(account.CodeHash, result.CodeHash.Bytes()) {
+		t.Fatalf("proven account mismatch: %+v", account)
+	}
+	// The proof of the genesis state has the original balance.
+	result, err = gc.GetProof(context.Background(), testAddr, nil, big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Balance.Cmp(testBalance) != 0 {
+		t.Fatalf("wrong genesis balance: have %v, want %v", result.Balance, testBalance)
+	}
+}
+
+func TestTraceTransaction(t *testing.T) {
+	backend, chain := newTestBackend(t)
+	defer backend.Stop()
+	client, _ := backend.Attach()
+	defer client.Close()
+	gc := New(client)
+
+	tx := chain[1].Transactions()[0]
+	result, err := gc.TraceTransaction(context.Background(), tx.Hash(), &TraceConfig{DisableStorage: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Gas != params.TxGas || result.Failed || len(result.StructLogs) != 0 {
+		t.Fatalf("wrong trace result: %+v", result)
+	}
+	raw, err := gc.TraceTransactionWithTracer(context.Background(), tx.Hash(), "callTracer", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(raw, []byte(`"type":"CALL"`)) {
+		t.Fatalf("unexpected call tracer output: %s", raw)
+	}
+	if _, err := gc.TraceTransaction(context.Background(), common.Hash{1}, nil); err == nil {
+		t.Fatal("expected error tracing unknown transaction")
+	}
+}
+
+func TestSubscribeFullPendingTransactions(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	defer backend.Stop()
+	client, _ := backend.Attach()
+	defer client.Close()
+	gc := New(client)
+
+	ch := make(chan *types.Transaction, 1)
+	sub, err := gc.SubscribeFullPendingTransactions(context.Background(), ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	tx, _ := types.SignTx(types.NewTransaction(1, testTo, big.NewInt(1), params.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+	if err := groclient.NewClient(client).SendTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case have := <-ch:
+		if have.Hash() != tx.Hash() {
+			t.Fatalf("wrong transaction: have %x, want %x", have.Hash(), tx.Hash())
+		}
+	case err := <-sub.Err():
+		t.Fatalf("subscription failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pending transaction")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	defer backend.Stop()
+	client, _ := backend.Attach()
+	defer client.Close()
+	gc := New(client)
+
+	info, err := gc.NodeInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil || info.Enode == "" {
+		t.Fatalf("incomplete node info: %+v", info)
+	}
+	peers, err := gc.Peers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 0 {
+		t.Fatalf("unexpected peers: %v", peers)
+	}
+	if err := gc.AddPeer(context.Background(), "invalid"); err == nil {
+		t.Fatal("expected error adding invalid peer")
+	}
+	if _, err := gc.Datadir(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
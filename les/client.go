@@ -241,7 +241,7 @@ func (s *LightGrosh) Start(srvr *p2p.Server) error {
 
 	// clients are searching for the first advertised protocol in the list
 	protocolVersion := AdvertiseProtocolVersions[0]
-	s.serverPool.start(srvr, lesTopic(s.blockchain.Genesis().Hash(), protocolVersion))
+	s.serverPool.start(srvr, s.blockchain.Genesis().Hash(), protocolVersion)
 	return nil
 }
 
@@ -107,6 +107,7 @@ func (h *clientHandler) handle(p *peer) error {
 	)
 	if err := p.Handshake(td, hash, number, h.backend.blockchain.Genesis().Hash(), nil); err != nil {
 		p.Log().Debug("Light Grosh handshake failed", "err", err)
+		p.Report(p2p.ScoreBad)
 		return err
 	}
 	// Register the peer locally
@@ -134,6 +135,7 @@ func (h *clientHandler) handle(p *peer) error {
 		if err := h.handleMsg(p); err != nil {
 			p.Log().Debug("Light Grosh message handling failed", "err", err)
 			p.fcServer.DumpLogs()
+			reportError(p, err)
 			return err
 		}
 	}
@@ -165,6 +167,7 @@ func (h *clientHandler) handleMsg(p *peer) error {
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
 		if err := req.sanityCheck(); err != nil {
+			p.Report(p2p.ScoreInvalid)
 			return err
 		}
 		update, size := req.Update.decode()
@@ -180,6 +183,7 @@ func (h *clientHandler) handleMsg(p *peer) error {
 			if p.announceType == announceTypeSigned {
 				if err := req.checkSignature(p.ID(), update); err != nil {
 					p.Log().Trace("Invalid announcement signature", "err", err)
+					p.Report(p2p.ScoreInvalid)
 					return err
 				}
 				p.Log().Trace("Valid announcement signature")
@@ -202,6 +206,8 @@ func (h *clientHandler) handleMsg(p *peer) error {
 		} else {
 			if err := h.downloader.DeliverHeaders(p.id, resp.Headers); err != nil {
 				log.Debug("Failed to deliver headers", "err", err)
+			} else if len(resp.Headers) > 0 {
+				p.Report(p2p.ScoreGood)
 			}
 		}
 	case BlockBodiesMsg:
@@ -313,16 +319,23 @@ func (h *clientHandler) handleMsg(p *peer) error {
 	// Deliver the received response to retriever.
 	if deliverMsg != nil {
 		if err := h.backend.retriever.deliver(p, deliverMsg); err != nil {
+			p.Report(p2p.ScoreBad)
 			p.responseErrors++
 			if p.responseErrors > maxResponseErrors {
 				return err
 			}
+		} else {
+			p.Report(p2p.ScoreGood)
 		}
 	}
 	return nil
 }
 
+// removePeer lowers the reputation score of a misbehaving server and disconnects it.
 func (h *clientHandler) removePeer(id string) {
+	if p := h.backend.peers.Peer(id); p != nil {
+		p.Report(p2p.ScoreBad)
+	}
 	h.backend.peers.Unregister(id)
 }
 
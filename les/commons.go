@@ -17,6 +17,7 @@
 package les
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
 	"sync"
@@ -29,16 +30,43 @@ import (
 	"github.com/groshproject/grosh-core/grodb"
 	"github.com/groshproject/grosh-core/light"
 	"github.com/groshproject/grosh-core/p2p"
-	"github.com/groshproject/grosh-core/p2p/discv5"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/params"
+	"github.com/groshproject/grosh-core/rlp"
 )
 
+// protocolError is returned for messages which violate the protocol.
+type protocolError struct {
+	code errCode
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return fmt.Sprintf("%v - %v", e.code, e.msg)
+}
+
 func errResp(code errCode, format string, v ...interface{}) error {
-	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+	return &protocolError{code, fmt.Sprintf(format, v...)}
 }
 
-func lesTopic(genesisHash common.Hash, protocolVersion uint) discv5.Topic {
+// reportError lowers the reputation score of a peer whose message violated the
+// protocol. Malformed and unsolicited messages count as invalid data.
+func reportError(p *peer, err error) {
+	perr, ok := err.(*protocolError)
+	if !ok {
+		return
+	}
+	switch perr.code {
+	case ErrMsgTooLarge, ErrDecode, ErrInvalidMsgCode, ErrUnexpectedResponse, ErrInvalidResponse:
+		p.Report(p2p.ScoreInvalid)
+	default:
+		p.Report(p2p.ScoreBad)
+	}
+}
+
+// lesTopic returns the network name of the given protocol version. It is used
+// as the database key prefix of the server pool.
+func lesTopic(genesisHash common.Hash, protocolVersion uint) string {
 	var name string
 	switch protocolVersion {
 	case lpv2:
@@ -46,7 +74,42 @@ func lesTopic(genesisHash common.Hash, protocolVersion uint) discv5.Topic {
 	default:
 		panic(nil)
 	}
-	return discv5.Topic(name + "@" + common.Bytes2Hex(genesisHash.Bytes()[0:8]))
+	return name + "@" + common.Bytes2Hex(genesisHash.Bytes()[0:8])
+}
+
+// lesEntry is the "les" ENR entry. It is set by servers to advertise the
+// LES protocol on the discovery network.
+type lesEntry struct {
+	Genesis  [8]byte // first bytes of the genesis block hash
+	Versions []uint  // served protocol versions
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e lesEntry) ENRKey() string {
+	return "les"
+}
+
+// newLesEntry creates the ENR entry of a server with the given genesis and versions.
+func newLesEntry(genesisHash common.Hash, versions []uint) *lesEntry {
+	e := &lesEntry{Versions: versions}
+	copy(e.Genesis[:], genesisHash[:])
+	return e
+}
+
+// matches reports whether the entry advertises the given network and protocol version.
+func (e *lesEntry) matches(genesisHash common.Hash, protocolVersion uint) bool {
+	if !bytes.Equal(e.Genesis[:], genesisHash[:len(e.Genesis)]) {
+		return false
+	}
+	for _, v := range e.Versions {
+		if v == protocolVersion {
+			return true
+		}
+	}
+	return false
 }
 
 type chainReader interface {
@@ -28,8 +28,8 @@ import (
 	"github.com/groshproject/grosh-core/light"
 	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/p2p"
-	"github.com/groshproject/grosh-core/p2p/discv5"
 	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/enr"
 	"github.com/groshproject/grosh-core/params"
 	"github.com/groshproject/grosh-core/rpc"
 )
@@ -39,7 +39,6 @@ type LesServer struct {
 
 	archiveMode bool // Flag whether the grosh node runs in archive mode.
 	handler     *serverHandler
-	lesTopics   []discv5.Topic
 	privateKey  *ecdsa.PrivateKey
 
 	// Flow control and capacity management
@@ -55,11 +54,6 @@ type LesServer struct {
 }
 
 func NewLesServer(e *eth.Grosh, config *eth.Config) (*LesServer, error) {
-	// Collect les protocol version information supported by local node.
-	lesTopics := make([]discv5.Topic, len(AdvertiseProtocolVersions))
-	for i, pv := range AdvertiseProtocolVersions {
-		lesTopics[i] = lesTopic(e.BlockChain().Genesis().Hash(), pv)
-	}
 	// Calculate the number of threads used to service the light client
 	// requests based on the user-specified value.
 	threads := config.LightServ * 4 / 100
@@ -80,7 +74,6 @@ func NewLesServer(e *eth.Grosh, config *eth.Config) (*LesServer, error) {
 			closeCh:          make(chan struct{}),
 		},
 		archiveMode:  e.ArchiveMode(),
-		lesTopics:    lesTopics,
 		fcManager:    flowcontrol.NewClientManager(nil, &mclock.System{}),
 		servingQueue: newServingQueue(int64(time.Millisecond*10), float64(config.LightServ)/100),
 		threadsBusy:  config.LightServ/100 + 1,
@@ -135,12 +128,17 @@ func (s *LesServer) APIs() []rpc.API {
 }
 
 func (s *LesServer) Protocols() []p2p.Protocol {
-	return s.makeProtocols(ServerProtocolVersions, s.handler.runPeer, func(id enode.ID) interface{} {
+	ps := s.makeProtocols(ServerProtocolVersions, s.handler.runPeer, func(id enode.ID) interface{} {
 		if p := s.peers.Peer(peerIdToString(id)); p != nil {
 			return p.Info()
 		}
 		return nil
 	})
+	// Add "les" ENR entries so clients can find the server via discovery.
+	for i := range ps {
+		ps[i].Attributes = []enr.Entry{newLesEntry(s.genesis, AdvertiseProtocolVersions)}
+	}
+	return ps
 }
 
 // Start starts the LES server
@@ -150,19 +148,6 @@ func (s *LesServer) Start(srvr *p2p.Server) {
 
 	s.wg.Add(1)
 	go s.capacityManagement()
-
-	if srvr.DiscV5 != nil {
-		for _, topic := range s.lesTopics {
-			topic := topic
-			go func() {
-				logger := log.New("topic", topic)
-				logger.Info("Starting topic registration")
-				defer logger.Info("Terminated topic registration")
-
-				srvr.DiscV5.RegisterTopic(topic, s.closeCh)
-			}()
-		}
-	}
 }
 
 // Stop stops the LES service
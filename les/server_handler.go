@@ -123,6 +123,7 @@ func (h *serverHandler) handle(p *peer) error {
 	)
 	if err := p.Handshake(td, hash, number, h.blockchain.Genesis().Hash(), h.server); err != nil {
 		p.Log().Debug("Light Grosh handshake failed", "err", err)
+		p.Report(p2p.ScoreBad)
 		return err
 	}
 	defer p.fcClient.Disconnect()
@@ -161,6 +162,7 @@ func (h *serverHandler) handle(p *peer) error {
 		}
 		if err := h.handleMsg(p, &wg); err != nil {
 			p.Log().Debug("Light Grosh message handling failed", "err", err)
+			reportError(p, err)
 			return err
 		}
 	}
@@ -202,6 +204,7 @@ func (h *serverHandler) handleMsg(p *peer, wg *sync.WaitGroup) error {
 		maxCost = p.fcCosts.getMaxCost(msg.Code, reqCnt)
 		accepted, bufShort, priority := p.fcClient.AcceptRequest(reqID, responseCount, maxCost)
 		if !accepted {
+			p.Report(p2p.ScoreBad)
 			p.freezeClient()
 			p.Log().Error("Request came too early", "remaining", common.PrettyDuration(time.Duration(bufShort*1000000/p.fcParams.MinRecharge)))
 			p.fcClient.OneTimeCost(inSizeCost)
@@ -819,6 +822,7 @@ func (h *serverHandler) handleMsg(p *peer, wg *sync.WaitGroup) error {
 	// reject them to prevent SPAM attack.
 	if atomic.LoadUint32(&p.invalidCount) > maxRequestErrors {
 		clientErrorMeter.Mark(1)
+		p.Report(p2p.ScoreBad)
 		return errTooManyInvalidRequest
 	}
 	return nil
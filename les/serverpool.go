@@ -27,12 +27,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/groshproject/grosh-core/common"
 	"github.com/groshproject/grosh-core/common/mclock"
 	"github.com/groshproject/grosh-core/crypto"
 	"github.com/groshproject/grosh-core/grodb"
 	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/p2p"
-	"github.com/groshproject/grosh-core/p2p/discv5"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/rlp"
 )
@@ -53,6 +53,9 @@ const (
 	// If the limit is reached, the least recently connected one is thrown out.
 	// (not that unlike new entries, known entries are persistent)
 	maxKnownEntries = 1000
+	// discoverBatchSize is the number of discovered servers fed into the
+	// pool on every discovery tick.
+	discoverBatchSize = 16
 	// target for simultaneously connected servers
 	targetServerCount = 5
 	// target for servers selected from the known table
@@ -117,8 +120,10 @@ type serverPool struct {
 	server *p2p.Server
 	connWg sync.WaitGroup
 
-	topic discv5.Topic
+	genesis         common.Hash
+	protocolVersion uint
 
+	discIter      enode.Iterator
 	discSetPeriod chan time.Duration
 	discNodes     chan *enode.Node
 	discLookups   chan bool
@@ -163,14 +168,16 @@ func newServerPool(db grodb.Database, ulcServers []string) *serverPool {
 	return pool
 }
 
-func (pool *serverPool) start(server *p2p.Server, topic discv5.Topic) {
+func (pool *serverPool) start(server *p2p.Server, genesis common.Hash, protocolVersion uint) {
 	pool.server = server
-	pool.topic = topic
-	pool.dbKey = append([]byte("serverPool/"), []byte(topic)...)
+	pool.genesis = genesis
+	pool.protocolVersion = protocolVersion
+	pool.dbKey = append([]byte("serverPool/"), []byte(lesTopic(genesis, protocolVersion))...)
 	pool.loadNodes()
 	pool.connectToTrustedNodes()
 
 	if pool.server.DiscV5 != nil {
+		pool.discIter = enode.Filter(pool.server.DiscV5.RandomNodes(), pool.isServer)
 		pool.discSetPeriod = make(chan time.Duration, 1)
 		pool.discNodes = make(chan *enode.Node, 100)
 		pool.discLookups = make(chan bool, 100)
@@ -183,23 +190,56 @@ func (pool *serverPool) start(server *p2p.Server, topic discv5.Topic) {
 
 func (pool *serverPool) stop() {
 	close(pool.closeCh)
+	if pool.discIter != nil {
+		pool.discIter.Close()
+	}
 	pool.wg.Wait()
 }
 
-// discoverNodes wraps SearchTopic, converting result nodes to enode.Node.
+// discoverNodes reads LES servers from the V5 discovery random walk and feeds
+// them into the pool. The read frequency is set via discSetPeriod, closing the
+// channel terminates the loop.
 func (pool *serverPool) discoverNodes() {
-	ch := make(chan *discv5.Node)
-	go func() {
-		pool.server.DiscV5.SearchTopic(pool.topic, pool.discSetPeriod, ch, pool.discLookups)
-		close(ch)
-	}()
-	for n := range ch {
-		pubkey, err := decodePubkey64(n.ID[:])
-		if err != nil {
+	var (
+		period = 100 * time.Millisecond
+		timer  = time.NewTimer(0)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case p, ok := <-pool.discSetPeriod:
+			if !ok {
+				return
+			}
+			period = p
 			continue
+		case <-timer.C:
 		}
-		pool.discNodes <- enode.NewV4(pubkey, n.IP, int(n.TCP), int(n.UDP))
+		for _, n := range enode.ReadNodes(pool.discIter, discoverBatchSize) {
+			select {
+			case pool.discNodes <- n:
+			case <-pool.closeCh:
+				return
+			}
+		}
+		select {
+		case pool.discLookups <- true:
+		case <-pool.closeCh:
+			return
+		}
+		timer.Reset(period)
+	}
+}
+
+// isServer reports whether the node record advertises a LES server for our
+// network and protocol version.
+func (pool *serverPool) isServer(n *enode.Node) bool {
+	var entry lesEntry
+	if n.Load(&entry) != nil {
+		return false
 	}
+	return n.TCP() != 0 && entry.matches(pool.genesis, pool.protocolVersion)
 }
 
 // connect should be called upon any incoming connection. If the connection has been
@@ -21,13 +21,14 @@ package geth
 
 import (
 	"errors"
+	"strings"
 
-	"github.com/groshproject/grosh-core/p2p/discv5"
+	"github.com/groshproject/grosh-core/p2p/enode"
 )
 
 // Enode represents a host on the network.
 type Enode struct {
-	node *discv5.Node
+	node *enode.Node
 }
 
 // NewEnode parses a node designator.
@@ -53,8 +54,18 @@ type Enode struct {
 // and UDP discovery port 30301.
 //
 //    enode://<hex node id>@10.3.58.6:30303?discport=30301
-func NewEnode(rawurl string) (enode *Enode, _ error) {
-	node, err := discv5.ParseNode(rawurl)
+//
+// Node records in their text form ("enr:...") are accepted as well.
+func NewEnode(rawurl string) (*Enode, error) {
+	var (
+		node *enode.Node
+		err  error
+	)
+	if strings.HasPrefix(rawurl, "enr:") {
+		node, err = enode.Parse(enode.ValidSchemes, rawurl)
+	} else {
+		node, err = enode.ParseV4(rawurl)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -62,12 +73,12 @@ func NewEnode(rawurl string) (enode *Enode, _ error) {
 }
 
 // Enodes represents a slice of accounts.
-type Enodes struct{ nodes []*discv5.Node }
+type Enodes struct{ nodes []*enode.Node }
 
 // NewEnodes creates a slice of uninitialized enodes.
 func NewEnodes(size int) *Enodes {
 	return &Enodes{
-		nodes: make([]*discv5.Node, size),
+		nodes: make([]*enode.Node, size),
 	}
 }
 
@@ -22,7 +22,7 @@ import (
 	"encoding/json"
 
 	"github.com/groshproject/grosh-core/core"
-	"github.com/groshproject/grosh-core/p2p/discv5"
+	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/params"
 )
 
@@ -53,9 +53,9 @@ func RinkebyGenesis() string {
 // FoundationBootnodes returns the enode URLs of the P2P bootstrap nodes operated
 // by the foundation running the V5 discovery protocol.
 func FoundationBootnodes() *Enodes {
-	nodes := &Enodes{nodes: make([]*discv5.Node, len(params.DiscoveryV5Bootnodes))}
+	nodes := &Enodes{nodes: make([]*enode.Node, len(params.DiscoveryV5Bootnodes))}
 	for i, url := range params.DiscoveryV5Bootnodes {
-		nodes.nodes[i] = discv5.MustParseNode(url)
+		nodes.nodes[i] = enode.MustParse(url)
 	}
 	return nodes
 }
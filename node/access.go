@@ -0,0 +1,176 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/netutil"
+)
+
+// accessList is the allow/deny list of peers which is managed through the admin API.
+// It is persisted in the datadir and applied to the p2p server on startup.
+type accessList struct {
+	Trusted        []*enode.Node `json:"trusted"`
+	Untrusted      []enode.ID    `json:"untrusted"` // overrides trusted-nodes.json and the config file
+	BannedNodes    []enode.ID    `json:"bannedNodes"`
+	BannedNetworks []string      `json:"bannedNetworks"`
+}
+
+// addTrusted adds a node to the trusted list, replacing any previous entry.
+func (l *accessList) addTrusted(n *enode.Node) {
+	l.deleteTrusted(n.ID())
+	l.Untrusted = deleteID(l.Untrusted, n.ID())
+	l.Trusted = append(l.Trusted, n)
+}
+
+// removeTrusted removes a node from the trusted list. The removal is recorded
+// so that it also applies to nodes from trusted-nodes.json or the config file.
+func (l *accessList) removeTrusted(id enode.ID) {
+	l.deleteTrusted(id)
+	l.Untrusted = append(deleteID(l.Untrusted, id), id)
+}
+
+func (l *accessList) deleteTrusted(id enode.ID) {
+	for i, n := range l.Trusted {
+		if n.ID() == id {
+			l.Trusted = append(l.Trusted[:i], l.Trusted[i+1:]...)
+			return
+		}
+	}
+}
+
+func deleteID(ids []enode.ID, id enode.ID) []enode.ID {
+	for i := range ids {
+		if ids[i] == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// setBans replaces the banned nodes and networks.
+func (l *accessList) setBans(bans p2p.BanList) {
+	l.BannedNodes = bans.Nodes
+	l.BannedNetworks = bans.Networks
+}
+
+// apply merges the access list into the given p2p configuration.
+func (l *accessList) apply(cfg *p2p.Config) error {
+	untrusted := make(map[enode.ID]bool, len(l.Untrusted))
+	for _, id := range l.Untrusted {
+		untrusted[id] = true
+	}
+	var trusted []*enode.Node
+	for _, n := range append(append([]*enode.Node{}, cfg.TrustedNodes...), l.Trusted...) {
+		if !untrusted[n.ID()] {
+			trusted = append(trusted, n)
+		}
+	}
+	cfg.TrustedNodes = trusted
+	cfg.BannedNodes = append(append([]enode.ID{}, cfg.BannedNodes...), l.BannedNodes...)
+
+	nets := new(netutil.Netlist)
+	if cfg.BannedNetworks != nil {
+		*nets = append(*nets, *cfg.BannedNetworks...)
+	}
+	for _, cidr := range l.BannedNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid banned network %q: %v", cidr, err)
+		}
+		nets.Add(cidr)
+	}
+	cfg.BannedNetworks = nets
+	return nil
+}
+
+// loadAccessList reads the persisted access list. An empty list is returned if
+// there is no datadir or the list hasn't been saved yet.
+func (c *Config) loadAccessList() (*accessList, error) {
+	l := new(accessList)
+	if c.DataDir == "" {
+		return l, nil
+	}
+	path := c.ResolvePath(datadirAccessList)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return l, nil
+	}
+	if err := common.LoadJSON(path, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// saveAccessList writes the access list to the datadir.
+func (c *Config) saveAccessList(l *accessList) error {
+	if c.DataDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash can't leave a truncated list behind.
+	path := c.ResolvePath(datadirAccessList)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// updateAccessList modifies the persisted access list.
+func (n *Node) updateAccessList(fn func(*accessList)) error {
+	n.accessLock.Lock()
+	defer n.accessLock.Unlock()
+
+	l, err := n.config.loadAccessList()
+	if err != nil {
+		return err
+	}
+	fn(l)
+	return n.config.saveAccessList(l)
+}
+
+// parseBanTarget interprets the argument of admin_banPeer and admin_unbanPeer. It
+// accepts an IP address, a CIDR range, an enode URL or ENR, or a hex node ID.
+func parseBanTarget(target string) (enode.ID, *net.IPNet, error) {
+	if _, ipnet, err := net.ParseCIDR(target); err == nil {
+		return enode.ID{}, ipnet, nil
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return enode.ID{}, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	if n, err := enode.Parse(enode.ValidSchemes, target); err == nil {
+		return n.ID(), nil, nil
+	}
+	var id enode.ID
+	if err := id.UnmarshalText([]byte(target)); err != nil {
+		return enode.ID{}, nil, fmt.Errorf("invalid ban target %q: need IP, CIDR, enode URL or node ID", target)
+	}
+	return id, nil, nil
+}
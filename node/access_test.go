@@ -0,0 +1,143 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/p2p/enode"
+)
+
+func TestParseBanTarget(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	node := enode.NewV4(&key.PublicKey, net.IP{127, 0, 0, 1}, 30303, 30303)
+
+	tests := []struct {
+		input   string
+		wantID  enode.ID
+		wantNet string
+		wantErr bool
+	}{
+		{input: "10.0.0.0/8", wantNet: "10.0.0.0/8"},
+		{input: "10.1.2.3", wantNet: "10.1.2.3/32"},
+		{input: "fe80::1", wantNet: "fe80::1/128"},
+		{input: node.String(), wantID: node.ID()},
+		{input: node.ID().String(), wantID: node.ID()},
+		{input: "foo", wantErr: true},
+	}
+	for _, test := range tests {
+		id, ipnet, err := parseBanTarget(test.input)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.input, err)
+			continue
+		}
+		if id != test.wantID {
+			t.Errorf("%q: wrong ID %v", test.input, id)
+		}
+		if (ipnet == nil) != (test.wantNet == "") || (ipnet != nil && ipnet.String() != test.wantNet) {
+			t.Errorf("%q: wrong network %v, want %q", test.input, ipnet, test.wantNet)
+		}
+	}
+}
+
+// Tests that the access list survives a save/load cycle and is merged
+// into the p2p configuration.
+func TestAccessListPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{Name: "unit-test", DataDir: dir}
+	os.MkdirAll(config.instanceDir(), 0700)
+
+	key, _ := crypto.GenerateKey()
+	trusted := enode.NewV4(&key.PublicKey, net.IP{127, 0, 0, 1}, 30303, 30303)
+	list := new(accessList)
+	list.addTrusted(trusted)
+	list.addTrusted(trusted)
+	list.setBans(p2p.BanList{
+		Nodes:    []enode.ID{{1}},
+		Networks: []string{"10.0.0.0/8"},
+	})
+	if err := config.saveAccessList(list); err != nil {
+		t.Fatalf("failed to save access list: %v", err)
+	}
+
+	loaded, err := config.loadAccessList()
+	if err != nil {
+		t.Fatalf("failed to load access list: %v", err)
+	}
+	if len(loaded.Trusted) != 1 || loaded.Trusted[0].ID() != trusted.ID() {
+		t.Errorf("wrong trusted nodes: %v", loaded.Trusted)
+	}
+	if !reflect.DeepEqual(loaded.BannedNodes, list.BannedNodes) {
+		t.Errorf("wrong banned nodes: %v", loaded.BannedNodes)
+	}
+
+	var cfg p2p.Config
+	if err := loaded.apply(&cfg); err != nil {
+		t.Fatalf("failed to apply access list: %v", err)
+	}
+	if len(cfg.TrustedNodes) != 1 || len(cfg.BannedNodes) != 1 {
+		t.Errorf("access list not applied: %+v", cfg)
+	}
+	if !cfg.BannedNetworks.Contains(net.IP{10, 1, 2, 3}) {
+		t.Errorf("banned network not applied: %v", cfg.BannedNetworks)
+	}
+}
+
+// Tests that removing a trusted node overrides nodes from trusted-nodes.json
+// and that adding it again makes it trusted.
+func TestAccessListUntrusted(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	node := enode.NewV4(&key.PublicKey, net.IP{127, 0, 0, 1}, 30303, 30303)
+	trusted := func(list *accessList) bool {
+		cfg := p2p.Config{TrustedNodes: []*enode.Node{node}}
+		if err := list.apply(&cfg); err != nil {
+			t.Fatalf("failed to apply access list: %v", err)
+		}
+		return len(cfg.TrustedNodes) > 0
+	}
+
+	list := new(accessList)
+	list.removeTrusted(node.ID())
+	list.removeTrusted(node.ID())
+	if len(list.Untrusted) != 1 {
+		t.Errorf("wrong untrusted nodes: %v", list.Untrusted)
+	}
+	if trusted(list) {
+		t.Error("removed node from config is still trusted")
+	}
+	list.addTrusted(node)
+	if len(list.Untrusted) != 0 || !trusted(list) {
+		t.Error("node added again is not trusted")
+	}
+}
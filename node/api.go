@@ -85,11 +85,15 @@ func (api *PrivateAdminAPI) AddTrustedPeer(url string) (bool, error) {
 		return false, fmt.Errorf("invalid enode: %v", err)
 	}
 	server.AddTrustedPeer(node)
+	if err := api.node.updateAccessList(func(l *accessList) { l.addTrusted(node) }); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
 // RemoveTrustedPeer removes a remote node from the trusted peer set, but it
-// does not disconnect it automatically.
+// does not disconnect it automatically. The removal is persisted and also
+// applies to nodes listed in trusted-nodes.json.
 func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	// Make sure the server is running, fail otherwise
 	server := api.node.Server()
@@ -101,9 +105,70 @@ func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 		return false, fmt.Errorf("invalid enode: %v", err)
 	}
 	server.RemoveTrustedPeer(node)
+	if err := api.node.updateAccessList(func(l *accessList) { l.removeTrusted(node.ID()) }); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
+// BanPeer prevents a node or IP range from connecting and drops existing connections
+// to it. The target can be an IP address, a CIDR range, an enode URL or a node ID.
+// Bans are persisted in the datadir.
+func (api *PrivateAdminAPI) BanPeer(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, ipnet, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	if ipnet != nil {
+		server.BanNetwork(ipnet)
+	} else {
+		server.BanNode(id)
+	}
+	if err := api.node.updateAccessList(func(l *accessList) { l.setBans(server.Bans()) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnbanPeer removes a node or IP range from the ban list. It returns false if the
+// target wasn't banned.
+func (api *PrivateAdminAPI) UnbanPeer(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, ipnet, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	var removed bool
+	if ipnet != nil {
+		removed = server.UnbanNetwork(ipnet)
+	} else {
+		removed = server.UnbanNode(id)
+	}
+	if err := api.node.updateAccessList(func(l *accessList) { l.setBans(server.Bans()) }); err != nil {
+		return false, err
+	}
+	return removed, nil
+}
+
+// ListBans returns the banned node IDs and IP ranges.
+func (api *PrivateAdminAPI) ListBans() (p2p.BanList, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return p2p.BanList{}, ErrNodeStopped
+	}
+	return server.Bans(), nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
@@ -186,7 +251,7 @@ func (api *PrivateAdminAPI) StartRPC(host *string, port *int, cors *string, apis
 		}
 	}
 
-	if err := api.node.startHTTP(fmt.Sprintf("%s:%d", *host, *port), api.node.rpcAPIs, modules, allowedOrigins, allowedVHosts, api.node.config.HTTPTimeouts); err != nil {
+	if err := api.node.startHTTP(fmt.Sprintf("%s:%d", *host, *port), api.node.rpcAPIs, modules, allowedOrigins, allowedVHosts, api.node.config.HTTPTimeouts, false); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -254,6 +319,9 @@ func (api *PrivateAdminAPI) StopWS() (bool, error) {
 	if api.node.wsHandler == nil {
 		return false, fmt.Errorf("WebSocket RPC not running")
 	}
+	if api.node.wsShared {
+		return false, fmt.Errorf("WebSocket RPC shares the HTTP RPC endpoint, stop HTTP RPC instead")
+	}
 	api.node.stopWS()
 	return true, nil
 }
@@ -280,6 +348,26 @@ func (api *PublicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
 	return server.PeersInfo(), nil
 }
 
+// PeerScores retrieves the reputation scores of all known nodes, ordered from lowest
+// to highest score.
+func (api *PublicAdminAPI) PeerScores() ([]p2p.PeerScore, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.PeerScores(), nil
+}
+
+// PeerTraffic retrieves the number of messages and bytes exchanged with each
+// connected peer, broken down by protocol and message code.
+func (api *PublicAdminAPI) PeerTraffic() ([]p2p.PeerTraffic, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.PeerTraffic(), nil
+}
+
 // NodeInfo retrieves all the information we know about the host node at the
 // protocol granularity.
 func (api *PublicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
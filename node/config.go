@@ -44,7 +44,9 @@ const (
 	datadirDefaultKeyStore = "keystore"           // Path within the datadir to the keystore
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
+	datadirAccessList      = "peer-access.json"   // Path within the datadir to the peer allow/deny list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirJWTSecret       = "jwtsecret"          // Path within the datadir to the authenticated RPC secret
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -137,7 +139,9 @@ type Config struct {
 	HTTPTimeouts rpc.HTTPTimeouts
 
 	// WSHost is the host interface on which to start the websocket RPC server. If
-	// this field is empty, no websocket API endpoint will be started.
+	// this field is empty, no websocket API endpoint will be started. If WSHost and
+	// WSPort are the same as HTTPHost and HTTPPort, websocket connections are served
+	// by the HTTP RPC server on the same port.
 	WSHost string `toml:",omitempty"`
 
 	// WSPort is the TCP port number on which to start the websocket RPC server. The
@@ -162,6 +166,34 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// AuthHost is the host interface on which to start the authenticated RPC server.
+	// The server accepts both HTTP and websocket connections, which must present a
+	// JWT token signed with the shared secret. If this field is empty, no
+	// authenticated endpoint will be started.
+	AuthHost string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated RPC server.
+	AuthPort int `toml:",omitempty"`
+
+	// AuthModules is a list of API modules to expose via the authenticated RPC
+	// interface. Only the listed modules are exposed, including private ones such
+	// as admin and debug. If the module list is empty, no modules are exposed.
+	AuthModules []string `toml:",omitempty"`
+
+	// AuthVirtualHosts is the list of virtual hostnames which are allowed on incoming
+	// requests to the authenticated RPC interface.
+	AuthVirtualHosts []string `toml:",omitempty"`
+
+	// JWTSecret is the path of the file holding the hex encoded shared secret for the
+	// authenticated RPC interface. If the file doesn't exist, a random secret is
+	// created. It defaults to a file in the instance directory.
+	JWTSecret string `toml:",omitempty"`
+
+	// RPCLimits configures batch, response size, concurrency and rate limits of
+	// the HTTP and websocket RPC interfaces. IPC and in-process connections are
+	// not limited.
+	RPCLimits rpc.Limits `toml:",omitempty"`
+
 	// GraphQLHost is the host interface on which to start the GraphQL server. If this
 	// field is empty, no GraphQL API endpoint will be started.
 	GraphQLHost string `toml:",omitempty"`
@@ -185,6 +217,16 @@ type Config struct {
 	// Requests using ip address directly are not affected
 	GraphQLVirtualHosts []string `toml:",omitempty"`
 
+	// GraphQLPrefix is the path prefix under which GraphQL is served on the HTTP RPC
+	// endpoint, e.g. "/graphql". If set, GraphQL doesn't open its own listener and
+	// GraphQLHost and GraphQLPort are ignored. The node fails to start if HTTP RPC
+	// is disabled.
+	GraphQLPrefix string `toml:",omitempty"`
+
+	// GraphQLTracing enables the trace field of transactions, which re-executes
+	// them. It is disabled by default as tracing is expensive.
+	GraphQLTracing bool `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
@@ -277,10 +319,28 @@ func DefaultWSEndpoint() string {
 	return config.WSEndpoint()
 }
 
+// AuthEndpoint resolves the authenticated RPC endpoint based on the configured host
+// interface and port parameters.
+func (c *Config) AuthEndpoint() string {
+	if c.AuthHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.AuthHost, c.AuthPort)
+}
+
+// JWTSecretPath returns the path of the shared secret file of the authenticated
+// RPC interface.
+func (c *Config) JWTSecretPath() string {
+	if c.JWTSecret != "" {
+		return c.JWTSecret
+	}
+	return c.ResolvePath(datadirJWTSecret)
+}
+
 // ExtRPCEnabled returns the indicator whether node enables the external
 // RPC(http, ws or graphql).
 func (c *Config) ExtRPCEnabled() bool {
-	return c.HTTPHost != "" || c.WSHost != "" || c.GraphQLHost != ""
+	return c.HTTPHost != "" || c.WSHost != "" || c.GraphQLHost != "" || c.AuthHost != ""
 }
 
 // NodeName returns the devp2p node identifier.
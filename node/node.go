@@ -17,9 +17,13 @@
 package node
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -59,18 +63,26 @@ type Node struct {
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
 	ipcHandler  *rpc.Server  // IPC RPC request handler to process the API requests
 
-	httpEndpoint  string       // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
-	httpWhitelist []string     // HTTP RPC modules to allow through this endpoint
-	httpListener  net.Listener // HTTP RPC listener socket to server API requests
-	httpHandler   *rpc.Server  // HTTP RPC request handler to process the API requests
+	httpEndpoint  string                  // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
+	httpWhitelist []string                // HTTP RPC modules to allow through this endpoint
+	httpListener  net.Listener            // HTTP RPC listener socket to server API requests
+	httpHandler   *rpc.Server             // HTTP RPC request handler to process the API requests
+	httpMounts    map[string]http.Handler // Service handlers mounted on the HTTP endpoint, keyed by path prefix
 
 	wsEndpoint string       // Websocket endpoint (interface + port) to listen at (empty = websocket disabled)
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
+	wsShared   bool         // Whether websocket requests are served on the HTTP listener
+
+	authEndpoint string       // Authenticated RPC endpoint (interface + port) to listen at (empty = disabled)
+	authListener net.Listener // Authenticated RPC listener socket to serve API requests
+	authHandler  *rpc.Server  // Authenticated RPC request handler to process the API requests
 
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
 
+	accessLock sync.Mutex // Serializes updates of the persisted peer access list
+
 	log log.Logger
 }
 
@@ -117,6 +129,7 @@ func New(conf *Config) (*Node, error) {
 		ipcEndpoint:       conf.IPCEndpoint(),
 		httpEndpoint:      conf.HTTPEndpoint(),
 		wsEndpoint:        conf.WSEndpoint(),
+		authEndpoint:      conf.AuthEndpoint(),
 		eventmux:          new(event.TypeMux),
 		log:               conf.Logger,
 	}, nil
@@ -186,6 +199,13 @@ func (n *Node) Start() error {
 	if n.serverConfig.NodeDatabase == "" {
 		n.serverConfig.NodeDatabase = n.config.NodeDB()
 	}
+	acl, err := n.config.loadAccessList()
+	if err != nil {
+		return err
+	}
+	if err := acl.apply(&n.serverConfig); err != nil {
+		return err
+	}
 	running := &p2p.Server{Config: n.serverConfig}
 	n.log.Info("Starting peer-to-peer node", "instance", n.serverConfig.Name)
 
@@ -280,9 +300,21 @@ func (n *Node) openDataDir() error {
 func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	// Gather all the possible APIs to surface
 	apis := n.apis()
+	mounts := make(map[string]http.Handler)
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
+		if hs, ok := service.(HTTPHandlerService); ok {
+			if prefix, handler := hs.HTTPHandler(); handler != nil {
+				if n.httpEndpoint == "" {
+					return fmt.Errorf("handler %q can't be served with HTTP RPC disabled", prefix)
+				}
+				mounts[prefix] = handler
+			}
+		}
 	}
+	n.httpMounts = mounts
+	// Websocket is served on the HTTP listener if both use the same endpoint
+	shareWS := n.httpEndpoint != "" && n.httpEndpoint == n.wsEndpoint
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -291,12 +323,21 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
-	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts, n.config.HTTPTimeouts); err != nil {
+	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts, n.config.HTTPTimeouts, shareWS); err != nil {
 		n.stopIPC()
 		n.stopInProc()
 		return err
 	}
-	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll); err != nil {
+	if !shareWS {
+		if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll); err != nil {
+			n.stopHTTP()
+			n.stopIPC()
+			n.stopInProc()
+			return err
+		}
+	}
+	if err := n.startAuth(n.authEndpoint, apis, n.config.AuthModules, n.config.AuthVirtualHosts, n.config.HTTPTimeouts); err != nil {
+		n.stopWS()
 		n.stopHTTP()
 		n.stopIPC()
 		n.stopInProc()
@@ -358,22 +399,35 @@ func (n *Node) stopIPC() {
 	}
 }
 
-// startHTTP initializes and starts the HTTP RPC endpoint.
-func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string, timeouts rpc.HTTPTimeouts) error {
+// startHTTP initializes and starts the HTTP RPC endpoint. If shareWS is set, the
+// websocket RPC endpoint is served on the same listener.
+func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string, timeouts rpc.HTTPTimeouts, shareWS bool) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts, timeouts)
+	var ws *rpc.WSConfig
+	if shareWS {
+		ws = &rpc.WSConfig{Modules: n.config.WSModules, Origins: n.config.WSOrigins, ExposeAll: n.config.WSExposeAll}
+	}
+	listener, handler, wsHandler, err := rpc.StartHTTPWSEndpoint(endpoint, apis, modules, cors, vhosts, timeouts, n.config.RPCLimits, ws, n.httpMounts)
 	if err != nil {
 		return err
 	}
 	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","))
+	for prefix := range n.httpMounts {
+		n.log.Info("HTTP handler mounted", "url", fmt.Sprintf("http://%s%s", endpoint, prefix))
+	}
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
 	n.httpListener = listener
 	n.httpHandler = handler
-
+	if shareWS {
+		n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()), "shared", true)
+		n.wsEndpoint = endpoint
+		n.wsHandler = wsHandler
+		n.wsShared = true
+	}
 	return nil
 }
 
@@ -389,6 +443,9 @@ func (n *Node) stopHTTP() {
 		n.httpHandler.Stop()
 		n.httpHandler = nil
 	}
+	if n.wsShared {
+		n.stopWS()
+	}
 }
 
 // startWS initializes and starts the websocket RPC endpoint.
@@ -397,7 +454,7 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll)
+	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll, n.config.RPCLimits)
 	if err != nil {
 		return err
 	}
@@ -422,6 +479,77 @@ func (n *Node) stopWS() {
 		n.wsHandler.Stop()
 		n.wsHandler = nil
 	}
+	n.wsShared = false
+}
+
+// startAuth initializes and starts the authenticated RPC endpoint.
+func (n *Node) startAuth(endpoint string, apis []rpc.API, modules []string, vhosts []string, timeouts rpc.HTTPTimeouts) error {
+	// Short circuit if the authenticated endpoint isn't being exposed
+	if endpoint == "" {
+		return nil
+	}
+	secret, err := obtainJWTSecret(n.config.JWTSecretPath())
+	if err != nil {
+		return err
+	}
+	listener, handler, err := rpc.StartAuthEndpoint(endpoint, apis, modules, vhosts, timeouts, secret, n.config.RPCLimits)
+	if err != nil {
+		return err
+	}
+	n.log.Info("Authenticated RPC endpoint opened", "url", fmt.Sprintf("http://%s", listener.Addr()), "modules", strings.Join(modules, ","))
+	// All listeners booted successfully
+	n.authEndpoint = endpoint
+	n.authListener = listener
+	n.authHandler = handler
+
+	return nil
+}
+
+// stopAuth terminates the authenticated RPC endpoint.
+func (n *Node) stopAuth() {
+	if n.authListener != nil {
+		n.authListener.Close()
+		n.authListener = nil
+
+		n.log.Info("Authenticated RPC endpoint closed", "url", fmt.Sprintf("http://%s", n.authEndpoint))
+	}
+	if n.authHandler != nil {
+		n.authHandler.Stop()
+		n.authHandler = nil
+	}
+}
+
+// obtainJWTSecret loads the hex encoded shared secret of the authenticated RPC
+// endpoint from the given file. If the file doesn't exist, a random secret is
+// generated and stored.
+func obtainJWTSecret(path string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("authenticated RPC needs a JWT secret file or a data directory")
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT secret in %s: %v", path, err)
+		}
+		if len(secret) < rpc.JWTSecretLength {
+			return nil, fmt.Errorf("JWT secret in %s too short, need at least %d bytes", path, rpc.JWTSecretLength)
+		}
+		return secret, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	secret := make([]byte, rpc.JWTSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(secret)), 0600); err != nil {
+		return nil, err
+	}
+	log.Info("Generated JWT secret", "path", path)
+	return secret, nil
 }
 
 // Stop terminates a running node along with all it's services. In the node was
@@ -436,6 +564,7 @@ func (n *Node) Stop() error {
 	}
 
 	// Terminate the API, services and the p2p server.
+	n.stopAuth()
 	n.stopWS()
 	n.stopHTTP()
 	n.stopIPC()
@@ -594,9 +723,24 @@ func (n *Node) WSEndpoint() string {
 	if n.wsListener != nil {
 		return n.wsListener.Addr().String()
 	}
+	if n.wsShared && n.httpListener != nil {
+		return n.httpListener.Addr().String()
+	}
 	return n.wsEndpoint
 }
 
+// AuthEndpoint retrieves the current authenticated RPC endpoint used by the
+// protocol stack.
+func (n *Node) AuthEndpoint() string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.authListener != nil {
+		return n.authListener.Addr().String()
+	}
+	return n.authEndpoint
+}
+
 // EventMux retrieves the event multiplexer used by all the network services in
 // the current protocol stack.
 func (n *Node) EventMux() *event.TypeMux {
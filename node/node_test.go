@@ -17,10 +17,15 @@
 package node
 
 import (
+	"context"
 	"errors"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -597,3 +602,192 @@ func TestAPIGather(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the authenticated RPC endpoint only accepts requests with a valid token
+// and only exposes the configured modules.
+func TestAuthEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-auth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := testNodeConfig()
+	conf.AuthHost = "127.0.0.1"
+	conf.AuthModules = []string{"admin", "web3"}
+	conf.JWTSecret = filepath.Join(dir, "jwtsecret")
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	defer stack.Stop()
+
+	// The secret file was generated on startup.
+	secret, err := obtainJWTSecret(conf.JWTSecret)
+	if err != nil {
+		t.Fatal("can't load generated secret:", err)
+	}
+	endpoint := stack.AuthEndpoint()
+
+	// Requests without token or with a token for a different secret are rejected.
+	plain, _ := rpc.DialHTTP("http://" + endpoint)
+	if err := plain.Call(new(string), "web3_clientVersion"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("unauthenticated call: got error %v, want 401", err)
+	}
+	wrong, _ := rpc.DialHTTPWithJWT("http://"+endpoint, make([]byte, rpc.JWTSecretLength))
+	if err := wrong.Call(new(string), "web3_clientVersion"); err == nil || !strings.Contains(err.Error(), "invalid token signature") {
+		t.Fatalf("call with wrong secret: got error %v", err)
+	}
+
+	// HTTP and websocket clients with the right secret get the configured modules.
+	httpClient, err := rpc.DialHTTPWithJWT("http://"+endpoint, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsClient, err := rpc.DialWebsocketWithJWT(context.Background(), "ws://"+endpoint, "", secret)
+	if err != nil {
+		t.Fatal("can't dial websocket:", err)
+	}
+	defer wsClient.Close()
+	for name, client := range map[string]*rpc.Client{"http": httpClient, "ws": wsClient} {
+		var modules map[string]string
+		if err := client.Call(&modules, "rpc_modules"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := map[string]string{"admin": "1.0", "web3": "1.0", "rpc": "1.0"}
+		if !reflect.DeepEqual(modules, want) {
+			t.Errorf("%s: wrong modules %v, want %v", name, modules, want)
+		}
+		var info p2p.NodeInfo
+		if err := client.Call(&info, "admin_nodeInfo"); err != nil {
+			t.Errorf("%s: admin_nodeInfo failed: %v", name, err)
+		}
+	}
+}
+
+// Tests loading of the JWT secret file.
+func TestObtainJWTSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-jwt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secret")
+	ioutil.WriteFile(path, []byte("0x"+strings.Repeat("ab", 32)+"\n"), 0600)
+	secret, err := obtainJWTSecret(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 || secret[0] != 0xab {
+		t.Fatalf("wrong secret %x", secret)
+	}
+	ioutil.WriteFile(path, []byte("abcd"), 0600)
+	if _, err := obtainJWTSecret(path); err == nil {
+		t.Fatal("short secret accepted")
+	}
+	ioutil.WriteFile(path, []byte("xyz"), 0600)
+	if _, err := obtainJWTSecret(path); err == nil {
+		t.Fatal("invalid secret accepted")
+	}
+}
+
+// Tests that HTTP and websocket RPC share a listener if configured with the same
+// endpoint, and that service handlers are mounted on it.
+func TestHTTPWSSharedEndpoint(t *testing.T) {
+	conf := testNodeConfig()
+	conf.HTTPHost, conf.WSHost = "127.0.0.1", "127.0.0.1"
+	conf.HTTPModules = []string{"web3"}
+	conf.WSModules = []string{"admin"}
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	mounted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "mounted")
+	})
+	if err := stack.Register(func(*ServiceContext) (Service, error) {
+		return &HTTPHandlerTestService{prefix: "/test", handler: mounted}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	defer stack.Stop()
+
+	if stack.HTTPEndpoint() != stack.WSEndpoint() {
+		t.Fatalf("endpoints differ: HTTP %s, WS %s", stack.HTTPEndpoint(), stack.WSEndpoint())
+	}
+	endpoint := stack.HTTPEndpoint()
+	httpClient, err := rpc.DialHTTP("http://" + endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsClient, err := rpc.DialWebsocket(context.Background(), "ws://"+endpoint, "")
+	if err != nil {
+		t.Fatal("can't dial websocket:", err)
+	}
+	defer wsClient.Close()
+
+	// Each interface keeps its own module list.
+	var info p2p.NodeInfo
+	if err := wsClient.Call(&info, "admin_nodeInfo"); err != nil {
+		t.Errorf("websocket call failed: %v", err)
+	}
+	if err := httpClient.Call(&info, "admin_nodeInfo"); err == nil {
+		t.Error("HTTP call to websocket-only module succeeded")
+	}
+	var version string
+	if err := httpClient.Call(&version, "web3_clientVersion"); err != nil {
+		t.Errorf("HTTP call failed: %v", err)
+	}
+
+	// The service handler is mounted.
+	resp, err := http.Get("http://" + endpoint + "/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "mounted" {
+		t.Errorf("wrong response from mounted handler: %q", body)
+	}
+
+	// Websocket can only be stopped together with HTTP.
+	api := NewPrivateAdminAPI(stack)
+	if _, err := api.StopWS(); err == nil {
+		t.Error("stopping shared websocket endpoint succeeded")
+	}
+	if _, err := api.StopRPC(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wsClient.SupportedModules(); err == nil {
+		t.Error("websocket connection still works after stopping HTTP")
+	}
+}
+
+// Tests that the node refuses to start if a service handler needs to be mounted
+// on the HTTP endpoint, but HTTP RPC is disabled.
+func TestHTTPHandlerWithoutEndpoint(t *testing.T) {
+	stack, err := New(testNodeConfig())
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if err := stack.Register(func(*ServiceContext) (Service, error) {
+		return &HTTPHandlerTestService{prefix: "/test", handler: handler}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.Start(); err == nil {
+		stack.Stop()
+		t.Fatal("node started with unservable HTTP handler")
+	}
+}
@@ -17,6 +17,7 @@
 package node
 
 import (
+	"net/http"
 	"path/filepath"
 	"reflect"
 
@@ -120,3 +121,11 @@ type Service interface {
 	// are all terminated.
 	Stop() error
 }
+
+// HTTPHandlerService is implemented by services which serve plain HTTP requests on
+// the node's HTTP RPC endpoint in addition to their RPC APIs. The handler is served
+// on the given path prefix, e.g. "/graphql". HTTPHandler is called after the service
+// was started and may return a nil handler if the service doesn't want to be mounted.
+type HTTPHandlerService interface {
+	HTTPHandler() (prefix string, handler http.Handler)
+}
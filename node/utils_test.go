@@ -20,6 +20,7 @@
 package node
 
 import (
+	"net/http"
 	"reflect"
 
 	"github.com/groshproject/grosh-core/p2p"
@@ -131,3 +132,15 @@ func (api *OneMethodAPI) TheOneMethod() {
 		api.fun()
 	}
 }
+
+// HTTPHandlerTestService is a service which serves an HTTP handler on the node's
+// HTTP endpoint.
+type HTTPHandlerTestService struct {
+	NoopService
+	prefix  string
+	handler http.Handler
+}
+
+func (s *HTTPHandlerTestService) HTTPHandler() (string, http.Handler) {
+	return s.prefix, s.handler
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/netutil"
+)
+
+// BanList is the set of banned node IDs and IP networks, as returned by admin_listBans.
+type BanList struct {
+	Nodes    []enode.ID `json:"nodes"`
+	Networks []string   `json:"networks"`
+}
+
+// banList holds the nodes which are neither dialed nor accepted, either by node ID
+// or by IP network.
+type banList struct {
+	mu    sync.RWMutex
+	nodes map[enode.ID]struct{}
+	nets  netutil.Netlist
+}
+
+func newBanList(nodes []enode.ID, nets *netutil.Netlist) *banList {
+	b := &banList{nodes: make(map[enode.ID]struct{})}
+	for _, id := range nodes {
+		b.nodes[id] = struct{}{}
+	}
+	if nets != nil {
+		b.nets = append(b.nets, *nets...)
+	}
+	return b
+}
+
+// contains reports whether the node is banned by ID or IP address.
+func (b *banList) contains(n *enode.Node) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok := b.nodes[n.ID()]; ok {
+		return true
+	}
+	return n.IP() != nil && b.nets.Contains(n.IP())
+}
+
+// containsIP reports whether the IP address is in a banned network.
+func (b *banList) containsIP(ip net.IP) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.nets.Contains(ip)
+}
+
+func (b *banList) addNode(id enode.ID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nodes[id] = struct{}{}
+}
+
+func (b *banList) removeNode(id enode.ID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.nodes[id]
+	delete(b.nodes, id)
+	return ok
+}
+
+func (b *banList) addNet(n *net.IPNet) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.findNet(n) < 0 {
+		b.nets = append(b.nets, *n)
+	}
+}
+
+func (b *banList) removeNet(n *net.IPNet) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i := b.findNet(n)
+	if i < 0 {
+		return false
+	}
+	b.nets = append(b.nets[:i], b.nets[i+1:]...)
+	return true
+}
+
+func (b *banList) findNet(n *net.IPNet) int {
+	for i, have := range b.nets {
+		if have.IP.Equal(n.IP) && bytes.Equal(have.Mask, n.Mask) {
+			return i
+		}
+	}
+	return -1
+}
+
+// list returns the content of the ban list, sorted for display.
+func (b *banList) list() BanList {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	l := BanList{Nodes: make([]enode.ID, 0, len(b.nodes)), Networks: make([]string, 0, len(b.nets))}
+	for id := range b.nodes {
+		l.Nodes = append(l.Nodes, id)
+	}
+	sort.Slice(l.Nodes, func(i, j int) bool {
+		return bytes.Compare(l.Nodes[i][:], l.Nodes[j][:]) < 0
+	})
+	for _, n := range b.nets {
+		l.Networks = append(l.Networks, n.String())
+	}
+	sort.Strings(l.Networks)
+	return l
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/netutil"
+)
+
+func TestBanList(t *testing.T) {
+	nets, _ := netutil.ParseNetlist("10.0.0.0/8")
+	b := newBanList([]enode.ID{uintID(1)}, nets)
+
+	_, ipnet, _ := net.ParseCIDR("192.168.0.0/16")
+	b.addNet(ipnet)
+	b.addNet(ipnet) // duplicate, ignored
+	b.addNode(uintID(2))
+
+	tests := []struct {
+		node *enode.Node
+		want bool
+	}{
+		{newNode(uintID(1), "127.0.0.1:30303"), true},
+		{newNode(uintID(2), ""), true},
+		{newNode(uintID(3), "10.1.2.3:30303"), true},
+		{newNode(uintID(3), "192.168.1.1:30303"), true},
+		{newNode(uintID(3), "127.0.0.1:30303"), false},
+		{newNode(uintID(3), ""), false},
+	}
+	for i, test := range tests {
+		if ok := b.contains(test.node); ok != test.want {
+			t.Errorf("test %d: contains returned %t, want %t", i, ok, test.want)
+		}
+	}
+
+	want := BanList{
+		Nodes:    []enode.ID{uintID(1), uintID(2)},
+		Networks: []string{"10.0.0.0/8", "192.168.0.0/16"},
+	}
+	if l := b.list(); !reflect.DeepEqual(l, want) {
+		t.Errorf("wrong list:\nhave %+v\nwant %+v", l, want)
+	}
+
+	if !b.removeNet(ipnet) {
+		t.Error("removeNet returned false for banned network")
+	}
+	if b.removeNet(ipnet) {
+		t.Error("removeNet returned true for unknown network")
+	}
+	if !b.removeNode(uintID(2)) {
+		t.Error("removeNode returned false for banned node")
+	}
+	if b.containsIP(net.IP{192, 168, 1, 1}) {
+		t.Error("IP still banned after network was removed")
+	}
+}
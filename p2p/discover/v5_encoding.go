@@ -0,0 +1,873 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/common/math"
+	"github.com/groshproject/grosh-core/common/mclock"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/enr"
+	"github.com/groshproject/grosh-core/rlp"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Discovery v5 packet layout:
+//
+//   packet        = masking-iv || masked-header || message
+//   masked-header = aes_ctr(masking-key, masking-iv, header)
+//   masking-key   = dest-id[:16]
+//   header        = static-header || authdata
+//   static-header = protocol-id || version || flag || nonce || authdata-size
+//   message       = aes_gcm(session-key, nonce, message-pt, masking-iv || header)
+//   message-pt    = message-type || rlp(message-data)
+//
+// The authdata section depends on the packet flag. Ordinary messages carry the source
+// node ID, WHOAREYOU packets carry the handshake challenge and handshake packets carry
+// the ID signature, ephemeral key and (optionally) the sender's node record.
+
+// Packet header flags.
+const (
+	flagMessage = iota
+	flagWhoareyou
+	flagHandshake
+)
+
+// RPC packet types
+const (
+	p_pingV5 byte = iota + 1
+	p_pongV5
+	p_findnodeV5
+	p_nodesV5
+	p_talkreqV5
+	p_talkrespV5
+	p_unknownV5   = 254 // any packet that can't be decrypted
+	p_whoareyouV5 = 255 // handshake challenge
+)
+
+// Protocol and encryption parameters.
+const (
+	v5Version    = 1
+	aesKeySize   = 16 // AES-128 for session keys and header masking
+	gcmNonceSize = 12
+
+	sizeofMaskingIV             = 16
+	sizeofStaticHeader          = 6 + 2 + 1 + gcmNonceSize + 2
+	sizeofStaticPacketData      = sizeofMaskingIV + sizeofStaticHeader
+	sizeofMessageAuthData       = 32
+	sizeofWhoareyouAuthData     = 16 + 8
+	sizeofHandshakeAuthDataHead = 32 + 1 + 1
+
+	minV5PacketSize     = 63 // smallest valid packet (WHOAREYOU)
+	minMessageSize      = 16 // GCM tag size
+	randomPacketMsgSize = 20
+)
+
+var v5ProtocolID = [6]byte{'d', 'i', 's', 'c', 'v', '5'}
+
+var (
+	idSignatureText  = "discovery v5 identity proof"
+	keyAgreementInfo = "discovery v5 key agreement"
+)
+
+// Errors.
+var (
+	errTooShort            = errors.New("packet too short")
+	errInvalidHeader       = errors.New("invalid packet header")
+	errInvalidFlag         = errors.New("invalid flag value in header")
+	errMinVersion          = errors.New("version of packet header below minimum")
+	errMsgTooShort         = errors.New("message/handshake packet below minimum size")
+	errAuthSize            = errors.New("declared auth size is beyond packet length")
+	errUnexpectedHandshake = errors.New("unexpected auth response, not in handshake")
+	errInvalidAuthKey      = errors.New("invalid ephemeral pubkey")
+	errNoRecord            = errors.New("expected ENR in handshake but none sent")
+	errInvalidNonceSig     = errors.New("invalid ID nonce signature")
+	errMessageTooShort     = errors.New("message contains no data")
+	errMessageDecrypt      = errors.New("cannot decrypt message")
+)
+
+// v5Nonce is the nonce of a discv5 packet. It is used as the AES-GCM nonce of the message
+// and identifies the packet when it is answered by WHOAREYOU.
+type v5Nonce [gcmNonceSize]byte
+
+// Discovery v5 messages.
+type (
+	// unknownV5 represents any packet that can't be decrypted.
+	unknownV5 struct {
+		Nonce v5Nonce
+	}
+
+	// whoareyouV5 contains the handshake challenge.
+	whoareyouV5 struct {
+		ChallengeData []byte   // encoded challenge
+		Nonce         v5Nonce  // nonce of request packet
+		IDNonce       [16]byte // identity proof data
+		RecordSeq     uint64   // ENR sequence number of recipient
+
+		// node is the locally known node record of the recipient.
+		// This must be set by the caller of encode.
+		node *enode.Node
+
+		sent mclock.AbsTime // for handshake GC
+	}
+
+	// pingV5 checks whether the recipient is alive.
+	pingV5 struct {
+		ReqID  []byte
+		ENRSeq uint64
+	}
+
+	// pongV5 is the reply to pingV5.
+	pongV5 struct {
+		ReqID  []byte
+		ENRSeq uint64
+		ToIP   net.IP // These fields should mirror the UDP envelope address of the ping
+		ToPort uint16 // packet, which provides a way to discover the external address (after NAT).
+	}
+
+	// findnodeV5 is a query for nodes at the given log distances.
+	findnodeV5 struct {
+		ReqID     []byte
+		Distances []uint
+	}
+
+	// nodesV5 is the reply to findnodeV5. Results may be split across
+	// several packets, Total holds the number of packets.
+	nodesV5 struct {
+		ReqID []byte
+		Total uint8
+		Nodes []*enr.Record
+	}
+
+	// talkreqV5 is an application-level request.
+	talkreqV5 struct {
+		ReqID    []byte
+		Protocol string
+		Message  []byte
+	}
+
+	// talkrespV5 is the reply to talkreqV5.
+	talkrespV5 struct {
+		ReqID   []byte
+		Message []byte
+	}
+)
+
+// v5StaticHeader is the unmasked fixed-size part of the packet header.
+type v5StaticHeader struct {
+	ProtocolID [6]byte
+	Version    uint16
+	Flag       byte
+	Nonce      v5Nonce
+	AuthSize   uint16
+}
+
+// v5Header is the complete packet header.
+type v5Header struct {
+	IV [sizeofMaskingIV]byte
+	v5StaticHeader
+	AuthData []byte
+
+	src enode.ID // used by decoder
+}
+
+// Authdata layouts.
+type (
+	messageAuthData struct {
+		SrcID enode.ID
+	}
+
+	whoareyouAuthData struct {
+		IDNonce   [16]byte // ID proof data
+		RecordSeq uint64   // highest known ENR sequence of requester
+	}
+
+	handshakeAuthData struct {
+		h struct {
+			SrcID      enode.ID
+			SigSize    byte // size of id-signature
+			PubkeySize byte // size of ephemeral pubkey
+		}
+		// Trailing variable-size data.
+		signature, pubkey, record []byte
+	}
+)
+
+// wireCodec encodes and decodes discovery v5 packets. It is not safe for concurrent use.
+type wireCodec struct {
+	sha256       hash.Hash
+	localnode    *enode.LocalNode
+	privkey      *ecdsa.PrivateKey
+	sc           *sessionCache
+	validSchemes enr.IdentityScheme // schemes accepted for records in handshakes
+
+	// encoder buffers
+	buf      bytes.Buffer // whole packet
+	headbuf  bytes.Buffer // packet header
+	msgbuf   bytes.Buffer // message RLP plaintext
+	msgctbuf []byte       // message data ciphertext
+
+	// decoder buffer
+	reader bytes.Reader
+}
+
+func newWireCodec(ln *enode.LocalNode, key *ecdsa.PrivateKey, clock mclock.Clock, validSchemes enr.IdentityScheme) *wireCodec {
+	c := &wireCodec{
+		sha256:       sha256.New(),
+		localnode:    ln,
+		privkey:      key,
+		sc:           newSessionCache(1024, clock),
+		validSchemes: validSchemes,
+	}
+	return c
+}
+
+// encode encodes a packet to a node. 'id' and 'addr' specify the destination node. The
+// 'challenge' parameter should be the most recently received WHOAREYOU packet from that
+// node.
+func (c *wireCodec) encode(id enode.ID, addr string, packet packetV5, challenge *whoareyouV5) ([]byte, v5Nonce, error) {
+	// Create the packet header.
+	var (
+		head    v5Header
+		session *session
+		msgData []byte
+		err     error
+	)
+	switch {
+	case packet.kind() == p_whoareyouV5:
+		head, err = c.encodeWhoareyou(id, packet.(*whoareyouV5))
+	case challenge != nil:
+		// We have an unanswered challenge, send handshake.
+		head, session, err = c.encodeHandshakeHeader(id, addr, challenge)
+	default:
+		session = c.sc.session(id, addr)
+		if session != nil {
+			// There is a session, use it.
+			head, err = c.encodeMessageHeader(id, session)
+		} else {
+			// No keys, send random data to kick off the handshake.
+			head, msgData, err = c.encodeRandom(id)
+		}
+	}
+	if err != nil {
+		return nil, v5Nonce{}, err
+	}
+
+	// Generate masking IV.
+	if _, err := crand.Read(head.IV[:]); err != nil {
+		return nil, v5Nonce{}, fmt.Errorf("can't generate masking IV: %v", err)
+	}
+
+	// Encode header data.
+	c.writeHeaders(&head)
+
+	// Store sent WHOAREYOU challenges.
+	if challenge, ok := packet.(*whoareyouV5); ok {
+		challenge.ChallengeData = common.CopyBytes(c.buf.Bytes())
+		c.sc.storeSentHandshake(id, addr, challenge)
+	} else if msgData == nil {
+		headerData := c.buf.Bytes()
+		msgData, err = c.encryptMessage(session, packet, &head, headerData)
+		if err != nil {
+			return nil, v5Nonce{}, err
+		}
+	}
+
+	enc := c.encodeRaw(id, msgData)
+	return enc, head.Nonce, nil
+}
+
+// encodeRaw masks the header currently held in c.buf and appends the message.
+func (c *wireCodec) encodeRaw(id enode.ID, msgData []byte) []byte {
+	packet := c.buf.Bytes()
+	mask := headerMask(id, packet[:sizeofMaskingIV])
+	header := packet[sizeofMaskingIV:]
+	mask.XORKeyStream(header, header)
+
+	enc := make([]byte, 0, len(packet)+len(msgData))
+	enc = append(enc, packet...)
+	return append(enc, msgData...)
+}
+
+func (c *wireCodec) writeHeaders(head *v5Header) {
+	c.buf.Reset()
+	c.buf.Write(head.IV[:])
+	binary.Write(&c.buf, binary.BigEndian, &head.v5StaticHeader)
+	c.buf.Write(head.AuthData)
+}
+
+// makeHeader creates a packet header.
+func (c *wireCodec) makeHeader(flag byte, authsizeExtra int) v5Header {
+	var authsize int
+	switch flag {
+	case flagMessage:
+		authsize = sizeofMessageAuthData
+	case flagWhoareyou:
+		authsize = sizeofWhoareyouAuthData
+	case flagHandshake:
+		authsize = sizeofHandshakeAuthDataHead
+	default:
+		panic(fmt.Errorf("BUG: invalid packet header flag %x", flag))
+	}
+	authsize += authsizeExtra
+	if authsize > int(^uint16(0)) {
+		panic(fmt.Errorf("BUG: auth size %d overflows uint16", authsize))
+	}
+	return v5Header{
+		v5StaticHeader: v5StaticHeader{
+			ProtocolID: v5ProtocolID,
+			Version:    v5Version,
+			Flag:       flag,
+			AuthSize:   uint16(authsize),
+		},
+	}
+}
+
+// encodeRandom encodes a packet with random content.
+func (c *wireCodec) encodeRandom(toID enode.ID) (v5Header, []byte, error) {
+	head := c.makeHeader(flagMessage, 0)
+
+	// Encode auth data.
+	auth := messageAuthData{SrcID: c.localnode.ID()}
+	if _, err := crand.Read(head.Nonce[:]); err != nil {
+		return head, nil, fmt.Errorf("can't get random data: %v", err)
+	}
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, auth)
+	head.AuthData = c.headbuf.Bytes()
+
+	// Fill message ciphertext buffer with random bytes.
+	c.msgctbuf = append(c.msgctbuf[:0], make([]byte, randomPacketMsgSize)...)
+	crand.Read(c.msgctbuf)
+	return head, c.msgctbuf, nil
+}
+
+// encodeWhoareyou encodes a WHOAREYOU packet.
+func (c *wireCodec) encodeWhoareyou(toID enode.ID, packet *whoareyouV5) (v5Header, error) {
+	// Sanity check node field to catch misbehaving callers.
+	if packet.RecordSeq > 0 && packet.node == nil {
+		panic("BUG: missing node in whoareyouV5 with non-zero seq")
+	}
+
+	// Create header.
+	head := c.makeHeader(flagWhoareyou, 0)
+	head.Nonce = packet.Nonce
+
+	// Encode auth data.
+	auth := &whoareyouAuthData{
+		IDNonce:   packet.IDNonce,
+		RecordSeq: packet.RecordSeq,
+	}
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, auth)
+	head.AuthData = c.headbuf.Bytes()
+	return head, nil
+}
+
+// encodeHandshakeHeader encodes the handshake message packet header.
+func (c *wireCodec) encodeHandshakeHeader(toID enode.ID, addr string, challenge *whoareyouV5) (v5Header, *session, error) {
+	// Ensure calling code sets challenge.node.
+	if challenge.node == nil {
+		panic("BUG: missing challenge.node in encode")
+	}
+
+	// Generate new secrets.
+	auth, session, err := c.makeHandshakeAuth(toID, addr, challenge)
+	if err != nil {
+		return v5Header{}, nil, err
+	}
+
+	// Generate nonce for message.
+	nonce, err := c.sc.nextNonce(session)
+	if err != nil {
+		return v5Header{}, nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	// TODO: this should happen when the first authenticated message is received
+	c.sc.storeNewSession(toID, addr, session)
+
+	// Encode the auth header.
+	var (
+		authsizeExtra = len(auth.pubkey) + len(auth.signature) + len(auth.record)
+		head          = c.makeHeader(flagHandshake, authsizeExtra)
+	)
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, &auth.h)
+	c.headbuf.Write(auth.signature)
+	c.headbuf.Write(auth.pubkey)
+	c.headbuf.Write(auth.record)
+	head.AuthData = c.headbuf.Bytes()
+	head.Nonce = nonce
+	return head, session, err
+}
+
+// makeHandshakeAuth creates the auth header on a request packet following WHOAREYOU.
+func (c *wireCodec) makeHandshakeAuth(toID enode.ID, addr string, challenge *whoareyouV5) (*handshakeAuthData, *session, error) {
+	auth := new(handshakeAuthData)
+	auth.h.SrcID = c.localnode.ID()
+
+	// Create the ephemeral key. This needs to be first because the
+	// key is part of the ID nonce signature.
+	var remotePubkey = new(ecdsa.PublicKey)
+	if err := challenge.node.Load((*enode.Secp256k1)(remotePubkey)); err != nil {
+		return nil, nil, fmt.Errorf("can't find secp256k1 key for recipient")
+	}
+	ephkey, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't generate ephemeral key")
+	}
+	ephpubkey := crypto.CompressPubkey(&ephkey.PublicKey)
+	auth.pubkey = ephpubkey
+	auth.h.PubkeySize = byte(len(auth.pubkey))
+
+	// Add ID nonce signature to response.
+	cdata := challenge.ChallengeData
+	idsig, err := makeIDSignature(c.sha256, c.privkey, cdata, ephpubkey, toID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't sign: %v", err)
+	}
+	auth.signature = idsig
+	auth.h.SigSize = byte(len(auth.signature))
+
+	// Add our record to response if it's newer than what remote side has.
+	ln := c.localnode.Node()
+	if challenge.RecordSeq < ln.Seq() {
+		auth.record, _ = rlp.EncodeToBytes(ln.Record())
+	}
+
+	// Create session keys.
+	sec := deriveKeys(sha256.New, ephkey, remotePubkey, c.localnode.ID(), challenge.node.ID(), cdata)
+	if sec == nil {
+		return nil, nil, fmt.Errorf("key derivation failed")
+	}
+	return auth, sec, err
+}
+
+// encodeMessageHeader encodes an encrypted message packet header.
+func (c *wireCodec) encodeMessageHeader(toID enode.ID, s *session) (v5Header, error) {
+	head := c.makeHeader(flagMessage, 0)
+
+	// Create the header.
+	nonce, err := c.sc.nextNonce(s)
+	if err != nil {
+		return v5Header{}, fmt.Errorf("can't generate nonce: %v", err)
+	}
+	auth := messageAuthData{SrcID: c.localnode.ID()}
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, &auth)
+	head.AuthData = c.headbuf.Bytes()
+	head.Nonce = nonce
+	return head, err
+}
+
+func (c *wireCodec) encryptMessage(s *session, p packetV5, head *v5Header, headerData []byte) ([]byte, error) {
+	// Encode message plaintext.
+	c.msgbuf.Reset()
+	c.msgbuf.WriteByte(p.kind())
+	if err := rlp.Encode(&c.msgbuf, p); err != nil {
+		return nil, err
+	}
+	messagePT := c.msgbuf.Bytes()
+
+	// Encrypt into message ciphertext buffer.
+	messageCT, err := encryptGCM(c.msgctbuf[:0], s.writeKey, head.Nonce[:], messagePT, headerData)
+	if err == nil {
+		c.msgctbuf = messageCT
+	}
+	return messageCT, err
+}
+
+// decode decodes a discovery packet. Note that the input buffer is modified.
+func (c *wireCodec) decode(input []byte, addr string) (src enode.ID, n *enode.Node, p packetV5, err error) {
+	if len(input) < minV5PacketSize {
+		return enode.ID{}, nil, nil, errTooShort
+	}
+	// Unmask the static header.
+	var head v5Header
+	copy(head.IV[:], input[:sizeofMaskingIV])
+	mask := headerMask(c.localnode.ID(), input[:sizeofMaskingIV])
+	staticHeader := input[sizeofMaskingIV:sizeofStaticPacketData]
+	mask.XORKeyStream(staticHeader, staticHeader)
+
+	// Decode and verify the static header.
+	c.reader.Reset(staticHeader)
+	binary.Read(&c.reader, binary.BigEndian, &head.v5StaticHeader)
+	remainingInput := len(input) - sizeofStaticPacketData
+	if err := head.checkValid(remainingInput); err != nil {
+		return enode.ID{}, nil, nil, err
+	}
+
+	// Unmask auth data.
+	authDataEnd := sizeofStaticPacketData + int(head.AuthSize)
+	authData := input[sizeofStaticPacketData:authDataEnd]
+	mask.XORKeyStream(authData, authData)
+	head.AuthData = authData
+
+	// Delete timed-out handshakes. This must happen before decoding to avoid
+	// processing the same handshake twice.
+	c.sc.handshakeGC()
+
+	// Decode auth part and message.
+	headerData := input[:authDataEnd]
+	msgData := input[authDataEnd:]
+	switch head.Flag {
+	case flagWhoareyou:
+		p, err = c.decodeWhoareyou(&head, headerData)
+	case flagHandshake:
+		n, p, err = c.decodeHandshakeMessage(addr, &head, headerData, msgData)
+	case flagMessage:
+		p, err = c.decodeMessage(addr, &head, headerData, msgData)
+	default:
+		err = errInvalidFlag
+	}
+	return head.src, n, p, err
+}
+
+// checkValid performs some basic validity checks on the header.
+// The packetLen here is the length remaining after the static header.
+func (h *v5StaticHeader) checkValid(packetLen int) error {
+	if h.ProtocolID != v5ProtocolID {
+		return errInvalidHeader
+	}
+	if h.Version < v5Version {
+		return errMinVersion
+	}
+	if h.Flag != flagWhoareyou && packetLen < minMessageSize {
+		return errMsgTooShort
+	}
+	if int(h.AuthSize) > packetLen {
+		return errAuthSize
+	}
+	return nil
+}
+
+// decodeWhoareyou reads WHOAREYOU packet data.
+func (c *wireCodec) decodeWhoareyou(head *v5Header, headerData []byte) (packetV5, error) {
+	if len(head.AuthData) != sizeofWhoareyouAuthData {
+		return nil, fmt.Errorf("invalid auth size %d for WHOAREYOU", len(head.AuthData))
+	}
+	var auth whoareyouAuthData
+	c.reader.Reset(head.AuthData)
+	binary.Read(&c.reader, binary.BigEndian, &auth)
+	p := &whoareyouV5{
+		Nonce:         head.Nonce,
+		IDNonce:       auth.IDNonce,
+		RecordSeq:     auth.RecordSeq,
+		ChallengeData: make([]byte, len(headerData)),
+	}
+	copy(p.ChallengeData, headerData)
+	return p, nil
+}
+
+// decodeHandshakeMessage reads the handshake packet and decrypts the message it carries.
+func (c *wireCodec) decodeHandshakeMessage(fromAddr string, head *v5Header, headerData, msgData []byte) (n *enode.Node, p packetV5, err error) {
+	node, auth, session, err := c.decodeHandshake(fromAddr, head)
+	if err != nil {
+		c.sc.deleteHandshake(auth.h.SrcID, fromAddr)
+		return nil, nil, err
+	}
+
+	// Decrypt the message using the new session keys.
+	msg, err := c.decryptMessage(msgData, head.Nonce[:], headerData, session.readKey)
+	if err != nil {
+		c.sc.deleteHandshake(auth.h.SrcID, fromAddr)
+		return node, msg, err
+	}
+
+	// Handshake OK, drop the challenge and store the new session keys.
+	c.sc.storeNewSession(auth.h.SrcID, fromAddr, session)
+	c.sc.deleteHandshake(auth.h.SrcID, fromAddr)
+	return node, msg, nil
+}
+
+func (c *wireCodec) decodeHandshake(fromAddr string, head *v5Header) (n *enode.Node, auth handshakeAuthData, s *session, err error) {
+	if auth, err = c.decodeHandshakeAuthData(head); err != nil {
+		return nil, auth, nil, err
+	}
+
+	// Verify against our last WHOAREYOU.
+	challenge := c.sc.getHandshake(auth.h.SrcID, fromAddr)
+	if challenge == nil {
+		return nil, auth, nil, errUnexpectedHandshake
+	}
+	// Get node record.
+	n, err = c.decodeHandshakeRecord(challenge.node, auth.h.SrcID, auth.record)
+	if err != nil {
+		return nil, auth, nil, err
+	}
+	// Verify ID nonce signature.
+	sig := auth.signature
+	cdata := challenge.ChallengeData
+	err = verifyIDSignature(c.sha256, sig, n, cdata, auth.pubkey, c.localnode.ID())
+	if err != nil {
+		return nil, auth, nil, err
+	}
+	// Verify ephemeral key is on curve.
+	ephkey, err := crypto.DecompressPubkey(auth.pubkey)
+	if err != nil {
+		return nil, auth, nil, errInvalidAuthKey
+	}
+	// Derive sesssion keys.
+	session := deriveKeys(sha256.New, c.privkey, ephkey, auth.h.SrcID, c.localnode.ID(), cdata)
+	if session == nil {
+		return nil, auth, nil, errInvalidAuthKey
+	}
+	session = session.keysFlipped()
+	return n, auth, session, nil
+}
+
+// decodeHandshakeAuthData reads the authdata section of a handshake packet.
+func (c *wireCodec) decodeHandshakeAuthData(head *v5Header) (auth handshakeAuthData, err error) {
+	// Decode fixed size part.
+	if len(head.AuthData) < sizeofHandshakeAuthDataHead {
+		return auth, fmt.Errorf("header authsize %d too low for handshake", head.AuthSize)
+	}
+	c.reader.Reset(head.AuthData)
+	binary.Read(&c.reader, binary.BigEndian, &auth.h)
+	head.src = auth.h.SrcID
+
+	// Decode variable-size part.
+	var (
+		vardata       = head.AuthData[sizeofHandshakeAuthDataHead:]
+		sigAndKeySize = int(auth.h.SigSize) + int(auth.h.PubkeySize)
+		keyOffset     = int(auth.h.SigSize)
+		recOffset     = keyOffset + int(auth.h.PubkeySize)
+	)
+	if len(vardata) < sigAndKeySize {
+		return auth, errTooShort
+	}
+	auth.signature = vardata[:keyOffset]
+	auth.pubkey = vardata[keyOffset:recOffset]
+	auth.record = vardata[recOffset:]
+	return auth, nil
+}
+
+// decodeHandshakeRecord verifies the node record contained in a handshake packet. The
+// remote node should include the record if we don't have one or if ours is older than the
+// latest sequence number.
+func (c *wireCodec) decodeHandshakeRecord(local *enode.Node, wantID enode.ID, remote []byte) (*enode.Node, error) {
+	node := local
+	if len(remote) > 0 {
+		var record enr.Record
+		if err := rlp.DecodeBytes(remote, &record); err != nil {
+			return nil, err
+		}
+		if local == nil || local.Seq() < record.Seq() {
+			n, err := enode.New(c.validSchemes, &record)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node record: %v", err)
+			}
+			if n.ID() != wantID {
+				return nil, fmt.Errorf("record in handshake has wrong ID: %v", n.ID())
+			}
+			node = n
+		}
+	}
+	if node == nil {
+		return nil, errNoRecord
+	}
+	return node, nil
+}
+
+// decodeMessage reads packet data following the header of an ordinary message packet.
+func (c *wireCodec) decodeMessage(fromAddr string, head *v5Header, headerData, msgData []byte) (packetV5, error) {
+	if len(head.AuthData) != sizeofMessageAuthData {
+		return nil, fmt.Errorf("invalid auth size %d for message packet", len(head.AuthData))
+	}
+	var auth messageAuthData
+	c.reader.Reset(head.AuthData)
+	binary.Read(&c.reader, binary.BigEndian, &auth)
+	head.src = auth.SrcID
+
+	// Try decrypting the message.
+	key := c.sc.readKey(auth.SrcID, fromAddr)
+	msg, err := c.decryptMessage(msgData, head.Nonce[:], headerData, key)
+	if err == errMessageDecrypt {
+		// It didn't work. Start the handshake since this is an ordinary message packet.
+		return &unknownV5{Nonce: head.Nonce}, nil
+	}
+	return msg, err
+}
+
+func (c *wireCodec) decryptMessage(input, nonce, headerData, readKey []byte) (packetV5, error) {
+	msgdata, err := decryptGCM(readKey, nonce, input, headerData)
+	if err != nil {
+		return nil, errMessageDecrypt
+	}
+	if len(msgdata) == 0 {
+		return nil, errMessageTooShort
+	}
+	return decodeV5Message(msgdata[0], msgdata[1:])
+}
+
+// decodeV5Message decodes the message body of a packet.
+func decodeV5Message(ptype byte, body []byte) (packetV5, error) {
+	var dec packetV5
+	switch ptype {
+	case p_pingV5:
+		dec = new(pingV5)
+	case p_pongV5:
+		dec = new(pongV5)
+	case p_findnodeV5:
+		dec = new(findnodeV5)
+	case p_nodesV5:
+		dec = new(nodesV5)
+	case p_talkreqV5:
+		dec = new(talkreqV5)
+	case p_talkrespV5:
+		dec = new(talkrespV5)
+	default:
+		return nil, fmt.Errorf("unknown packet type %d", ptype)
+	}
+	if err := rlp.DecodeBytes(body, dec); err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
+
+// headerMask returns a cipher for masking/unmasking packet headers.
+func headerMask(destID enode.ID, iv []byte) cipher.Stream {
+	block, err := aes.NewCipher(destID[:aesKeySize])
+	if err != nil {
+		panic("can't create cipher")
+	}
+	return cipher.NewCTR(block, iv)
+}
+
+// makeIDSignature creates the ID nonce signature.
+func makeIDSignature(hash hash.Hash, key *ecdsa.PrivateKey, challenge, ephkey []byte, destID enode.ID) ([]byte, error) {
+	input := idNonceHash(hash, challenge, ephkey, destID)
+	switch key.Curve {
+	case crypto.S256():
+		idsig, err := crypto.Sign(input, key)
+		if err != nil {
+			return nil, err
+		}
+		return idsig[:len(idsig)-1], nil // remove recovery ID
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+	}
+}
+
+// verifyIDSignature checks that the ID nonce signature was made by the given node.
+func verifyIDSignature(hash hash.Hash, sig []byte, n *enode.Node, challenge, ephkey []byte, destID enode.ID) error {
+	switch idscheme := n.Record().IdentityScheme(); idscheme {
+	case "v4":
+		var pubkey enode.Secp256k1
+		if n.Load(&pubkey) != nil {
+			return errors.New("no secp256k1 public key in record")
+		}
+		input := idNonceHash(hash, challenge, ephkey, destID)
+		if !crypto.VerifySignature(crypto.FromECDSAPub((*ecdsa.PublicKey)(&pubkey)), input, sig) {
+			return errInvalidNonceSig
+		}
+		return nil
+	default:
+		return fmt.Errorf("can't verify ID nonce signature against scheme %q", idscheme)
+	}
+}
+
+// idNonceHash computes the hash of the identity proof input.
+func idNonceHash(h hash.Hash, challenge, ephkey []byte, destID enode.ID) []byte {
+	h.Reset()
+	h.Write([]byte(idSignatureText))
+	h.Write(challenge)
+	h.Write(ephkey)
+	h.Write(destID[:])
+	return h.Sum(nil)
+}
+
+// deriveKeys creates the session keys.
+func deriveKeys(hash func() hash.Hash, priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, n1, n2 enode.ID, challenge []byte) *session {
+	info := []byte(keyAgreementInfo)
+	info = append(info, n1[:]...)
+	info = append(info, n2[:]...)
+
+	eph := ecdh(priv, pub)
+	if eph == nil {
+		return nil
+	}
+	kdf := hkdf.New(hash, eph, challenge, info)
+	sec := session{writeKey: make([]byte, aesKeySize), readKey: make([]byte, aesKeySize)}
+	kdf.Read(sec.writeKey)
+	kdf.Read(sec.readKey)
+	for i := range eph {
+		eph[i] = 0
+	}
+	return &sec
+}
+
+// ecdh creates a shared secret. The result is the compressed shared point.
+func ecdh(privkey *ecdsa.PrivateKey, pubkey *ecdsa.PublicKey) []byte {
+	curve := elliptic.Curve(crypto.S256())
+	if !curve.IsOnCurve(pubkey.X, pubkey.Y) {
+		return nil
+	}
+	secX, secY := curve.ScalarMult(pubkey.X, pubkey.Y, privkey.D.Bytes())
+	if secX == nil {
+		return nil
+	}
+	sec := make([]byte, 33)
+	sec[0] = 0x02 | byte(secY.Bit(0))
+	math.ReadBits(secX, sec[1:])
+	return sec
+}
+
+// encryptGCM encrypts pt using AES-GCM with the given key and nonce. The ciphertext is
+// appended to dest, which must not overlap with plaintext.
+func encryptGCM(dest, key, nonce, plaintext, authData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(fmt.Errorf("can't create block cipher: %v", err))
+	}
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		panic(fmt.Errorf("can't create GCM: %v", err))
+	}
+	return aesgcm.Seal(dest, nonce, plaintext, authData), nil
+}
+
+// decryptGCM decrypts ct using AES-GCM with the given key and nonce.
+func decryptGCM(key, nonce, ct, authData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't create block cipher: %v", err)
+	}
+	if len(nonce) != gcmNonceSize {
+		return nil, fmt.Errorf("invalid GCM nonce size: %d", len(nonce))
+	}
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		return nil, fmt.Errorf("can't create GCM: %v", err)
+	}
+	pt := make([]byte, 0, len(ct))
+	return aesgcm.Open(pt, nonce, ct, authData)
+}
@@ -0,0 +1,296 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/groshproject/grosh-core/common/mclock"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/enr"
+)
+
+func TestDeriveKeysV5(t *testing.T) {
+	t.Parallel()
+
+	var (
+		n1        = enode.ID{1}
+		n2        = enode.ID{2}
+		challenge = []byte("challenge data")
+		keyA      = newkey()
+		keyB      = newkey()
+	)
+	s1 := deriveKeys(sha256.New, keyA, &keyB.PublicKey, n1, n2, challenge)
+	s2 := deriveKeys(sha256.New, keyB, &keyA.PublicKey, n1, n2, challenge)
+	if s1 == nil || s2 == nil {
+		t.Fatal("key derivation failed")
+	}
+	if !bytes.Equal(s1.writeKey, s2.writeKey) || !bytes.Equal(s1.readKey, s2.readKey) {
+		t.Fatalf("keys not equal:\n  %s\n  %s", spew.Sdump(s1), spew.Sdump(s2))
+	}
+}
+
+func TestIDSignatureV5(t *testing.T) {
+	t.Parallel()
+
+	var (
+		key       = newkey()
+		ephkey    = newkey()
+		challenge = []byte("challenge data")
+		destID    = enode.ID{5}
+		h         = sha256.New()
+	)
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+	n := enode.NewLocalNode(db, key).Node()
+
+	ephpub := crypto.CompressPubkey(&ephkey.PublicKey)
+	sig, err := makeIDSignature(h, key, challenge, ephpub, destID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyIDSignature(h, sig, n, challenge, ephpub, destID); err != nil {
+		t.Fatal("valid signature rejected:", err)
+	}
+	if err := verifyIDSignature(h, sig, n, challenge, ephpub, enode.ID{6}); err == nil {
+		t.Fatal("signature accepted for wrong destination")
+	}
+}
+
+// This test checks the full handshake flow between two codecs.
+func TestHandshakeV5(t *testing.T) {
+	t.Parallel()
+	net := newHandshakeTest()
+	defer net.close()
+
+	// A -> B   RANDOM PACKET
+	packet, _ := net.nodeA.encode(t, net.nodeB, &findnodeV5{})
+	resp := net.nodeB.expectDecode(t, p_unknownV5, packet)
+
+	// A <- B   WHOAREYOU
+	challenge := &whoareyouV5{
+		Nonce:     resp.(*unknownV5).Nonce,
+		IDNonce:   [16]byte{1},
+		RecordSeq: 0,
+	}
+	whoareyou, _ := net.nodeB.encode(t, net.nodeA, challenge)
+	challenge = net.nodeA.expectDecode(t, p_whoareyouV5, whoareyou).(*whoareyouV5)
+
+	// A -> B   FINDNODE (handshake packet)
+	findnode, _ := net.nodeA.encodeWithChallenge(t, net.nodeB, challenge, &findnodeV5{})
+	net.nodeB.expectDecode(t, p_findnodeV5, findnode)
+	if len(net.nodeB.c.sc.handshakes) > 0 {
+		t.Fatalf("node B didn't remove handshake from challenge map")
+	}
+
+	// A <- B   NODES
+	nodes, _ := net.nodeB.encode(t, net.nodeA, &nodesV5{Total: 1})
+	net.nodeA.expectDecode(t, p_nodesV5, nodes)
+}
+
+// This test checks that handshake attempts are removed within the timeout.
+func TestHandshakeV5_timeout(t *testing.T) {
+	t.Parallel()
+	net := newHandshakeTest()
+	defer net.close()
+
+	// A -> B   RANDOM PACKET
+	packet, _ := net.nodeA.encode(t, net.nodeB, &findnodeV5{})
+	resp := net.nodeB.expectDecode(t, p_unknownV5, packet)
+
+	// A <- B   WHOAREYOU
+	challenge := &whoareyouV5{
+		Nonce:     resp.(*unknownV5).Nonce,
+		IDNonce:   [16]byte{1},
+		RecordSeq: 0,
+	}
+	whoareyou, _ := net.nodeB.encode(t, net.nodeA, challenge)
+	challenge = net.nodeA.expectDecode(t, p_whoareyouV5, whoareyou).(*whoareyouV5)
+
+	// A -> B   FINDNODE after timeout
+	net.clock.Run(handshakeTimeout + 1)
+	findnode, _ := net.nodeA.encodeWithChallenge(t, net.nodeB, challenge, &findnodeV5{})
+	net.nodeB.expectDecodeErr(t, errUnexpectedHandshake, findnode)
+}
+
+// This test checks that a handshake with a wrong ID nonce signature is rejected.
+func TestHandshakeV5_invalidSignature(t *testing.T) {
+	t.Parallel()
+	net := newHandshakeTest()
+	defer net.close()
+
+	// A -> B   RANDOM PACKET
+	packet, _ := net.nodeA.encode(t, net.nodeB, &findnodeV5{})
+	resp := net.nodeB.expectDecode(t, p_unknownV5, packet)
+
+	// A <- B   WHOAREYOU
+	challenge := &whoareyouV5{
+		Nonce:     resp.(*unknownV5).Nonce,
+		IDNonce:   [16]byte{1},
+		RecordSeq: 0,
+	}
+	whoareyou, _ := net.nodeB.encode(t, net.nodeA, challenge)
+	challenge = net.nodeA.expectDecode(t, p_whoareyouV5, whoareyou).(*whoareyouV5)
+
+	// A -> B   FINDNODE answering a different challenge
+	fake := *challenge
+	fake.ChallengeData = append([]byte{}, challenge.ChallengeData...)
+	fake.ChallengeData[len(fake.ChallengeData)-1] ^= 1
+	findnode, _ := net.nodeA.encodeWithChallenge(t, net.nodeB, &fake, &findnodeV5{})
+	if _, err := net.nodeB.decode(findnode); err == nil {
+		t.Fatal("handshake with invalid signature accepted")
+	}
+}
+
+// This test checks that records in handshakes are checked against the configured
+// identity schemes.
+func TestHandshakeV5_validSchemes(t *testing.T) {
+	t.Parallel()
+	net := newHandshakeTest()
+	defer net.close()
+	net.nodeB.c.validSchemes = enr.SchemeMap{}
+
+	// A -> B   RANDOM PACKET
+	packet, _ := net.nodeA.encode(t, net.nodeB, &findnodeV5{})
+	resp := net.nodeB.expectDecode(t, p_unknownV5, packet)
+
+	// A <- B   WHOAREYOU
+	challenge := &whoareyouV5{
+		Nonce:     resp.(*unknownV5).Nonce,
+		IDNonce:   [16]byte{1},
+		RecordSeq: 0,
+	}
+	whoareyou, _ := net.nodeB.encode(t, net.nodeA, challenge)
+	challenge = net.nodeA.expectDecode(t, p_whoareyouV5, whoareyou).(*whoareyouV5)
+
+	// A -> B   FINDNODE with a record of an unknown scheme
+	findnode, _ := net.nodeA.encodeWithChallenge(t, net.nodeB, challenge, &findnodeV5{})
+	if _, err := net.nodeB.decode(findnode); err == nil {
+		t.Fatal("handshake with record of invalid scheme accepted")
+	}
+}
+
+// This test checks that packets with a modified header are rejected.
+func TestDecodeV5_errors(t *testing.T) {
+	t.Parallel()
+	net := newHandshakeTest()
+	defer net.close()
+
+	if _, err := net.nodeB.decode(make([]byte, 10)); err != errTooShort {
+		t.Fatalf("wrong error for short packet: %v", err)
+	}
+	packet, _ := net.nodeA.encode(t, net.nodeB, &pingV5{})
+	// Decoding with the wrong key produces a garbled static header.
+	if _, err := net.nodeA.decode(packet); err == nil {
+		t.Fatal("packet decoded with wrong masking key")
+	}
+}
+
+// handshakeTest is a helper for testing the v5 wire codec.
+type handshakeTest struct {
+	nodeA, nodeB handshakeTestNode
+	clock        mclock.Simulated
+}
+
+type handshakeTestNode struct {
+	ln *enode.LocalNode
+	c  *wireCodec
+}
+
+func newHandshakeTest() *handshakeTest {
+	t := new(handshakeTest)
+	t.nodeA.init(newkey(), net.IP{127, 0, 0, 1}, &t.clock)
+	t.nodeB.init(newkey(), net.IP{127, 0, 0, 1}, &t.clock)
+	return t
+}
+
+func (t *handshakeTest) close() {
+	t.nodeA.ln.Database().Close()
+	t.nodeB.ln.Database().Close()
+}
+
+func (n *handshakeTestNode) init(key *ecdsa.PrivateKey, ip net.IP, clock mclock.Clock) {
+	db, _ := enode.OpenDB("")
+	n.ln = enode.NewLocalNode(db, key)
+	n.ln.SetStaticIP(ip)
+	n.c = newWireCodec(n.ln, key, clock, enode.ValidSchemesForTesting)
+}
+
+func (n *handshakeTestNode) encode(t testing.TB, to handshakeTestNode, p packetV5) ([]byte, v5Nonce) {
+	t.Helper()
+	return n.encodeWithChallenge(t, to, nil, p)
+}
+
+func (n *handshakeTestNode) encodeWithChallenge(t testing.TB, to handshakeTestNode, c *whoareyouV5, p packetV5) ([]byte, v5Nonce) {
+	t.Helper()
+	// Copy challenge and add destination node. This avoids sharing 'c' among the two codecs.
+	var challenge *whoareyouV5
+	if c != nil {
+		challengeCopy := *c
+		challenge = &challengeCopy
+		challenge.node = to.n()
+	}
+	// Encode to destination.
+	enc, nonce, err := n.c.encode(to.id(), to.addr(), p, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc, nonce
+}
+
+func (n *handshakeTestNode) expectDecode(t *testing.T, ptype byte, p []byte) packetV5 {
+	t.Helper()
+	dec, err := n.decode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.kind() != ptype {
+		t.Fatalf("expected packet type %d, got %d", ptype, dec.kind())
+	}
+	return dec
+}
+
+func (n *handshakeTestNode) expectDecodeErr(t *testing.T, wantErr error, p []byte) {
+	t.Helper()
+	if _, err := n.decode(p); !reflect.DeepEqual(err, wantErr) {
+		t.Fatal(spew.Sprintf("expected decode error %v, got %v", wantErr, err))
+	}
+}
+
+func (n *handshakeTestNode) decode(input []byte) (packetV5, error) {
+	_, _, p, err := n.c.decode(input, "127.0.0.1")
+	return p, err
+}
+
+func (n *handshakeTestNode) n() *enode.Node {
+	return n.ln.Node()
+}
+
+func (n *handshakeTestNode) addr() string {
+	return n.ln.Node().IP().String()
+}
+
+func (n *handshakeTestNode) id() enode.ID {
+	return n.ln.ID()
+}
@@ -0,0 +1,629 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/internal/testlog"
+	"github.com/groshproject/grosh-core/log"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/enr"
+)
+
+// Real sockets, real crypto: this test checks end-to-end connectivity for UDPv5.
+func TestUDPv5_lookupE2E(t *testing.T) {
+	t.Parallel()
+
+	const N = 5
+	var nodes []*UDPv5
+	for i := 0; i < N; i++ {
+		var cfg Config
+		if len(nodes) > 0 {
+			bn := nodes[0].Self()
+			cfg.Bootnodes = []*enode.Node{bn}
+		}
+		node := startLocalhostV5(t, cfg)
+		nodes = append(nodes, node)
+		defer node.Close()
+		// Wait for the initial self-lookup so the bootnode knows about this node.
+		<-node.tab.initDone
+	}
+	last := nodes[N-1]
+	target := nodes[rand.Intn(N-2)].Self()
+
+	// The target is known to the bootnode, so the lookup must find it.
+	results := last.Lookup(target.ID())
+	if len(results) == 0 || results[0].ID() != target.ID() {
+		t.Fatalf("lookup didn't find target %v: %v", target.ID(), results)
+	}
+	if hasDuplicates(wrapNodes(results)) {
+		t.Fatalf("lookup result contains duplicates")
+	}
+	if !sortedByDistanceTo(target.ID(), wrapNodes(results)) {
+		t.Fatalf("lookup result not sorted by distance to target")
+	}
+}
+
+func startLocalhostV5(t *testing.T, cfg Config) *UDPv5 {
+	cfg.PrivateKey = newkey()
+	db, _ := enode.OpenDB("")
+	ln := enode.NewLocalNode(db, cfg.PrivateKey)
+
+	// Prefix logs with node ID.
+	lprefix := fmt.Sprintf("(%s)", ln.ID().TerminalString())
+	lfmt := log.TerminalFormat(false)
+	cfg.Log = testlog.Logger(t, log.LvlTrace)
+	cfg.Log.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		t.Logf("%s %s", lprefix, lfmt.Format(r))
+		return nil
+	}))
+
+	// Listen.
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	realaddr := socket.LocalAddr().(*net.UDPAddr)
+	ln.SetStaticIP(realaddr.IP)
+	ln.Set(enr.UDP(realaddr.Port))
+	udp, err := ListenV5(socket, ln, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return udp
+}
+
+// This test checks that incoming PING calls are handled correctly.
+func TestUDPv5_pingHandling(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	test.handshake()
+	test.packetIn(&pingV5{ReqID: []byte("foo")})
+	test.waitPacketOut(func(p *pongV5, addr *net.UDPAddr) {
+		if string(p.ReqID) != "foo" {
+			t.Error("wrong request ID in response:", p.ReqID)
+		}
+		if p.ENRSeq != test.table.self().Seq() {
+			t.Error("wrong ENR sequence number in response:", p.ENRSeq)
+		}
+		if !p.ToIP.Equal(test.remoteaddr.IP) || int(p.ToPort) != test.remoteaddr.Port {
+			t.Errorf("wrong endpoint in response: %v:%d", p.ToIP, p.ToPort)
+		}
+	})
+}
+
+// This test checks that incoming 'unknown' packets trigger the handshake.
+func TestUDPv5_unknownPacket(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	nonce := test.packetIn(&pingV5{ReqID: []byte("foo")})
+	check := func(p *whoareyouV5, wantSeq uint64) {
+		t.Helper()
+		if p.Nonce != nonce {
+			t.Error("wrong nonce in WHOAREYOU:", p.Nonce, nonce)
+		}
+		if p.IDNonce == ([16]byte{}) {
+			t.Error("all zero ID nonce")
+		}
+		if p.RecordSeq != wantSeq {
+			t.Errorf("wrong record seq %d in WHOAREYOU, want %d", p.RecordSeq, wantSeq)
+		}
+	}
+
+	// Unknown packet from unknown node.
+	test.waitPacketOut(func(p *whoareyouV5, addr *net.UDPAddr) {
+		check(p, 0)
+	})
+
+	// Make node known.
+	n := test.getNode(test.remotekey, test.remoteaddr).Node()
+	test.table.addSeenNode(wrapNode(n))
+
+	nonce = test.packetIn(&pingV5{ReqID: []byte("foo")})
+	test.waitPacketOut(func(p *whoareyouV5, addr *net.UDPAddr) {
+		check(p, n.Seq())
+	})
+}
+
+// This test checks that incoming FINDNODE calls are handled correctly.
+func TestUDPv5_findnodeHandling(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	// Create test nodes and insert them into the table.
+	nodes253 := nodesAtDistance(test.table.self().ID(), 253, 10)
+	nodes249 := nodesAtDistance(test.table.self().ID(), 249, 4)
+	nodes248 := nodesAtDistance(test.table.self().ID(), 248, 10)
+	fillTable(test.table, wrapNodes(nodes253))
+	fillTable(test.table, wrapNodes(nodes249))
+	fillTable(test.table, wrapNodes(nodes248))
+
+	// The handshake adds the remote node to the table. Keep it out of the buckets
+	// queried below, it would show up in the responses otherwise.
+	for {
+		switch enode.LogDist(test.table.self().ID(), encodePubkey(&test.remotekey.PublicKey).id()) {
+		case 248, 249, 253, 254:
+			test.remotekey = newkey()
+			continue
+		}
+		break
+	}
+	test.handshake()
+
+	// Requesting with distance zero should return the node's own record.
+	test.packetIn(&findnodeV5{ReqID: []byte{0}, Distances: []uint{0}})
+	test.expectNodes([]byte{0}, 1, []*enode.Node{test.udp.Self()})
+
+	// Requesting with distance > 256 shouldn't crash.
+	test.packetIn(&findnodeV5{ReqID: []byte{1}, Distances: []uint{4234098}})
+	test.expectNodes([]byte{1}, 1, nil)
+
+	// Requesting with empty distance list shouldn't crash either.
+	test.packetIn(&findnodeV5{ReqID: []byte{2}, Distances: []uint{}})
+	test.expectNodes([]byte{2}, 1, nil)
+
+	// This request gets no nodes because the corresponding bucket is empty.
+	test.packetIn(&findnodeV5{ReqID: []byte{3}, Distances: []uint{254}})
+	test.expectNodes([]byte{3}, 1, nil)
+
+	// This request gets all the distance-253 nodes.
+	test.packetIn(&findnodeV5{ReqID: []byte{4}, Distances: []uint{253}})
+	test.expectNodes([]byte{4}, 4, nodes253)
+
+	// This request gets all the distance-249 nodes and some more at 248 because
+	// the bucket at 249 is not full.
+	test.packetIn(&findnodeV5{ReqID: []byte{5}, Distances: []uint{249, 248}})
+	var nodes []*enode.Node
+	nodes = append(nodes, nodes249...)
+	nodes = append(nodes, nodes248[:10]...)
+	test.expectNodes([]byte{5}, 5, nodes)
+}
+
+func (test *udpV5Test) expectNodes(wantReqID []byte, wantTotal uint8, wantNodes []*enode.Node) {
+	nodeSet := make(map[enode.ID]*enr.Record)
+	for _, n := range wantNodes {
+		nodeSet[n.ID()] = n.Record()
+	}
+
+	for {
+		test.waitPacketOut(func(p *nodesV5, addr *net.UDPAddr) {
+			if len(p.Nodes) > nodesResponseItemLimit {
+				test.t.Fatalf("too many nodes in response")
+			}
+			if p.Total != wantTotal {
+				test.t.Fatalf("wrong total response count %d, want %d", p.Total, wantTotal)
+			}
+			if !reflect.DeepEqual(p.ReqID, wantReqID) {
+				test.t.Fatalf("wrong request ID %v in response, want %v", p.ReqID, wantReqID)
+			}
+			for _, record := range p.Nodes {
+				n, _ := enode.New(enode.ValidSchemesForTesting, record)
+				want := nodeSet[n.ID()]
+				if want == nil {
+					test.t.Fatalf("unexpected node in response: %v", n)
+				}
+				if !reflect.DeepEqual(record, want) {
+					test.t.Fatalf("wrong record in response: %v", n)
+				}
+				delete(nodeSet, n.ID())
+			}
+		})
+		if len(nodeSet) == 0 {
+			return
+		}
+	}
+}
+
+// This test checks that outgoing PING calls work.
+func TestUDPv5_pingCall(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	remote := test.getNode(test.remotekey, test.remoteaddr).Node()
+	done := make(chan error, 1)
+
+	// This ping times out.
+	go func() {
+		_, err := test.udp.ping(remote)
+		done <- err
+	}()
+	test.waitPacketOut(func(p *pingV5, addr *net.UDPAddr) {})
+	if err := <-done; err != errTimeout {
+		t.Fatalf("want errTimeout, got %q", err)
+	}
+
+	// This ping works.
+	go func() {
+		_, err := test.udp.ping(remote)
+		done <- err
+	}()
+	test.waitPacketOut(func(p *pingV5, addr *net.UDPAddr) {
+		test.packetInFrom(test.remotekey, test.remoteaddr, &pongV5{ReqID: p.ReqID})
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+// This test checks that outgoing FINDNODE calls work and multiple NODES
+// replies are aggregated.
+func TestUDPv5_findnodeCall(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	// Launch the request:
+	var (
+		distances = []uint{230}
+		remote    = test.getNode(test.remotekey, test.remoteaddr).Node()
+		nodes     = nodesAtDistance(remote.ID(), int(distances[0]), 8)
+		done      = make(chan error, 1)
+		response  []*enode.Node
+	)
+	go func() {
+		var err error
+		response, err = test.udp.findnode(remote, distances)
+		done <- err
+	}()
+
+	// Serve the responses:
+	test.waitPacketOut(func(p *findnodeV5, addr *net.UDPAddr) {
+		if !reflect.DeepEqual(p.Distances, distances) {
+			t.Fatalf("wrong distances in request: %v", p.Distances)
+		}
+		test.packetIn(&nodesV5{
+			ReqID: p.ReqID,
+			Total: 2,
+			Nodes: nodesToRecords(nodes[:4]),
+		})
+		test.packetIn(&nodesV5{
+			ReqID: p.ReqID,
+			Total: 2,
+			Nodes: nodesToRecords(nodes[4:]),
+		})
+	})
+
+	// Check results:
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := checkNodesEqual(response, nodes); err != nil {
+		t.Fatalf("wrong nodes in response: %v", err)
+	}
+}
+
+// This test checks that calls with n replies may take up to n * respTimeout.
+func TestUDPv5_callTimeoutReset(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	// Launch the request:
+	var (
+		distance = uint(230)
+		remote   = test.getNode(test.remotekey, test.remoteaddr).Node()
+		nodes    = nodesAtDistance(remote.ID(), int(distance), 8)
+		done     = make(chan error, 1)
+	)
+	go func() {
+		_, err := test.udp.findnode(remote, []uint{distance})
+		done <- err
+	}()
+
+	// Serve two responses, slowly.
+	test.waitPacketOut(func(p *findnodeV5, addr *net.UDPAddr) {
+		time.Sleep(respTimeoutV5 - 50*time.Millisecond)
+		test.packetIn(&nodesV5{
+			ReqID: p.ReqID,
+			Total: 2,
+			Nodes: nodesToRecords(nodes[:4]),
+		})
+
+		time.Sleep(respTimeoutV5 - 50*time.Millisecond)
+		test.packetIn(&nodesV5{
+			ReqID: p.ReqID,
+			Total: 2,
+			Nodes: nodesToRecords(nodes[4:]),
+		})
+	})
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+}
+
+// This test checks that TALKREQ calls are answered with an empty response.
+func TestUDPv5_talkHandling(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	test.handshake()
+	test.packetIn(&talkreqV5{ReqID: []byte("foo"), Protocol: "test", Message: []byte("hi")})
+	test.waitPacketOut(func(p *talkrespV5, addr *net.UDPAddr) {
+		if string(p.ReqID) != "foo" {
+			t.Error("wrong request ID in response:", p.ReqID)
+		}
+		if len(p.Message) != 0 {
+			t.Error("non-empty message in response:", p.Message)
+		}
+	})
+}
+
+func TestUDPv5_lookupDistances(t *testing.T) {
+	var (
+		lnID  = enode.ID{}
+		tests = []struct {
+			dist int
+			want []uint
+		}{
+			{256, []uint{256, 255, 254}},
+			{255, []uint{255, 256, 254}},
+			{1, []uint{1, 2, 3}},
+		}
+	)
+	for _, test := range tests {
+		target := idAtDistance(lnID, test.dist)
+		if dists := lookupDistances(target, lnID); !reflect.DeepEqual(dists, test.want) {
+			t.Errorf("wrong distances for logdist %d: got %v, want %v", test.dist, dists, test.want)
+		}
+	}
+}
+
+func TestUDPv5_packNodes(t *testing.T) {
+	reqid := []byte{1}
+	if resp := packNodes(reqid, nil); len(resp) != 1 || resp[0].Total != 1 || len(resp[0].Nodes) != 0 {
+		t.Fatalf("wrong response for empty node list: %v", resp)
+	}
+	nodes := nodesAtDistance(enode.ID{}, 256, 7)
+	resp := packNodes(reqid, nodes)
+	if len(resp) != 3 {
+		t.Fatalf("wrong number of packets %d, want 3", len(resp))
+	}
+	var count int
+	for _, p := range resp {
+		if p.Total != 3 {
+			t.Errorf("wrong total %d, want 3", p.Total)
+		}
+		count += len(p.Nodes)
+	}
+	if count != len(nodes) {
+		t.Fatalf("wrong node count %d, want %d", count, len(nodes))
+	}
+}
+
+// udpV5Test is the framework for all tests above.
+// It runs the UDPv5 transport on a virtual socket and allows testing outgoing packets.
+type udpV5Test struct {
+	t                   *testing.T
+	pipe                *dgramPipe
+	table               *Table
+	db                  *enode.DB
+	udp                 *UDPv5
+	localkey, remotekey *ecdsa.PrivateKey
+	remoteaddr          *net.UDPAddr
+	nodesByID           map[enode.ID]*testNodeV5
+	nodesByIP           map[string]*testNodeV5
+}
+
+// testNodeV5 is a remote node participating in the test.
+type testNodeV5 struct {
+	ln    *enode.LocalNode
+	codec *wireCodec
+}
+
+func newUDPV5Test(t *testing.T) *udpV5Test {
+	test := &udpV5Test{
+		t:          t,
+		pipe:       newpipe(),
+		localkey:   newkey(),
+		remotekey:  newkey(),
+		remoteaddr: &net.UDPAddr{IP: net.IP{10, 0, 1, 99}, Port: 30303},
+		nodesByID:  make(map[enode.ID]*testNodeV5),
+		nodesByIP:  make(map[string]*testNodeV5),
+	}
+	test.db, _ = enode.OpenDB("")
+	ln := enode.NewLocalNode(test.db, test.localkey)
+	ln.SetStaticIP(net.IP{10, 0, 0, 1})
+	ln.Set(enr.UDP(30303))
+	test.udp, _ = ListenV5(test.pipe, ln, Config{
+		PrivateKey:   test.localkey,
+		Log:          testlog.Logger(t, log.LvlTrace),
+		ValidSchemes: enode.ValidSchemesForTesting,
+	})
+	test.table = test.udp.tab
+	// Wait for initial refresh so the table doesn't send unexpected findnode.
+	<-test.table.initDone
+	return test
+}
+
+func (test *udpV5Test) close() {
+	test.t.Helper()
+
+	test.udp.Close()
+	test.db.Close()
+	for id, n := range test.nodesByID {
+		if id != test.udp.Self().ID() {
+			n.ln.Database().Close()
+		}
+	}
+	if len(test.pipe.queue) != 0 {
+		test.t.Fatalf("%d unmatched UDP packets in queue", len(test.pipe.queue))
+	}
+}
+
+// getNode ensures the test knows about a node at the given endpoint.
+func (test *udpV5Test) getNode(key *ecdsa.PrivateKey, addr *net.UDPAddr) *enode.LocalNode {
+	id := encodePubkey(&key.PublicKey).id()
+	n := test.nodesByID[id]
+	if n == nil {
+		db, _ := enode.OpenDB("")
+		ln := enode.NewLocalNode(db, key)
+		ln.SetStaticIP(addr.IP)
+		ln.Set(enr.UDP(addr.Port))
+		n = &testNodeV5{ln: ln, codec: newWireCodec(ln, key, test.udp.clock, enode.ValidSchemesForTesting)}
+		test.nodesByID[id] = n
+		test.nodesByIP[string(addr.IP)] = n
+	}
+	return n.ln
+}
+
+// handshake performs the handshake between the test node at remoteaddr
+// and the transport under test.
+func (test *udpV5Test) handshake() {
+	test.t.Helper()
+
+	nonce := test.packetIn(&pingV5{ReqID: []byte("hs")})
+	var challenge *whoareyouV5
+	test.waitPacketOut(func(p *whoareyouV5, addr *net.UDPAddr) {
+		if p.Nonce != nonce {
+			test.t.Fatal("wrong nonce in WHOAREYOU")
+		}
+		challenge = p
+	})
+	challenge.node = test.udp.Self()
+	test.packetInChallenge(test.remotekey, test.remoteaddr, challenge, &pingV5{ReqID: []byte("hs")})
+	test.waitPacketOut(func(p *pongV5, addr *net.UDPAddr) {})
+}
+
+// packetIn delivers a packet to the transport as if it had been sent by the
+// test node at remoteaddr.
+func (test *udpV5Test) packetIn(packet packetV5) v5Nonce {
+	test.t.Helper()
+	return test.packetInFrom(test.remotekey, test.remoteaddr, packet)
+}
+
+// packetInFrom delivers a packet to the transport from the given key/endpoint.
+func (test *udpV5Test) packetInFrom(key *ecdsa.PrivateKey, addr *net.UDPAddr, packet packetV5) v5Nonce {
+	test.t.Helper()
+	return test.packetInChallenge(key, addr, nil, packet)
+}
+
+func (test *udpV5Test) packetInChallenge(key *ecdsa.PrivateKey, addr *net.UDPAddr, challenge *whoareyouV5, packet packetV5) v5Nonce {
+	test.t.Helper()
+
+	ln := test.getNode(key, addr)
+	codec := test.nodesByID[ln.ID()].codec
+	enc, nonce, err := codec.encode(test.udp.Self().ID(), test.udp.Self().IP().String(), packet, challenge)
+	if err != nil {
+		test.t.Errorf("%s encode error: %v", packet.name(), err)
+	}
+	if test.udp.dispatchReadPacket(addr, enc) {
+		<-test.udp.readNextCh // unblock UDPv5.dispatch
+	}
+	return nonce
+}
+
+// waitPacketOut waits for the next output packet and handles it using the given 'validate'
+// function. The function must be of type func (X, *net.UDPAddr) where X is a subtype of
+// packetV5.
+func (test *udpV5Test) waitPacketOut(validate interface{}) (closed bool) {
+	test.t.Helper()
+
+	fn := reflect.ValueOf(validate)
+	exptype := fn.Type().In(0)
+
+	dgram, ok := test.pipe.receive()
+	if !ok {
+		return true
+	}
+	ln := test.nodesByIP[string(dgram.to.IP)]
+	if ln == nil {
+		test.t.Fatalf("attempt to send to non-existing node %v", &dgram.to)
+		return false
+	}
+	_, _, p, err := ln.codec.decode(dgram.data, test.udp.Self().IP().String())
+	if err != nil {
+		test.t.Errorf("could not decode packet to %v: %v", &dgram.to, err)
+		return false
+	}
+	if u, ok := p.(*unknownV5); ok && exptype != reflect.TypeOf(u) {
+		// The transport sent a random packet to start the handshake. Answer
+		// with WHOAREYOU and decode the packet that follows.
+		challenge := &whoareyouV5{Nonce: u.Nonce}
+		enc, _, _ := ln.codec.encode(test.udp.Self().ID(), test.udp.Self().IP().String(), challenge, nil)
+		if test.udp.dispatchReadPacket(&dgram.to, enc) {
+			<-test.udp.readNextCh
+		}
+		return test.waitPacketOut(validate)
+	}
+	if !reflect.TypeOf(p).AssignableTo(exptype) {
+		test.t.Errorf("sent packet type mismatch, got: %v, want: %v", reflect.TypeOf(p), exptype)
+		return false
+	}
+	fn.Call([]reflect.Value{reflect.ValueOf(p), reflect.ValueOf(&dgram.to)})
+	return false
+}
+
+// nodesAtDistance creates n nodes for which enode.LogDist(base, node.ID()) == dist.
+func nodesAtDistance(base enode.ID, dist int, n int) []*enode.Node {
+	results := make([]*enode.Node, n)
+	for i := range results {
+		var r enr.Record
+		r.Set(enr.IP(intIP(i + 1)))
+		r.Set(enr.UDP(30303))
+		results[i] = enode.SignNull(&r, idAtDistance(base, dist))
+	}
+	return results
+}
+
+// checkNodesEqual reports an error if the two node lists differ.
+func checkNodesEqual(got, want []*enode.Node) error {
+	if len(got) == len(want) {
+		for i := range got {
+			if got[i].ID() != want[i].ID() || !reflect.DeepEqual(got[i].Record(), want[i].Record()) {
+				goto NotEqual
+			}
+		}
+		return nil
+	}
+
+NotEqual:
+	output := new(bytes.Buffer)
+	fmt.Fprintf(output, "got %d nodes:\n", len(got))
+	for _, n := range got {
+		fmt.Fprintf(output, "  %v %v\n", n.ID(), n)
+	}
+	fmt.Fprintf(output, "want %d:\n", len(want))
+	for _, n := range want {
+		fmt.Fprintf(output, "  %v %v\n", n.ID(), n)
+	}
+	return errors.New(output.String())
+}
+
+func nodesToRecords(nodes []*enode.Node) []*enr.Record {
+	records := make([]*enr.Record, len(nodes))
+	for i := range nodes {
+		records[i] = nodes[i].Record()
+	}
+	return records
+}
@@ -17,10 +17,12 @@
 package enode
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"fmt"
 	"net"
 	"reflect"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -38,6 +40,12 @@ const (
 	iptrackContactWindow = 10 * time.Minute
 )
 
+// Names of the built-in external address sources.
+const (
+	SourceStatic    = "static"    // set by SetStaticIP
+	SourceDiscovery = "discovery" // predicted from endpoint statements of other nodes
+)
+
 // LocalNode produces the signed node record of a local node, i.e. a node run in the
 // current process. Setting ENR entries via the Set method updates the record. A new version
 // of the record is signed on demand when the Node method is called.
@@ -59,6 +67,14 @@ type lnEndpoint struct {
 	track                *netutil.IPTracker
 	staticIP, fallbackIP net.IP
 	fallbackUDP          int
+	sources              map[string]net.IP // external IPs reported by SetExternalIP
+}
+
+// ExternalAddr is an external address of the local node as reported by one source.
+type ExternalAddr struct {
+	Source string `json:"source"`
+	IP     net.IP `json:"ip"`
+	Port   int    `json:"port,omitempty"`
 }
 
 // NewLocalNode creates a local node.
@@ -183,6 +199,58 @@ func (ln *LocalNode) SetFallbackUDP(port int) {
 	ln.updateEndpoints()
 }
 
+// SetExternalIP records the external IP address of the local node as reported by the
+// given source, e.g. a NAT port mapping protocol. Passing a nil IP removes the address
+// previously reported by the source. When no static IP is set, the IP of the local
+// record is chosen by consensus among all sources and the endpoint predictor.
+func (ln *LocalNode) SetExternalIP(source string, ip net.IP) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	if ip == nil || ip.IsUnspecified() {
+		delete(ln.endpoint4.sources, source)
+		delete(ln.endpoint6.sources, source)
+	} else {
+		e := ln.endpointForIP(ip)
+		if e.sources == nil {
+			e.sources = make(map[string]net.IP)
+		}
+		// A source reports a single address, remove it from the other family.
+		if e == &ln.endpoint4 {
+			delete(ln.endpoint6.sources, source)
+		} else {
+			delete(ln.endpoint4.sources, source)
+		}
+		e.sources[source] = ip
+	}
+	ln.updateEndpoints()
+}
+
+// ExternalAddrs returns the external addresses reported by all sources, including
+// the static IP and the prediction of the endpoint predictor.
+func (ln *LocalNode) ExternalAddrs() []ExternalAddr {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	var addrs []ExternalAddr
+	for _, e := range []*lnEndpoint{&ln.endpoint4, &ln.endpoint6} {
+		if e.staticIP != nil {
+			addrs = append(addrs, ExternalAddr{Source: SourceStatic, IP: e.staticIP})
+		}
+		if ip, port := predictAddr(e.track); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			addrs = append(addrs, ExternalAddr{Source: SourceDiscovery, IP: ip, Port: port})
+		}
+		for source, ip := range e.sources {
+			addrs = append(addrs, ExternalAddr{Source: source, IP: ip})
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool { return addrs[i].Source < addrs[j].Source })
+	return addrs
+}
+
 // UDPEndpointStatement should be called whenever a statement about the local node's
 // UDP endpoint is received. It feeds the local endpoint predictor.
 func (ln *LocalNode) UDPEndpointStatement(fromaddr, endpoint *net.UDPAddr) {
@@ -208,6 +276,14 @@ func (ln *LocalNode) updateEndpoints() {
 	ip4, udp4 := ln.endpoint4.get()
 	ip6, udp6 := ln.endpoint6.get()
 
+	// Log address changes, but not the initial assignment.
+	if old, ok := ln.entries[enr.IPv4{}.ENRKey()].(enr.IPv4); ok && !net.IP(old).Equal(ip4) {
+		log.Info("Local node IP changed", "ip", ip4, "old", net.IP(old), "sources", ln.endpoint4.describe())
+	}
+	if old, ok := ln.entries[enr.IPv6{}.ENRKey()].(enr.IPv6); ok && !net.IP(old).Equal(ip6) {
+		log.Info("Local node IPv6 changed", "ip", ip6, "old", net.IP(old), "sources", ln.endpoint6.describe())
+	}
+
 	if ip4 != nil && !ip4.IsUnspecified() {
 		ln.set(enr.IPv4(ip4))
 	} else {
@@ -230,7 +306,8 @@ func (ln *LocalNode) updateEndpoints() {
 	}
 }
 
-// get returns the endpoint with highest precedence.
+// get returns the endpoint with highest precedence. A static IP overrides everything,
+// followed by the consensus of the external address sources and the fallback IP.
 func (e *lnEndpoint) get() (newIP net.IP, newPort int) {
 	newPort = e.fallbackUDP
 	if e.fallbackIP != nil {
@@ -238,13 +315,83 @@ func (e *lnEndpoint) get() (newIP net.IP, newPort int) {
 	}
 	if e.staticIP != nil {
 		newIP = e.staticIP
-	} else if ip, port := predictAddr(e.track); ip != nil {
+		return newIP, newPort
+	}
+	predicted, port := predictAddr(e.track)
+	if ip := e.consensus(predicted); ip != nil {
 		newIP = ip
-		newPort = port
+		if ip.Equal(predicted) {
+			newPort = port
+		}
 	}
 	return newIP, newPort
 }
 
+// consensus chooses the external IP from the addresses reported by all sources. The
+// IP reported by most sources wins. Ties are broken in favor of the predicted IP
+// because it is confirmed by other nodes, and then in favor of public addresses
+// because NAT gateways may themselves be behind another NAT.
+func (e *lnEndpoint) consensus(predicted net.IP) net.IP {
+	type candidate struct {
+		ip        net.IP
+		votes     int
+		predicted bool
+	}
+	var cands []*candidate
+	vote := func(ip net.IP, predicted bool) {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		for _, c := range cands {
+			if c.ip.Equal(ip) {
+				c.votes++
+				c.predicted = c.predicted || predicted
+				return
+			}
+		}
+		cands = append(cands, &candidate{ip: ip, votes: 1, predicted: predicted})
+	}
+	if predicted != nil {
+		vote(predicted, true)
+	}
+	for _, ip := range e.sources {
+		vote(ip, false)
+	}
+	if len(cands) == 0 {
+		return nil
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		if a.votes != b.votes {
+			return a.votes > b.votes
+		}
+		if a.predicted != b.predicted {
+			return a.predicted
+		}
+		if lanA, lanB := netutil.IsLAN(a.ip), netutil.IsLAN(b.ip); lanA != lanB {
+			return lanB
+		}
+		return bytes.Compare(a.ip, b.ip) < 0
+	})
+	return cands[0].ip
+}
+
+// describe returns a summary of the external address sources for logging.
+func (e *lnEndpoint) describe() string {
+	var parts []string
+	if e.staticIP != nil {
+		parts = append(parts, SourceStatic+"="+e.staticIP.String())
+	}
+	if ep := e.track.PredictEndpoint(); ep != "" {
+		parts = append(parts, SourceDiscovery+"="+ep)
+	}
+	for source, ip := range e.sources {
+		parts = append(parts, source+"="+ip.String())
+	}
+	sort.Strings(parts)
+	return fmt.Sprint(parts)
+}
+
 // predictAddr wraps IPTracker.PredictEndpoint, converting from its string-based
 // endpoint representation to IP and port types.
 func predictAddr(t *netutil.IPTracker) (net.IP, int) {
@@ -120,3 +120,58 @@ func TestLocalNodeEndpoint(t *testing.T) {
 	assert.Equal(t, fallback.Port, ln.Node().UDP())
 	assert.Equal(t, uint64(4), ln.Node().Seq())
 }
+
+func TestLocalNodeExternalIP(t *testing.T) {
+	var (
+		fallback  = net.IP{127, 0, 0, 1}
+		routerIP  = net.IP{192, 168, 1, 1}
+		publicIP  = net.IP{203, 0, 113, 7}
+		predicted = &net.UDPAddr{IP: net.IP{198, 51, 100, 9}, Port: 30303}
+	)
+	ln, db := newLocalNodeForTesting()
+	defer db.Close()
+	ln.SetFallbackIP(fallback)
+	ln.SetFallbackUDP(30301)
+
+	// A single source overrides the fallback IP.
+	ln.SetExternalIP("upnp", routerIP)
+	assert.Equal(t, routerIP, ln.Node().IP())
+	assert.Equal(t, 30301, ln.Node().UDP())
+
+	// On a tie, public addresses are preferred over LAN addresses.
+	ln.SetExternalIP("stun", publicIP)
+	assert.Equal(t, publicIP, ln.Node().IP())
+
+	// The endpoint prediction wins ties against other sources and provides the port.
+	for i := 0; i < iptrackMinStatements; i++ {
+		from := &net.UDPAddr{IP: make(net.IP, 4), Port: 90}
+		rand.Read(from.IP)
+		ln.UDPEndpointStatement(from, predicted)
+	}
+	assert.Equal(t, predicted.IP, ln.Node().IP())
+	assert.Equal(t, predicted.Port, ln.Node().UDP())
+
+	// Two sources agreeing outvote the prediction.
+	ln.SetExternalIP("upnp", publicIP)
+	assert.Equal(t, publicIP, ln.Node().IP())
+	assert.Equal(t, 30301, ln.Node().UDP())
+
+	addrs := ln.ExternalAddrs()
+	want := []ExternalAddr{
+		{Source: SourceDiscovery, IP: predicted.IP, Port: predicted.Port},
+		{Source: "stun", IP: publicIP},
+		{Source: "upnp", IP: publicIP},
+	}
+	assert.Equal(t, want, addrs)
+
+	// Removing sources returns to the prediction.
+	ln.SetExternalIP("upnp", nil)
+	ln.SetExternalIP("stun", nil)
+	assert.Equal(t, predicted.IP, ln.Node().IP())
+
+	// Static IP overrides all sources.
+	ln.SetExternalIP("stun", publicIP)
+	ln.SetStaticIP(routerIP)
+	assert.Equal(t, routerIP, ln.Node().IP())
+	assert.Equal(t, ExternalAddr{Source: SourceStatic, IP: routerIP}, ln.ExternalAddrs()[1])
+}
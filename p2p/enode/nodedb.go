@@ -40,6 +40,7 @@ const (
 	dbVersionKey   = "version" // Version of the database to flush if changes
 	dbNodePrefix   = "n:"      // Identifier to prefix node entries with
 	dbLocalPrefix  = "local:"
+	dbScorePrefix  = "score:" // Identifier to prefix reputation scores with
 	dbDiscoverRoot = "v4"
 
 	// These fields are stored per ID and IP, the full key is "n:<ID>:v4:<IP>:findfail".
@@ -180,6 +181,11 @@ func localItemKey(id ID, field string) []byte {
 	return key
 }
 
+// scoreKey returns the key of a node's reputation score.
+func scoreKey(id ID) []byte {
+	return append([]byte(dbScorePrefix), id[:]...)
+}
+
 // fetchInt64 retrieves an integer associated with a particular key.
 func (db *DB) fetchInt64(key []byte) int64 {
 	blob, err := db.lvl.Get(key, nil)
@@ -378,6 +384,64 @@ func (db *DB) UpdateFindFails(id ID, ip net.IP, fails int) error {
 	return db.storeInt64(nodeItemKey(id, ip, dbNodeFindFails), int64(fails))
 }
 
+// NodeScore is the reputation score of a node and the time of its last update.
+type NodeScore struct {
+	Score   int64
+	Updated time.Time
+}
+
+// NodeScore retrieves the reputation score of a node.
+func (db *DB) NodeScore(id ID) NodeScore {
+	blob, err := db.lvl.Get(scoreKey(id), nil)
+	if err != nil {
+		return NodeScore{}
+	}
+	return decodeNodeScore(blob)
+}
+
+// UpdateNodeScore stores the reputation score of a node.
+func (db *DB) UpdateNodeScore(id ID, s NodeScore) error {
+	blob := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutVarint(blob, s.Score)
+	n += binary.PutVarint(blob[n:], s.Updated.Unix())
+	return db.lvl.Put(scoreKey(id), blob[:n], nil)
+}
+
+// DeleteNodeScore removes the reputation score of a node.
+func (db *DB) DeleteNodeScore(id ID) error {
+	return db.lvl.Delete(scoreKey(id), nil)
+}
+
+// NodeScores retrieves the reputation scores of all nodes.
+func (db *DB) NodeScores() map[ID]NodeScore {
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbScorePrefix)), nil)
+	defer it.Release()
+
+	scores := make(map[ID]NodeScore)
+	for it.Next() {
+		var id ID
+		key := it.Key()[len(dbScorePrefix):]
+		if len(key) != len(id) {
+			continue
+		}
+		copy(id[:], key)
+		scores[id] = decodeNodeScore(it.Value())
+	}
+	return scores
+}
+
+func decodeNodeScore(blob []byte) NodeScore {
+	score, n := binary.Varint(blob)
+	if n <= 0 {
+		return NodeScore{}
+	}
+	updated, m := binary.Varint(blob[n:])
+	if m <= 0 {
+		return NodeScore{}
+	}
+	return NodeScore{Score: score, Updated: time.Unix(updated, 0)}
+}
+
 // LocalSeq retrieves the local record sequence counter.
 func (db *DB) localSeq(id ID) uint64 {
 	return db.fetchUint64(localItemKey(id, dbLocalSeq))
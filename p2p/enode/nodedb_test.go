@@ -462,3 +462,38 @@ func TestDBExpiration(t *testing.T) {
 		}
 	}
 }
+
+func TestDBNodeScore(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+
+	var (
+		id1     = ID{1}
+		id2     = ID{2}
+		updated = time.Unix(time.Now().Unix(), 0)
+	)
+	if s := db.NodeScore(id1); s != (NodeScore{}) {
+		t.Fatalf("non-existing score: %v", s)
+	}
+	if err := db.UpdateNodeScore(id1, NodeScore{Score: -120, Updated: updated}); err != nil {
+		t.Fatalf("failed to update score: %v", err)
+	}
+	if err := db.UpdateNodeScore(id2, NodeScore{Score: 7, Updated: updated}); err != nil {
+		t.Fatalf("failed to update score: %v", err)
+	}
+	if s := db.NodeScore(id1); s.Score != -120 || !s.Updated.Equal(updated) {
+		t.Fatalf("score mismatch: have %v", s)
+	}
+	if all := db.NodeScores(); len(all) != 2 || all[id2].Score != 7 {
+		t.Fatalf("wrong scores: %v", all)
+	}
+
+	// Node expiration shouldn't touch the scores.
+	db.expireNodes()
+	if err := db.DeleteNodeScore(id1); err != nil {
+		t.Fatalf("failed to delete score: %v", err)
+	}
+	if all := db.NodeScores(); len(all) != 1 || all[id2].Score != 7 {
+		t.Fatalf("wrong scores after delete: %v", all)
+	}
+}
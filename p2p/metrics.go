@@ -37,6 +37,10 @@ const (
 	MetricsOutboundConnects = "p2p/dials"   // Name for the registered outbound connects meter
 	MetricsInboundConnects  = "p2p/serves"  // Name for the registered inbound connects meter
 
+	MetricsMessages       = "p2p/msg"            // Prefix for the per-message meters
+	MetricsSnappyInbound  = "p2p/snappy/ingress" // Prefix for the inbound compression meters
+	MetricsSnappyOutbound = "p2p/snappy/egress"  // Prefix for the outbound compression meters
+
 	MeteredPeerLimit = 1024 // This amount of peers are individually metered
 )
 
@@ -47,6 +51,11 @@ var (
 	egressTrafficMeter  = metrics.NewRegisteredMeter(MetricsOutboundTraffic, nil)  // Meter metering the cumulative egress traffic
 	activePeerGauge     = metrics.NewRegisteredGauge("p2p/peers", nil)             // Gauge tracking the current peer count
 
+	snappyIngressCompressedMeter = metrics.NewRegisteredMeter(MetricsSnappyInbound+"/compressed", nil)  // Meter for compressed message bytes read
+	snappyIngressRawMeter        = metrics.NewRegisteredMeter(MetricsSnappyInbound+"/raw", nil)         // Meter for the decompressed size of messages read
+	snappyEgressCompressedMeter  = metrics.NewRegisteredMeter(MetricsSnappyOutbound+"/compressed", nil) // Meter for compressed message bytes written
+	snappyEgressRawMeter         = metrics.NewRegisteredMeter(MetricsSnappyOutbound+"/raw", nil)        // Meter for the uncompressed size of messages written
+
 	PeerIngressRegistry = metrics.NewPrefixedChildRegistry(metrics.EphemeralRegistry, MetricsInboundTraffic+"/")  // Registry containing the peer ingress
 	PeerEgressRegistry  = metrics.NewPrefixedChildRegistry(metrics.EphemeralRegistry, MetricsOutboundTraffic+"/") // Registry containing the peer egress
 
@@ -55,16 +55,27 @@ type Interface interface {
 //
 //     "" or "none"         return nil
 //     "extip:77.12.33.4"   will assume the local machine is reachable on the given IP
-//     "any"                uses the first auto-detected mechanism
+//     "any"                uses the first auto-detected mechanism, or STUN
 //     "upnp"               uses the Universal Plug and Play protocol
 //     "pmp"                uses NAT-PMP with an auto-detected gateway address
 //     "pmp:192.168.0.1"    uses NAT-PMP with the given gateway address
+//     "stun"               uses the default public STUN servers
+//     "stun:<host:port>"   uses the given STUN server
 func Parse(spec string) (Interface, error) {
 	var (
 		parts = strings.SplitN(spec, ":", 2)
 		mech  = strings.ToLower(parts[0])
 		ip    net.IP
 	)
+	if mech == "stun" {
+		if len(parts) > 1 {
+			if _, _, err := net.SplitHostPort(parts[1]); err != nil {
+				return nil, fmt.Errorf("invalid STUN server address: %v", err)
+			}
+			return STUN(parts[1]), nil
+		}
+		return STUN(), nil
+	}
 	if len(parts) > 1 {
 		ip = net.ParseIP(parts[1])
 		if ip == nil {
@@ -140,11 +151,12 @@ func (ExtIP) AddMapping(string, int, int, string, time.Duration) error { return
 func (ExtIP) DeleteMapping(string, int, int) error                     { return nil }
 
 // Any returns a port mapper that tries to discover any supported
-// mechanism on the local network.
+// mechanism on the local network. If no router supports port mapping,
+// the external IP is found using the default STUN servers.
 func Any() Interface {
 	// TODO: attempt to discover whether the local machine has an
 	// Internet-class address. Return ExtIP in this case.
-	return startautodisc("UPnP or NAT-PMP", func() Interface {
+	return startautodisc("UPnP, NAT-PMP or STUN", func() Interface {
 		found := make(chan Interface, 2)
 		go func() { found <- discoverUPnP() }()
 		go func() { found <- discoverPMP() }()
@@ -153,7 +165,7 @@ func Any() Interface {
 				return c
 			}
 		}
-		return nil
+		return STUN()
 	})
 }
 
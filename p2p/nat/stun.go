@@ -0,0 +1,226 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package nat
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultSTUNServers are the public STUN servers used when none are configured.
+var DefaultSTUNServers = []string{
+	"stun.l.google.com:19302",
+	"stun1.l.google.com:19302",
+	"stun2.l.google.com:19302",
+	"stun.cloudflare.com:3478",
+}
+
+const (
+	stunTimeout = 3 * time.Second
+	stunQueries = 3 // number of servers which must respond
+
+	stunMagicCookie      = 0x2112A442
+	stunHeaderSize       = 20
+	stunBindingRequest   = 0x0001
+	stunBindingResponse  = 0x0101
+	stunAttrMappedAddr   = 0x0001
+	stunAttrXorMappedAdr = 0x0020
+)
+
+var errSTUNNoAddr = errors.New("no mapped address in STUN response")
+
+// stun discovers the external IP address by sending binding requests (RFC 5389)
+// to public STUN servers. It doesn't map ports, the mapping methods do nothing.
+type stun struct {
+	servers []string
+	timeout time.Duration
+}
+
+// STUN returns a NAT interface which finds the external IP address using the given
+// STUN servers. The address reported by the majority of the servers is used. If no
+// servers are given, DefaultSTUNServers is used.
+//
+// STUN is useful when the router doesn't support UPnP or NAT-PMP, for example behind
+// carrier-grade or cloud NAT.
+func STUN(servers ...string) Interface {
+	if len(servers) == 0 {
+		servers = DefaultSTUNServers
+	}
+	return &stun{servers: servers, timeout: stunTimeout}
+}
+
+func (s *stun) String() string { return "STUN" }
+
+// These do nothing.
+
+func (s *stun) AddMapping(string, int, int, string, time.Duration) error { return nil }
+func (s *stun) DeleteMapping(string, int, int) error                     { return nil }
+
+// ExternalIP queries the STUN servers and returns the IP reported by most of them.
+func (s *stun) ExternalIP() (net.IP, error) {
+	var (
+		responses int
+		votes     = make(map[string]int)
+		best      net.IP
+		lastErr   error
+	)
+	for _, server := range s.servers {
+		if responses == stunQueries {
+			break
+		}
+		addr, err := stunRequest(server, s.timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		responses++
+		key := addr.IP.String()
+		votes[key]++
+		if best == nil || votes[key] > votes[best.String()] {
+			best = addr.IP
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no STUN server responded: %v", lastErr)
+	}
+	return best, nil
+}
+
+// stunRequest sends a binding request to the server and returns the mapped address.
+func stunRequest(server string, timeout time.Duration) (*net.UDPAddr, error) {
+	conn, err := net.DialTimeout("udp4", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req, txid := newSTUNRequest()
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := parseSTUNResponse(buf[:n], txid)
+		if err == errSTUNTxID {
+			continue // stale response to an earlier request
+		}
+		return addr, err
+	}
+}
+
+// newSTUNRequest creates a binding request with a random transaction ID.
+func newSTUNRequest() (req []byte, txid []byte) {
+	req = make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint16(req[2:], 0)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	rand.Read(req[8:20])
+	return req, req[8:20]
+}
+
+var errSTUNTxID = errors.New("STUN transaction ID mismatch")
+
+// parseSTUNResponse decodes the mapped address in a binding response.
+func parseSTUNResponse(msg []byte, txid []byte) (*net.UDPAddr, error) {
+	if len(msg) < stunHeaderSize {
+		return nil, errors.New("STUN response too short")
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != stunBindingResponse {
+		return nil, fmt.Errorf("unexpected STUN message type %#04x", binary.BigEndian.Uint16(msg[0:]))
+	}
+	if binary.BigEndian.Uint32(msg[4:]) != stunMagicCookie {
+		return nil, errors.New("invalid STUN magic cookie")
+	}
+	if !bytes.Equal(msg[8:20], txid) {
+		return nil, errSTUNTxID
+	}
+	size := int(binary.BigEndian.Uint16(msg[2:]))
+	if stunHeaderSize+size > len(msg) {
+		return nil, errors.New("truncated STUN response")
+	}
+
+	// Walk the attributes. XOR-MAPPED-ADDRESS is preferred because some NATs rewrite
+	// addresses in packet payloads.
+	var mapped *net.UDPAddr
+	attrs := msg[stunHeaderSize : stunHeaderSize+size]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		alen := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+alen > len(attrs) {
+			return nil, errors.New("truncated STUN attribute")
+		}
+		val := attrs[4 : 4+alen]
+		switch typ {
+		case stunAttrXorMappedAdr:
+			return decodeSTUNAddr(val, msg[4:20])
+		case stunAttrMappedAddr:
+			if addr, err := decodeSTUNAddr(val, nil); err == nil {
+				mapped = addr
+			}
+		}
+		// Attributes are padded to a multiple of four bytes.
+		next := 4 + (alen+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	if mapped == nil {
+		return nil, errSTUNNoAddr
+	}
+	return mapped, nil
+}
+
+// decodeSTUNAddr decodes a (XOR-)MAPPED-ADDRESS attribute value. For
+// XOR-MAPPED-ADDRESS, xor holds the magic cookie and transaction ID.
+func decodeSTUNAddr(val []byte, xor []byte) (*net.UDPAddr, error) {
+	if len(val) < 4 {
+		return nil, errors.New("invalid STUN address attribute")
+	}
+	var iplen int
+	switch val[1] {
+	case 0x01:
+		iplen = net.IPv4len
+	case 0x02:
+		iplen = net.IPv6len
+	default:
+		return nil, fmt.Errorf("unknown STUN address family %d", val[1])
+	}
+	if len(val) < 4+iplen {
+		return nil, errors.New("invalid STUN address attribute")
+	}
+	port := binary.BigEndian.Uint16(val[2:])
+	ip := make(net.IP, iplen)
+	copy(ip, val[4:])
+	if xor != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package nat
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSTUNServer answers binding requests with a fixed mapped address.
+type fakeSTUNServer struct {
+	conn   *net.UDPConn
+	mapped *net.UDPAddr
+	xor    bool // use XOR-MAPPED-ADDRESS
+}
+
+func newFakeSTUNServer(t *testing.T, mapped *net.UDPAddr, xor bool) *fakeSTUNServer {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSTUNServer{conn: conn, mapped: mapped, xor: xor}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSTUNServer) addr() string { return s.conn.LocalAddr().String() }
+
+func (s *fakeSTUNServer) close() { s.conn.Close() }
+
+func (s *fakeSTUNServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if n < stunHeaderSize || binary.BigEndian.Uint16(buf) != stunBindingRequest {
+			continue
+		}
+		s.conn.WriteToUDP(s.response(buf[8:20]), from)
+	}
+}
+
+func (s *fakeSTUNServer) response(txid []byte) []byte {
+	ip := s.mapped.IP.To4()
+	port := uint16(s.mapped.Port)
+	attrType := uint16(stunAttrMappedAddr)
+	if s.xor {
+		attrType = stunAttrXorMappedAdr
+		port ^= uint16(stunMagicCookie >> 16)
+		cookie := make([]byte, 4)
+		binary.BigEndian.PutUint32(cookie, stunMagicCookie)
+		xip := make(net.IP, 4)
+		for i := range ip {
+			xip[i] = ip[i] ^ cookie[i]
+		}
+		ip = xip
+	}
+	// An unknown attribute with padding, followed by the address.
+	attrs := []byte{0x80, 0x22, 0x00, 0x03, 'a', 'b', 'c', 0x00}
+	addr := make([]byte, 12)
+	binary.BigEndian.PutUint16(addr[0:], attrType)
+	binary.BigEndian.PutUint16(addr[2:], 8)
+	addr[5] = 0x01
+	binary.BigEndian.PutUint16(addr[6:], port)
+	copy(addr[8:], ip)
+	attrs = append(attrs, addr...)
+
+	msg := make([]byte, stunHeaderSize, stunHeaderSize+len(attrs))
+	binary.BigEndian.PutUint16(msg[0:], stunBindingResponse)
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(attrs)))
+	binary.BigEndian.PutUint32(msg[4:], stunMagicCookie)
+	copy(msg[8:], txid)
+	return append(msg, attrs...)
+}
+
+func TestSTUNRequest(t *testing.T) {
+	mapped := &net.UDPAddr{IP: net.IP{203, 0, 113, 5}, Port: 41234}
+	for _, xor := range []bool{false, true} {
+		srv := newFakeSTUNServer(t, mapped, xor)
+		addr, err := stunRequest(srv.addr(), time.Second)
+		srv.close()
+		if err != nil {
+			t.Fatalf("xor=%v: %v", xor, err)
+		}
+		if !addr.IP.Equal(mapped.IP) || addr.Port != mapped.Port {
+			t.Fatalf("xor=%v: wrong mapped address %v, want %v", xor, addr, mapped)
+		}
+	}
+}
+
+func TestSTUNExternalIP(t *testing.T) {
+	var (
+		ipA  = net.IP{203, 0, 113, 5}
+		ipB  = net.IP{198, 51, 100, 1}
+		srv1 = newFakeSTUNServer(t, &net.UDPAddr{IP: ipB, Port: 1}, true)
+		srv2 = newFakeSTUNServer(t, &net.UDPAddr{IP: ipA, Port: 2}, true)
+		srv3 = newFakeSTUNServer(t, &net.UDPAddr{IP: ipA, Port: 3}, false)
+	)
+	defer srv1.close()
+	defer srv2.close()
+	defer srv3.close()
+
+	// A server which doesn't respond.
+	dead, _ := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	defer dead.Close()
+
+	s := &stun{
+		servers: []string{dead.LocalAddr().String(), srv1.addr(), srv2.addr(), srv3.addr()},
+		timeout: 200 * time.Millisecond,
+	}
+	ip, err := s.ExternalIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(ipA) {
+		t.Fatalf("wrong external IP %v, want majority answer %v", ip, ipA)
+	}
+
+	// Only dead servers.
+	s.servers = []string{dead.LocalAddr().String()}
+	if _, err := s.ExternalIP(); err == nil {
+		t.Fatal("expected error when no server responds")
+	}
+}
+
+func TestParseSTUN(t *testing.T) {
+	tests := []struct {
+		spec    string
+		servers []string
+		err     bool
+	}{
+		{spec: "stun", servers: DefaultSTUNServers},
+		{spec: "STUN:stun.example.org:3478", servers: []string{"stun.example.org:3478"}},
+		{spec: "stun:1.2.3.4", err: true},
+	}
+	for _, test := range tests {
+		m, err := Parse(test.spec)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		s, ok := m.(*stun)
+		if !ok {
+			t.Errorf("%q: wrong interface type %T", test.spec, m)
+			continue
+		}
+		if len(s.servers) != len(test.servers) || s.servers[0] != test.servers[0] {
+			t.Errorf("%q: wrong servers %v", test.spec, s.servers)
+		}
+	}
+}
@@ -115,6 +115,12 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	// rep records reputation reports if set
+	rep *reputation
+
+	// traffic counts the protocol messages exchanged with the peer
+	traffic *peerTraffic
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -167,6 +173,28 @@ func (p *Peer) Disconnect(reason DiscReason) {
 	}
 }
 
+// Report adjusts the reputation score of the peer by delta. Protocols report useful
+// behavior with positive and misbehavior with negative values, e.g. ScoreGood and
+// ScoreBad. Peers with a low score are redialed less often. If the score drops to the
+// ban threshold, the peer is disconnected and won't be dialed or accepted again until
+// its score has recovered.
+func (p *Peer) Report(delta int) {
+	if p.rep == nil {
+		return
+	}
+	score := p.rep.adjust(p.ID(), int64(delta))
+	p.log.Trace("Peer score updated", "delta", delta, "score", score)
+	if score <= banScore && !p.rw.is(trustedConn|staticDialedConn) {
+		p.log.Debug("Disconnecting banned peer", "score", score)
+		p.Disconnect(DiscUselessPeer)
+	}
+}
+
+// Traffic returns the protocol message counters of the peer.
+func (p *Peer) Traffic() PeerTraffic {
+	return PeerTraffic{ID: p.ID().String(), Inbound: p.Inbound(), Messages: p.traffic.list()}
+}
+
 // String implements fmt.Stringer.
 func (p *Peer) String() string {
 	id := p.ID()
@@ -188,6 +216,7 @@ func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
 		closed:   make(chan struct{}),
 		log:      log.New("id", conn.node.ID(), "conn", conn.flags),
+		traffic:  newPeerTraffic(conn.is(inboundConn)),
 	}
 	return p
 }
@@ -300,6 +329,7 @@ func (p *Peer) handle(msg Msg) error {
 		if err != nil {
 			return fmt.Errorf("msg code out of range: %v", msg.Code)
 		}
+		p.traffic.mark(&proto.Protocol, msg.Code-proto.offset, msg.Size, true)
 		select {
 		case proto.in <- msg:
 			return nil
@@ -354,6 +384,7 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
+		proto.traffic = p.traffic
 		var rw MsgReadWriter = proto
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name, p.Info().Network.RemoteAddress, p.Info().Network.LocalAddress)
@@ -392,16 +423,22 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *peerTraffic
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	if msg.Code >= rw.Length {
 		return newPeerError(errInvalidMsgCode, "not handled")
 	}
+	code := msg.Code
 	msg.Code += rw.offset
 	select {
 	case <-rw.wstart:
 		err = rw.w.WriteMsg(msg)
+		if err == nil && rw.traffic != nil {
+			rw.traffic.mark(&rw.Protocol, code, msg.Size, false)
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/groshproject/grosh-core/log"
+	"github.com/groshproject/grosh-core/metrics"
 )
 
 var discard = Protocol{
@@ -47,8 +48,8 @@ var discard = Protocol{
 
 func testPeer(protos []Protocol) (func(), *conn, *Peer, <-chan error) {
 	fd1, fd2 := net.Pipe()
-	c1 := &conn{fd: fd1, node: newNode(randomID(), nil), transport: newTestTransport(&newkey().PublicKey, fd1)}
-	c2 := &conn{fd: fd2, node: newNode(randomID(), nil), transport: newTestTransport(&newkey().PublicKey, fd2)}
+	c1 := &conn{fd: fd1, node: newNode(randomID(), ""), transport: newTestTransport(&newkey().PublicKey, fd1)}
+	c2 := &conn{fd: fd2, node: newNode(randomID(), ""), transport: newTestTransport(&newkey().PublicKey, fd2)}
 	for _, p := range protos {
 		c1.caps = append(c1.caps, p.cap())
 		c2.caps = append(c2.caps, p.cap())
@@ -122,6 +123,70 @@ func TestPeerProtoEncodeMsg(t *testing.T) {
 	}
 }
 
+func TestPeerTraffic(t *testing.T) {
+	done := make(chan struct{})
+	proto := Protocol{
+		Name:    "a",
+		Version: 1,
+		Length:  5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				t.Error(err)
+			}
+			if err := ExpectMsg(rw, 2, []uint{2}); err != nil {
+				t.Error(err)
+			}
+			if err := SendItems(rw, 4, "foo"); err != nil {
+				t.Error(err)
+			}
+			close(done)
+			<-peer.closed
+			return nil
+		},
+	}
+	closer, rw, peer, _ := testPeer([]Protocol{proto})
+	defer closer()
+
+	Send(rw, baseProtocolLength+2, []uint{1})
+	Send(rw, baseProtocolLength+2, []uint{2})
+	if err := ExpectMsg(rw, baseProtocolLength+4, []string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	want := []MsgTraffic{
+		{Protocol: "a", Version: 1, Code: 2, IngressPackets: 2, IngressBytes: 4},
+		{Protocol: "a", Version: 1, Code: 4, EgressPackets: 1, EgressBytes: 5},
+	}
+	if got := peer.Traffic().Messages; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong traffic:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestPeerTrafficMeters(t *testing.T) {
+	defer func(enabled bool) { metrics.Enabled = enabled }(metrics.Enabled)
+	metrics.Enabled = true
+
+	proto := &Protocol{Name: "meters", Version: 1}
+	traffic := newPeerTraffic(true)
+	traffic.mark(proto, 2, 10, true)
+	traffic.mark(proto, 2, 20, true)
+	traffic.mark(proto, 2, 5, false)
+
+	// The meters are resolved once per message type and direction.
+	if len(traffic.meters) != 2 {
+		t.Fatalf("wrong number of cached meters: %d", len(traffic.meters))
+	}
+	key := trafficKey{"meters", 1, 2}
+	meters := traffic.meters[meterKey{key, true}]
+	if meters.bytes.Count() != 30 || meters.packets.Count() != 2 {
+		t.Fatalf("wrong ingress meters: %d bytes, %d packets", meters.bytes.Count(), meters.packets.Count())
+	}
+	if metrics.GetOrRegisterMeter(msgMeterName(true, "inbound", key), nil) != meters.bytes {
+		t.Fatal("cached meter not registered")
+	}
+}
+
 func TestPeerPing(t *testing.T) {
 	closer, rw, _, _ := testPeer(nil)
 	defer closer()
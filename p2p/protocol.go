@@ -54,6 +54,15 @@ type Protocol struct {
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id enode.ID) interface{}
 
+	// DialCandidates, if non-nil, is a way to tell Server about protocol-specific nodes
+	// that should be dialed. The server continuously reads nodes from the iterator and
+	// attempts to create connections to them.
+	//
+	// When any protocol provides dial candidates, unfiltered results of the
+	// discovery v4 table are no longer dialed. Such protocols can use
+	// Server.DiscoveryV4 to create their own, filtered source of nodes.
+	DialCandidates enode.Iterator
+
 	// Attributes contains protocol specific information for the node record.
 	Attributes []enr.Entry
 }
@@ -0,0 +1,170 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/groshproject/grosh-core/p2p/enode"
+)
+
+// Reputation score adjustments which protocols can report through Peer.Report.
+const (
+	ScoreGood    = 1    // Peer delivered useful data
+	ScoreBad     = -10  // Peer failed a request, timed out or sent useless data
+	ScoreInvalid = -100 // Peer sent invalid data, bans it unless it has a good history
+)
+
+const (
+	scoreHalfLife      = 30 * time.Minute // Time after which a score has decayed by half
+	scoreFlushInterval = 1 * time.Minute  // Time between writes of changed scores to the node database
+	minScore           = -1000
+	maxScore           = 1000
+	banScore           = -100          // Peers at or below this score are not dialed or accepted
+	maxRedialDelay     = 1 * time.Hour // Upper bound of the redial delay for low scores
+)
+
+// PeerScore is the reputation of a node, as returned by admin_peerScores.
+type PeerScore struct {
+	ID     enode.ID `json:"id"`
+	Score  int64    `json:"score"`
+	Banned bool     `json:"banned"`
+}
+
+// reputation keeps track of the scores reported by protocols. Scores decay towards
+// zero over time, so bans expire on their own. They are kept in memory and written to
+// the node database periodically by flush.
+type reputation struct {
+	db  *enode.DB
+	now func() time.Time
+
+	mu     sync.Mutex
+	scores map[enode.ID]enode.NodeScore
+	dirty  map[enode.ID]struct{} // scores changed since the last flush
+}
+
+func newReputation(db *enode.DB) *reputation {
+	return &reputation{
+		db:     db,
+		now:    time.Now,
+		scores: db.NodeScores(),
+		dirty:  make(map[enode.ID]struct{}),
+	}
+}
+
+// score returns the current score of a node.
+func (r *reputation) score(id enode.ID) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.decay(r.scores[id])
+}
+
+// decay applies the exponential decay since the last update to a stored score.
+func (r *reputation) decay(s enode.NodeScore) int64 {
+	elapsed := r.now().Sub(s.Updated)
+	if s.Score == 0 || elapsed <= 0 {
+		return s.Score
+	}
+	factor := math.Exp2(-float64(elapsed) / float64(scoreHalfLife))
+	return int64(math.Round(float64(s.Score) * factor))
+}
+
+// adjust adds delta to the score of a node and returns the new score.
+func (r *reputation) adjust(id enode.ID, delta int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	score := r.decay(r.scores[id]) + delta
+	if score < minScore {
+		score = minScore
+	}
+	if score > maxScore {
+		score = maxScore
+	}
+	if score == 0 {
+		delete(r.scores, id)
+	} else {
+		r.scores[id] = enode.NodeScore{Score: score, Updated: r.now()}
+	}
+	r.dirty[id] = struct{}{}
+	return score
+}
+
+// flush writes the scores which changed since the last flush to the node database.
+// Scores which have fully decayed are removed.
+func (r *reputation) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, s := range r.scores {
+		if r.decay(s) == 0 {
+			delete(r.scores, id)
+			r.dirty[id] = struct{}{}
+		}
+	}
+	for id := range r.dirty {
+		if s, ok := r.scores[id]; ok {
+			r.db.UpdateNodeScore(id, s)
+		} else {
+			r.db.DeleteNodeScore(id)
+		}
+		delete(r.dirty, id)
+	}
+}
+
+// banned reports whether the node's score is too low to connect to it.
+func (r *reputation) banned(id enode.ID) bool {
+	return r.score(id) <= banScore
+}
+
+// redialDelay returns how long the dialer should wait before dialing the node again.
+// The base delay applies to nodes with a non-negative score and grows linearly for
+// nodes with a negative score.
+func (r *reputation) redialDelay(id enode.ID, base time.Duration) time.Duration {
+	score := r.score(id)
+	if score >= 0 {
+		return base
+	}
+	delay := base * time.Duration(1-score/10)
+	if delay > maxRedialDelay || delay < base {
+		delay = maxRedialDelay
+	}
+	return delay
+}
+
+// all returns all non-zero scores, ordered from lowest to highest.
+func (r *reputation) all() []PeerScore {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var scores []PeerScore
+	for id, s := range r.scores {
+		if score := r.decay(s); score != 0 {
+			scores = append(scores, PeerScore{ID: id, Score: score, Banned: score <= banScore})
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score < scores[j].Score
+		}
+		return scores[i].ID.String() < scores[j].ID.String()
+	})
+	return scores
+}
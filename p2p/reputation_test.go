@@ -0,0 +1,157 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/p2p/enode"
+)
+
+func newTestReputation(t *testing.T) (*reputation, *time.Time) {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000000, 0)
+	rep := newReputation(db)
+	rep.now = func() time.Time { return now }
+	return rep, &now
+}
+
+func TestReputationDecay(t *testing.T) {
+	rep, now := newTestReputation(t)
+	defer rep.db.Close()
+
+	id := enode.ID{1}
+	if score := rep.adjust(id, -200); score != -200 {
+		t.Fatalf("wrong score %d after adjust", score)
+	}
+	if !rep.banned(id) {
+		t.Fatal("node not banned")
+	}
+	*now = now.Add(scoreHalfLife)
+	if score := rep.score(id); score != -100 {
+		t.Fatalf("wrong score %d after one half-life", score)
+	}
+	*now = now.Add(scoreHalfLife)
+	if score := rep.score(id); score != -50 {
+		t.Fatalf("wrong score %d after two half-lives", score)
+	}
+	if rep.banned(id) {
+		t.Fatal("node still banned after score decayed")
+	}
+	if score := rep.adjust(id, 60); score != 10 {
+		t.Fatalf("wrong score %d after adjust", score)
+	}
+}
+
+func TestReputationLimits(t *testing.T) {
+	rep, _ := newTestReputation(t)
+	defer rep.db.Close()
+
+	id := enode.ID{1}
+	if score := rep.adjust(id, 5000); score != maxScore {
+		t.Fatalf("score %d not clamped to %d", score, maxScore)
+	}
+	if score := rep.adjust(id, -5000); score != minScore {
+		t.Fatalf("score %d not clamped to %d", score, minScore)
+	}
+}
+
+func TestReputationRedialDelay(t *testing.T) {
+	rep, _ := newTestReputation(t)
+	defer rep.db.Close()
+
+	base := 1 * time.Minute
+	tests := []struct {
+		score int64
+		want  time.Duration
+	}{
+		{score: 0, want: base},
+		{score: 50, want: base},
+		{score: -5, want: base},
+		{score: -10, want: 2 * base},
+		{score: -50, want: 6 * base},
+		{score: minScore, want: maxRedialDelay},
+	}
+	for i, test := range tests {
+		id := enode.ID{byte(i)}
+		rep.adjust(id, test.score)
+		if d := rep.redialDelay(id, base); d != test.want {
+			t.Errorf("score %d: got delay %v, want %v", test.score, d, test.want)
+		}
+	}
+}
+
+func TestReputationAll(t *testing.T) {
+	rep, now := newTestReputation(t)
+	defer rep.db.Close()
+
+	rep.adjust(enode.ID{1}, 1)
+	rep.adjust(enode.ID{2}, -150)
+	rep.adjust(enode.ID{3}, 20)
+	*now = now.Add(2 * scoreHalfLife)
+
+	want := []PeerScore{
+		{ID: enode.ID{2}, Score: -38},
+		{ID: enode.ID{3}, Score: 5},
+	}
+	scores := rep.all()
+	if len(scores) != len(want) {
+		t.Fatalf("got %d scores, want %d: %v", len(scores), len(want), scores)
+	}
+	for i := range want {
+		if scores[i] != want[i] {
+			t.Errorf("score %d: got %+v, want %+v", i, scores[i], want[i])
+		}
+	}
+	// The fully decayed score should be removed from the database.
+	rep.flush()
+	if s := rep.db.NodeScore(enode.ID{1}); s.Score != 0 {
+		t.Fatalf("decayed score not removed: %v", s)
+	}
+}
+
+func TestReputationFlush(t *testing.T) {
+	rep, now := newTestReputation(t)
+	defer rep.db.Close()
+
+	rep.adjust(enode.ID{1}, -150)
+	rep.adjust(enode.ID{2}, 20)
+	if s := rep.db.NodeScore(enode.ID{1}); s.Score != 0 {
+		t.Fatalf("score written before flush: %v", s)
+	}
+	rep.flush()
+	if s := rep.db.NodeScore(enode.ID{1}); s.Score != -150 || !s.Updated.Equal(*now) {
+		t.Fatalf("wrong score after flush: %v", s)
+	}
+
+	// Scores are loaded from the database on startup.
+	restored := newReputation(rep.db)
+	restored.now = rep.now
+	if score := restored.score(enode.ID{1}); score != -150 {
+		t.Fatalf("wrong restored score %d", score)
+	}
+	// Scores which return to zero are deleted on the next flush.
+	rep.adjust(enode.ID{2}, -20)
+	rep.flush()
+	if s := rep.db.NodeScore(enode.ID{2}); s.Score != 0 {
+		t.Fatalf("zero score not deleted: %v", s)
+	}
+}
@@ -14,7 +14,8 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
 
-package p2p
+// Package rlpx implements the RLPx transport protocol.
+package rlpx
 
 import (
 	"bytes"
@@ -29,17 +30,14 @@ import (
 	"fmt"
 	"hash"
 	"io"
-	"io/ioutil"
 	mrand "math/rand"
 	"net"
-	"sync"
 	"time"
 
-	"github.com/groshproject/grosh-core/common/bitutil"
+	"github.com/golang/snappy"
 	"github.com/groshproject/grosh-core/crypto"
 	"github.com/groshproject/grosh-core/crypto/ecies"
 	"github.com/groshproject/grosh-core/rlp"
-	"github.com/golang/snappy"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -59,138 +57,114 @@ const (
 	encAuthMsgLen  = authMsgLen + eciesOverhead  // size of encrypted pre-EIP-8 initiator handshake
 	encAuthRespLen = authRespLen + eciesOverhead // size of encrypted pre-EIP-8 handshake reply
 
-	// total timeout for encryption handshake and protocol
-	// handshake in both directions.
-	handshakeTimeout = 5 * time.Second
-
-	// This is the timeout for sending the disconnect reason.
-	// This is shorter than the usual timeout because we don't want
-	// to wait if the connection is known to be bad anyway.
-	discWriteTimeout = 1 * time.Second
+	// maxSnappyRatio bounds the ratio between the decoded and the encoded size of a
+	// compressed message. Valid snappy data can't exceed a ratio of about 22, so
+	// anything above is a decompression bomb and is rejected before allocating the
+	// decode buffer.
+	maxSnappyRatio = 32
 )
 
-// errPlainMessageTooLarge is returned if a decompressed message length exceeds
-// the allowed 24 bits (i.e. length >= 16MB).
-var errPlainMessageTooLarge = errors.New("message length >= 16MB")
+var (
+	// errPlainMessageTooLarge is returned if a decompressed message length exceeds
+	// the allowed 24 bits (i.e. length >= 16MB).
+	errPlainMessageTooLarge = errors.New("message length >= 16MB")
+
+	// errSnappyRatio is returned if the decompressed message length is implausibly
+	// large compared to the compressed length.
+	errSnappyRatio = errors.New("snappy compression ratio too high")
+
+	errNoHandshake = errors.New("encryption handshake not done")
+)
 
-// rlpx is the transport protocol used by actual (non-test) connections.
-// It wraps the frame encoder with locks and read/write deadlines.
-type rlpx struct {
+// Conn is an RLPx network connection. It wraps a low-level network connection,
+// which should not be used for other activity once it is wrapped.
+//
+// The encryption handshake must be performed by calling Handshake before any
+// messages are exchanged. Conn doesn't perform the protocol handshake, the hello
+// messages are exchanged by the caller using message code 0x00. After the
+// handshake, Read and Write may be called concurrently with each other, but not
+// with themselves.
+type Conn struct {
 	fd net.Conn
+	rw *rlpxFrameRW // set by the handshake
+}
 
-	rmu, wmu sync.Mutex
-	rw       *rlpxFrameRW
+// NewConn wraps the given network connection.
+func NewConn(fd net.Conn) *Conn {
+	return &Conn{fd: fd}
 }
 
-func newRLPX(fd net.Conn) transport {
-	fd.SetDeadline(time.Now().Add(handshakeTimeout))
-	return &rlpx{fd: fd}
+// Handshake performs the encryption handshake. dialDest is the public key of the
+// remote node when dialing and nil when accepting a connection. It returns the
+// remote node's public key.
+func (c *Conn) Handshake(prv *ecdsa.PrivateKey, dialDest *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
+	var (
+		sec Secrets
+		err error
+	)
+	if dialDest == nil {
+		sec, err = receiverEncHandshake(c.fd, prv)
+	} else {
+		sec, err = initiatorEncHandshake(c.fd, prv, dialDest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.InitWithSecrets(sec)
+	return sec.Remote.ExportECDSA(), nil
 }
 
-func (t *rlpx) ReadMsg() (Msg, error) {
-	t.rmu.Lock()
-	defer t.rmu.Unlock()
-	t.fd.SetReadDeadline(time.Now().Add(frameReadTimeout))
-	return t.rw.ReadMsg()
+// InitWithSecrets injects the connection secrets as if a handshake had been
+// performed. It is meant for tests.
+func (c *Conn) InitWithSecrets(sec Secrets) {
+	c.rw = newRLPXFrameRW(c.fd, sec)
 }
 
-func (t *rlpx) WriteMsg(msg Msg) error {
-	t.wmu.Lock()
-	defer t.wmu.Unlock()
-	t.fd.SetWriteDeadline(time.Now().Add(frameWriteTimeout))
-	return t.rw.WriteMsg(msg)
+// SetSnappy enables or disables snappy compression of messages. It must be called
+// after the encryption handshake, while no messages are read or written.
+// Compression is enabled after the hello exchange when both sides announce base
+// protocol version 5 or later.
+func (c *Conn) SetSnappy(snappy bool) {
+	c.rw.snappy = snappy
 }
 
-func (t *rlpx) close(err error) {
-	t.wmu.Lock()
-	defer t.wmu.Unlock()
-	// Tell the remote end why we're disconnecting if possible.
-	if t.rw != nil {
-		if r, ok := err.(DiscReason); ok && r != DiscNetworkError {
-			// rlpx tries to send DiscReason to disconnected peer
-			// if the connection is net.Pipe (in-memory simulation)
-			// it hangs forever, since net.Pipe does not implement
-			// a write deadline. Because of this only try to send
-			// the disconnect reason message if there is no error.
-			if err := t.fd.SetWriteDeadline(time.Now().Add(discWriteTimeout)); err == nil {
-				SendItems(t.rw, discMsg, r)
-			}
-		}
+// Read reads a message from the connection. It returns the message code, the
+// payload and the size of the payload on the wire, which is smaller than the
+// payload when compression is enabled.
+func (c *Conn) Read() (code uint64, data []byte, wireSize int, err error) {
+	if c.rw == nil {
+		return 0, nil, 0, errNoHandshake
 	}
-	t.fd.Close()
+	return c.rw.read()
 }
 
-func (t *rlpx) doProtoHandshake(our *protoHandshake) (their *protoHandshake, err error) {
-	// Writing our handshake happens concurrently, we prefer
-	// returning the handshake read error. If the remote side
-	// disconnects us early with a valid reason, we should return it
-	// as the error so it can be tracked elsewhere.
-	werr := make(chan error, 1)
-	go func() { werr <- Send(t.rw, handshakeMsg, our) }()
-	if their, err = readProtocolHandshake(t.rw); err != nil {
-		<-werr // make sure the write terminates too
-		return nil, err
-	}
-	if err := <-werr; err != nil {
-		return nil, fmt.Errorf("write error: %v", err)
+// Write writes a message to the connection. It returns the size of the payload on
+// the wire.
+func (c *Conn) Write(code uint64, data []byte) (uint32, error) {
+	if c.rw == nil {
+		return 0, errNoHandshake
 	}
-	// If the protocol version supports Snappy encoding, upgrade immediately
-	t.rw.snappy = their.Version >= snappyProtocolVersion
+	return c.rw.write(code, data)
+}
 
-	return their, nil
+// SetReadDeadline sets the deadline for all future read operations.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.fd.SetReadDeadline(t)
 }
 
-func readProtocolHandshake(rw MsgReader) (*protoHandshake, error) {
-	msg, err := rw.ReadMsg()
-	if err != nil {
-		return nil, err
-	}
-	if msg.Size > baseProtocolMaxMsgSize {
-		return nil, fmt.Errorf("message too big")
-	}
-	if msg.Code == discMsg {
-		// Disconnect before protocol handshake is valid according to the
-		// spec and we send it ourself if the post-handshake checks fail.
-		// We can't return the reason directly, though, because it is echoed
-		// back otherwise. Wrap it in a string instead.
-		var reason [1]DiscReason
-		rlp.Decode(msg.Payload, &reason)
-		return nil, reason[0]
-	}
-	if msg.Code != handshakeMsg {
-		return nil, fmt.Errorf("expected handshake, got %x", msg.Code)
-	}
-	var hs protoHandshake
-	if err := msg.Decode(&hs); err != nil {
-		return nil, err
-	}
-	if len(hs.ID) != 64 || !bitutil.TestBytes(hs.ID) {
-		return nil, DiscInvalidIdentity
-	}
-	return &hs, nil
+// SetWriteDeadline sets the deadline for all future write operations.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.fd.SetWriteDeadline(t)
 }
 
-// doEncHandshake runs the protocol handshake using authenticated
-// messages. the protocol handshake is the first authenticated message
-// and also verifies whether the encryption handshake 'worked' and the
-// remote side actually provided the right public key.
-func (t *rlpx) doEncHandshake(prv *ecdsa.PrivateKey, dial *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
-	var (
-		sec secrets
-		err error
-	)
-	if dial == nil {
-		sec, err = receiverEncHandshake(t.fd, prv)
-	} else {
-		sec, err = initiatorEncHandshake(t.fd, prv, dial)
-	}
-	if err != nil {
-		return nil, err
-	}
-	t.wmu.Lock()
-	t.rw = newRLPXFrameRW(t.fd, sec)
-	t.wmu.Unlock()
-	return sec.Remote.ExportECDSA(), nil
+// SetDeadline sets the deadline for all future read and write operations.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.fd.SetDeadline(t)
+}
+
+// Close closes the underlying network connection.
+func (c *Conn) Close() error {
+	return c.fd.Close()
 }
 
 // encHandshake contains the state of the encryption handshake.
@@ -202,9 +176,9 @@ type encHandshake struct {
 	remoteRandomPub      *ecies.PublicKey  // ecdhe-random-pubk
 }
 
-// secrets represents the connection secrets
+// Secrets represents the connection secrets
 // which are negotiated during the encryption handshake.
-type secrets struct {
+type Secrets struct {
 	Remote                *ecies.PublicKey
 	AES, MAC              []byte
 	EgressMAC, IngressMAC hash.Hash
@@ -236,16 +210,16 @@ type authRespV4 struct {
 
 // secrets is called after the handshake is completed.
 // It extracts the connection secrets from the handshake values.
-func (h *encHandshake) secrets(auth, authResp []byte) (secrets, error) {
+func (h *encHandshake) secrets(auth, authResp []byte) (Secrets, error) {
 	ecdheSecret, err := h.randomPrivKey.GenerateShared(h.remoteRandomPub, sskLen, sskLen)
 	if err != nil {
-		return secrets{}, err
+		return Secrets{}, err
 	}
 
 	// derive base secrets from ephemeral key agreement
 	sharedSecret := crypto.Keccak256(ecdheSecret, crypto.Keccak256(h.respNonce, h.initNonce))
 	aesSecret := crypto.Keccak256(ecdheSecret, sharedSecret)
-	s := secrets{
+	s := Secrets{
 		Remote: h.remote,
 		AES:    aesSecret,
 		MAC:    crypto.Keccak256(ecdheSecret, aesSecret),
@@ -277,7 +251,7 @@ func (h *encHandshake) staticSharedSecret(prv *ecdsa.PrivateKey) ([]byte, error)
 // it should be called on the dialing side of the connection.
 //
 // prv is the local client's private key.
-func initiatorEncHandshake(conn io.ReadWriter, prv *ecdsa.PrivateKey, remote *ecdsa.PublicKey) (s secrets, err error) {
+func initiatorEncHandshake(conn io.ReadWriter, prv *ecdsa.PrivateKey, remote *ecdsa.PublicKey) (s Secrets, err error) {
 	h := &encHandshake{initiator: true, remote: ecies.ImportECDSAPublic(remote)}
 	authMsg, err := h.makeAuthMsg(prv)
 	if err != nil {
@@ -345,7 +319,7 @@ func (h *encHandshake) handleAuthResp(msg *authRespV4) (err error) {
 // it should be called on the listening side of the connection.
 //
 // prv is the local client's private key.
-func receiverEncHandshake(conn io.ReadWriter, prv *ecdsa.PrivateKey) (s secrets, err error) {
+func receiverEncHandshake(conn io.ReadWriter, prv *ecdsa.PrivateKey) (s Secrets, err error) {
 	authMsg := new(authMsgV4)
 	authPacket, err := readHandshakeMsg(authMsg, encAuthMsgLen, prv, conn)
 	if err != nil {
@@ -566,7 +540,7 @@ type rlpxFrameRW struct {
 	snappy bool
 }
 
-func newRLPXFrameRW(conn io.ReadWriter, s secrets) *rlpxFrameRW {
+func newRLPXFrameRW(conn io.ReadWriter, s Secrets) *rlpxFrameRW {
 	macc, err := aes.NewCipher(s.MAC)
 	if err != nil {
 		panic("invalid MAC secret: " + err.Error())
@@ -588,25 +562,21 @@ func newRLPXFrameRW(conn io.ReadWriter, s secrets) *rlpxFrameRW {
 	}
 }
 
-func (rw *rlpxFrameRW) WriteMsg(msg Msg) error {
-	ptype, _ := rlp.EncodeToBytes(msg.Code)
+func (rw *rlpxFrameRW) write(code uint64, data []byte) (uint32, error) {
+	ptype, _ := rlp.EncodeToBytes(code)
 
 	// if snappy is enabled, compress message now
 	if rw.snappy {
-		if msg.Size > maxUint24 {
-			return errPlainMessageTooLarge
+		if uint32(len(data)) > maxUint24 {
+			return 0, errPlainMessageTooLarge
 		}
-		payload, _ := ioutil.ReadAll(msg.Payload)
-		payload = snappy.Encode(nil, payload)
-
-		msg.Payload = bytes.NewReader(payload)
-		msg.Size = uint32(len(payload))
+		data = snappy.Encode(nil, data)
 	}
 	// write header
 	headbuf := make([]byte, 32)
-	fsize := uint32(len(ptype)) + msg.Size
+	fsize := uint32(len(ptype)) + uint32(len(data))
 	if fsize > maxUint24 {
-		return errors.New("message size overflows uint24")
+		return 0, errors.New("message size overflows uint24")
 	}
 	putInt24(fsize, headbuf) // TODO: check overflow
 	copy(headbuf[3:], zeroHeader)
@@ -615,21 +585,21 @@ func (rw *rlpxFrameRW) WriteMsg(msg Msg) error {
 	// write header MAC
 	copy(headbuf[16:], updateMAC(rw.egressMAC, rw.macCipher, headbuf[:16]))
 	if _, err := rw.conn.Write(headbuf); err != nil {
-		return err
+		return 0, err
 	}
 
 	// write encrypted frame, updating the egress MAC hash with
 	// the data written to conn.
 	tee := cipher.StreamWriter{S: rw.enc, W: io.MultiWriter(rw.conn, rw.egressMAC)}
 	if _, err := tee.Write(ptype); err != nil {
-		return err
+		return 0, err
 	}
-	if _, err := io.Copy(tee, msg.Payload); err != nil {
-		return err
+	if _, err := tee.Write(data); err != nil {
+		return 0, err
 	}
 	if padding := fsize % 16; padding > 0 {
 		if _, err := tee.Write(zero16[:16-padding]); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
@@ -638,19 +608,19 @@ func (rw *rlpxFrameRW) WriteMsg(msg Msg) error {
 	fmacseed := rw.egressMAC.Sum(nil)
 	mac := updateMAC(rw.egressMAC, rw.macCipher, fmacseed)
 	_, err := rw.conn.Write(mac)
-	return err
+	return uint32(len(data)), err
 }
 
-func (rw *rlpxFrameRW) ReadMsg() (msg Msg, err error) {
+func (rw *rlpxFrameRW) read() (code uint64, data []byte, wireSize int, err error) {
 	// read the header
 	headbuf := make([]byte, 32)
 	if _, err := io.ReadFull(rw.conn, headbuf); err != nil {
-		return msg, err
+		return 0, nil, 0, err
 	}
 	// verify header mac
 	shouldMAC := updateMAC(rw.ingressMAC, rw.macCipher, headbuf[:16])
 	if !hmac.Equal(shouldMAC, headbuf[16:]) {
-		return msg, errors.New("bad header MAC")
+		return 0, nil, 0, errors.New("bad header MAC")
 	}
 	rw.dec.XORKeyStream(headbuf[:16], headbuf[:16]) // first half is now decrypted
 	fsize := readInt24(headbuf)
@@ -663,18 +633,18 @@ func (rw *rlpxFrameRW) ReadMsg() (msg Msg, err error) {
 	}
 	framebuf := make([]byte, rsize)
 	if _, err := io.ReadFull(rw.conn, framebuf); err != nil {
-		return msg, err
+		return 0, nil, 0, err
 	}
 
 	// read and validate frame MAC. we can re-use headbuf for that.
 	rw.ingressMAC.Write(framebuf)
 	fmacseed := rw.ingressMAC.Sum(nil)
 	if _, err := io.ReadFull(rw.conn, headbuf[:16]); err != nil {
-		return msg, err
+		return 0, nil, 0, err
 	}
 	shouldMAC = updateMAC(rw.ingressMAC, rw.macCipher, fmacseed)
 	if !hmac.Equal(shouldMAC, headbuf[:16]) {
-		return msg, errors.New("bad frame MAC")
+		return 0, nil, 0, errors.New("bad frame MAC")
 	}
 
 	// decrypt frame content
@@ -682,32 +652,29 @@ func (rw *rlpxFrameRW) ReadMsg() (msg Msg, err error) {
 
 	// decode message code
 	content := bytes.NewReader(framebuf[:fsize])
-	if err := rlp.Decode(content, &msg.Code); err != nil {
-		return msg, err
+	if err := rlp.Decode(content, &code); err != nil {
+		return 0, nil, 0, err
 	}
-	msg.Size = uint32(content.Len())
-	msg.Payload = content
+	data = framebuf[fsize-uint32(content.Len()) : fsize]
+	wireSize = len(data)
 
 	// if snappy is enabled, verify and decompress message
 	if rw.snappy {
-		payload, err := ioutil.ReadAll(msg.Payload)
-		if err != nil {
-			return msg, err
-		}
-		size, err := snappy.DecodedLen(payload)
+		size, err := snappy.DecodedLen(data)
 		if err != nil {
-			return msg, err
+			return 0, nil, 0, err
 		}
 		if size > int(maxUint24) {
-			return msg, errPlainMessageTooLarge
+			return 0, nil, 0, errPlainMessageTooLarge
 		}
-		payload, err = snappy.Decode(nil, payload)
-		if err != nil {
-			return msg, err
+		if size > len(data)*maxSnappyRatio {
+			return 0, nil, 0, errSnappyRatio
+		}
+		if data, err = snappy.Decode(nil, data); err != nil {
+			return 0, nil, 0, err
 		}
-		msg.Size, msg.Payload = uint32(size), bytes.NewReader(payload)
 	}
-	return msg, nil
+	return code, data, wireSize, nil
 }
 
 // updateMAC reseeds the given hash with encrypted seed.
@@ -14,27 +14,25 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
 
-package p2p
+package rlpx
 
 import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
-	"errors"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"reflect"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/groshproject/grosh-core/crypto"
 	"github.com/groshproject/grosh-core/crypto/ecies"
-	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
 	"github.com/groshproject/grosh-core/rlp"
 	"golang.org/x/crypto/sha3"
 )
@@ -88,7 +86,7 @@ func testEncHandshake(token []byte) error {
 		prv0, _  = crypto.GenerateKey()
 		prv1, _  = crypto.GenerateKey()
 		fd0, fd1 = net.Pipe()
-		c0, c1   = newRLPX(fd0).(*rlpx), newRLPX(fd1).(*rlpx)
+		c0, c1   = NewConn(fd0), NewConn(fd1)
 		output   = make(chan result)
 	)
 
@@ -97,7 +95,7 @@ func testEncHandshake(token []byte) error {
 		defer func() { output <- r }()
 		defer fd0.Close()
 
-		r.pubkey, r.err = c0.doEncHandshake(prv0, &prv1.PublicKey)
+		r.pubkey, r.err = c0.Handshake(prv0, &prv1.PublicKey)
 		if r.err != nil {
 			return
 		}
@@ -110,7 +108,7 @@ func testEncHandshake(token []byte) error {
 		defer func() { output <- r }()
 		defer fd1.Close()
 
-		r.pubkey, r.err = c1.doEncHandshake(prv1, nil)
+		r.pubkey, r.err = c1.Handshake(prv1, nil)
 		if r.err != nil {
 			return
 		}
@@ -144,130 +142,10 @@ func testEncHandshake(token []byte) error {
 	return nil
 }
 
-func TestProtocolHandshake(t *testing.T) {
-	var (
-		prv0, _ = crypto.GenerateKey()
-		pub0    = crypto.FromECDSAPub(&prv0.PublicKey)[1:]
-		hs0     = &protoHandshake{Version: 3, ID: pub0, Caps: []Cap{{"a", 0}, {"b", 2}}}
-
-		prv1, _ = crypto.GenerateKey()
-		pub1    = crypto.FromECDSAPub(&prv1.PublicKey)[1:]
-		hs1     = &protoHandshake{Version: 3, ID: pub1, Caps: []Cap{{"c", 1}, {"d", 3}}}
-
-		wg sync.WaitGroup
-	)
-
-	fd0, fd1, err := pipes.TCPPipe()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		defer fd0.Close()
-		rlpx := newRLPX(fd0)
-		rpubkey, err := rlpx.doEncHandshake(prv0, &prv1.PublicKey)
-		if err != nil {
-			t.Errorf("dial side enc handshake failed: %v", err)
-			return
-		}
-		if !reflect.DeepEqual(rpubkey, &prv1.PublicKey) {
-			t.Errorf("dial side remote pubkey mismatch: got %v, want %v", rpubkey, &prv1.PublicKey)
-			return
-		}
-
-		phs, err := rlpx.doProtoHandshake(hs0)
-		if err != nil {
-			t.Errorf("dial side proto handshake error: %v", err)
-			return
-		}
-		phs.Rest = nil
-		if !reflect.DeepEqual(phs, hs1) {
-			t.Errorf("dial side proto handshake mismatch:\ngot: %s\nwant: %s\n", spew.Sdump(phs), spew.Sdump(hs1))
-			return
-		}
-		rlpx.close(DiscQuitting)
-	}()
-	go func() {
-		defer wg.Done()
-		defer fd1.Close()
-		rlpx := newRLPX(fd1)
-		rpubkey, err := rlpx.doEncHandshake(prv1, nil)
-		if err != nil {
-			t.Errorf("listen side enc handshake failed: %v", err)
-			return
-		}
-		if !reflect.DeepEqual(rpubkey, &prv0.PublicKey) {
-			t.Errorf("listen side remote pubkey mismatch: got %v, want %v", rpubkey, &prv0.PublicKey)
-			return
-		}
-
-		phs, err := rlpx.doProtoHandshake(hs1)
-		if err != nil {
-			t.Errorf("listen side proto handshake error: %v", err)
-			return
-		}
-		phs.Rest = nil
-		if !reflect.DeepEqual(phs, hs0) {
-			t.Errorf("listen side proto handshake mismatch:\ngot: %s\nwant: %s\n", spew.Sdump(phs), spew.Sdump(hs0))
-			return
-		}
-
-		if err := ExpectMsg(rlpx, discMsg, []DiscReason{DiscQuitting}); err != nil {
-			t.Errorf("error receiving disconnect: %v", err)
-		}
-	}()
-	wg.Wait()
-}
-
-func TestProtocolHandshakeErrors(t *testing.T) {
-	tests := []struct {
-		code uint64
-		msg  interface{}
-		err  error
-	}{
-		{
-			code: discMsg,
-			msg:  []DiscReason{DiscQuitting},
-			err:  DiscQuitting,
-		},
-		{
-			code: 0x989898,
-			msg:  []byte{1},
-			err:  errors.New("expected handshake, got 989898"),
-		},
-		{
-			code: handshakeMsg,
-			msg:  make([]byte, baseProtocolMaxMsgSize+2),
-			err:  errors.New("message too big"),
-		},
-		{
-			code: handshakeMsg,
-			msg:  []byte{1, 2, 3},
-			err:  newPeerError(errInvalidMsg, "(code 0) (size 4) rlp: expected input list for p2p.protoHandshake"),
-		},
-		{
-			code: handshakeMsg,
-			msg:  &protoHandshake{Version: 3},
-			err:  DiscInvalidIdentity,
-		},
-	}
-
-	for i, test := range tests {
-		p1, p2 := MsgPipe()
-		go Send(p1, test.code, test.msg)
-		_, err := readProtocolHandshake(p2)
-		if !reflect.DeepEqual(err, test.err) {
-			t.Errorf("test %d: error mismatch: got %q, want %q", i, err, test.err)
-		}
-	}
-}
-
 func TestRLPXFrameFake(t *testing.T) {
 	buf := new(bytes.Buffer)
 	hash := fakeHash([]byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1})
-	rw := newRLPXFrameRW(buf, secrets{
+	rw := newRLPXFrameRW(buf, Secrets{
 		AES:        crypto.Keccak256(),
 		MAC:        crypto.Keccak256(),
 		IngressMAC: hash,
@@ -281,31 +159,31 @@ ba628a4ba590cb43f7848f41c4382885
 01010101010101010101010101010101
 `)
 
-	// Check WriteMsg. This puts a message into the buffer.
-	if err := Send(rw, 8, []uint{1, 2, 3, 4}); err != nil {
-		t.Fatalf("WriteMsg error: %v", err)
+	// Check write. This puts a message into the buffer.
+	payload, _ := rlp.EncodeToBytes([]uint{1, 2, 3, 4})
+	if _, err := rw.write(8, payload); err != nil {
+		t.Fatalf("write error: %v", err)
 	}
 	written := buf.Bytes()
 	if !bytes.Equal(written, golden) {
 		t.Fatalf("output mismatch:\n  got:  %x\n  want: %x", written, golden)
 	}
 
-	// Check ReadMsg. It reads the message encoded by WriteMsg, which
+	// Check read. It reads the message encoded by write, which
 	// is equivalent to the golden message above.
-	msg, err := rw.ReadMsg()
+	code, data, _, err := rw.read()
 	if err != nil {
-		t.Fatalf("ReadMsg error: %v", err)
+		t.Fatalf("read error: %v", err)
 	}
-	if msg.Size != 5 {
-		t.Errorf("msg size mismatch: got %d, want %d", msg.Size, 5)
+	if len(data) != 5 {
+		t.Errorf("msg size mismatch: got %d, want %d", len(data), 5)
 	}
-	if msg.Code != 8 {
-		t.Errorf("msg code mismatch: got %d, want %d", msg.Code, 8)
+	if code != 8 {
+		t.Errorf("msg code mismatch: got %d, want %d", code, 8)
 	}
-	payload, _ := ioutil.ReadAll(msg.Payload)
 	wantPayload := unhex("C401020304")
-	if !bytes.Equal(payload, wantPayload) {
-		t.Errorf("msg payload mismatch:\ngot  %x\nwant %x", payload, wantPayload)
+	if !bytes.Equal(data, wantPayload) {
+		t.Errorf("msg payload mismatch:\ngot  %x\nwant %x", data, wantPayload)
 	}
 }
 
@@ -330,7 +208,7 @@ func TestRLPXFrameRW(t *testing.T) {
 	}
 	conn := new(bytes.Buffer)
 
-	s1 := secrets{
+	s1 := Secrets{
 		AES:        aesSecret,
 		MAC:        macSecret,
 		EgressMAC:  sha3.NewLegacyKeccak256(),
@@ -340,7 +218,7 @@ func TestRLPXFrameRW(t *testing.T) {
 	s1.IngressMAC.Write(ingressMACinit)
 	rw1 := newRLPXFrameRW(conn, s1)
 
-	s2 := secrets{
+	s2 := Secrets{
 		AES:        aesSecret,
 		MAC:        macSecret,
 		EgressMAC:  sha3.NewLegacyKeccak256(),
@@ -354,27 +232,163 @@ func TestRLPXFrameRW(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		// write message into conn buffer
 		wmsg := []interface{}{"foo", "bar", strings.Repeat("test", i)}
-		err := Send(rw1, uint64(i), wmsg)
-		if err != nil {
-			t.Fatalf("WriteMsg error (i=%d): %v", i, err)
+		wantPayload, _ := rlp.EncodeToBytes(wmsg)
+		if _, err := rw1.write(uint64(i), wantPayload); err != nil {
+			t.Fatalf("write error (i=%d): %v", i, err)
 		}
 
 		// read message that rw1 just wrote
-		msg, err := rw2.ReadMsg()
+		code, payload, _, err := rw2.read()
 		if err != nil {
-			t.Fatalf("ReadMsg error (i=%d): %v", i, err)
+			t.Fatalf("read error (i=%d): %v", i, err)
 		}
-		if msg.Code != uint64(i) {
-			t.Fatalf("msg code mismatch: got %d, want %d", msg.Code, i)
+		if code != uint64(i) {
+			t.Fatalf("msg code mismatch: got %d, want %d", code, i)
 		}
-		payload, _ := ioutil.ReadAll(msg.Payload)
-		wantPayload, _ := rlp.EncodeToBytes(wmsg)
 		if !bytes.Equal(payload, wantPayload) {
 			t.Fatalf("msg payload mismatch:\ngot  %x\nwant %x", payload, wantPayload)
 		}
 	}
 }
 
+func newTestFrameRWPair() (rw1, rw2 *rlpxFrameRW) {
+	var (
+		aesSecret      = make([]byte, 16)
+		macSecret      = make([]byte, 16)
+		egressMACinit  = make([]byte, 32)
+		ingressMACinit = make([]byte, 32)
+	)
+	for _, s := range [][]byte{aesSecret, macSecret, egressMACinit, ingressMACinit} {
+		rand.Read(s)
+	}
+	conn := new(bytes.Buffer)
+	s1 := Secrets{AES: aesSecret, MAC: macSecret, EgressMAC: sha3.NewLegacyKeccak256(), IngressMAC: sha3.NewLegacyKeccak256()}
+	s1.EgressMAC.Write(egressMACinit)
+	s1.IngressMAC.Write(ingressMACinit)
+	s2 := Secrets{AES: aesSecret, MAC: macSecret, EgressMAC: sha3.NewLegacyKeccak256(), IngressMAC: sha3.NewLegacyKeccak256()}
+	s2.EgressMAC.Write(ingressMACinit)
+	s2.IngressMAC.Write(egressMACinit)
+	return newRLPXFrameRW(conn, s1), newRLPXFrameRW(conn, s2)
+}
+
+func TestRLPXFrameRWSnappy(t *testing.T) {
+	rw1, rw2 := newTestFrameRWPair()
+	rw1.snappy, rw2.snappy = true, true
+
+	for _, size := range []int{0, 100, 1 << 20} {
+		content := bytes.Repeat([]byte{'a'}, size)
+		wireSize, err := rw1.write(0x10, content)
+		if err != nil {
+			t.Fatalf("size %d: write error: %v", size, err)
+		}
+		code, got, readSize, err := rw2.read()
+		if err != nil {
+			t.Fatalf("size %d: read error: %v", size, err)
+		}
+		if code != 0x10 || !bytes.Equal(got, content) {
+			t.Fatalf("size %d: message mismatch", size)
+		}
+		if readSize != int(wireSize) {
+			t.Fatalf("size %d: wire size mismatch: wrote %d, read %d", size, wireSize, readSize)
+		}
+	}
+}
+
+func TestRLPXFrameRWSnappyLimits(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		err     error
+	}{
+		// Declared size of 1MB in two bytes of data.
+		{append(snappyHeader(1<<20), 0, 0), errSnappyRatio},
+		// Declared size above 16MB.
+		{append(snappyHeader(1<<24), make([]byte, 1<<20)...), errPlainMessageTooLarge},
+	}
+	for i, test := range tests {
+		rw1, rw2 := newTestFrameRWPair()
+		rw2.snappy = true
+		// rw1 doesn't compress, so the crafted payload arrives as is.
+		if _, err := rw1.write(0x10, test.payload); err != nil {
+			t.Fatalf("test %d: write error: %v", i, err)
+		}
+		if _, _, _, err := rw2.read(); err != test.err {
+			t.Errorf("test %d: got error %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+// snappyHeader returns the varint length prefix of a snappy block.
+func snappyHeader(size uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, size)]
+}
+
+func TestConn(t *testing.T) {
+	var (
+		key1, _  = crypto.GenerateKey()
+		key2, _  = crypto.GenerateKey()
+		fd1, fd2 = net.Pipe()
+		c1, c2   = NewConn(fd1), NewConn(fd2)
+	)
+	defer c1.Close()
+	defer c2.Close()
+
+	if _, err := c1.Write(0, nil); err != errNoHandshake {
+		t.Fatalf("wrong error before handshake: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		remote, err := c2.Handshake(key2, nil)
+		if err == nil && !reflect.DeepEqual(remote, &key1.PublicKey) {
+			t.Errorf("receiver: wrong remote key %x", crypto.FromECDSAPub(remote))
+		}
+		errc <- err
+	}()
+	remote, err := c1.Handshake(key1, &key2.PublicKey)
+	if err != nil {
+		t.Fatal("initiator handshake failed:", err)
+	}
+	if !reflect.DeepEqual(remote, &key2.PublicKey) {
+		t.Fatalf("initiator: wrong remote key %x", crypto.FromECDSAPub(remote))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("receiver handshake failed:", err)
+	}
+
+	c1.SetSnappy(true)
+	c2.SetSnappy(true)
+	payload, _ := rlp.EncodeToBytes([]interface{}{"foo", uint(2)})
+	go func() {
+		_, err := c1.Write(0x20, payload)
+		errc <- err
+	}()
+	code, data, _, err := c2.Read()
+	if err != nil {
+		t.Fatal("read error:", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("write error:", err)
+	}
+	if code != 0x20 || !bytes.Equal(data, payload) {
+		t.Fatalf("wrong message: code %d, payload %x", code, data)
+	}
+
+	// Reads time out according to the deadline.
+	c2.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, _, err := c2.Read(); err == nil {
+		t.Fatal("read didn't time out")
+	}
+}
+
+func unhex(str string) []byte {
+	r := strings.NewReplacer("\t", "", " ", "", "\n", "")
+	b, err := hex.DecodeString(r.Replace(str))
+	if err != nil {
+		panic(fmt.Sprintf("invalid hex string: %q", str))
+	}
+	return b
+}
+
 type handshakeAuthTest struct {
 	input       string
 	isPlain     bool
@@ -35,7 +35,6 @@ import (
 	"github.com/groshproject/grosh-core/event"
 	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/p2p/discover"
-	"github.com/groshproject/grosh-core/p2p/discv5"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/enr"
 	"github.com/groshproject/grosh-core/p2p/nat"
@@ -45,8 +44,12 @@ import (
 const (
 	defaultDialTimeout = 15 * time.Second
 
+	// This is the fairness knob for the discovery mixer. When looking for peers, we'll
+	// wait this long for a single source of candidates before moving on and trying other
+	// sources.
+	discmixTimeout = 5 * time.Second
+
 	// Connectivity defaults.
-	maxActiveDialTasks     = 16
 	defaultMaxPendingPeers = 50
 	defaultDialRatio       = 3
 
@@ -59,6 +62,13 @@ const (
 
 	// Maximum amount of time allowed for writing a complete message.
 	frameWriteTimeout = 20 * time.Second
+
+	// The external IP is re-queried from the NAT interface at this interval
+	// to detect changes of the mapped address.
+	natRefreshInterval = 5 * time.Minute
+
+	// Name of the NAT interface as an external address source of the local node.
+	natSource = "nat"
 )
 
 var errServerStopped = errors.New("server stopped")
@@ -86,8 +96,8 @@ type Config struct {
 	// Disabling is useful for protocol debugging (manual topology).
 	NoDiscovery bool
 
-	// DiscoveryV5 specifies whether the new topic-discovery based V5 discovery
-	// protocol should be started or not.
+	// DiscoveryV5 specifies whether the V5 discovery protocol should be started
+	// or not. It shares the UDP socket with V4 discovery if both are enabled.
 	DiscoveryV5 bool `toml:",omitempty"`
 
 	// Name sets the node name of this server.
@@ -101,7 +111,7 @@ type Config struct {
 	// BootstrapNodesV5 are used to establish connectivity
 	// with the rest of the network using the V5 discovery
 	// protocol.
-	BootstrapNodesV5 []*discv5.Node `toml:",omitempty"`
+	BootstrapNodesV5 []*enode.Node `toml:",omitempty"`
 
 	// Static nodes are used as pre-configured connections which are always
 	// maintained and re-connected on disconnects.
@@ -116,6 +126,12 @@ type Config struct {
 	// IP networks contained in the list are considered.
 	NetRestrict *netutil.Netlist `toml:",omitempty"`
 
+	// BannedNodes and BannedNetworks contain nodes which are never dialed or
+	// accepted, by node ID or IP network. More bans can be added at runtime
+	// through BanNode and BanNetwork.
+	BannedNodes    []enode.ID       `toml:",omitempty"`
+	BannedNetworks *netutil.Netlist `toml:",omitempty"`
+
 	// NodeDatabase is the path to the database containing the previously seen
 	// live nodes in the network.
 	NodeDatabase string `toml:",omitempty"`
@@ -151,6 +167,10 @@ type Config struct {
 
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
+
+	// clock is the time source used by the dialer and the inbound connection
+	// throttle. It is set to the system clock by Start unless a test sets it.
+	clock mclock.Clock
 }
 
 // Server manages all peer connections.
@@ -168,11 +188,15 @@ type Server struct {
 	running bool
 
 	nodedb       *enode.DB
+	rep          *reputation
+	bans         *banList
 	localnode    *enode.LocalNode
-	ntab         discoverTable
+	ntab         *discover.UDPv4
+	DiscV5       *discover.UDPv5
+	discmix      *enode.FairMix
+	dialsched    *dialScheduler
 	listener     net.Listener
 	ourHandshake *protoHandshake
-	DiscV5       *discv5.Network
 	loopWG       sync.WaitGroup // loop, listenLoop
 	peerFeed     event.Feed
 	log          log.Logger
@@ -190,7 +214,6 @@ type Server struct {
 	checkpointAddPeer       chan *conn
 
 	// State of run loop and listenLoop.
-	lastLookup     time.Time
 	inboundHistory expHeap
 }
 
@@ -291,6 +314,11 @@ func (srv *Server) LocalNode() *enode.LocalNode {
 	return srv.localnode
 }
 
+// DiscoveryV4 returns the discovery v4 instance, if configured.
+func (srv *Server) DiscoveryV4() *discover.UDPv4 {
+	return srv.ntab
+}
+
 // Peers returns all connected peers.
 func (srv *Server) Peers() []*Peer {
 	var ps []*Peer
@@ -355,6 +383,47 @@ func (srv *Server) RemoveTrustedPeer(node *enode.Node) {
 	}
 }
 
+// BanNode prevents the node with the given ID from connecting. Existing connections
+// to the node are dropped. The server must be running.
+func (srv *Server) BanNode(id enode.ID) {
+	srv.bans.addNode(id)
+	srv.dropBanned()
+}
+
+// UnbanNode removes a node ID from the ban list. It returns false if the node
+// wasn't banned.
+func (srv *Server) UnbanNode(id enode.ID) bool {
+	return srv.bans.removeNode(id)
+}
+
+// BanNetwork prevents all nodes in the given IP network from connecting. Existing
+// connections to such nodes are dropped. The server must be running.
+func (srv *Server) BanNetwork(n *net.IPNet) {
+	srv.bans.addNet(n)
+	srv.dropBanned()
+}
+
+// UnbanNetwork removes an IP network from the ban list. It returns false if the
+// network wasn't banned.
+func (srv *Server) UnbanNetwork(n *net.IPNet) bool {
+	return srv.bans.removeNet(n)
+}
+
+// Bans returns the banned node IDs and IP networks.
+func (srv *Server) Bans() BanList {
+	return srv.bans.list()
+}
+
+// dropBanned disconnects all peers which are on the ban list.
+func (srv *Server) dropBanned() {
+	for _, p := range srv.Peers() {
+		if srv.bans.contains(p.Node()) {
+			p.log.Debug("Disconnecting banned peer")
+			p.Disconnect(DiscUselessPeer)
+		}
+	}
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -397,7 +466,7 @@ type sharedUDPConn struct {
 	unhandled chan discover.ReadPacket
 }
 
-// ReadFromUDP implements discv5.conn
+// ReadFromUDP implements discover.UDPConn
 func (s *sharedUDPConn) ReadFromUDP(b []byte) (n int, addr *net.UDPAddr, err error) {
 	packet, ok := <-s.unhandled
 	if !ok {
@@ -411,7 +480,7 @@ func (s *sharedUDPConn) ReadFromUDP(b []byte) (n int, addr *net.UDPAddr, err err
 	return l, packet.Addr, nil
 }
 
-// Close implements discv5.conn
+// Close implements discover.UDPConn
 func (s *sharedUDPConn) Close() error {
 	return nil
 }
@@ -429,6 +498,9 @@ func (srv *Server) Start() (err error) {
 	if srv.log == nil {
 		srv.log = log.Root()
 	}
+	if srv.clock == nil {
+		srv.clock = mclock.System{}
+	}
 	if srv.NoDial && srv.ListenAddr == "" {
 		srv.log.Warn("P2P server will be useless, neither dialing nor listening")
 	}
@@ -456,6 +528,7 @@ func (srv *Server) Start() (err error) {
 	srv.removetrusted = make(chan *enode.Node)
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
+	srv.bans = newBanList(srv.BannedNodes, srv.BannedNetworks)
 
 	if err := srv.setupLocalNode(); err != nil {
 		return err
@@ -468,11 +541,10 @@ func (srv *Server) Start() (err error) {
 	if err := srv.setupDiscovery(); err != nil {
 		return err
 	}
+	srv.setupDialScheduler()
 
-	dynPeers := srv.maxDialedConns()
-	dialer := newDialState(srv.localnode.ID(), srv.ntab, dynPeers, &srv.Config)
 	srv.loopWG.Add(1)
-	go srv.run(dialer)
+	go srv.run()
 	return nil
 }
 
@@ -491,6 +563,7 @@ func (srv *Server) setupLocalNode() error {
 		return err
 	}
 	srv.nodedb = db
+	srv.rep = newReputation(db)
 	srv.localnode = enode.NewLocalNode(db, srv.PrivateKey)
 	srv.localnode.SetFallbackIP(net.IP{127, 0, 0, 1})
 	// TODO: check conflicts
@@ -510,17 +583,74 @@ func (srv *Server) setupLocalNode() error {
 		// Ask the router about the IP. This takes a while and blocks startup,
 		// do it in the background.
 		srv.loopWG.Add(1)
-		go func() {
-			defer srv.loopWG.Done()
-			if ip, err := srv.NAT.ExternalIP(); err == nil {
-				srv.localnode.SetStaticIP(ip)
-			}
-		}()
+		go srv.natLoop(natRefreshInterval)
 	}
 	return nil
 }
 
+// natLoop periodically queries the external IP from the NAT interface and reports it
+// to the local node. The reported IP is one of the sources of the local node's
+// endpoint prediction, so it doesn't override addresses confirmed by other nodes.
+func (srv *Server) natLoop(interval time.Duration) {
+	defer srv.loopWG.Done()
+
+	type natResult struct {
+		ip  net.IP
+		err error
+	}
+	var (
+		timer  = time.NewTimer(0)
+		result chan natResult // non-nil while a query is running
+		last   net.IP
+	)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			// The query can block for a long time on an unresponsive gateway, run
+			// it in the background to not hold up shutdown.
+			result = make(chan natResult, 1)
+			go func(ch chan<- natResult) {
+				ip, err := srv.NAT.ExternalIP()
+				ch <- natResult{ip, err}
+			}(result)
+		case r := <-result:
+			result = nil
+			ip, err := r.ip, r.err
+			// A failed query withdraws the address, but the last good IP is
+			// kept so that a later change is still reported as one.
+			switch {
+			case err != nil:
+				srv.log.Debug("Couldn't get external IP", "interface", srv.NAT, "err", err)
+				ip = nil
+			case last == nil:
+				srv.log.Info("Found external IP", "interface", srv.NAT, "ip", ip)
+				last = ip
+			case !ip.Equal(last):
+				srv.log.Info("External IP changed", "interface", srv.NAT, "ip", ip, "old", last)
+				last = ip
+			}
+			srv.localnode.SetExternalIP(natSource, ip)
+			timer.Reset(interval)
+		case <-srv.quit:
+			return
+		}
+	}
+}
+
 func (srv *Server) setupDiscovery() error {
+	srv.discmix = enode.NewFairMix(discmixTimeout)
+
+	// Add protocol-specific discovery sources.
+	added := make(map[string]bool)
+	for _, proto := range srv.Protocols {
+		if proto.DialCandidates != nil && !added[proto.Name] {
+			srv.discmix.AddSource(proto.DialCandidates)
+			added[proto.Name] = true
+		}
+	}
+
+	// Don't listen on UDP endpoint if DHT is disabled.
 	if srv.NoDiscovery && !srv.DiscoveryV5 {
 		return nil
 	}
@@ -562,27 +692,54 @@ func (srv *Server) setupDiscovery() error {
 			return err
 		}
 		srv.ntab = ntab
+		// Protocols which provide their own dial candidates are expected to
+		// filter discovery results themselves.
+		if len(added) == 0 {
+			srv.discmix.AddSource(ntab.RandomNodes())
+		}
 	}
 	// Discovery V5
 	if srv.DiscoveryV5 {
-		var ntab *discv5.Network
+		cfg := discover.Config{
+			PrivateKey:  srv.PrivateKey,
+			NetRestrict: srv.NetRestrict,
+			Bootnodes:   srv.BootstrapNodesV5,
+			Log:         srv.log,
+		}
 		var err error
 		if sconn != nil {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, sconn, "", srv.NetRestrict)
+			srv.DiscV5, err = discover.ListenV5(sconn, srv.localnode, cfg)
 		} else {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, conn, "", srv.NetRestrict)
+			srv.DiscV5, err = discover.ListenV5(conn, srv.localnode, cfg)
 		}
 		if err != nil {
 			return err
 		}
-		if err := ntab.SetFallbackNodes(srv.BootstrapNodesV5); err != nil {
-			return err
-		}
-		srv.DiscV5 = ntab
 	}
 	return nil
 }
 
+func (srv *Server) setupDialScheduler() {
+	config := dialConfig{
+		self:           srv.localnode.ID(),
+		maxDialPeers:   srv.maxDialedConns(),
+		maxActiveDials: srv.MaxPendingPeers,
+		rep:            srv.rep,
+		bans:           srv.bans,
+		log:            srv.log,
+		netRestrict:    srv.NetRestrict,
+		dialer:         srv.Dialer,
+		clock:          srv.clock,
+	}
+	if srv.ntab != nil {
+		config.resolver = srv.ntab
+	}
+	srv.dialsched = newDialScheduler(config, srv.discmix, srv.SetupConn)
+	for _, n := range srv.StaticNodes {
+		srv.dialsched.addStatic(n)
+	}
+}
+
 func (srv *Server) setupListening() error {
 	// Launch the listener.
 	listener, err := srv.listenFunc("tcp", srv.ListenAddr)
@@ -609,84 +766,52 @@ func (srv *Server) setupListening() error {
 	return nil
 }
 
-type dialer interface {
-	newTasks(running int, peers map[enode.ID]*Peer, now time.Time) []task
-	taskDone(task, time.Time)
-	addStatic(*enode.Node)
-	removeStatic(*enode.Node)
-}
-
-func (srv *Server) run(dialstate dialer) {
+// run is the main loop of the server.
+func (srv *Server) run() {
 	srv.log.Info("Started P2P networking", "self", srv.localnode.Node().URLv4())
 	defer srv.loopWG.Done()
 	defer srv.nodedb.Close()
+	defer srv.rep.flush()
+	defer srv.discmix.Close()
+	defer srv.dialsched.stop()
 
 	var (
 		peers        = make(map[enode.ID]*Peer)
 		inboundCount = 0
 		trusted      = make(map[enode.ID]bool, len(srv.TrustedNodes))
-		taskdone     = make(chan task, maxActiveDialTasks)
-		runningTasks []task
-		queuedTasks  []task // tasks that can't run yet
+		flushScores  = time.NewTicker(scoreFlushInterval)
 	)
+	defer flushScores.Stop()
 	// Put trusted nodes into a map to speed up checks.
 	// Trusted peers are loaded on startup or added via AddTrustedPeer RPC.
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID()] = true
 	}
 
-	// removes t from runningTasks
-	delTask := func(t task) {
-		for i := range runningTasks {
-			if runningTasks[i] == t {
-				runningTasks = append(runningTasks[:i], runningTasks[i+1:]...)
-				break
-			}
-		}
-	}
-	// starts until max number of active tasks is satisfied
-	startTasks := func(ts []task) (rest []task) {
-		i := 0
-		for ; len(runningTasks) < maxActiveDialTasks && i < len(ts); i++ {
-			t := ts[i]
-			srv.log.Trace("New dial task", "task", t)
-			go func() { t.Do(srv); taskdone <- t }()
-			runningTasks = append(runningTasks, t)
-		}
-		return ts[i:]
-	}
-	scheduleTasks := func() {
-		// Start from queue first.
-		queuedTasks = append(queuedTasks[:0], startTasks(queuedTasks)...)
-		// Query dialer for new tasks and start as many as possible now.
-		if len(runningTasks) < maxActiveDialTasks {
-			nt := dialstate.newTasks(len(runningTasks)+len(queuedTasks), peers, time.Now())
-			queuedTasks = append(queuedTasks, startTasks(nt)...)
-		}
-	}
-
 running:
 	for {
-		scheduleTasks()
-
 		select {
 		case <-srv.quit:
 			// The server was stopped. Run the cleanup logic.
 			break running
 
+		case <-flushScores.C:
+			// Persist the reputation scores reported since the last flush.
+			srv.rep.flush()
+
 		case n := <-srv.addstatic:
 			// This channel is used by AddPeer to add to the
 			// ephemeral static peer list. Add it to the dialer,
 			// it will keep the node connected.
 			srv.log.Trace("Adding static node", "node", n)
-			dialstate.addStatic(n)
+			srv.dialsched.addStatic(n)
 
 		case n := <-srv.removestatic:
 			// This channel is used by RemovePeer to send a
 			// disconnect request to a peer and begin the
 			// stop keeping the node connected.
 			srv.log.Trace("Removing static node", "node", n)
-			dialstate.removeStatic(n)
+			srv.dialsched.removeStatic(n)
 			if p, ok := peers[n.ID()]; ok {
 				p.Disconnect(DiscRequested)
 			}
@@ -717,14 +842,6 @@ running:
 			op(peers)
 			srv.peerOpDone <- struct{}{}
 
-		case t := <-taskdone:
-			// A task got done. Tell dialstate about it so it
-			// can update its state and remove it from the active
-			// tasks list.
-			srv.log.Trace("Dial task done", "task", t)
-			dialstate.taskDone(t, time.Now())
-			delTask(t)
-
 		case c := <-srv.checkpointPostHandshake:
 			// A connection has passed the encryption handshake so
 			// the remote identity is known (but hasn't been verified yet).
@@ -742,6 +859,7 @@ running:
 			if err == nil {
 				// The handshakes are done and it passed all checks.
 				p := newPeer(srv.log, c, srv.Protocols)
+				p.rep = srv.rep
 				// If message events are enabled, pass the peerFeed
 				// to the peer
 				if srv.EnableMsgEvents {
@@ -754,10 +872,8 @@ running:
 				if p.Inbound() {
 					inboundCount++
 				}
+				srv.dialsched.peerAdded(c)
 			}
-			// The dialer logic relies on the assumption that
-			// dial tasks complete after the peer has been added or
-			// discarded. Unblock the task last.
 			c.cont <- err
 
 		case pd := <-srv.delpeer:
@@ -768,6 +884,7 @@ running:
 			if pd.Inbound() {
 				inboundCount--
 			}
+			srv.dialsched.peerRemoved(pd.rw)
 		}
 	}
 
@@ -789,7 +906,7 @@ running:
 	// is closed.
 	for len(peers) > 0 {
 		p := <-srv.delpeer
-		p.log.Trace("<-delpeer (spindown)", "remainingTasks", len(runningTasks))
+		p.log.Trace("<-delpeer (spindown)")
 		delete(peers, p.ID())
 	}
 }
@@ -804,6 +921,10 @@ func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount in
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case srv.bans.contains(c.node):
+		return DiscUselessPeer
+	case !c.is(trustedConn|staticDialedConn) && srv.rep.banned(c.node.ID()):
+		return DiscUselessPeer
 	default:
 		return nil
 	}
@@ -823,15 +944,19 @@ func (srv *Server) maxInboundConns() int {
 	return srv.MaxPeers - srv.maxDialedConns()
 }
 
-func (srv *Server) maxDialedConns() int {
-	if srv.NoDiscovery || srv.NoDial {
+func (srv *Server) maxDialedConns() (limit int) {
+	if srv.NoDial || srv.MaxPeers == 0 {
 		return 0
 	}
-	r := srv.DialRatio
-	if r == 0 {
-		r = defaultDialRatio
+	if srv.DialRatio == 0 {
+		limit = srv.MaxPeers / defaultDialRatio
+	} else {
+		limit = srv.MaxPeers / srv.DialRatio
+	}
+	if limit == 0 {
+		limit = 1
 	}
-	return srv.MaxPeers / r
+	return limit
 }
 
 // listenLoop runs in its own goroutine and accepts
@@ -893,12 +1018,17 @@ func (srv *Server) checkInboundConn(fd net.Conn, remoteIP net.IP) error {
 		if srv.NetRestrict != nil && !srv.NetRestrict.Contains(remoteIP) {
 			return fmt.Errorf("not whitelisted in NetRestrict")
 		}
+		// Reject connections from banned networks.
+		if srv.bans.containsIP(remoteIP) {
+			return fmt.Errorf("banned network")
+		}
 		// Reject Internet peers that try too often.
-		srv.inboundHistory.expire(time.Now())
+		now := srv.clock.Now()
+		srv.inboundHistory.expire(now, nil)
 		if !netutil.IsLAN(remoteIP) && srv.inboundHistory.contains(remoteIP.String()) {
 			return fmt.Errorf("too many attempts")
 		}
-		srv.inboundHistory.add(remoteIP.String(), time.Now().Add(inboundThrottleTime))
+		srv.inboundHistory.add(remoteIP.String(), now.Add(inboundThrottleTime))
 	}
 	return nil
 }
@@ -1056,6 +1186,10 @@ type NodeInfo struct {
 	} `json:"ports"`
 	ListenAddr string                 `json:"listenAddr"`
 	Protocols  map[string]interface{} `json:"protocols"`
+
+	// ExternalAddrs lists the external addresses reported by NAT interfaces
+	// and other nodes, which determine the IP of the node record.
+	ExternalAddrs []enode.ExternalAddr `json:"externalAddrs"`
 }
 
 // NodeInfo gathers and returns a collection of metadata known about the host.
@@ -1073,6 +1207,9 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	info.Ports.Discovery = node.UDP()
 	info.Ports.Listener = node.TCP()
 	info.ENR = node.String()
+	if srv.localnode != nil {
+		info.ExternalAddrs = srv.localnode.ExternalAddrs()
+	}
 
 	// Gather all the running protocol infos (only once per protocol type)
 	for _, proto := range srv.Protocols {
@@ -1087,6 +1224,28 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	return info
 }
 
+// PeerScores returns the reputation scores of all nodes which have a non-zero
+// score, ordered from lowest to highest.
+func (srv *Server) PeerScores() []PeerScore {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if !srv.running {
+		return nil
+	}
+	return srv.rep.all()
+}
+
+// PeerTraffic returns the protocol message counters of all connected peers, sorted
+// by node ID.
+func (srv *Server) PeerTraffic() []PeerTraffic {
+	traffic := make([]PeerTraffic, 0, srv.PeerCount())
+	for _, peer := range srv.Peers() {
+		traffic = append(traffic, peer.Traffic())
+	}
+	sort.Slice(traffic, func(i, j int) bool { return traffic[i].ID < traffic[j].ID })
+	return traffic
+}
+
 // PeersInfo returns an array of metadata objects describing connected peers.
 func (srv *Server) PeersInfo() []*PeerInfo {
 	// Gather all the generic and sub-protocol specific infos
@@ -23,6 +23,7 @@ import (
 	"math/rand"
 	"net"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -31,6 +32,7 @@ import (
 	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/enr"
+	"github.com/groshproject/grosh-core/p2p/rlpx"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -40,20 +42,20 @@ import (
 
 type testTransport struct {
 	rpub *ecdsa.PublicKey
-	*rlpx
+	*rlpxTransport
 
 	closeErr error
 }
 
 func newTestTransport(rpub *ecdsa.PublicKey, fd net.Conn) transport {
-	wrapped := newRLPX(fd).(*rlpx)
-	wrapped.rw = newRLPXFrameRW(fd, secrets{
-		MAC:        zero16,
-		AES:        zero16,
+	wrapped := newRLPX(fd).(*rlpxTransport)
+	wrapped.conn.InitWithSecrets(rlpx.Secrets{
+		MAC:        make([]byte, 16),
+		AES:        make([]byte, 16),
 		IngressMAC: sha3.NewLegacyKeccak256(),
 		EgressMAC:  sha3.NewLegacyKeccak256(),
 	})
-	return &testTransport{rpub: rpub, rlpx: wrapped}
+	return &testTransport{rpub: rpub, rlpxTransport: wrapped}
 }
 
 func (c *testTransport) doEncHandshake(prv *ecdsa.PrivateKey, dialDest *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
@@ -66,7 +68,7 @@ func (c *testTransport) doProtoHandshake(our *protoHandshake) (*protoHandshake,
 }
 
 func (c *testTransport) close(err error) {
-	c.rlpx.fd.Close()
+	c.conn.Close()
 	c.closeErr = err
 }
 
@@ -124,6 +126,48 @@ func TestServerListen(t *testing.T) {
 	}
 }
 
+// This test checks that banned nodes are disconnected and can't reconnect.
+func TestServerBanNode(t *testing.T) {
+	connected := make(chan *Peer, 2)
+	remid := &newkey().PublicKey
+	srv := startTestServer(t, remid, func(p *Peer) { connected <- p })
+	defer srv.Stop()
+
+	conn, err := net.DialTimeout("tcp", srv.ListenAddr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+	select {
+	case <-connected:
+	case <-time.After(1 * time.Second):
+		t.Fatal("server did not accept within one second")
+	}
+
+	// Ban the peer and wait for it to be dropped.
+	srv.BanNode(enode.PubkeyToIDV4(remid))
+	for start := time.Now(); srv.PeerCount() > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 1*time.Second {
+			t.Fatal("banned peer not disconnected")
+		}
+	}
+
+	// Reconnecting should fail.
+	conn2, err := net.DialTimeout("tcp", srv.ListenAddr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn2.Close()
+	select {
+	case <-connected:
+		t.Fatal("banned node was accepted")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if bans := srv.Bans(); len(bans.Nodes) != 1 {
+		t.Fatalf("wrong ban list: %+v", bans)
+	}
+}
+
 func TestServerDial(t *testing.T) {
 	// run a one-shot TCP server to handle the connection.
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -205,152 +249,6 @@ func TestServerDial(t *testing.T) {
 	}
 }
 
-// This test checks that tasks generated by dialstate are
-// actually executed and taskdone is called for them.
-func TestServerTaskScheduling(t *testing.T) {
-	var (
-		done           = make(chan *testTask)
-		quit, returned = make(chan struct{}), make(chan struct{})
-		tc             = 0
-		tg             = taskgen{
-			newFunc: func(running int, peers map[enode.ID]*Peer) []task {
-				tc++
-				return []task{&testTask{index: tc - 1}}
-			},
-			doneFunc: func(t task) {
-				select {
-				case done <- t.(*testTask):
-				case <-quit:
-				}
-			},
-		}
-	)
-
-	// The Server in this test isn't actually running
-	// because we're only interested in what run does.
-	db, _ := enode.OpenDB("")
-	srv := &Server{
-		Config:    Config{MaxPeers: 10},
-		localnode: enode.NewLocalNode(db, newkey()),
-		nodedb:    db,
-		quit:      make(chan struct{}),
-		ntab:      fakeTable{},
-		running:   true,
-		log:       log.New(),
-	}
-	srv.loopWG.Add(1)
-	go func() {
-		srv.run(tg)
-		close(returned)
-	}()
-
-	var gotdone []*testTask
-	for i := 0; i < 100; i++ {
-		gotdone = append(gotdone, <-done)
-	}
-	for i, task := range gotdone {
-		if task.index != i {
-			t.Errorf("task %d has wrong index, got %d", i, task.index)
-			break
-		}
-		if !task.called {
-			t.Errorf("task %d was not called", i)
-			break
-		}
-	}
-
-	close(quit)
-	srv.Stop()
-	select {
-	case <-returned:
-	case <-time.After(500 * time.Millisecond):
-		t.Error("Server.run did not return within 500ms")
-	}
-}
-
-// This test checks that Server doesn't drop tasks,
-// even if newTasks returns more than the maximum number of tasks.
-func TestServerManyTasks(t *testing.T) {
-	alltasks := make([]task, 300)
-	for i := range alltasks {
-		alltasks[i] = &testTask{index: i}
-	}
-
-	var (
-		db, _ = enode.OpenDB("")
-		srv   = &Server{
-			quit:      make(chan struct{}),
-			localnode: enode.NewLocalNode(db, newkey()),
-			nodedb:    db,
-			ntab:      fakeTable{},
-			running:   true,
-			log:       log.New(),
-		}
-		done       = make(chan *testTask)
-		start, end = 0, 0
-	)
-	defer srv.Stop()
-	srv.loopWG.Add(1)
-	go srv.run(taskgen{
-		newFunc: func(running int, peers map[enode.ID]*Peer) []task {
-			start, end = end, end+maxActiveDialTasks+10
-			if end > len(alltasks) {
-				end = len(alltasks)
-			}
-			return alltasks[start:end]
-		},
-		doneFunc: func(tt task) {
-			done <- tt.(*testTask)
-		},
-	})
-
-	doneset := make(map[int]bool)
-	timeout := time.After(2 * time.Second)
-	for len(doneset) < len(alltasks) {
-		select {
-		case tt := <-done:
-			if doneset[tt.index] {
-				t.Errorf("task %d got done more than once", tt.index)
-			} else {
-				doneset[tt.index] = true
-			}
-		case <-timeout:
-			t.Errorf("%d of %d tasks got done within 2s", len(doneset), len(alltasks))
-			for i := 0; i < len(alltasks); i++ {
-				if !doneset[i] {
-					t.Logf("task %d not done", i)
-				}
-			}
-			return
-		}
-	}
-}
-
-type taskgen struct {
-	newFunc  func(running int, peers map[enode.ID]*Peer) []task
-	doneFunc func(task)
-}
-
-func (tg taskgen) newTasks(running int, peers map[enode.ID]*Peer, now time.Time) []task {
-	return tg.newFunc(running, peers)
-}
-func (tg taskgen) taskDone(t task, now time.Time) {
-	tg.doneFunc(t)
-}
-func (tg taskgen) addStatic(*enode.Node) {
-}
-func (tg taskgen) removeStatic(*enode.Node) {
-}
-
-type testTask struct {
-	index  int
-	called bool
-}
-
-func (t *testTask) Do(srv *Server) {
-	t.called = true
-}
-
 // This test checks that connections are disconnected
 // just after the encryption handshake when the server is
 // at capacity. Trusted connections should still be accepted.
@@ -363,7 +261,7 @@ func TestServerAtCap(t *testing.T) {
 			MaxPeers:     10,
 			NoDial:       true,
 			NoDiscovery:  true,
-			TrustedNodes: []*enode.Node{newNode(trustedID, nil)},
+			TrustedNodes: []*enode.Node{newNode(trustedID, "")},
 		},
 	}
 	if err := srv.Start(); err != nil {
@@ -401,14 +299,14 @@ func TestServerAtCap(t *testing.T) {
 	}
 
 	// Remove from trusted set and try again
-	srv.RemoveTrustedPeer(newNode(trustedID, nil))
+	srv.RemoveTrustedPeer(newNode(trustedID, ""))
 	c = newconn(trustedID)
 	if err := srv.checkpoint(c, srv.checkpointPostHandshake); err != DiscTooManyPeers {
 		t.Error("wrong error for insert:", err)
 	}
 
 	// Add anotherID to trusted set and try again
-	srv.AddTrustedPeer(newNode(anotherID, nil))
+	srv.AddTrustedPeer(newNode(anotherID, ""))
 	c = newconn(anotherID)
 	if err := srv.checkpoint(c, srv.checkpointPostHandshake); err != nil {
 		t.Error("unexpected error for trusted conn @posthandshake:", err)
@@ -724,3 +622,113 @@ func (l *fakeAddrListener) Accept() (net.Conn, error) {
 func (c *fakeAddrConn) RemoteAddr() net.Addr {
 	return c.remoteAddr
 }
+
+// fakeNAT is a NAT interface with a changeable external IP.
+type fakeNAT struct {
+	mu   sync.Mutex
+	ip   net.IP
+	err  error
+	hang chan struct{} // if set, queries block until it is closed
+}
+
+func (n *fakeNAT) set(ip net.IP, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.ip, n.err = ip, err
+}
+
+func (n *fakeNAT) ExternalIP() (net.IP, error) {
+	n.mu.Lock()
+	hang := n.hang
+	n.mu.Unlock()
+	if hang != nil {
+		<-hang
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ip, n.err
+}
+
+func (n *fakeNAT) AddMapping(string, int, int, string, time.Duration) error { return nil }
+func (n *fakeNAT) DeleteMapping(string, int, int) error                     { return nil }
+func (n *fakeNAT) String() string                                           { return "fake" }
+
+func TestServerNATExternalIP(t *testing.T) {
+	var (
+		ipA = net.IP{203, 0, 113, 1}
+		ipB = net.IP{203, 0, 113, 2}
+		nat = &fakeNAT{ip: ipA}
+	)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    10,
+			NoDiscovery: true,
+			ListenAddr:  "127.0.0.1:0",
+			NAT:         nat,
+			Logger:      testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	waitIP := func(want net.IP) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !srv.Self().IP().Equal(want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("wrong local node IP %v, want %v", srv.Self().IP(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitIP(ipA)
+	info := srv.NodeInfo()
+	if len(info.ExternalAddrs) != 1 || info.ExternalAddrs[0].Source != natSource || !info.ExternalAddrs[0].IP.Equal(ipA) {
+		t.Fatalf("wrong external addresses in node info: %+v", info.ExternalAddrs)
+	}
+
+	// Run another refresh loop with a short interval to check that changes of
+	// the external IP are picked up.
+	srv.loopWG.Add(1)
+	go srv.natLoop(10 * time.Millisecond)
+	nat.set(ipB, nil)
+	waitIP(ipB)
+
+	// When the NAT interface stops working, its address is dropped.
+	nat.set(nil, errors.New("gateway unreachable"))
+	waitIP(net.IP{127, 0, 0, 1})
+}
+
+func TestServerNATUnresponsive(t *testing.T) {
+	nat := &fakeNAT{hang: make(chan struct{})}
+	defer close(nat.hang)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    10,
+			NoDiscovery: true,
+			ListenAddr:  "127.0.0.1:0",
+			NAT:         nat,
+			Logger:      testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop must not wait for the query of the external IP.
+	stopped := make(chan struct{})
+	go func() {
+		srv.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server shutdown blocked by NAT query")
+	}
+}
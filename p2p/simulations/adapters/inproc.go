@@ -17,6 +17,8 @@
 package adapters
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -38,9 +40,21 @@ type SimAdapter struct {
 	pipe     func() (net.Conn, net.Conn, error)
 	mtx      sync.RWMutex
 	nodes    map[enode.ID]*SimNode
+	links    map[linkKey]*pipes.Link
 	services map[string]ServiceFunc
 }
 
+// linkKey identifies the link between two nodes. The IDs are ordered so that the
+// key is the same in both directions.
+type linkKey struct{ a, b enode.ID }
+
+func newLinkKey(one, other enode.ID) linkKey {
+	if bytes.Compare(one[:], other[:]) > 0 {
+		one, other = other, one
+	}
+	return linkKey{one, other}
+}
+
 // NewSimAdapter creates a SimAdapter which is capable of running in-memory
 // simulation nodes running any of the given services (the services to run on a
 // particular node are passed to the NewNode function in the NodeConfig)
@@ -49,6 +63,7 @@ func NewSimAdapter(services map[string]ServiceFunc) *SimAdapter {
 	return &SimAdapter{
 		pipe:     pipes.NetPipe,
 		nodes:    make(map[enode.ID]*SimNode),
+		links:    make(map[linkKey]*pipes.Link),
 		services: services,
 	}
 }
@@ -57,6 +72,7 @@ func NewTCPAdapter(services map[string]ServiceFunc) *SimAdapter {
 	return &SimAdapter{
 		pipe:     pipes.TCPPipe,
 		nodes:    make(map[enode.ID]*SimNode),
+		links:    make(map[linkKey]*pipes.Link),
 		services: services,
 	}
 }
@@ -102,7 +118,7 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 			PrivateKey:      config.PrivateKey,
 			MaxPeers:        math.MaxInt32,
 			NoDiscovery:     true,
-			Dialer:          s,
+			Dialer:          &simDialer{s, id},
 			EnableMsgEvents: config.EnableMsgEvents,
 		},
 		NoUSB:  true,
@@ -124,8 +140,58 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 }
 
 // Dial implements the p2p.NodeDialer interface by connecting to the node using
-// an in-memory net.Pipe
-func (s *SimAdapter) Dial(dest *enode.Node) (conn net.Conn, err error) {
+// an in-memory net.Pipe. Connections created by Dial are not shaped because the
+// source node is unknown. Nodes created by the adapter use a dialer which applies
+// the link configuration.
+func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn, err error) {
+	return s.dial(dest, s.pipe)
+}
+
+// simDialer dials on behalf of a simulation node.
+type simDialer struct {
+	adapter *SimAdapter
+	src     enode.ID
+}
+
+// Dial implements p2p.NodeDialer. The connection is sent through the link between
+// the two nodes, which is perfect until it is configured by SetLink.
+func (d *simDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	return d.adapter.dial(dest, d.adapter.link(d.src, dest.ID()).Pipe(d.adapter.pipe))
+}
+
+// link returns the link between two nodes, creating a perfect one if none exists.
+func (s *SimAdapter) link(one, other enode.ID) *pipes.Link {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	key := newLinkKey(one, other)
+	link := s.links[key]
+	if link == nil {
+		link = pipes.NewLink(pipes.LinkConfig{})
+		s.links[key] = link
+	}
+	return link
+}
+
+// SetLink implements LinkShaper. The configuration applies to open connections
+// between the two nodes as well as to future ones.
+func (s *SimAdapter) SetLink(one, other enode.ID, cfg pipes.LinkConfig) {
+	s.link(one, other).SetConfig(cfg)
+}
+
+// Link implements LinkShaper.
+func (s *SimAdapter) Link(one, other enode.ID) (pipes.LinkConfig, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	link := s.links[newLinkKey(one, other)]
+	if link == nil {
+		return pipes.LinkConfig{}, false
+	}
+	return link.Config(), true
+}
+
+func (s *SimAdapter) dial(dest *enode.Node, pipe func() (net.Conn, net.Conn, error)) (net.Conn, error) {
 	node, ok := s.GetNode(dest.ID())
 	if !ok {
 		return nil, fmt.Errorf("unknown node: %s", dest.ID())
@@ -135,7 +201,7 @@ func (s *SimAdapter) Dial(dest *enode.Node) (conn net.Conn, err error) {
 		return nil, fmt.Errorf("node not running: %s", dest.ID())
 	}
 	// SimAdapter.pipe is net.Pipe (NewSimAdapter)
-	pipe1, pipe2, err := s.pipe()
+	pipe1, pipe2, err := pipe()
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +23,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/groshproject/grosh-core/node"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
+	"github.com/groshproject/grosh-core/rpc"
 )
 
 func TestTCPPipe(t *testing.T) {
@@ -257,3 +261,95 @@ func TestNetPipeBidirections(t *testing.T) {
 		t.Fatal("test timeout")
 	}
 }
+
+// pingService answers pings and reports pongs of its peers.
+type pingService struct {
+	peers chan p2p.MsgReadWriter
+	pongs chan struct{}
+}
+
+func (s *pingService) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    "ping",
+		Version: 1,
+		Length:  2,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			s.peers <- rw
+			for {
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					return err
+				}
+				msg.Discard()
+				switch msg.Code {
+				case 0:
+					if err := p2p.Send(rw, 1, []uint{}); err != nil {
+						return err
+					}
+				case 1:
+					s.pongs <- struct{}{}
+				}
+			}
+		},
+	}}
+}
+
+func (s *pingService) APIs() []rpc.API             { return nil }
+func (s *pingService) Start(srv *p2p.Server) error { return nil }
+func (s *pingService) Stop() error                 { return nil }
+
+func TestSimAdapterSetLink(t *testing.T) {
+	services := make(map[enode.ID]*pingService)
+	adapter := NewSimAdapter(Services{
+		"ping": func(ctx *ServiceContext) (node.Service, error) {
+			svc := &pingService{peers: make(chan p2p.MsgReadWriter, 1), pongs: make(chan struct{}, 1)}
+			services[ctx.Config.ID] = svc
+			return svc, nil
+		},
+	})
+	var nodes []Node
+	for i := 0; i < 2; i++ {
+		config := RandomNodeConfig()
+		config.Services = []string{"ping"}
+		n, err := adapter.NewNode(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Start(nil); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Stop()
+		nodes = append(nodes, n)
+	}
+	one, other := nodes[0].(*SimNode), nodes[1].(*SimNode)
+	one.Server().AddPeer(other.Node())
+
+	svc := services[one.ID]
+	var rw p2p.MsgReadWriter
+	select {
+	case rw = <-svc.peers:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nodes did not connect")
+	}
+	ping := func() time.Duration {
+		start := time.Now()
+		if err := p2p.Send(rw, 0, []uint{}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-svc.pongs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no pong received")
+		}
+		return time.Since(start)
+	}
+	if rtt := ping(); rtt > 100*time.Millisecond {
+		t.Fatalf("round trip over perfect link took %v", rtt)
+	}
+	// Configuring the link shapes the open connection.
+	latency := 100 * time.Millisecond
+	adapter.SetLink(one.ID, other.ID, pipes.LinkConfig{Latency: latency})
+	if rtt := ping(); rtt < 2*latency {
+		t.Fatalf("round trip over shaped link took %v, want at least %v", rtt, 2*latency)
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/groshproject/grosh-core/p2p"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/enr"
+	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
 	"github.com/groshproject/grosh-core/rpc"
 )
 
@@ -75,6 +76,19 @@ type NodeAdapter interface {
 	NewNode(config *NodeConfig) (Node, error)
 }
 
+// LinkShaper is implemented by node adapters which can simulate the properties of
+// the network links between nodes.
+type LinkShaper interface {
+	// SetLink configures the link between two nodes. The configuration applies to
+	// existing and future connections between the nodes, in both directions.
+	SetLink(one, other enode.ID, cfg pipes.LinkConfig)
+
+	// Link returns the configuration of the link between two nodes. It returns
+	// false if the nodes have never been connected and the link has not been
+	// configured.
+	Link(one, other enode.ID) (pipes.LinkConfig, bool)
+}
+
 // NodeConfig is the configuration used to start a node in a simulation
 // network
 type NodeConfig struct {
@@ -291,5 +305,5 @@ func (n *NodeConfig) initEnode(ip net.IP, tcpport int, udpport int) error {
 }
 
 func (n *NodeConfig) initDummyEnode() error {
-	return n.initEnode(net.IPv4(127, 0, 0, 1), 0, 0)
+	return n.initEnode(net.IPv4(127, 0, 0, 1), int(n.Port), 0)
 }
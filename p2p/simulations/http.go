@@ -33,6 +33,7 @@ import (
 	"github.com/groshproject/grosh-core/p2p"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/simulations/adapters"
+	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
 	"github.com/groshproject/grosh-core/rpc"
 	"github.com/julienschmidt/httprouter"
 	"golang.org/x/net/websocket"
@@ -74,6 +75,11 @@ func (c *Client) StopNetwork() error {
 	return c.Post("/stop", nil, nil)
 }
 
+// ResetNetwork removes all nodes and connections from the simulation network
+func (c *Client) ResetNetwork() error {
+	return c.Post("/reset", nil, nil)
+}
+
 // CreateSnapshot creates a network snapshot
 func (c *Client) CreateSnapshot() (*Snapshot, error) {
 	snap := &Snapshot{}
@@ -205,6 +211,17 @@ func (c *Client) DisconnectNode(nodeID, peerID string) error {
 	return c.Delete(fmt.Sprintf("/nodes/%s/conn/%s", nodeID, peerID))
 }
 
+// SetLink configures the simulated network link between two nodes
+func (c *Client) SetLink(nodeID, peerID string, cfg pipes.LinkConfig) error {
+	return c.Post(fmt.Sprintf("/nodes/%s/link/%s", nodeID, peerID), cfg, nil)
+}
+
+// GetLink returns the configuration of the network link between two nodes
+func (c *Client) GetLink(nodeID, peerID string) (*pipes.LinkConfig, error) {
+	cfg := &pipes.LinkConfig{}
+	return cfg, c.Get(fmt.Sprintf("/nodes/%s/link/%s", nodeID, peerID), cfg)
+}
+
 // RPCClient returns an RPC client connected to a node
 func (c *Client) RPCClient(ctx context.Context, nodeID string) (*rpc.Client, error) {
 	baseURL := strings.Replace(c.URL, "http", "ws", 1)
@@ -295,6 +312,8 @@ func NewServer(network *Network) *Server {
 	s.POST("/nodes/:nodeid/stop", s.StopNode)
 	s.POST("/nodes/:nodeid/conn/:peerid", s.ConnectNode)
 	s.DELETE("/nodes/:nodeid/conn/:peerid", s.DisconnectNode)
+	s.GET("/nodes/:nodeid/link/:peerid", s.GetLink)
+	s.POST("/nodes/:nodeid/link/:peerid", s.SetLink)
 	s.GET("/nodes/:nodeid/rpc", s.NodeRPC)
 
 	return s
@@ -647,6 +666,39 @@ func (s *Server) DisconnectNode(w http.ResponseWriter, req *http.Request) {
 	s.JSON(w, http.StatusOK, node.NodeInfo())
 }
 
+// SetLink configures the network link between a node and a peer node
+func (s *Server) SetLink(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	var cfg pipes.LinkConfig
+	if err := json.NewDecoder(req.Body).Decode(&cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.network.SetLink(node.ID(), peer.ID(), cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.JSON(w, http.StatusOK, cfg)
+}
+
+// GetLink returns the configuration of the network link between a node and a
+// peer node
+func (s *Server) GetLink(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	cfg, err := s.network.GetLink(node.ID(), peer.ID())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.JSON(w, http.StatusOK, cfg)
+}
+
 // Options responds to the OPTIONS HTTP method by returning a 200 OK response
 // with the "Access-Control-Allow-Headers" header set to "Content-Type"
 func (s *Server) Options(w http.ResponseWriter, req *http.Request) {
@@ -35,6 +35,7 @@ import (
 	"github.com/groshproject/grosh-core/p2p"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/simulations/adapters"
+	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
 	"github.com/groshproject/grosh-core/rpc"
 	"github.com/mattn/go-colorable"
 )
@@ -357,6 +358,86 @@ func TestHTTPNetwork(t *testing.T) {
 	)
 }
 
+// TestHTTPLink tests configuring the network links between nodes using the
+// HTTP API
+func TestHTTPLink(t *testing.T) {
+	network, s := testHTTPServer(t)
+	defer s.Close()
+	defer network.Shutdown()
+
+	// wait for the last protocol handshake before shaping the link, the nodes
+	// can't be shut down while handshakes are in progress
+	client := NewClient(s.URL)
+	events := make(chan *Event, 10)
+	sub, err := client.SubscribeNetwork(events, SubscribeOpts{Filter: "prb:0"})
+	if err != nil {
+		t.Fatalf("error subscribing to network events: %s", err)
+	}
+	defer sub.Unsubscribe()
+	nodeIDs := startTestNetwork(t, client)
+	x := &expectEvents{t, events, sub}
+	x.expectMsgs(map[MsgFilter]int{
+		{"prb", 0}: 2,
+	})
+
+	// unconfigured links are perfect links
+	cfg, err := client.GetLink(nodeIDs[0], nodeIDs[1])
+	if err != nil {
+		t.Fatalf("error getting link: %s", err)
+	}
+	if *cfg != (pipes.LinkConfig{}) {
+		t.Fatalf("expected empty link config, got %+v", cfg)
+	}
+
+	// set the link and check it applies in both directions
+	want := pipes.LinkConfig{
+		Latency:   20 * time.Millisecond,
+		Jitter:    5 * time.Millisecond,
+		Loss:      0.1,
+		Bandwidth: 1024 * 1024,
+		Seed:      1,
+	}
+	if err := client.SetLink(nodeIDs[0], nodeIDs[1], want); err != nil {
+		t.Fatalf("error setting link: %s", err)
+	}
+	for _, ids := range [][2]string{{nodeIDs[0], nodeIDs[1]}, {nodeIDs[1], nodeIDs[0]}} {
+		cfg, err := client.GetLink(ids[0], ids[1])
+		if err != nil {
+			t.Fatalf("error getting link: %s", err)
+		}
+		if *cfg != want {
+			t.Fatalf("wrong link config %s -> %s: got %+v, want %+v", ids[0], ids[1], cfg, want)
+		}
+	}
+
+	// invalid configurations are rejected
+	if err := client.SetLink(nodeIDs[0], nodeIDs[1], pipes.LinkConfig{Loss: 1.5}); err == nil {
+		t.Fatal("expected error for invalid loss probability")
+	}
+	if err := client.SetLink(nodeIDs[0], nodeIDs[1], pipes.LinkConfig{Latency: -time.Second}); err == nil {
+		t.Fatal("expected error for negative latency")
+	}
+	if cfg, _ := client.GetLink(nodeIDs[0], nodeIDs[1]); *cfg != want {
+		t.Fatalf("link config changed by invalid request: %+v", cfg)
+	}
+
+	// the existing connection stays up over the shaped link
+	var one, other enode.ID
+	one.UnmarshalText([]byte(nodeIDs[0]))
+	other.UnmarshalText([]byte(nodeIDs[1]))
+	for i := 0; ; i++ {
+		conn := network.GetConn(one, other)
+		if conn != nil && conn.Up {
+			t.Logf("up after %d", i)
+			break
+		}
+		if i == 300 {
+			t.Fatalf("nodes not connected after changing the link %v", conn)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func startTestNetwork(t *testing.T, client *Client) []string {
 	// create two nodes
 	nodeCount := 2
@@ -27,6 +27,7 @@ import (
 	"github.com/groshproject/grosh-core/log"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/simulations/adapters"
+	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
 )
 
 //a map of mocker names to its function
@@ -34,6 +35,7 @@ var mockerList = map[string]func(net *Network, quit chan struct{}, nodeCount int
 	"startStop":     startStop,
 	"probabilistic": probabilistic,
 	"boot":          boot,
+	"degraded":      degraded,
 }
 
 //Lookup a mocker by its name, returns the mockerFn
@@ -168,6 +170,54 @@ func probabilistic(net *Network, quit chan struct{}, nodeCount int) {
 
 }
 
+//The degraded mocker connects the nodes in a ring, degrades all links of the ring
+//and then periodically changes the latency, loss and bandwidth of random links.
+//It needs a node adapter which supports link shaping
+func degraded(net *Network, quit chan struct{}, nodeCount int) {
+	nodes, err := connectNodesInRing(net, nodeCount)
+	if err != nil {
+		panic("Could not startup node network for mocker")
+	}
+	for i := range nodes {
+		if err := net.SetLink(nodes[i], nodes[(i+1)%len(nodes)], randomLinkConfig()); err != nil {
+			log.Error("error changing link", "err", err)
+			return
+		}
+	}
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-quit:
+			log.Info("Terminating simulation loop")
+			return
+		case <-tick.C:
+			i := rand.Intn(len(nodes))
+			one, other := nodes[i], nodes[(i+1)%len(nodes)]
+			cfg := randomLinkConfig()
+			log.Debug("changing link", "one", one, "other", other, "latency", cfg.Latency, "loss", cfg.Loss, "bandwidth", cfg.Bandwidth)
+			if err := net.SetLink(one, other, cfg); err != nil {
+				log.Error("error changing link", "err", err)
+				return
+			}
+		}
+	}
+}
+
+//randomLinkConfig returns a link configuration ranging from a perfect link to
+//a slow and lossy one
+func randomLinkConfig() pipes.LinkConfig {
+	bandwidths := []uint64{0, 10 * 1024 * 1024, 1024 * 1024, 128 * 1024}
+	latency := time.Duration(rand.Intn(300)) * time.Millisecond
+	return pipes.LinkConfig{
+		Latency:   latency,
+		Jitter:    latency / 5,
+		Loss:      float64(rand.Intn(10)) / 100,
+		Bandwidth: bandwidths[rand.Intn(len(bandwidths))],
+		Seed:      rand.Int63(),
+	}
+}
+
 //connect nodeCount number of nodes in a ring
 func connectNodesInRing(net *Network, nodeCount int) ([]enode.ID, error) {
 	ids := make([]enode.ID, nodeCount)
@@ -32,6 +32,7 @@ import (
 	"github.com/groshproject/grosh-core/p2p"
 	"github.com/groshproject/grosh-core/p2p/enode"
 	"github.com/groshproject/grosh-core/p2p/simulations/adapters"
+	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
 )
 
 var DialBanTimeout = 200 * time.Millisecond
@@ -334,6 +335,41 @@ func (net *Network) Disconnect(oneID, otherID enode.ID) error {
 	return client.Call(nil, "admin_removePeer", string(conn.other.Addr()))
 }
 
+// SetLink configures the simulated network link between two nodes. It applies to
+// existing and future connections between the nodes. The node adapter must
+// implement adapters.LinkShaper.
+func (net *Network) SetLink(oneID, otherID enode.ID, cfg pipes.LinkConfig) error {
+	shaper, ok := net.nodeAdapter.(adapters.LinkShaper)
+	if !ok {
+		return fmt.Errorf("adapter %s does not support link shaping", net.nodeAdapter.Name())
+	}
+	if net.GetNode(oneID) == nil {
+		return fmt.Errorf("node %v does not exist", oneID)
+	}
+	if net.GetNode(otherID) == nil {
+		return fmt.Errorf("node %v does not exist", otherID)
+	}
+	if cfg.Loss < 0 || cfg.Loss > 1 {
+		return fmt.Errorf("invalid loss probability %v", cfg.Loss)
+	}
+	if cfg.Latency < 0 || cfg.Jitter < 0 {
+		return fmt.Errorf("negative latency or jitter")
+	}
+	shaper.SetLink(oneID, otherID, cfg)
+	return nil
+}
+
+// GetLink returns the configuration of the link between two nodes. Links which
+// have not been configured are perfect links.
+func (net *Network) GetLink(oneID, otherID enode.ID) (pipes.LinkConfig, error) {
+	shaper, ok := net.nodeAdapter.(adapters.LinkShaper)
+	if !ok {
+		return pipes.LinkConfig{}, fmt.Errorf("adapter %s does not support link shaping", net.nodeAdapter.Name())
+	}
+	cfg, _ := shaper.Link(oneID, otherID)
+	return cfg, nil
+}
+
 // DidConnect tracks the fact that the "one" node connected to the "other" node
 func (net *Network) DidConnect(one, other enode.ID) error {
 	net.lock.Lock()
@@ -0,0 +1,349 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package pipes
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/groshproject/grosh-core/common/mclock"
+)
+
+const (
+	// minRetransmitDelay is the minimum delay added to a lost segment. Connections
+	// are reliable streams, so packet loss shows up as the retransmission delay of TCP.
+	minRetransmitDelay = 200 * time.Millisecond
+
+	// lingerTimeout bounds the time spent delivering data written before Close
+	// to a peer which doesn't read it.
+	lingerTimeout = 5 * time.Second
+)
+
+var errLinkClosed = errors.New("link connection closed")
+
+// timeoutError is returned by writes which exceed the write deadline.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// LinkConfig describes the properties of a simulated network link. The zero value
+// is a perfect link.
+type LinkConfig struct {
+	Latency   time.Duration `json:"latency"`   // One-way delay of each write
+	Jitter    time.Duration `json:"jitter"`    // Maximum random delay added to Latency
+	Loss      float64       `json:"loss"`      // Probability that a write needs to be retransmitted
+	Bandwidth uint64        `json:"bandwidth"` // Throughput in bytes per second, zero is unlimited
+	Seed      int64         `json:"seed"`      // Seed for jitter and loss, for deterministic runs
+}
+
+// Link is a simulated network link. Connections wrapped by the link delay their
+// writes according to its configuration. The configuration can be changed while
+// connections are open, and the change applies to all subsequent writes.
+type Link struct {
+	clock mclock.Clock
+
+	mu   sync.Mutex
+	cfg  LinkConfig
+	rand *rand.Rand
+}
+
+// NewLink creates a link with the given configuration.
+func NewLink(cfg LinkConfig) *Link {
+	return NewLinkWithClock(cfg, mclock.System{})
+}
+
+// NewLinkWithClock creates a link which delays writes according to the given clock.
+// With a simulated clock, the timing of all writes is deterministic.
+func NewLinkWithClock(cfg LinkConfig, clock mclock.Clock) *Link {
+	return &Link{clock: clock, cfg: cfg, rand: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Config returns the current configuration of the link.
+func (l *Link) Config() LinkConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
+
+// SetConfig changes the configuration of the link. The random source is reseeded.
+func (l *Link) SetConfig(cfg LinkConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	l.rand = rand.New(rand.NewSource(cfg.Seed))
+}
+
+// sample returns the transmission time and the propagation delay of a write.
+func (l *Link) sample(size int) (tx, delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.Bandwidth > 0 {
+		tx = time.Duration(uint64(size) * uint64(time.Second) / l.cfg.Bandwidth)
+	}
+	delay = l.cfg.Latency
+	if l.cfg.Jitter > 0 {
+		delay += time.Duration(l.rand.Int63n(int64(l.cfg.Jitter) + 1))
+	}
+	if l.cfg.Loss > 0 && l.rand.Float64() < l.cfg.Loss {
+		retransmit := 2 * l.cfg.Latency
+		if retransmit < minRetransmitDelay {
+			retransmit = minRetransmitDelay
+		}
+		delay += retransmit
+	}
+	return tx, delay
+}
+
+// wait blocks until the link's clock reaches the given time. It returns false if
+// the wait was aborted by closing one of the abort channels, which may be nil.
+func (l *Link) wait(until mclock.AbsTime, abort1, abort2 <-chan struct{}) bool {
+	d := time.Duration(until - l.clock.Now())
+	if d <= 0 {
+		return true
+	}
+	reached := make(chan struct{})
+	ev := l.clock.AfterFunc(d, func() { close(reached) })
+	defer ev.Cancel()
+
+	select {
+	case <-reached:
+		return true
+	case <-abort1:
+		return false
+	case <-abort2:
+		return false
+	}
+}
+
+// Wrap returns a connection which sends its writes through the link. Reads are not
+// affected, so both ends of a connection need to be wrapped to shape both directions.
+func (l *Link) Wrap(c net.Conn) net.Conn {
+	sc := &linkConn{
+		Conn:    c,
+		link:    l,
+		queue:   make(chan segment, 64),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go sc.loop()
+	return sc
+}
+
+// Pipe wraps a pipe function so that both ends of the pipe are shaped by the link.
+func (l *Link) Pipe(pipe func() (net.Conn, net.Conn, error)) func() (net.Conn, net.Conn, error) {
+	return func() (net.Conn, net.Conn, error) {
+		c1, c2, err := pipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		return l.Wrap(c1), l.Wrap(c2), nil
+	}
+}
+
+type segment struct {
+	data    []byte
+	deliver mclock.AbsTime
+}
+
+// linkConn delays writes to the underlying connection. Writes block for the
+// transmission time of the data and are then delivered by a background goroutine
+// after the propagation delay. Data is delivered in order.
+type linkConn struct {
+	net.Conn
+	link *Link
+
+	wmu         sync.Mutex     // serializes writes
+	nextSend    mclock.AbsTime // time at which the link is free for the next write
+	lastDeliver mclock.AbsTime // delivery time of the previous write
+
+	deadlineMu    sync.Mutex
+	writeDeadline time.Time
+
+	queue     chan segment
+	closing   chan struct{} // closed by Close
+	done      chan struct{} // closed when the delivery loop exits
+	closeOnce sync.Once
+
+	errMu sync.Mutex
+	err   error // write error of the delivery loop
+}
+
+// Write queues the data for delivery after blocking for its transmission time. It
+// fails with a timeout error if the write deadline passes before the data is queued.
+func (c *linkConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.writeErr(); err != nil {
+		return 0, err
+	}
+	select {
+	case <-c.closing:
+		return 0, errLinkClosed
+	default:
+	}
+	expired, stop := c.deadlineTimer()
+	defer stop()
+	select {
+	case <-expired:
+		return 0, timeoutError{}
+	default:
+	}
+
+	tx, delay := c.link.sample(len(b))
+	now := c.link.clock.Now()
+	nextSend := c.nextSend
+	if nextSend < now {
+		nextSend = now
+	}
+	nextSend = nextSend.Add(tx)
+	deliver := nextSend.Add(delay)
+	if deliver < c.lastDeliver {
+		deliver = c.lastDeliver
+	}
+
+	// Block while the data is being transmitted.
+	if !c.link.wait(nextSend, c.closing, expired) {
+		select {
+		case <-c.closing:
+			return 0, errLinkClosed
+		default:
+			return 0, timeoutError{}
+		}
+	}
+	seg := segment{data: append([]byte(nil), b...), deliver: deliver}
+	select {
+	case c.queue <- seg:
+		c.nextSend, c.lastDeliver = nextSend, deliver
+		return len(b), nil
+	case <-expired:
+		return 0, timeoutError{}
+	case <-c.closing:
+		return 0, errLinkClosed
+	case <-c.done:
+		if err := c.writeErr(); err != nil {
+			return 0, err
+		}
+		return 0, errLinkClosed
+	}
+}
+
+// deadlineTimer returns a channel which is closed when the write deadline passes,
+// and a function releasing the timer.
+func (c *linkConn) deadlineTimer() (<-chan struct{}, func()) {
+	c.deadlineMu.Lock()
+	deadline := c.writeDeadline
+	c.deadlineMu.Unlock()
+
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+	expired := make(chan struct{})
+	timer := time.AfterFunc(time.Until(deadline), func() { close(expired) })
+	return expired, func() { timer.Stop() }
+}
+
+// SetWriteDeadline sets the deadline for queueing writes. It doesn't apply to the
+// delivery of queued data.
+func (c *linkConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// SetDeadline sets the read deadline of the underlying connection and the write
+// deadline of the link.
+func (c *linkConn) SetDeadline(t time.Time) error {
+	c.SetWriteDeadline(t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+// loop delivers queued data. After Close, it delivers the data written before and
+// exits once the queue is empty.
+func (c *linkConn) loop() {
+	defer close(c.done)
+
+	closing := false
+	for {
+		var seg segment
+		select {
+		case seg = <-c.queue:
+		case <-c.closing:
+			closing = true
+			select {
+			case seg = <-c.queue:
+			default:
+				return
+			}
+		}
+		c.link.wait(seg.deliver, nil, nil)
+		if closing {
+			c.Conn.SetWriteDeadline(time.Now().Add(lingerTimeout))
+		}
+		if _, err := c.Conn.Write(seg.data); err != nil {
+			c.errMu.Lock()
+			c.err = err
+			c.errMu.Unlock()
+			return
+		}
+	}
+}
+
+func (c *linkConn) writeErr() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// Read reads from the underlying connection. Reads fail once the connection is
+// closed, even while written data is still being delivered.
+func (c *linkConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		select {
+		case <-c.closing:
+			err = errLinkClosed
+		default:
+		}
+	}
+	return n, err
+}
+
+// Close closes the connection. Like a TCP socket, data which was written before
+// Close is still delivered, the underlying connection is closed afterwards.
+func (c *linkConn) Close() error {
+	err := errLinkClosed
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		// Unblock pending reads, the connection is closed for the local end.
+		// Delivery of the written data is bounded by the linger timeout.
+		c.Conn.SetReadDeadline(time.Now())
+		c.Conn.SetWriteDeadline(time.Now().Add(lingerTimeout))
+		go func() {
+			<-c.done
+			c.Conn.Close()
+		}()
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/common/mclock"
+)
+
+// newSimPipe creates a pipe shaped by a link which uses a simulated clock.
+func newSimPipe(t *testing.T, cfg LinkConfig) (*mclock.Simulated, net.Conn, net.Conn) {
+	clock := new(mclock.Simulated)
+	c1, c2, err := NewLinkWithClock(cfg, clock).Pipe(NetPipe)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clock, c1, c2
+}
+
+// readAsync reads n bytes from c in the background.
+func readAsync(c net.Conn, n int) <-chan []byte {
+	ch := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(c, buf); err != nil {
+			buf = nil
+		}
+		ch <- buf
+	}()
+	return ch
+}
+
+// expectDelivery checks that data written to a shaped pipe arrives exactly after
+// the given delay of the simulated clock.
+func expectDelivery(t *testing.T, clock *mclock.Simulated, received <-chan []byte, data []byte, delay time.Duration) {
+	t.Helper()
+	clock.WaitForTimers(1)
+	clock.Run(delay - time.Millisecond)
+	if clock.ActiveTimers() == 0 {
+		t.Fatalf("data delivered before %v", delay)
+	}
+	clock.Run(time.Millisecond)
+	select {
+	case buf := <-received:
+		if !bytes.Equal(buf, data) {
+			t.Fatalf("data mismatch: %q", buf)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("data not delivered after %v", delay)
+	}
+}
+
+func TestLinkLatency(t *testing.T) {
+	clock, c1, c2 := newSimPipe(t, LinkConfig{Latency: 50 * time.Millisecond})
+	defer c1.Close()
+	defer c2.Close()
+
+	received := readAsync(c2, 5)
+	if _, err := c1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	expectDelivery(t, clock, received, []byte("hello"), 50*time.Millisecond)
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	clock, c1, c2 := newSimPipe(t, LinkConfig{Bandwidth: 100 * 1024})
+	defer c1.Close()
+	defer c2.Close()
+
+	// The write blocks for the transmission time, 10KB at 100KB/s.
+	data := make([]byte, 10*1024)
+	received := readAsync(c2, len(data))
+	go c1.Write(data)
+	expectDelivery(t, clock, received, data, 100*time.Millisecond)
+}
+
+func TestLinkLoss(t *testing.T) {
+	clock, c1, c2 := newSimPipe(t, LinkConfig{Loss: 1})
+	defer c1.Close()
+	defer c2.Close()
+
+	received := readAsync(c2, 5)
+	if _, err := c1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	expectDelivery(t, clock, received, []byte("hello"), minRetransmitDelay)
+}
+
+func TestLinkOrder(t *testing.T) {
+	link := NewLink(LinkConfig{Latency: 5 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	c1, c2, _ := link.Pipe(NetPipe)()
+	defer c1.Close()
+	defer c2.Close()
+
+	go func() {
+		for i := 0; i < 20; i++ {
+			c1.Write([]byte{byte(i)})
+		}
+	}()
+	buf := make([]byte, 20)
+	if _, err := io.ReadFull(c2, buf); err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range buf {
+		if int(b) != i {
+			t.Fatalf("data reordered: %v", buf)
+		}
+	}
+}
+
+func TestLinkDeterministic(t *testing.T) {
+	cfg := LinkConfig{Latency: time.Millisecond, Jitter: time.Second, Loss: 0.5, Seed: 42}
+	l1, l2 := NewLink(cfg), NewLink(cfg)
+	for i := 0; i < 100; i++ {
+		_, d1 := l1.sample(100)
+		_, d2 := l2.sample(100)
+		if d1 != d2 {
+			t.Fatalf("sample %d differs: %v != %v", i, d1, d2)
+		}
+	}
+}
+
+func TestLinkClose(t *testing.T) {
+	clock, c1, c2 := newSimPipe(t, LinkConfig{Latency: time.Hour})
+	defer c2.Close()
+
+	// Data written before Close is still delivered, then the connection is closed.
+	received := readAsync(c2, 7)
+	if _, err := c1.Write([]byte("pending")); err != nil {
+		t.Fatal(err)
+	}
+	c1.Close()
+	if _, err := c1.Write([]byte("after close")); err == nil {
+		t.Fatal("write after close succeeded")
+	}
+	if _, err := c1.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read after close succeeded")
+	}
+	expectDelivery(t, clock, received, []byte("pending"), time.Hour)
+	if _, err := c2.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("wrong read error after delivery: %v", err)
+	}
+}
+
+func TestLinkWriteDeadline(t *testing.T) {
+	_, c1, c2 := newSimPipe(t, LinkConfig{Bandwidth: 1024})
+	defer c1.Close()
+	defer c2.Close()
+
+	// The clock doesn't move, so the write can't finish before the deadline.
+	c1.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := c1.Write(make([]byte, 10*1024))
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	// Expired deadlines fail immediately.
+	if _, err := c1.Write([]byte("x")); err == nil {
+		t.Fatal("write after deadline succeeded")
+	}
+}
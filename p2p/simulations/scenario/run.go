@@ -0,0 +1,441 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package scenario
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/groshproject/grosh-core/common/hexutil"
+	"github.com/groshproject/grosh-core/crypto"
+	"github.com/groshproject/grosh-core/log"
+	"github.com/groshproject/grosh-core/p2p/enode"
+	"github.com/groshproject/grosh-core/p2p/simulations"
+	"github.com/groshproject/grosh-core/p2p/simulations/adapters"
+)
+
+// checkInterval is the delay between attempts of checks with a 'within' duration.
+const checkInterval = 100 * time.Millisecond
+
+// Report is the outcome of running a scenario.
+type Report struct {
+	Name     string    `json:"name"`
+	Start    time.Time `json:"start"`
+	Duration Duration  `json:"duration"`
+	Results  []Result  `json:"results"`
+
+	// Error is set when the scenario was aborted because setup or an event failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name    string   `json:"name"`
+	At      Duration `json:"at"`
+	Passed  bool     `json:"passed"`
+	Elapsed Duration `json:"elapsed"` // time from scheduled start until the check passed
+	Error   string   `json:"error,omitempty"`
+}
+
+// Failed returns the number of failed checks.
+func (r *Report) Failed() int {
+	count := 0
+	for _, res := range r.Results {
+		if !res.Passed {
+			count++
+		}
+	}
+	return count
+}
+
+// Write prints the report in text form.
+func (r *Report) Write(w io.Writer) {
+	for _, res := range r.Results {
+		if res.Passed {
+			fmt.Fprintf(w, "-- OK %s (at %v, took %v)\n", res.Name, time.Duration(res.At), time.Duration(res.Elapsed))
+		} else {
+			fmt.Fprintf(w, "-- FAIL %s (at %v): %s\n", res.Name, time.Duration(res.At), res.Error)
+		}
+	}
+	if r.Error != "" {
+		fmt.Fprintf(w, "scenario %q aborted: %s\n", r.Name, r.Error)
+	}
+	fmt.Fprintf(w, "%d/%d checks passed in %v\n", len(r.Results)-r.Failed(), len(r.Results), time.Duration(r.Duration))
+}
+
+// Run executes the scenario against the simulation network behind the given client.
+// The returned report is always non-nil. An error is returned if the scenario could
+// not be completed, failing checks are only recorded in the report.
+func Run(ctx context.Context, client *simulations.Client, s *Scenario) (*Report, error) {
+	r := &runner{
+		client: client,
+		s:      s,
+		report: &Report{Name: s.Name, Start: time.Now()},
+	}
+	err := r.run(ctx)
+	r.report.Duration = Duration(time.Since(r.report.Start))
+	if err != nil {
+		r.report.Error = err.Error()
+	}
+	return r.report, err
+}
+
+type runner struct {
+	client *simulations.Client
+	s      *Scenario
+	report *Report
+
+	names       map[enode.ID]string // node names by ID
+	partitioned [][2]string         // connections dropped by partitions
+}
+
+// step is an event or check on the timeline.
+type step struct {
+	at    time.Duration
+	event *Event
+	check int // index of check, -1 for events
+}
+
+func (r *runner) run(ctx context.Context) error {
+	if err := r.setup(); err != nil {
+		return fmt.Errorf("setup failed: %v", err)
+	}
+
+	// Build the timeline. Events are ordered before checks which are scheduled
+	// at the same time.
+	steps := make([]step, 0, len(r.s.Events)+len(r.s.Checks))
+	for i := range r.s.Events {
+		steps = append(steps, step{at: time.Duration(r.s.Events[i].At), event: &r.s.Events[i], check: -1})
+	}
+	for i := range r.s.Checks {
+		steps = append(steps, step{at: time.Duration(r.s.Checks[i].At), check: i})
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].at < steps[j].at })
+
+	// Run the timeline. Checks run concurrently so a check which waits for its
+	// condition doesn't delay later events.
+	var (
+		wg      sync.WaitGroup
+		results = make([]Result, len(r.s.Checks))
+		start   = time.Now()
+		err     error
+	)
+	for _, st := range steps {
+		if err = sleepUntil(ctx, start.Add(st.at)); err != nil {
+			break
+		}
+		if st.event != nil {
+			log.Info("Scenario event", "at", st.at, "action", st.event.Action, "nodes", st.event.Nodes)
+			if err = r.apply(st.event); err != nil {
+				err = fmt.Errorf("%s at %v failed: %v", st.event.Action, st.at, err)
+				break
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = r.runCheck(ctx, &r.s.Checks[i])
+		}(st.check)
+	}
+	wg.Wait()
+
+	// Only checks which were started are reported.
+	for i, res := range results {
+		if res.Name != "" {
+			r.report.Results = append(r.report.Results, results[i])
+		}
+	}
+	return err
+}
+
+// setup creates the nodes of the scenario.
+func (r *runner) setup() error {
+	if r.s.Reset {
+		if err := r.client.StopNetwork(); err != nil {
+			return err
+		}
+		if err := r.client.ResetNetwork(); err != nil {
+			return err
+		}
+	}
+	if r.s.Snapshot != "" {
+		data, err := ioutil.ReadFile(r.s.Snapshot)
+		if err != nil {
+			return err
+		}
+		snap := new(simulations.Snapshot)
+		if err := json.Unmarshal(data, snap); err != nil {
+			return fmt.Errorf("invalid snapshot: %v", err)
+		}
+		if err := r.client.LoadSnapshot(snap); err != nil {
+			return err
+		}
+	}
+	for _, spec := range r.s.Nodes {
+		config := adapters.RandomNodeConfig()
+		config.Name = spec.Name
+		config.Services = spec.Services
+		if spec.Key != "" {
+			key, err := crypto.HexToECDSA(spec.Key)
+			if err != nil {
+				return fmt.Errorf("node %q: invalid key: %v", spec.Name, err)
+			}
+			config.ID = enode.PubkeyToIDV4(&key.PublicKey)
+			config.PrivateKey = key
+		}
+		if _, err := r.client.CreateNode(config); err != nil {
+			return fmt.Errorf("can't create node %q: %v", spec.Name, err)
+		}
+		if !spec.Down {
+			if err := r.client.StartNode(spec.Name); err != nil {
+				return fmt.Errorf("can't start node %q: %v", spec.Name, err)
+			}
+		}
+	}
+
+	// Resolve all node references.
+	nodes, err := r.client.GetNodes()
+	if err != nil {
+		return err
+	}
+	r.names = make(map[enode.ID]string, len(nodes))
+	known := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		var id enode.ID
+		if err := id.UnmarshalText([]byte(n.ID)); err != nil {
+			return err
+		}
+		r.names[id] = n.Name
+		known[n.Name] = true
+	}
+	for _, ev := range r.s.Events {
+		refs := ev.Nodes
+		for _, g := range ev.Groups {
+			refs = append(refs[:len(refs):len(refs)], g...)
+		}
+		for _, name := range refs {
+			if !known[name] {
+				return fmt.Errorf("%s event references unknown node %q", ev.Action, name)
+			}
+		}
+	}
+	for _, c := range r.s.Checks {
+		if !known[c.Node] {
+			return fmt.Errorf("check %s references unknown node %q", c.name(), c.Node)
+		}
+	}
+	return nil
+}
+
+// apply executes an event.
+func (r *runner) apply(ev *Event) error {
+	switch ev.Action {
+	case ActionStart:
+		for _, n := range ev.Nodes {
+			if err := r.client.StartNode(n); err != nil {
+				return err
+			}
+		}
+	case ActionStop:
+		for _, n := range ev.Nodes {
+			if err := r.client.StopNode(n); err != nil {
+				return err
+			}
+		}
+	case ActionConnect:
+		for _, other := range ev.Nodes[1:] {
+			if err := r.client.ConnectNode(ev.Nodes[0], other); err != nil {
+				return err
+			}
+		}
+	case ActionDisconnect:
+		for _, other := range ev.Nodes[1:] {
+			if err := r.client.DisconnectNode(ev.Nodes[0], other); err != nil {
+				return err
+			}
+		}
+	case ActionLink:
+		return r.client.SetLink(ev.Nodes[0], ev.Nodes[1], *ev.Link)
+	case ActionPartition:
+		return r.partition(ev.Groups)
+	case ActionHeal:
+		return r.heal()
+	}
+	return nil
+}
+
+// partition drops all connections between nodes in different groups. Nodes which
+// are not listed in any group form one additional group.
+func (r *runner) partition(groups [][]string) error {
+	group := make(map[string]int)
+	for i, g := range groups {
+		for _, n := range g {
+			group[n] = i + 1
+		}
+	}
+	network, err := r.client.GetNetwork()
+	if err != nil {
+		return err
+	}
+	for _, conn := range network.Conns {
+		one, other := r.names[conn.One], r.names[conn.Other]
+		if !conn.Up || group[one] == group[other] {
+			continue
+		}
+		if err := r.client.DisconnectNode(one, other); err != nil {
+			return err
+		}
+		r.partitioned = append(r.partitioned, [2]string{one, other})
+	}
+	return nil
+}
+
+// heal restores the connections dropped by partitions. Note that nodes keep recently
+// dialed peers in their dial history, so the connections are re-established after the
+// usual redial delay rather than immediately.
+func (r *runner) heal() error {
+	network, err := r.client.GetNetwork()
+	if err != nil {
+		return err
+	}
+	up := make(map[[2]string]bool)
+	for _, conn := range network.Conns {
+		if conn.Up {
+			one, other := r.names[conn.One], r.names[conn.Other]
+			up[[2]string{one, other}] = true
+			up[[2]string{other, one}] = true
+		}
+	}
+	for _, pair := range r.partitioned {
+		if up[pair] {
+			continue
+		}
+		if err := r.client.ConnectNode(pair[0], pair[1]); err != nil {
+			return err
+		}
+		up[pair] = true
+		up[[2]string{pair[1], pair[0]}] = true
+	}
+	r.partitioned = nil
+	return nil
+}
+
+// runCheck evaluates a check, retrying until it passes or its 'within' duration
+// has elapsed.
+func (r *runner) runCheck(ctx context.Context, c *Check) Result {
+	var (
+		res      = Result{Name: c.name(), At: c.At}
+		start    = time.Now()
+		deadline = start.Add(time.Duration(c.Within))
+	)
+	for {
+		err := r.evalCheck(ctx, c)
+		if err == nil {
+			res.Passed = true
+			res.Elapsed = Duration(time.Since(start))
+			return res
+		}
+		if time.Now().Add(checkInterval).After(deadline) {
+			res.Error = err.Error()
+			return res
+		}
+		if sleepUntil(ctx, time.Now().Add(checkInterval)) != nil {
+			res.Error = err.Error()
+			return res
+		}
+	}
+}
+
+func (r *runner) evalCheck(ctx context.Context, c *Check) error {
+	client, err := r.client.RPCClient(ctx, c.Node)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var result json.RawMessage
+	if err := client.CallContext(ctx, &result, c.Method, c.Params...); err != nil {
+		return err
+	}
+	var got interface{}
+	if err := json.Unmarshal(result, &got); err != nil {
+		return err
+	}
+	if len(c.Expect) > 0 {
+		var want interface{}
+		if err := json.Unmarshal(c.Expect, &want); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("got %s, want %s", result, c.Expect)
+		}
+	}
+	if c.Min != nil || c.Max != nil {
+		v, err := checkValue(got)
+		if err != nil {
+			return err
+		}
+		if c.Min != nil && v < *c.Min {
+			return fmt.Errorf("value %v below minimum %v", v, *c.Min)
+		}
+		if c.Max != nil && v > *c.Max {
+			return fmt.Errorf("value %v above maximum %v", v, *c.Max)
+		}
+	}
+	return nil
+}
+
+// checkValue converts an RPC result to a number for min/max comparison.
+func checkValue(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := hexutil.DecodeBig(v)
+		if err != nil {
+			return 0, fmt.Errorf("result %q is not a number", v)
+		}
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	default:
+		return 0, fmt.Errorf("can't compare result of type %T", v)
+	}
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package scenario implements declarative experiments for simulation networks.
+//
+// A scenario describes the nodes of a network, a timeline of events such as
+// connecting, disconnecting and partitioning nodes, and checks on the RPC-observable
+// state of nodes at given times. Scenarios are executed against the HTTP API of a
+// simulation network and produce a pass/fail report.
+//
+// Scenarios are written in JSON:
+//
+//	{
+//	  "name": "partition heals",
+//	  "reset": true,
+//	  "nodes": [
+//	    {"name": "a", "services": ["ping"]},
+//	    {"name": "b", "services": ["ping"]}
+//	  ],
+//	  "events": [
+//	    {"at": "0s", "action": "connect", "nodes": ["a", "b"]},
+//	    {"at": "5s", "action": "partition", "groups": [["a"], ["b"]]},
+//	    {"at": "10s", "action": "heal"}
+//	  ],
+//	  "checks": [
+//	    {"at": "1s", "node": "a", "method": "admin_peers", "min": 1, "within": "2s"},
+//	    {"at": "6s", "node": "a", "method": "admin_peers", "max": 0, "within": "2s"}
+//	  ]
+//	}
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/groshproject/grosh-core/p2p/simulations/pipes"
+)
+
+// Event actions.
+const (
+	ActionStart      = "start"      // start the given nodes
+	ActionStop       = "stop"       // stop the given nodes
+	ActionConnect    = "connect"    // connect the first node to all other given nodes
+	ActionDisconnect = "disconnect" // disconnect the first node from all other given nodes
+	ActionPartition  = "partition"  // drop all connections between the given groups
+	ActionHeal       = "heal"       // restore connections dropped by partitions
+	ActionLink       = "link"       // configure the link between two nodes
+)
+
+// Scenario is a scripted experiment on a simulation network.
+type Scenario struct {
+	Name string `json:"name"`
+
+	// Reset stops and removes all existing nodes before the scenario is set up.
+	Reset bool `json:"reset,omitempty"`
+
+	// Snapshot is the path of a network snapshot which is loaded before the nodes
+	// are created. Relative paths are resolved against the scenario file.
+	Snapshot string `json:"snapshot,omitempty"`
+
+	Nodes  []NodeSpec `json:"nodes,omitempty"`
+	Events []Event    `json:"events,omitempty"`
+	Checks []Check    `json:"checks,omitempty"`
+}
+
+// NodeSpec describes a node which is created during setup.
+type NodeSpec struct {
+	Name     string   `json:"name"`
+	Services []string `json:"services,omitempty"`
+	Key      string   `json:"key,omitempty"`  // hex private key, random if empty
+	Down     bool     `json:"down,omitempty"` // don't start the node during setup
+}
+
+// Event is a change to the network at a point in time.
+type Event struct {
+	At     Duration          `json:"at"`
+	Action string            `json:"action"`
+	Nodes  []string          `json:"nodes,omitempty"`
+	Groups [][]string        `json:"groups,omitempty"`
+	Link   *pipes.LinkConfig `json:"link,omitempty"`
+}
+
+// Check is an assertion on the result of an RPC call at a point in time.
+//
+// Expect compares the result for equality. Min and Max bound the result, which
+// must be a number, a hex quantity, or an array or object. Arrays and objects are
+// compared by their length. If Within is set, the check is repeated until it passes
+// or the duration has elapsed.
+type Check struct {
+	At     Duration        `json:"at"`
+	Name   string          `json:"name,omitempty"`
+	Node   string          `json:"node"`
+	Method string          `json:"method"`
+	Params []interface{}   `json:"params,omitempty"`
+	Expect json.RawMessage `json:"expect,omitempty"`
+	Min    *float64        `json:"min,omitempty"`
+	Max    *float64        `json:"max,omitempty"`
+	Within Duration        `json:"within,omitempty"`
+}
+
+// Duration is a time.Duration which is encoded as a string like "1.5s" in JSON.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(input []byte) error {
+	var s string
+	if err := json.Unmarshal(input, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, want string like \"1s\"", input)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Load reads a scenario from a JSON file.
+func Load(file string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if s.Snapshot != "" && !filepath.IsAbs(s.Snapshot) {
+		s.Snapshot = filepath.Join(filepath.Dir(file), s.Snapshot)
+	}
+	return s, nil
+}
+
+// Parse decodes and validates a JSON scenario.
+func Parse(data []byte) (*Scenario, error) {
+	s := new(Scenario)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate checks the scenario for structural errors. References to nodes are
+// resolved when the scenario runs because nodes can also come from a snapshot.
+func (s *Scenario) Validate() error {
+	names := make(map[string]bool)
+	for i, n := range s.Nodes {
+		if n.Name == "" {
+			return fmt.Errorf("node %d has no name", i)
+		}
+		if names[n.Name] {
+			return fmt.Errorf("duplicate node name %q", n.Name)
+		}
+		names[n.Name] = true
+	}
+	for i, ev := range s.Events {
+		if err := ev.validate(); err != nil {
+			return fmt.Errorf("event %d (%s at %v): %v", i, ev.Action, time.Duration(ev.At), err)
+		}
+	}
+	for i, c := range s.Checks {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("check %d (%s): %v", i, c.name(), err)
+		}
+	}
+	return nil
+}
+
+func (ev *Event) validate() error {
+	if ev.At < 0 {
+		return errors.New("negative time")
+	}
+	switch ev.Action {
+	case ActionStart, ActionStop:
+		if len(ev.Nodes) == 0 {
+			return errors.New("no nodes given")
+		}
+	case ActionConnect, ActionDisconnect:
+		if len(ev.Nodes) < 2 {
+			return errors.New("need at least two nodes")
+		}
+	case ActionPartition:
+		if len(ev.Groups) == 0 {
+			return errors.New("no groups given")
+		}
+		seen := make(map[string]bool)
+		for _, g := range ev.Groups {
+			for _, n := range g {
+				if seen[n] {
+					return fmt.Errorf("node %q is in more than one group", n)
+				}
+				seen[n] = true
+			}
+		}
+	case ActionHeal:
+	case ActionLink:
+		if len(ev.Nodes) != 2 {
+			return errors.New("need exactly two nodes")
+		}
+		if ev.Link == nil {
+			return errors.New("no link config given")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", ev.Action)
+	}
+	return nil
+}
+
+func (c *Check) validate() error {
+	if c.At < 0 || c.Within < 0 {
+		return errors.New("negative time")
+	}
+	if c.Node == "" {
+		return errors.New("no node given")
+	}
+	if c.Method == "" {
+		return errors.New("no method given")
+	}
+	if len(c.Expect) == 0 && c.Min == nil && c.Max == nil {
+		return errors.New("need at least one of expect, min, max")
+	}
+	if len(c.Expect) > 0 && !json.Valid(c.Expect) {
+		return errors.New("invalid expected value")
+	}
+	return nil
+}
+
+// name returns the name of the check in reports.
+func (c *Check) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("%s@%s", c.Method, c.Node)
+}
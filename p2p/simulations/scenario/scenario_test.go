@@ -0,0 +1,243 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/groshproject/grosh-core/node"
+	"github.com/groshproject/grosh-core/p2p"
+	"github.com/groshproject/grosh-core/p2p/simulations"
+	"github.com/groshproject/grosh-core/p2p/simulations/adapters"
+	"github.com/groshproject/grosh-core/rpc"
+)
+
+// pingService is a service with a protocol that keeps peers connected.
+type pingService struct{}
+
+func (pingService) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    "ping",
+		Version: 1,
+		Length:  1,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			for {
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					return err
+				}
+				msg.Discard()
+			}
+		},
+	}}
+}
+
+func (pingService) APIs() []rpc.API                { return nil }
+func (pingService) Start(server *p2p.Server) error { return nil }
+func (pingService) Stop() error                    { return nil }
+
+func newTestNetwork(t *testing.T) (*simulations.Client, func()) {
+	services := adapters.Services{
+		"ping": func(ctx *adapters.ServiceContext) (node.Service, error) { return pingService{}, nil },
+	}
+	network := simulations.NewNetwork(adapters.NewSimAdapter(services), &simulations.NetworkConfig{
+		DefaultService: "ping",
+	})
+	server := httptest.NewServer(simulations.NewServer(network))
+	return simulations.NewClient(server.URL), func() {
+		server.Close()
+		network.Shutdown()
+	}
+}
+
+const testScenario = `{
+  "name": "partition",
+  "nodes": [
+    {"name": "a", "services": ["ping"]},
+    {"name": "b", "services": ["ping"]},
+    {"name": "c", "services": ["ping"]}
+  ],
+  "events": [
+    {"at": "0s", "action": "connect", "nodes": ["a", "b", "c"]},
+    {"at": "0s", "action": "connect", "nodes": ["b", "c"]},
+    {"at": "500ms", "action": "partition", "groups": [["a"]]},
+    {"at": "1s", "action": "heal"}
+  ],
+  "checks": [
+    {"at": "0s", "name": "connected", "node": "a", "method": "admin_peers", "min": 2, "max": 2, "within": "2s"},
+    {"at": "500ms", "name": "isolated", "node": "a", "method": "admin_peers", "max": 0, "within": "400ms"},
+    {"at": "500ms", "name": "others", "node": "b", "method": "admin_peers", "expect": [], "within": "400ms"},
+    {"at": "1s", "name": "healing", "node": "c", "method": "admin_peers", "min": 1}
+  ]
+}`
+
+func TestRun(t *testing.T) {
+	client, cleanup := newTestNetwork(t)
+	defer cleanup()
+
+	s, err := Parse([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(context.Background(), client, s)
+	if err != nil {
+		t.Fatal("scenario failed:", err)
+	}
+
+	var out bytes.Buffer
+	report.Write(&out)
+	t.Log("report:\n" + out.String())
+
+	// The "others" check expects an empty peer list for b, which is wrong because
+	// b and c stay connected during the partition.
+	want := map[string]bool{"connected": true, "isolated": true, "others": false, "healing": true}
+	if len(report.Results) != len(want) {
+		t.Fatalf("wrong number of results: %d", len(report.Results))
+	}
+	for _, res := range report.Results {
+		if res.Passed != want[res.Name] {
+			t.Errorf("check %q: passed=%v, want %v (error %q)", res.Name, res.Passed, want[res.Name], res.Error)
+		}
+	}
+	if report.Failed() != 1 {
+		t.Errorf("wrong failure count %d", report.Failed())
+	}
+	if !strings.Contains(out.String(), "3/4 checks passed") {
+		t.Error("report summary missing")
+	}
+
+	// The report must be encodable as JSON.
+	if _, err := json.Marshal(report); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunSnapshot(t *testing.T) {
+	client, cleanup := newTestNetwork(t)
+	defer func() { cleanup() }()
+
+	// Create a network and snapshot it.
+	s, err := Parse([]byte(`{
+	  "nodes": [{"name": "a"}, {"name": "b"}],
+	  "events": [{"at": "0s", "action": "connect", "nodes": ["a", "b"]}],
+	  "checks": [{"at": "0s", "node": "a", "method": "admin_peers", "min": 1, "within": "2s"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, err := Run(context.Background(), client, s); err != nil || report.Failed() > 0 {
+		t.Fatalf("setup scenario failed: %v", err)
+	}
+	snap, err := client.CreateSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "scenario-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	snapJSON, _ := json.Marshal(snap)
+	ioutil.WriteFile(filepath.Join(dir, "snap.json"), snapJSON, 0644)
+
+	// Replay the snapshot on a new network.
+	cleanup()
+	client, cleanup = newTestNetwork(t)
+	scenarioJSON := `{
+	  "snapshot": "snap.json",
+	  "checks": [{"at": "0s", "node": "b", "method": "admin_peers", "min": 1, "within": "5s"}]
+	}`
+	ioutil.WriteFile(filepath.Join(dir, "scenario.json"), []byte(scenarioJSON), 0644)
+	s, err = Load(filepath.Join(dir, "scenario.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(context.Background(), client, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed() > 0 {
+		t.Fatalf("replay check failed: %s", report.Results[0].Error)
+	}
+}
+
+func TestRunUnknownNode(t *testing.T) {
+	client, cleanup := newTestNetwork(t)
+	defer cleanup()
+
+	s, err := Parse([]byte(`{
+	  "nodes": [{"name": "a"}],
+	  "events": [{"at": "0s", "action": "stop", "nodes": ["x"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(context.Background(), client, s)
+	if err == nil || !strings.Contains(err.Error(), `unknown node "x"`) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if report.Error == "" {
+		t.Fatal("report has no error")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input, err string
+	}{
+		{`{"nodes": [{"name": "a"}, {"name": "a"}]}`, `duplicate node name "a"`},
+		{`{"events": [{"at": "1s", "action": "explode"}]}`, `unknown action "explode"`},
+		{`{"events": [{"at": "1s", "action": "connect", "nodes": ["a"]}]}`, "need at least two nodes"},
+		{`{"events": [{"at": 5, "action": "heal"}]}`, "invalid duration"},
+		{`{"events": [{"at": "0s", "action": "partition", "groups": [["a"], ["a"]]}]}`, "more than one group"},
+		{`{"checks": [{"at": "0s", "node": "a", "method": "admin_peers"}]}`, "need at least one of"},
+		{`{"chekcs": []}`, "unknown field"},
+	}
+	for _, test := range tests {
+		_, err := Parse([]byte(test.input))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("input %s: got error %v, want %q", test.input, err, test.err)
+		}
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	d := Duration(1500 * time.Millisecond)
+	enc, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(enc) != `"1.5s"` {
+		t.Fatalf("wrong encoding %s", enc)
+	}
+	var dec Duration
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec != d {
+		t.Fatalf("wrong decoded duration %v", time.Duration(dec))
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/groshproject/grosh-core/metrics"
+)
+
+// MsgTraffic is the number of protocol messages and payload bytes of one message
+// type exchanged with a peer. Sizes are measured before compression.
+type MsgTraffic struct {
+	Protocol       string `json:"protocol"`
+	Version        uint   `json:"version"`
+	Code           uint64 `json:"code"`
+	IngressPackets uint64 `json:"ingressPackets"`
+	IngressBytes   uint64 `json:"ingressBytes"`
+	EgressPackets  uint64 `json:"egressPackets"`
+	EgressBytes    uint64 `json:"egressBytes"`
+}
+
+// PeerTraffic is the message traffic of a connected peer, as returned by
+// admin_peerTraffic.
+type PeerTraffic struct {
+	ID       string       `json:"id"`
+	Inbound  bool         `json:"inbound"`
+	Messages []MsgTraffic `json:"messages"`
+}
+
+type trafficKey struct {
+	proto   string
+	version uint
+	code    uint64
+}
+
+// peerTraffic counts the protocol messages exchanged with a single peer. It also
+// marks the process-wide per-message meters, which are registered under the name
+//
+//	p2p/msg/<ingress|egress>/<inbound|outbound>/<protocol>/<version>/<code>
+//
+// for payload bytes and with a "/packets" suffix for the message count.
+type peerTraffic struct {
+	dir string // "inbound" or "outbound"
+
+	mu     sync.Mutex
+	msgs   map[trafficKey]*MsgTraffic
+	meters map[meterKey]msgMeters
+}
+
+// meterKey identifies the meters of a message type in one direction.
+type meterKey struct {
+	trafficKey
+	ingress bool
+}
+
+// msgMeters are the process-wide meters of a message type, resolved once per peer
+// to keep the registry lookups off the message path.
+type msgMeters struct {
+	bytes, packets metrics.Meter
+}
+
+func newPeerTraffic(inbound bool) *peerTraffic {
+	dir := "outbound"
+	if inbound {
+		dir = "inbound"
+	}
+	return &peerTraffic{
+		dir:    dir,
+		msgs:   make(map[trafficKey]*MsgTraffic),
+		meters: make(map[meterKey]msgMeters),
+	}
+}
+
+// mark records a message. The code is relative to the protocol offset.
+func (t *peerTraffic) mark(proto *Protocol, code uint64, size uint32, ingress bool) {
+	key := trafficKey{proto.Name, proto.Version, code}
+	t.mu.Lock()
+	m := t.msgs[key]
+	if m == nil {
+		m = &MsgTraffic{Protocol: proto.Name, Version: proto.Version, Code: code}
+		t.msgs[key] = m
+	}
+	if ingress {
+		m.IngressPackets++
+		m.IngressBytes += uint64(size)
+	} else {
+		m.EgressPackets++
+		m.EgressBytes += uint64(size)
+	}
+	var meters msgMeters
+	if metrics.Enabled {
+		mkey := meterKey{key, ingress}
+		if meters = t.meters[mkey]; meters.bytes == nil {
+			name := msgMeterName(ingress, t.dir, key)
+			meters.bytes = metrics.GetOrRegisterMeter(name, nil)
+			meters.packets = metrics.GetOrRegisterMeter(name+"/packets", nil)
+			t.meters[mkey] = meters
+		}
+	}
+	t.mu.Unlock()
+
+	if meters.bytes != nil {
+		meters.bytes.Mark(int64(size))
+		meters.packets.Mark(1)
+	}
+}
+
+func msgMeterName(ingress bool, dir string, key trafficKey) string {
+	traffic := "egress"
+	if ingress {
+		traffic = "ingress"
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%d/%#02x", MetricsMessages, traffic, dir, key.proto, key.version, key.code)
+}
+
+// list returns the counters ordered by protocol and message code.
+func (t *peerTraffic) list() []MsgTraffic {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]MsgTraffic, 0, len(t.msgs))
+	for _, m := range t.msgs {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Code < b.Code
+	})
+	return list
+}
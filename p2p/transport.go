@@ -0,0 +1,182 @@
+// Copyright 2015 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/groshproject/grosh-core/common/bitutil"
+	"github.com/groshproject/grosh-core/p2p/rlpx"
+	"github.com/groshproject/grosh-core/rlp"
+)
+
+const (
+	// total timeout for encryption handshake and protocol
+	// handshake in both directions.
+	handshakeTimeout = 5 * time.Second
+
+	// This is the timeout for sending the disconnect reason.
+	// This is shorter than the usual timeout because we don't want
+	// to wait if the connection is known to be bad anyway.
+	discWriteTimeout = 1 * time.Second
+)
+
+// rlpxTransport is the transport used by actual (non-test) connections.
+// It wraps an RLPx connection with locks and read/write deadlines.
+type rlpxTransport struct {
+	rmu, wmu sync.Mutex
+	conn     *rlpx.Conn
+	snappy   bool // set by the protocol handshake
+}
+
+func newRLPX(fd net.Conn) transport {
+	fd.SetDeadline(time.Now().Add(handshakeTimeout))
+	return &rlpxTransport{conn: rlpx.NewConn(fd)}
+}
+
+func (t *rlpxTransport) ReadMsg() (Msg, error) {
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	t.conn.SetReadDeadline(time.Now().Add(frameReadTimeout))
+	return t.readMsg()
+}
+
+func (t *rlpxTransport) WriteMsg(msg Msg) error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	t.conn.SetWriteDeadline(time.Now().Add(frameWriteTimeout))
+	return t.writeMsg(msg)
+}
+
+// readMsg reads a message without locking or touching the deadline.
+func (t *rlpxTransport) readMsg() (Msg, error) {
+	code, data, wireSize, err := t.conn.Read()
+	if err != nil {
+		return Msg{}, err
+	}
+	if t.snappy {
+		snappyIngressCompressedMeter.Mark(int64(wireSize))
+		snappyIngressRawMeter.Mark(int64(len(data)))
+	}
+	return Msg{Code: code, Size: uint32(len(data)), Payload: bytes.NewReader(data)}, nil
+}
+
+// writeMsg writes a message without locking or touching the deadline.
+func (t *rlpxTransport) writeMsg(msg Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	wireSize, err := t.conn.Write(msg.Code, payload)
+	if err == nil && t.snappy {
+		snappyEgressRawMeter.Mark(int64(len(payload)))
+		snappyEgressCompressedMeter.Mark(int64(wireSize))
+	}
+	return err
+}
+
+func (t *rlpxTransport) close(err error) {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	// Tell the remote end why we're disconnecting if possible. Before the
+	// encryption handshake, the write fails without touching the connection.
+	if r, ok := err.(DiscReason); ok && r != DiscNetworkError {
+		// rlpx tries to send DiscReason to disconnected peer
+		// if the connection is net.Pipe (in-memory simulation)
+		// it hangs forever, since net.Pipe does not implement
+		// a write deadline. Because of this only try to send
+		// the disconnect reason message if there is no error.
+		if err := t.conn.SetWriteDeadline(time.Now().Add(discWriteTimeout)); err == nil {
+			reason, _ := rlp.EncodeToBytes([]DiscReason{r})
+			t.conn.Write(discMsg, reason)
+		}
+	}
+	t.conn.Close()
+}
+
+// doEncHandshake runs the encryption handshake. The protocol handshake is the
+// first authenticated message and also verifies whether the encryption handshake
+// 'worked' and the remote side actually provided the right public key.
+func (t *rlpxTransport) doEncHandshake(prv *ecdsa.PrivateKey, dial *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
+	return t.conn.Handshake(prv, dial)
+}
+
+func (t *rlpxTransport) doProtoHandshake(our *protoHandshake) (their *protoHandshake, err error) {
+	// Writing our handshake happens concurrently, we prefer
+	// returning the handshake read error. If the remote side
+	// disconnects us early with a valid reason, we should return it
+	// as the error so it can be tracked elsewhere. The messages are
+	// exchanged under the deadline of the whole handshake.
+	rw := handshakeRW{t}
+	werr := make(chan error, 1)
+	go func() { werr <- Send(rw, handshakeMsg, our) }()
+	if their, err = readProtocolHandshake(rw); err != nil {
+		<-werr // make sure the write terminates too
+		return nil, err
+	}
+	if err := <-werr; err != nil {
+		return nil, fmt.Errorf("write error: %v", err)
+	}
+	// If both sides support Snappy encoding, upgrade immediately.
+	t.snappy = our.Version >= snappyProtocolVersion && their.Version >= snappyProtocolVersion
+	t.conn.SetSnappy(t.snappy)
+
+	return their, nil
+}
+
+// handshakeRW exchanges the protocol handshake messages without resetting the
+// deadline set for the whole handshake.
+type handshakeRW struct{ t *rlpxTransport }
+
+func (rw handshakeRW) ReadMsg() (Msg, error)  { return rw.t.readMsg() }
+func (rw handshakeRW) WriteMsg(msg Msg) error { return rw.t.writeMsg(msg) }
+
+func readProtocolHandshake(rw MsgReader) (*protoHandshake, error) {
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	if msg.Size > baseProtocolMaxMsgSize {
+		return nil, fmt.Errorf("message too big")
+	}
+	if msg.Code == discMsg {
+		// Disconnect before protocol handshake is valid according to the
+		// spec and we send it ourself if the post-handshake checks fail.
+		// We can't return the reason directly, though, because it is echoed
+		// back otherwise. Wrap it in a string instead.
+		var reason [1]DiscReason
+		rlp.Decode(msg.Payload, &reason)
+		return nil, reason[0]
+	}
+	if msg.Code != handshakeMsg {
+		return nil, fmt.Errorf("expected handshake, got %x", msg.Code)
+	}
+	var hs protoHandshake
+	if err := msg.Decode(&hs); err != nil {
+		return nil, err
+	}
+	if len(hs.ID) != 64 || !bitutil.TestBytes(hs.ID) {
+		return nil, DiscInvalidIdentity
+	}
+	return &hs, nil
+}
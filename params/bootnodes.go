@@ -74,7 +74,7 @@ var GoerliBootnodes = []string{
 }
 
 // DiscoveryV5Bootnodes are the enode URLs of the P2P bootstrap nodes for the
-// experimental RLPx v5 topic-discovery network.
+// discovery v5 network.
 var DiscoveryV5Bootnodes = []string{
 	"enode://5392f623ef84de17e96d1c0e70cb8def77de09454f62cab69f0049cae8e9d0c4f2677e00451d7f48caaefc04782baef142296e591eb4669dbe412ecbd2a2e5c7@10.10.254.113:30303",
 	"enode://36ea36f32830ed9d654c1de9695ac85187c3d94bad90d56cba0463b5e5bf1fe40dc7a8138292b7ef3e659c45e5730bbc097bdf464bf234a37e983e5a7fb2c9fd@10.10.254.113:30301",
@@ -0,0 +1,183 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// JWTSecretLength is the minimum length of a JWT shared secret in bytes.
+	JWTSecretLength = 32
+
+	// jwtMaxClockSkew is how far the issued-at time of a token may be away from
+	// the current time. Tokens are meant to be created for each request, so this
+	// also limits the time window for replaying a captured token.
+	jwtMaxClockSkew = 60 * time.Second
+)
+
+var (
+	errJWTMissing   = errors.New("missing token")
+	errJWTMalformed = errors.New("malformed token")
+	errJWTAlgorithm = errors.New("unsupported signing algorithm")
+	errJWTSignature = errors.New("invalid token signature")
+	errJWTIssuedAt  = errors.New("token issued-at time too far from current time")
+	errJWTExpired   = errors.New("token expired")
+
+	jwtEncoding = base64.RawURLEncoding
+	jwtHeader   = jwtEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+)
+
+type jwtClaims struct {
+	IssuedAt  *int64 `json:"iat"`
+	ExpiresAt *int64 `json:"exp,omitempty"`
+}
+
+// NewJWTToken creates a token for the given shared secret, signed with HS256. The
+// token contains the issued-at claim and is accepted by authenticated endpoints for
+// one minute around the issue time.
+func NewJWTToken(secret []byte, issued time.Time) string {
+	iat := issued.Unix()
+	claims, _ := json.Marshal(jwtClaims{IssuedAt: &iat})
+	payload := jwtHeader + "." + jwtEncoding.EncodeToString(claims)
+	return payload + "." + jwtEncoding.EncodeToString(jwtSign(secret, payload))
+}
+
+func jwtSign(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// verifyJWT checks the signature and claims of a token.
+func verifyJWT(secret []byte, token string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := jwtDecode(parts[0], &header); err != nil {
+		return err
+	}
+	if header.Alg != "HS256" {
+		return errJWTAlgorithm
+	}
+	sig, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errJWTMalformed
+	}
+	if !hmac.Equal(sig, jwtSign(secret, parts[0]+"."+parts[1])) {
+		return errJWTSignature
+	}
+	var claims jwtClaims
+	if err := jwtDecode(parts[1], &claims); err != nil {
+		return err
+	}
+	if claims.IssuedAt == nil {
+		return errJWTIssuedAt
+	}
+	if skew := now.Sub(time.Unix(*claims.IssuedAt, 0)); skew > jwtMaxClockSkew || skew < -jwtMaxClockSkew {
+		return errJWTIssuedAt
+	}
+	if claims.ExpiresAt != nil && !now.Before(time.Unix(*claims.ExpiresAt, 0)) {
+		return errJWTExpired
+	}
+	return nil
+}
+
+func jwtDecode(part string, v interface{}) error {
+	data, err := jwtEncoding.DecodeString(part)
+	if err != nil {
+		return errJWTMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errJWTMalformed
+	}
+	return nil
+}
+
+// jwtHandler is a handler which requires a valid bearer token in the Authorization
+// header of incoming requests. For websocket connections, only the handshake is
+// authenticated.
+type jwtHandler struct {
+	secret []byte
+	next   http.Handler
+	now    func() time.Time
+}
+
+func newJWTHandler(secret []byte, next http.Handler) http.Handler {
+	return &jwtHandler{secret: secret, next: next, now: time.Now}
+}
+
+// ServeHTTP checks the token and passes authenticated requests on.
+func (h *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := errJWTMissing
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		err = verifyJWT(h.secret, strings.TrimSpace(auth[7:]), h.now())
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// jwtTransport adds a fresh token to every outgoing HTTP request.
+type jwtTransport struct {
+	secret []byte
+	base   http.RoundTripper
+}
+
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+NewJWTToken(t.secret, time.Now()))
+	return t.base.RoundTrip(req)
+}
+
+// DialHTTPWithJWT creates a new RPC client that connects to an authenticated RPC
+// server over HTTP. A new token is created for every request.
+func DialHTTPWithJWT(endpoint string, secret []byte) (*Client, error) {
+	if len(secret) < JWTSecretLength {
+		return nil, fmt.Errorf("JWT secret too short, need at least %d bytes", JWTSecretLength)
+	}
+	client := &http.Client{Transport: &jwtTransport{secret, http.DefaultTransport}}
+	return DialHTTPWithClient(endpoint, client)
+}
+
+// DialWebsocketWithJWT creates a new RPC client that connects to an authenticated
+// RPC server over websocket. A new token is created whenever the client connects.
+func DialWebsocketWithJWT(ctx context.Context, endpoint, origin string, secret []byte) (*Client, error) {
+	if len(secret) < JWTSecretLength {
+		return nil, fmt.Errorf("JWT secret too short, need at least %d bytes", JWTSecretLength)
+	}
+	return dialWebsocket(ctx, endpoint, origin, func(h http.Header) {
+		h.Set("Authorization", "Bearer "+NewJWTToken(secret, time.Now()))
+	})
+}
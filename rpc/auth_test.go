@@ -0,0 +1,95 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	var (
+		secret = bytes.Repeat([]byte{1}, JWTSecretLength)
+		now    = time.Unix(1600000000, 0)
+		sign   = func(header, claims string) string {
+			payload := jwtEncoding.EncodeToString([]byte(header)) + "." + jwtEncoding.EncodeToString([]byte(claims))
+			return payload + "." + jwtEncoding.EncodeToString(jwtSign(secret, payload))
+		}
+		hs256 = `{"alg":"HS256","typ":"JWT"}`
+	)
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", NewJWTToken(secret, now), nil},
+		{"valid-skew", NewJWTToken(secret, now.Add(-59*time.Second)), nil},
+		{"old", NewJWTToken(secret, now.Add(-61*time.Second)), errJWTIssuedAt},
+		{"future", NewJWTToken(secret, now.Add(61*time.Second)), errJWTIssuedAt},
+		{"wrong-secret", NewJWTToken(make([]byte, JWTSecretLength), now), errJWTSignature},
+		{"no-iat", sign(hs256, `{}`), errJWTIssuedAt},
+		{"expired", sign(hs256, `{"iat":1600000000,"exp":1600000000}`), errJWTExpired},
+		{"not-expired", sign(hs256, `{"iat":1600000000,"exp":1600000001}`), nil},
+		{"alg-none", sign(`{"alg":"none"}`, `{"iat":1600000000}`), errJWTAlgorithm},
+		{"alg-rs256", sign(`{"alg":"RS256"}`, `{"iat":1600000000}`), errJWTAlgorithm},
+		{"two-parts", "a.b", errJWTMalformed},
+		{"bad-base64", "!!." + strings.SplitN(NewJWTToken(secret, now), ".", 2)[1], errJWTMalformed},
+	}
+	for _, test := range tests {
+		if err := verifyJWT(secret, test.token, now); err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestJWTHandler(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, JWTSecretLength)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := newJWTHandler(secret, ok)
+
+	tests := []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"Bearer " + NewJWTToken(secret, time.Now().Add(-time.Hour)), http.StatusUnauthorized},
+		{"Bearer " + NewJWTToken(secret, time.Now()), http.StatusOK},
+		{"bearer " + NewJWTToken(secret, time.Now()), http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("auth %q: got status %d, want %d", test.auth, rec.Code, test.code)
+		}
+	}
+}
+
+func TestDialWithJWTShortSecret(t *testing.T) {
+	if _, err := DialHTTPWithJWT("http://127.0.0.1:1", []byte{1, 2, 3}); err == nil {
+		t.Fatal("short secret accepted")
+	}
+}
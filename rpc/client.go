@@ -25,6 +25,7 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -77,12 +78,19 @@ type Client struct {
 	idgen    func() ID // for subscriptions
 	isHTTP   bool
 	services *serviceRegistry
+	limits   *serverLimits // limits for serving requests, nil for outgoing connections
 
 	idCounter uint32
 
 	// This function, if non-nil, is called when the connection is lost.
 	reconnectFunc reconnectFunc
 
+	// for reconnecting mode, see EnableReconnect
+	reconnectLock   sync.Mutex
+	reconnectConfig *ReconnectConfig // nil unless in reconnecting mode
+	lost            *connLoss        // connection loss not yet picked up by reconnectLoop
+	lostSignal      chan struct{}    // notifies reconnectLoop of a connection loss
+
 	// writeConn is used for writing to the connection on the caller's goroutine. It should
 	// only be accessed outside of dispatch, with the write lock held. The write lock is
 	// taken by sending on requestOp and released by sending on sendDone.
@@ -111,7 +119,7 @@ type clientConn struct {
 
 func (c *Client) newClientConn(conn ServerCodec) *clientConn {
 	ctx := context.WithValue(context.Background(), clientContextKey{}, c)
-	handler := newHandler(ctx, conn, c.idgen, c.services)
+	handler := newHandler(ctx, conn, c.idgen, c.services, c.limits)
 	return &clientConn{conn, handler}
 }
 
@@ -197,22 +205,24 @@ func newClient(initctx context.Context, connect reconnectFunc) (*Client, error)
 	if err != nil {
 		return nil, err
 	}
-	c := initClient(conn, randomIDGenerator(), new(serviceRegistry))
+	c := initClient(conn, randomIDGenerator(), new(serviceRegistry), nil)
 	c.reconnectFunc = connect
 	return c, nil
 }
 
-func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *Client {
+func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry, limits *serverLimits) *Client {
 	_, isHTTP := conn.(*httpConn)
 	c := &Client{
 		idgen:       idgen,
 		isHTTP:      isHTTP,
 		services:    services,
+		limits:      limits,
 		writeConn:   conn,
 		close:       make(chan struct{}),
 		closing:     make(chan struct{}),
 		didClose:    make(chan struct{}),
 		reconnected: make(chan ServerCodec),
+		lostSignal:  make(chan struct{}, 1),
 		readOp:      make(chan readOp),
 		readErr:     make(chan error),
 		reqInit:     make(chan *requestOp),
@@ -435,7 +445,7 @@ func (c *Client) Subscribe(ctx context.Context, namespace string, channel interf
 	op := &requestOp{
 		ids:  []json.RawMessage{msg.ID},
 		resp: make(chan *jsonrpcMessage),
-		sub:  newClientSubscription(c, namespace, chanVal),
+		sub:  newClientSubscription(c, namespace, chanVal, args),
 	}
 
 	// Send the subscription request.
@@ -553,6 +563,9 @@ func (c *Client) dispatch(codec ServerCodec) {
 
 		case err := <-c.readErr:
 			conn.handler.log.Debug("RPC connection read error", "err", err)
+			if c.reconnecting() {
+				c.connectionLost(conn.codec, err, conn.handler.takeClientSubs())
+			}
 			conn.close(err, lastOp)
 			reading = false
 
@@ -565,6 +578,9 @@ func (c *Client) dispatch(codec ServerCodec) {
 				// In those cases the caller will notice first and reconnect. Closing the
 				// handler terminates all waiting requests (closing op.resp) except for
 				// lastOp, which will be transferred to the new handler.
+				if c.reconnecting() {
+					c.connectionLost(conn.codec, errClientReconnected, conn.handler.takeClientSubs())
+				}
 				conn.close(errClientReconnected, lastOp)
 				c.drainRead()
 			}
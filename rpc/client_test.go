@@ -263,6 +263,75 @@ func TestClientSubscribe(t *testing.T) {
 	}
 }
 
+// This test checks that a subscription closed by the server delivers all notifications
+// sent before and is removed on the server.
+func TestClientSubscribeServerClose(t *testing.T) {
+	service := &notificationTestService{unsubscribed: make(chan string, 1)}
+	server := NewServer()
+	server.RegisterName("nftest", service)
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	nc := make(chan int)
+	count := 10
+	sub, err := client.Subscribe(context.Background(), "nftest", nc, "closingSubscription", count)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	for i := 0; i < count; i++ {
+		if val := <-nc; val != i {
+			t.Fatalf("value mismatch: got %d, want %d", val, i)
+		}
+	}
+	select {
+	case <-service.unsubscribed:
+	case <-time.After(1 * time.Second):
+		t.Fatal("subscription not closed on the server within 1s")
+	}
+	var result bool
+	if err := client.Call(&result, "nftest_unsubscribe", sub.id()); err == nil {
+		t.Fatal("unsubscribe of closed subscription succeeded")
+	}
+}
+
+// This test checks that a subscription ended by Notifier.Fail delivers all notifications
+// before the error.
+func TestClientSubscribeFail(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	nc := make(chan int)
+	count := 10
+	sub, err := client.Subscribe(context.Background(), "nftest", nc, "failingSubscription", count)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	for i := 0; i < count; i++ {
+		if val := <-nc; val != i {
+			t.Fatalf("value mismatch: got %d, want %d", val, i)
+		}
+	}
+	select {
+	case v := <-nc:
+		t.Fatal("received value after failure:", v)
+	case err := <-sub.Err():
+		rpcErr, ok := err.(Error)
+		if !ok || rpcErr.ErrorCode() != -32005 || err.Error() != "too many notifications" {
+			t.Fatalf("wrong error: %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("subscription not closed within 1s after failure")
+	}
+	// The server has removed the subscription.
+	var result bool
+	if err := client.Call(&result, "nftest_unsubscribe", sub.id()); err == nil {
+		t.Fatal("unsubscribe of failed subscription succeeded")
+	}
+}
+
 // In this test, the connection drops while Subscribe is waiting for a response.
 func TestClientSubscribeClose(t *testing.T) {
 	server := newTestServer()
@@ -107,6 +107,17 @@ Subscriptions are deleted when the user sends an unsubscribe request or when the
 connection which was used to create the subscription is closed. This can be initiated by
 the client and server. The server will close the connection for any write error.
 
+The server can also end a single subscription with Notifier.Close or Notifier.Fail.
+Fail additionally tells the client why, using a final notification which has an
+"error" member instead of "result":
+
+ {"jsonrpc":"2.0","method":"blockchain_subscription","params":{"subscription":"0x..","error":{"code":-32000,"message":".."}}}
+
+This notification is an extension of this package. Clients which don't know it may
+ignore it, but they still observe the end of the subscription because unsubscribing
+fails. The Client of this package returns the error on the Err channel of the
+ClientSubscription after all earlier notifications were delivered.
+
 For more information about subscriptions, see https://github.com/groshproject/grosh-core/wiki/RPC-PUB-SUB.
 
 Reverse Calls
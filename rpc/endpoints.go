@@ -17,13 +17,17 @@
 package rpc
 
 import (
+	"fmt"
 	"net"
+	"net/http"
+	"strings"
 
+	"github.com/gorilla/websocket"
 	"github.com/groshproject/grosh-core/log"
 )
 
-// StartHTTPEndpoint starts the HTTP RPC endpoint, configured with cors/vhosts/modules
-func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string, timeouts HTTPTimeouts) (net.Listener, *Server, error) {
+// StartHTTPEndpoint starts the HTTP RPC endpoint, configured with cors/vhosts/modules/limits
+func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string, timeouts HTTPTimeouts, limits Limits) (net.Listener, *Server, error) {
 	// Generate the whitelist based on the allowed modules
 	whitelist := make(map[string]bool)
 	for _, module := range modules {
@@ -31,6 +35,7 @@ func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []str
 	}
 	// Register all the APIs exposed by the services
 	handler := NewServer()
+	handler.SetLimits(limits)
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -51,8 +56,78 @@ func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []str
 	return listener, handler, err
 }
 
+// WSConfig configures the websocket part of an endpoint started by
+// StartHTTPWSEndpoint.
+type WSConfig struct {
+	Modules   []string // modules to expose, public modules if empty
+	Origins   []string // allowed origins of websocket handshakes
+	ExposeAll bool     // expose all modules, including private ones
+}
+
+// StartHTTPWSEndpoint starts an HTTP RPC endpoint like StartHTTPEndpoint. If ws is
+// non-nil, websocket connections are accepted on the same port, served by a
+// separate Server with its own module whitelist. The handlers in mounts are served
+// on their path prefixes, e.g. "/graphql", instead of the RPC handler.
+func StartHTTPWSEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string, timeouts HTTPTimeouts, limits Limits, ws *WSConfig, mounts map[string]http.Handler) (net.Listener, *Server, *Server, error) {
+	for prefix := range mounts {
+		if !strings.HasPrefix(prefix, "/") || prefix == "/" || strings.HasSuffix(prefix, "/") {
+			return nil, nil, nil, fmt.Errorf("invalid handler path prefix %q", prefix)
+		}
+	}
+	httpHandler, err := newWhitelistServer(apis, modules, false, limits, "HTTP")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var (
+		wsHandler *Server
+		handler   = NewHTTPHandler(cors, vhosts, httpHandler)
+	)
+	if ws != nil {
+		if wsHandler, err = newWhitelistServer(apis, ws.Modules, ws.ExposeAll, limits, "WebSocket"); err != nil {
+			return nil, nil, nil, err
+		}
+		handler = NewHTTPWSHandler(handler, wsHandler.WebsocketHandler(ws.Origins))
+	}
+	if len(mounts) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		for prefix, h := range mounts {
+			mux.Handle(prefix, h)
+			mux.Handle(prefix+"/", h)
+		}
+		handler = mux
+	}
+	// All APIs registered, start the HTTP listener
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	go newHTTPServerWithTimeouts(handler, timeouts).Serve(listener)
+	return listener, httpHandler, wsHandler, nil
+}
+
+// newWhitelistServer creates a server exposing the whitelisted modules. If the
+// whitelist is empty, all public modules are exposed.
+func newWhitelistServer(apis []API, modules []string, exposeAll bool, limits Limits, kind string) (*Server, error) {
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	handler := NewServer()
+	handler.SetLimits(limits)
+	for _, api := range apis {
+		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
+			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+				return nil, err
+			}
+			log.Debug(kind+" registered", "namespace", api.Namespace)
+		}
+	}
+	return handler, nil
+}
+
 // StartWSEndpoint starts a websocket endpoint
-func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []string, exposeAll bool) (net.Listener, *Server, error) {
+func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []string, exposeAll bool, limits Limits) (net.Listener, *Server, error) {
 
 	// Generate the whitelist based on the allowed modules
 	whitelist := make(map[string]bool)
@@ -61,6 +136,7 @@ func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []
 	}
 	// Register all the APIs exposed by the services
 	handler := NewServer()
+	handler.SetLimits(limits)
 	for _, api := range apis {
 		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -82,6 +158,57 @@ func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []
 
 }
 
+// StartAuthEndpoint starts an RPC endpoint which serves both HTTP and websocket
+// connections. All requests must carry a JWT token signed with the shared secret.
+// Unlike the other endpoints, only the modules in the whitelist are exposed.
+func StartAuthEndpoint(endpoint string, apis []API, modules []string, vhosts []string, timeouts HTTPTimeouts, secret []byte, limits Limits) (net.Listener, *Server, error) {
+	if len(secret) < JWTSecretLength {
+		return nil, nil, fmt.Errorf("JWT secret too short, need at least %d bytes", JWTSecretLength)
+	}
+	// Generate the whitelist based on the allowed modules
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	// Register all the APIs exposed by the services
+	handler := NewServer()
+	handler.SetLimits(limits)
+	for _, api := range apis {
+		if whitelist[api.Namespace] {
+			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+				return nil, nil, err
+			}
+			log.Debug("Authenticated RPC registered", "namespace", api.Namespace)
+		}
+	}
+	// All APIs registered, start the listener
+	var (
+		listener net.Listener
+		err      error
+	)
+	if listener, err = net.Listen("tcp", endpoint); err != nil {
+		return nil, nil, err
+	}
+	var srv http.Handler = NewHTTPWSHandler(newGzipHandler(handler), handler.WebsocketHandler(nil))
+	srv = newJWTHandler(secret, srv)
+	srv = newVHostHandler(vhosts, srv)
+	go newHTTPServerWithTimeouts(srv, timeouts).Serve(listener)
+	return listener, handler, err
+}
+
+// NewHTTPWSHandler returns a handler which serves HTTP and websocket requests on the
+// same port. Websocket handshakes are passed to wsHandler, on any path, and all other
+// requests to httpHandler.
+func NewHTTPWSHandler(httpHandler, wsHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			wsHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
+
 // StartIPCEndpoint starts an IPC endpoint.
 func StartIPCEndpoint(ipcEndpoint string, apis []API) (net.Listener, *Server, error) {
 	// Register all the APIs exposed by the services.
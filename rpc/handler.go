@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/groshproject/grosh-core/log"
@@ -62,16 +63,21 @@ type handler struct {
 	log            log.Logger
 	allowSubscribe bool
 
+	limits   *serverLimits // nil if the connection is not limited
+	clientIP string        // remote IP for rate and concurrency limits
+	inflight int32         // number of running calls, accessed atomically
+
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
 }
 
 type callProc struct {
-	ctx       context.Context
-	notifiers []*Notifier
+	ctx        context.Context
+	notifiers  []*Notifier
+	respBudget int // response bytes left for the next call, if the size is limited
 }
 
-func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry) *handler {
+func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry, limits *serverLimits) *handler {
 	rootCtx, cancelRoot := context.WithCancel(connCtx)
 	h := &handler{
 		reg:            reg,
@@ -84,6 +90,8 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		limits:         limits,
+		clientIP:       clientIP(conn.RemoteAddr()),
 	}
 	if conn.RemoteAddr() != "" {
 		h.log = h.log.New("conn", conn.RemoteAddr())
@@ -102,6 +110,14 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		return
 	}
 
+	// Reject batches above the size limit:
+	if h.limits != nil && h.limits.BatchItems > 0 && len(msgs) > h.limits.BatchItems {
+		h.startCallProc(func(cp *callProc) {
+			h.conn.Write(cp.ctx, errorMessage(&limitExceededError{"batch too large"}))
+		})
+		return
+	}
+
 	// Handle non-call messages first:
 	calls := make([]*jsonrpcMessage, 0, len(msgs))
 	for _, msg := range msgs {
@@ -112,14 +128,38 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	if len(calls) == 0 {
 		return
 	}
+	if !h.acquireCall() {
+		h.rejectCalls(true, calls...)
+		return
+	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
-		answers := make([]*jsonrpcMessage, 0, len(msgs))
+		var (
+			answers = make([]*jsonrpcMessage, 0, len(msgs))
+			size    int
+		)
 		for _, msg := range calls {
-			if answer := h.handleCallMsg(cp, msg); answer != nil {
+			// Once the responses exceed the size limit, the remaining calls
+			// are not executed.
+			var answer *jsonrpcMessage
+			if h.limits != nil {
+				cp.respBudget = h.limits.ResponseSize - size
+			}
+			if h.responseTooLarge(size) {
+				if msg.isCall() {
+					answer = msg.errorResponse(&limitExceededError{"response too large"})
+				}
+			} else if answer = h.handleCallMsg(cp, msg); answer != nil {
+				size += len(answer.Result)
+				if h.responseTooLarge(size) {
+					answer = msg.errorResponse(&limitExceededError{"response too large"})
+				}
+			}
+			if answer != nil {
 				answers = append(answers, answer)
 			}
 		}
+		h.releaseCall()
 		h.addSubscriptions(cp.notifiers)
 		if len(answers) > 0 {
 			h.conn.Write(cp.ctx, answers)
@@ -135,8 +175,19 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	if ok := h.handleImmediate(msg); ok {
 		return
 	}
+	if !h.acquireCall() {
+		h.rejectCalls(false, msg)
+		return
+	}
 	h.startCallProc(func(cp *callProc) {
+		if h.limits != nil {
+			cp.respBudget = h.limits.ResponseSize
+		}
 		answer := h.handleCallMsg(cp, msg)
+		h.releaseCall()
+		if answer != nil && h.responseTooLarge(len(answer.Result)) {
+			answer = msg.errorResponse(&limitExceededError{"response too large"})
+		}
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
 			h.conn.Write(cp.ctx, answer)
@@ -147,6 +198,74 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	})
 }
 
+// acquireCall reserves a slot for running a call. It returns false if the connection
+// or the client has reached the limit of concurrent calls.
+func (h *handler) acquireCall() bool {
+	if h.limits == nil {
+		return true
+	}
+	if h.limits.ConcurrentRequests > 0 {
+		if atomic.AddInt32(&h.inflight, 1) > int32(h.limits.ConcurrentRequests) {
+			atomic.AddInt32(&h.inflight, -1)
+			return false
+		}
+	}
+	if !h.limits.acquire(h.clientIP) {
+		if h.limits.ConcurrentRequests > 0 {
+			atomic.AddInt32(&h.inflight, -1)
+		}
+		return false
+	}
+	return true
+}
+
+// releaseCall frees a slot reserved by acquireCall.
+func (h *handler) releaseCall() {
+	if h.limits == nil {
+		return
+	}
+	if h.limits.ConcurrentRequests > 0 {
+		atomic.AddInt32(&h.inflight, -1)
+	}
+	h.limits.release(h.clientIP)
+}
+
+// rejectCalls responds to the given calls with an error because the connection or
+// the client has too many calls running.
+func (h *handler) rejectCalls(batch bool, msgs ...*jsonrpcMessage) {
+	h.log.Debug("Rejecting RPC calls, too many concurrent requests", "calls", len(msgs))
+	var answers []*jsonrpcMessage
+	for _, msg := range msgs {
+		if msg.isCall() {
+			answers = append(answers, msg.errorResponse(&limitExceededError{"too many concurrent requests"}))
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+	h.startCallProc(func(cp *callProc) {
+		if batch {
+			h.conn.Write(cp.ctx, answers)
+		} else {
+			h.conn.Write(cp.ctx, answers[0])
+		}
+	})
+}
+
+// responseTooLarge reports whether the given response size exceeds the limit. This
+// catches responses of methods which don't check their budget, see ResponseBudget.
+func (h *handler) responseTooLarge(size int) bool {
+	return h.limits != nil && h.limits.ResponseSize > 0 && size > h.limits.ResponseSize
+}
+
+// allowRate reports whether a call to the given method is within the rate limits.
+func (h *handler) allowRate(method string) bool {
+	if h.limits == nil || h.limits.rate == nil {
+		return true
+	}
+	return h.limits.rate.allow(h.clientIP, method)
+}
+
 // close cancels all requests except for inflightReq and waits for
 // call goroutines to shut down.
 func (h *handler) close(err error, inflightReq *requestOp) {
@@ -170,6 +289,17 @@ func (h *handler) removeRequestOp(op *requestOp) {
 	}
 }
 
+// takeClientSubs removes all active client subscriptions from the handler without
+// ending them.
+func (h *handler) takeClientSubs() []*ClientSubscription {
+	subs := make([]*ClientSubscription, 0, len(h.clientSubs))
+	for id, sub := range h.clientSubs {
+		delete(h.clientSubs, id)
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
 // cancelAllRequests unblocks and removes pending requests and active subscriptions.
 func (h *handler) cancelAllRequests(err error, inflightReq *requestOp) {
 	didClose := make(map[*requestOp]bool)
@@ -204,6 +334,17 @@ func (h *handler) addSubscriptions(nn []*Notifier) {
 	}
 }
 
+// removeSubscription removes a subscription which was closed by the server.
+func (h *handler) removeSubscription(id ID) {
+	h.subLock.Lock()
+	defer h.subLock.Unlock()
+
+	if s := h.serverSubs[id]; s != nil {
+		close(s.err)
+		delete(h.serverSubs, id)
+	}
+}
+
 // cancelServerSubscriptions removes all subscriptions and closes their error channels.
 func (h *handler) cancelServerSubscriptions(err error) {
 	h.subLock.Lock()
@@ -254,9 +395,16 @@ func (h *handler) handleSubscriptionResult(msg *jsonrpcMessage) {
 		h.log.Debug("Dropping invalid subscription message")
 		return
 	}
-	if h.clientSubs[result.ID] != nil {
-		h.clientSubs[result.ID].deliver(result.Result)
+	sub := h.clientSubs[result.ID]
+	if sub == nil {
+		return
 	}
+	if result.Error != nil {
+		delete(h.clientSubs, result.ID)
+		sub.fail(result.Error)
+		return
+	}
+	sub.deliver(result.Result)
 }
 
 // handleResponse processes method call responses.
@@ -280,15 +428,25 @@ func (h *handler) handleResponse(msg *jsonrpcMessage) {
 		op.err = msg.Error
 		return
 	}
-	if op.err = json.Unmarshal(msg.Result, &op.sub.subid); op.err == nil {
-		go op.sub.start()
-		h.clientSubs[op.sub.subid] = op.sub
+	var subid string
+	if op.err = json.Unmarshal(msg.Result, &subid); op.err == nil {
+		if op.sub.setID(subid) {
+			go op.sub.start()
+		}
+		h.clientSubs[subid] = op.sub
 	}
 }
 
 // handleCallMsg executes a call message and returns the answer.
 func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
 	start := time.Now()
+	if (msg.isCall() || msg.isNotification()) && !h.allowRate(msg.Method) {
+		h.log.Debug("Rate limited "+msg.Method, "reqid", idForLog{msg.ID})
+		if msg.isCall() {
+			return msg.errorResponse(&limitExceededError{"rate limit exceeded"})
+		}
+		return nil
+	}
 	switch {
 	case msg.isNotification():
 		h.handleCall(ctx, msg)
@@ -328,7 +486,16 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
 
-	return h.runMethod(cp.ctx, msg, callb, args)
+	return h.runMethod(h.callContext(cp), msg, callb, args)
+}
+
+// callContext returns the context for running a method call. If the response size
+// is limited, it carries the budget left for the result.
+func (h *handler) callContext(cp *callProc) context.Context {
+	if h.limits == nil || h.limits.ResponseSize <= 0 {
+		return cp.ctx
+	}
+	return context.WithValue(cp.ctx, responseBudgetKey{}, cp.respBudget)
 }
 
 // handleSubscribe processes *_subscribe method calls.
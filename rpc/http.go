@@ -213,11 +213,22 @@ func (t *httpServerConn) SetWriteDeadline(time.Time) error { return nil }
 //
 // Deprecated: Server implements http.Handler
 func NewHTTPServer(cors []string, vhosts []string, timeouts HTTPTimeouts, srv http.Handler) *http.Server {
+	return newHTTPServerWithTimeouts(NewHTTPHandler(cors, vhosts, srv), timeouts)
+}
+
+// NewHTTPHandler wraps srv with the CORS, virtual host and gzip handling of the HTTP
+// RPC server. The result can be combined with a websocket handler using
+// NewHTTPWSHandler.
+func NewHTTPHandler(cors []string, vhosts []string, srv http.Handler) http.Handler {
 	// Wrap the CORS-handler within a host-handler
 	handler := newCorsHandler(srv, cors)
 	handler = newVHostHandler(vhosts, handler)
-	handler = newGzipHandler(handler)
+	return newGzipHandler(handler)
+}
 
+// newHTTPServerWithTimeouts creates an HTTP server for the given handler, using the
+// timeouts after sanitizing them.
+func newHTTPServerWithTimeouts(handler http.Handler, timeouts HTTPTimeouts) *http.Server {
 	// Make sure timeout values are meaningful
 	if timeouts.ReadTimeout < time.Second {
 		log.Warn("Sanitizing invalid HTTP read timeout", "provided", timeouts.ReadTimeout, "updated", DefaultHTTPTimeouts.ReadTimeout)
@@ -17,6 +17,9 @@
 package rpc
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -52,3 +55,66 @@ func testHTTPErrorResponse(t *testing.T, method, contentType, body string, expec
 		t.Fatalf("response code should be %d not %d", expected, code)
 	}
 }
+
+func TestHTTPWSEndpoint(t *testing.T) {
+	apis := []API{
+		{Namespace: "test", Version: "1.0", Service: new(testService), Public: true},
+		{Namespace: "nftest", Version: "1.0", Service: new(notificationTestService), Public: true},
+	}
+	mounts := map[string]http.Handler{
+		"/mounted": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "mounted "+r.URL.Path)
+		}),
+	}
+	ws := &WSConfig{Modules: []string{"nftest"}}
+	listener, httpSrv, wsSrv, err := StartHTTPWSEndpoint("127.0.0.1:0", apis, []string{"test"}, nil, []string{"*"}, DefaultHTTPTimeouts, Limits{}, ws, mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	defer httpSrv.Stop()
+	defer wsSrv.Stop()
+	addr := listener.Addr().String()
+
+	// HTTP and websocket are served on the same port, with their own modules.
+	httpClient, err := DialHTTP("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsClient, err := DialWebsocket(context.Background(), "ws://"+addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wsClient.Close()
+	if err := httpClient.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatal("HTTP call failed:", err)
+	}
+	if err := wsClient.Call(nil, "test_noArgsRets"); err == nil {
+		t.Fatal("websocket call to HTTP-only module succeeded")
+	}
+	var result int
+	if err := wsClient.Call(&result, "nftest_echo", 7); err != nil || result != 7 {
+		t.Fatalf("websocket call failed: %v %d", err, result)
+	}
+
+	// Mounted handlers are served on their prefix.
+	for _, path := range []string{"/mounted", "/mounted/x"} {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "mounted "+path {
+			t.Errorf("wrong response for %s: %q", path, body)
+		}
+	}
+
+	// Invalid prefixes are rejected.
+	for _, prefix := range []string{"", "/", "mounted", "/mounted/"} {
+		_, _, _, err := StartHTTPWSEndpoint("127.0.0.1:0", apis, nil, nil, nil, DefaultHTTPTimeouts, Limits{}, nil, map[string]http.Handler{prefix: mounts["/mounted"]})
+		if err == nil {
+			t.Errorf("prefix %q accepted", prefix)
+		}
+	}
+}
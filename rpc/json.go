@@ -44,6 +44,7 @@ var null = json.RawMessage("null")
 type subscriptionResult struct {
 	ID     string          `json:"subscription"`
 	Result json.RawMessage `json:"result,omitempty"`
+	Error  *jsonError      `json:"error,omitempty"` // set by Notifier.Fail, not part of the standard
 }
 
 // A value of this type can a JSON-RPC request, notification, successful response or
@@ -107,15 +108,15 @@ func (msg *jsonrpcMessage) response(result interface{}) *jsonrpcMessage {
 }
 
 func errorMessage(err error) *jsonrpcMessage {
-	msg := &jsonrpcMessage{Version: vsn, ID: null, Error: &jsonError{
-		Code:    defaultErrorCode,
-		Message: err.Error(),
-	}}
-	ec, ok := err.(Error)
-	if ok {
-		msg.Error.Code = ec.ErrorCode()
+	return &jsonrpcMessage{Version: vsn, ID: null, Error: newJSONError(err)}
+}
+
+func newJSONError(err error) *jsonError {
+	jerr := &jsonError{Code: defaultErrorCode, Message: err.Error()}
+	if ec, ok := err.(Error); ok {
+		jerr.Code = ec.ErrorCode()
 	}
-	return msg
+	return jerr
 }
 
 type jsonError struct {
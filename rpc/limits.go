@@ -0,0 +1,253 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Limits configures the resources a Server spends on requests. Zero values mean
+// that the corresponding limit is disabled.
+type Limits struct {
+	// BatchItems is the maximum number of requests in a batch.
+	BatchItems int `toml:",omitempty"`
+
+	// ResponseSize is the maximum size of a response in bytes. For batches, the
+	// limit applies to the sum of all responses in the batch.
+	//
+	// Methods which can return large results learn the remaining budget through
+	// ResponseBudget and stop producing their result once it is exceeded. All
+	// other responses are checked after encoding and replaced by an error if
+	// they are too large.
+	ResponseSize int `toml:",omitempty"`
+
+	// ConcurrentRequests is the maximum number of requests processed concurrently
+	// for a single connection.
+	ConcurrentRequests int `toml:",omitempty"`
+
+	// ClientConcurrentRequests is the maximum number of requests processed
+	// concurrently for a single client IP, across all connections to the server.
+	// Connections without a remote address, e.g. IPC, are not limited.
+	ClientConcurrentRequests int `toml:",omitempty"`
+
+	// ClientRate limits the rate of requests of each client IP.
+	ClientRate RateLimit `toml:",omitempty"`
+
+	// MethodRates limits the rate of requests of each client IP for individual
+	// methods, e.g. "eth_getLogs".
+	MethodRates map[string]RateLimit `toml:",omitempty"`
+}
+
+// ErrResponseTooLarge is returned by methods whose result exceeds the response size
+// budget of the call.
+var ErrResponseTooLarge Error = &limitExceededError{"response too large"}
+
+type responseBudgetKey struct{}
+
+// ResponseBudget returns the number of bytes which the result of the current call
+// may occupy in the encoded response. The boolean is false if the response size is
+// not limited. Methods which build large results should check their size against
+// the budget while producing them and fail with ErrResponseTooLarge once it is
+// exceeded, instead of building a result which is rejected afterwards.
+func ResponseBudget(ctx context.Context) (int, bool) {
+	budget, ok := ctx.Value(responseBudgetKey{}).(int)
+	return budget, ok
+}
+
+// RateLimit configures a token bucket.
+type RateLimit struct {
+	Rate  float64 `toml:",omitempty"` // requests per second, zero means unlimited
+	Burst int     `toml:",omitempty"` // bucket size, defaults to the rate rounded up
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+func (l *Limits) rateLimited() bool {
+	if l.ClientRate.enabled() {
+		return true
+	}
+	for _, r := range l.MethodRates {
+		if r.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// serverLimits is the limit configuration shared by all connections of a server.
+type serverLimits struct {
+	Limits
+	rate *rateLimiter // nil if rate limiting is disabled
+
+	mu       sync.Mutex
+	inflight map[string]int // running calls per client IP
+}
+
+func newServerLimits(l Limits) *serverLimits {
+	sl := &serverLimits{Limits: l, inflight: make(map[string]int)}
+	if l.rateLimited() {
+		sl.rate = newRateLimiter(l.ClientRate, l.MethodRates)
+	}
+	return sl
+}
+
+// acquire reserves a slot for running a call of the given client. It returns false
+// if the client has reached the limit of concurrent calls.
+func (sl *serverLimits) acquire(client string) bool {
+	if sl.ClientConcurrentRequests <= 0 || client == "" {
+		return true
+	}
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.inflight[client] >= sl.ClientConcurrentRequests {
+		return false
+	}
+	sl.inflight[client]++
+	return true
+}
+
+// release frees a slot reserved by acquire.
+func (sl *serverLimits) release(client string) {
+	if sl.ClientConcurrentRequests <= 0 || client == "" {
+		return
+	}
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.inflight[client]--; sl.inflight[client] <= 0 {
+		delete(sl.inflight, client)
+	}
+}
+
+const rateLimiterGCInterval = time.Minute
+
+// rateLimiter tracks token buckets per client IP and method.
+type rateLimiter struct {
+	client  RateLimit
+	methods map[string]RateLimit
+	now     func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*tokenBucket
+	lastGC  time.Time
+}
+
+// bucketKey identifies a token bucket. The method is empty for the bucket which
+// limits all requests of a client.
+type bucketKey struct {
+	client, method string
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(client RateLimit, methods map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		client:  client,
+		methods: methods,
+		now:     time.Now,
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// allow reports whether a request of the given client for the given method is
+// within the limits. If so, a token is taken from all applicable buckets.
+func (rl *rateLimiter) allow(client, method string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.lastGC) >= rateLimiterGCInterval {
+		rl.gc(now)
+	}
+	var buckets [2]*tokenBucket
+	n := 0
+	if rl.client.enabled() {
+		buckets[n] = rl.bucket(bucketKey{client, ""}, rl.client, now)
+		n++
+	}
+	if lim, ok := rl.methods[method]; ok && lim.enabled() {
+		buckets[n] = rl.bucket(bucketKey{client, method}, lim, now)
+		n++
+	}
+	for _, b := range buckets[:n] {
+		if b.tokens < 1 {
+			return false
+		}
+	}
+	for _, b := range buckets[:n] {
+		b.tokens--
+	}
+	return true
+}
+
+// bucket returns the bucket for key, refilled up to the current time.
+func (rl *rateLimiter) bucket(key bucketKey, lim RateLimit, now time.Time) *tokenBucket {
+	b := rl.buckets[key]
+	if b == nil {
+		b = &tokenBucket{limit: lim, tokens: lim.burst(), last: now}
+		rl.buckets[key] = b
+		return b
+	}
+	b.refill(now)
+	return b
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.limit.burst(), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// gc removes buckets which are full. They are equivalent to new buckets.
+func (rl *rateLimiter) gc(now time.Time) {
+	rl.lastGC = now
+	for key, b := range rl.buckets {
+		b.refill(now)
+		if b.tokens >= b.limit.burst() {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// clientIP returns the IP part of a connection's remote address, which is used to
+// identify clients for rate limiting.
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var (
+		now = time.Unix(1000, 0)
+		rl  = newRateLimiter(RateLimit{Rate: 2, Burst: 3}, map[string]RateLimit{
+			"test_echo": {Rate: 1},
+		})
+	)
+	rl.now = func() time.Time { return now }
+
+	// The client bucket allows a burst of three requests.
+	for i := 0; i < 3; i++ {
+		if !rl.allow("a", "test_sleep") {
+			t.Fatalf("request %d rejected", i)
+		}
+	}
+	if rl.allow("a", "test_sleep") {
+		t.Fatal("request above burst allowed")
+	}
+	// Other clients are unaffected.
+	if !rl.allow("b", "test_sleep") {
+		t.Fatal("request of other client rejected")
+	}
+	// The bucket refills at the configured rate.
+	now = now.Add(500 * time.Millisecond)
+	if !rl.allow("a", "test_sleep") {
+		t.Fatal("request after refill rejected")
+	}
+	if rl.allow("a", "test_sleep") {
+		t.Fatal("second request after refill allowed")
+	}
+
+	// Method limits apply in addition to the client limit. A rejected request
+	// doesn't consume tokens from the client bucket.
+	now = now.Add(time.Hour)
+	if !rl.allow("a", "test_echo") {
+		t.Fatal("first echo rejected")
+	}
+	if rl.allow("a", "test_echo") {
+		t.Fatal("second echo allowed")
+	}
+	if !rl.allow("a", "test_sleep") || !rl.allow("a", "test_sleep") {
+		t.Fatal("client bucket drained by rejected request")
+	}
+
+	// Full buckets are removed.
+	now = now.Add(time.Hour)
+	rl.allow("c", "test_sleep")
+	if len(rl.buckets) != 1 {
+		t.Fatalf("wrong bucket count %d after gc, want 1", len(rl.buckets))
+	}
+}
+
+// limitTestConn is a raw JSON connection to a server with limits.
+type limitTestConn struct {
+	t    *testing.T
+	conn net.Conn
+	buf  *bufio.Reader
+}
+
+func newLimitTestConn(t *testing.T, limits Limits) *limitTestConn {
+	server := newTestServer()
+	server.SetLimits(limits)
+	return dialLimitTestConn(t, server)
+}
+
+// dialLimitTestConn opens another connection to the server. All connections have
+// the same remote address.
+func dialLimitTestConn(t *testing.T, server *Server) *limitTestConn {
+	clientConn, serverConn := net.Pipe()
+	codec := NewJSONCodec(connWithRemoteAddr{serverConn, "127.0.0.1:1234"})
+	go server.ServeCodec(codec, OptionMethodInvocation)
+	return &limitTestConn{t, clientConn, bufio.NewReader(clientConn)}
+}
+
+func (c *limitTestConn) send(msg string) {
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(c.conn, msg+"\n"); err != nil {
+		c.t.Fatal("write error:", err)
+	}
+}
+
+func (c *limitTestConn) expect(want string) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.buf.ReadString('\n')
+	if err != nil {
+		c.t.Fatal("read error:", err)
+	}
+	if line = strings.TrimRight(line, "\r\n"); line != want {
+		c.t.Fatalf("wrong response\ngot:  %s\nwant: %s", line, want)
+	}
+}
+
+func TestServerBatchLimit(t *testing.T) {
+	c := newLimitTestConn(t, Limits{BatchItems: 2})
+	defer c.conn.Close()
+
+	c.send(`[{"jsonrpc":"2.0","id":1,"method":"test_noArgsRets"},{"jsonrpc":"2.0","id":2,"method":"test_noArgsRets"}]`)
+	c.expect(`[{"jsonrpc":"2.0","id":1,"result":null},{"jsonrpc":"2.0","id":2,"result":null}]`)
+
+	c.send(`[{"jsonrpc":"2.0","id":1,"method":"test_noArgsRets"},{"jsonrpc":"2.0","id":2,"method":"test_noArgsRets"},{"jsonrpc":"2.0","id":3,"method":"test_noArgsRets"}]`)
+	c.expect(`{"jsonrpc":"2.0","id":null,"error":{"code":-32005,"message":"batch too large"}}`)
+}
+
+func TestServerResponseSizeLimit(t *testing.T) {
+	c := newLimitTestConn(t, Limits{ResponseSize: 50})
+	defer c.conn.Close()
+
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1]}`)
+	c.expect(`{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":1,"Args":null}}`)
+
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"test_echo","params":["` + strings.Repeat("x", 50) + `",1]}`)
+	c.expect(`{"jsonrpc":"2.0","id":2,"error":{"code":-32005,"message":"response too large"}}`)
+
+	// In a batch, the limit applies to the sum of all responses. Calls after the
+	// limit is exceeded are not executed.
+	c.send(`[{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1]},{"jsonrpc":"2.0","id":2,"method":"test_echo","params":["y",2]},{"jsonrpc":"2.0","id":3,"method":"test_noArgsRets"}]`)
+	c.expect(`[{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":1,"Args":null}},{"jsonrpc":"2.0","id":2,"error":{"code":-32005,"message":"response too large"}},{"jsonrpc":"2.0","id":3,"error":{"code":-32005,"message":"response too large"}}]`)
+}
+
+func TestServerResponseBudget(t *testing.T) {
+	c := newLimitTestConn(t, Limits{ResponseSize: 50})
+	defer c.conn.Close()
+
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"test_responseBudget"}`)
+	c.expect(`{"jsonrpc":"2.0","id":1,"result":50}`)
+
+	// In a batch, the budget shrinks with every response.
+	c.send(`[{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1]},{"jsonrpc":"2.0","id":2,"method":"test_responseBudget"}]`)
+	c.expect(`[{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":1,"Args":null}},{"jsonrpc":"2.0","id":2,"result":16}]`)
+
+	// Without a size limit, there is no budget.
+	c2 := newLimitTestConn(t, Limits{})
+	defer c2.conn.Close()
+	c2.send(`{"jsonrpc":"2.0","id":1,"method":"test_responseBudget"}`)
+	c2.expect(`{"jsonrpc":"2.0","id":1,"result":-1}`)
+}
+
+func TestServerConcurrencyLimit(t *testing.T) {
+	c := newLimitTestConn(t, Limits{ConcurrentRequests: 1})
+	defer c.conn.Close()
+
+	// Start a long-running call, then send another one while it runs.
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"test_sleep","params":[500000000]}`)
+	time.Sleep(100 * time.Millisecond)
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"test_noArgsRets"}`)
+	c.expect(`{"jsonrpc":"2.0","id":2,"error":{"code":-32005,"message":"too many concurrent requests"}}`)
+	c.expect(`{"jsonrpc":"2.0","id":1,"result":null}`)
+
+	// The slot is free again.
+	c.send(`{"jsonrpc":"2.0","id":3,"method":"test_noArgsRets"}`)
+	c.expect(`{"jsonrpc":"2.0","id":3,"result":null}`)
+}
+
+func TestServerConcurrencyLimitPerConn(t *testing.T) {
+	server := newTestServer()
+	server.SetLimits(Limits{ConcurrentRequests: 1})
+	c1, c2 := dialLimitTestConn(t, server), dialLimitTestConn(t, server)
+	defer c1.conn.Close()
+	defer c2.conn.Close()
+
+	// The limit doesn't apply to other connections of the client.
+	c1.send(`{"jsonrpc":"2.0","id":1,"method":"test_sleep","params":[500000000]}`)
+	time.Sleep(100 * time.Millisecond)
+	c2.send(`{"jsonrpc":"2.0","id":2,"method":"test_noArgsRets"}`)
+	c2.expect(`{"jsonrpc":"2.0","id":2,"result":null}`)
+	c1.expect(`{"jsonrpc":"2.0","id":1,"result":null}`)
+}
+
+func TestServerConcurrencyLimitPerClient(t *testing.T) {
+	server := newTestServer()
+	server.SetLimits(Limits{ClientConcurrentRequests: 1})
+	c1, c2 := dialLimitTestConn(t, server), dialLimitTestConn(t, server)
+	defer c1.conn.Close()
+	defer c2.conn.Close()
+
+	// The limit applies to all connections of the client.
+	c1.send(`{"jsonrpc":"2.0","id":1,"method":"test_sleep","params":[500000000]}`)
+	time.Sleep(100 * time.Millisecond)
+	c2.send(`{"jsonrpc":"2.0","id":2,"method":"test_noArgsRets"}`)
+	c2.expect(`{"jsonrpc":"2.0","id":2,"error":{"code":-32005,"message":"too many concurrent requests"}}`)
+	c1.expect(`{"jsonrpc":"2.0","id":1,"result":null}`)
+
+	c2.send(`{"jsonrpc":"2.0","id":3,"method":"test_noArgsRets"}`)
+	c2.expect(`{"jsonrpc":"2.0","id":3,"result":null}`)
+	if n := len(server.limits.inflight); n != 0 {
+		t.Fatalf("%d clients tracked after all calls finished", n)
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	c := newLimitTestConn(t, Limits{
+		ClientRate:  RateLimit{Rate: 0.001, Burst: 3},
+		MethodRates: map[string]RateLimit{"test_echo": {Rate: 0.001, Burst: 1}},
+	})
+	defer c.conn.Close()
+
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1]}`)
+	c.expect(`{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":1,"Args":null}}`)
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"test_echo","params":["x",1]}`)
+	c.expect(`{"jsonrpc":"2.0","id":2,"error":{"code":-32005,"message":"rate limit exceeded"}}`)
+
+	// Other methods are only subject to the client limit.
+	c.send(`[{"jsonrpc":"2.0","id":3,"method":"test_noArgsRets"},{"jsonrpc":"2.0","id":4,"method":"test_noArgsRets"},{"jsonrpc":"2.0","id":5,"method":"test_noArgsRets"}]`)
+	c.expect(`[{"jsonrpc":"2.0","id":3,"result":null},{"jsonrpc":"2.0","id":4,"result":null},{"jsonrpc":"2.0","id":5,"error":{"code":-32005,"message":"rate limit exceeded"}}]`)
+}
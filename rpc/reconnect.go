@@ -0,0 +1,256 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/groshproject/grosh-core/common"
+	"github.com/groshproject/grosh-core/log"
+)
+
+// ReconnectConfig configures the reconnecting mode of a client.
+type ReconnectConfig struct {
+	MinBackoff time.Duration // delay after the first failed attempt, doubled after every further one
+	MaxBackoff time.Duration // upper limit of the delay between attempts
+}
+
+// DefaultReconnectConfig contains the default reconnection backoff.
+var DefaultReconnectConfig = ReconnectConfig{
+	MinBackoff: 100 * time.Millisecond,
+	MaxBackoff: 30 * time.Second,
+}
+
+// sanitize replaces unset or inconsistent values with usable ones.
+func (config ReconnectConfig) sanitize() ReconnectConfig {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultReconnectConfig.MinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+		if DefaultReconnectConfig.MaxBackoff > config.MaxBackoff {
+			config.MaxBackoff = DefaultReconnectConfig.MaxBackoff
+		}
+	}
+	return config
+}
+
+// SubscriptionGapError is delivered on the Gaps channel of a subscription which
+// was re-established after the connection of the client had been lost.
+type SubscriptionGapError struct {
+	Err          error     // error which ended the previous connection
+	Disconnected time.Time // time the connection was lost
+	Resubscribed time.Time // time the subscription was re-established
+}
+
+func (e *SubscriptionGapError) Error() string {
+	return fmt.Sprintf("subscription resumed after %v gap: %v", common.PrettyDuration(e.Resubscribed.Sub(e.Disconnected)), e.Err)
+}
+
+// connLoss describes a lost connection of a client in reconnecting mode.
+type connLoss struct {
+	codec ServerCodec           // the lost connection
+	err   error                 // error which ended the connection
+	time  time.Time             // time the first unhandled loss happened
+	subs  []*ClientSubscription // subscriptions to re-establish
+}
+
+// DialReconnecting creates a new client for the given URL, just like DialContext,
+// and switches it into reconnecting mode.
+func DialReconnecting(ctx context.Context, rawurl string, config ReconnectConfig) (*Client, error) {
+	c, err := DialContext(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	c.EnableReconnect(config)
+	return c, nil
+}
+
+// EnableReconnect switches the client into reconnecting mode. When the connection
+// is lost, the client reconnects in the background with exponential backoff and
+// re-establishes all active subscriptions on the new connection. Requests which
+// were in flight when the connection broke still fail.
+//
+// Subscriptions report every interruption on their Gaps channel instead of ending
+// with an error. Reconnecting mode has no effect on HTTP clients, which don't keep
+// a connection.
+func (c *Client) EnableReconnect(config ReconnectConfig) {
+	if c.isHTTP || c.reconnectFunc == nil {
+		return
+	}
+	c.reconnectLock.Lock()
+	defer c.reconnectLock.Unlock()
+
+	if c.reconnectConfig != nil {
+		return
+	}
+	config = config.sanitize()
+	c.reconnectConfig = &config
+	go c.reconnectLoop(config)
+}
+
+// reconnecting reports whether the client is in reconnecting mode.
+func (c *Client) reconnecting() bool {
+	c.reconnectLock.Lock()
+	defer c.reconnectLock.Unlock()
+
+	return c.reconnectConfig != nil
+}
+
+// connectionLost is called by dispatch when the connection of a client in
+// reconnecting mode is lost. It hands the detached subscriptions over to the
+// reconnect loop.
+func (c *Client) connectionLost(codec ServerCodec, err error, subs []*ClientSubscription) {
+	c.reconnectLock.Lock()
+	if c.lost == nil {
+		c.lost = &connLoss{time: time.Now()}
+	}
+	c.lost.codec, c.lost.err = codec, err
+	c.lost.subs = append(c.lost.subs, subs...)
+	c.reconnectLock.Unlock()
+
+	select {
+	case c.lostSignal <- struct{}{}:
+	default:
+	}
+}
+
+// takeLoss merges the connection loss reported by dispatch, if any, into the one
+// currently being handled.
+func (c *Client) takeLoss(current *connLoss) *connLoss {
+	c.reconnectLock.Lock()
+	defer c.reconnectLock.Unlock()
+
+	lost := c.lost
+	c.lost = nil
+	switch {
+	case lost == nil:
+		return current
+	case current == nil:
+		return lost
+	}
+	current.codec, current.err = lost.codec, lost.err
+	current.subs = append(current.subs, lost.subs...)
+	return current
+}
+
+// reconnectLoop restores the connection and subscriptions of a client in
+// reconnecting mode whenever dispatch reports the connection lost.
+func (c *Client) reconnectLoop(config ReconnectConfig) {
+	var loss *connLoss
+	defer func() {
+		// The client is closed, end the subscriptions still waiting.
+		if loss = c.takeLoss(loss); loss != nil {
+			for _, sub := range loss.subs {
+				sub.quitWithError(ErrClientQuit, false)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-c.lostSignal:
+		case <-c.closing:
+			return
+		}
+		delay := config.MinBackoff
+		for loss = c.takeLoss(loss); loss != nil; loss = c.takeLoss(loss) {
+			err := c.restore(loss)
+			if err == nil {
+				loss = nil
+				break
+			}
+			if err == ErrClientQuit {
+				return
+			}
+			log.Debug("RPC client reconnect failed", "err", err, "subscriptions", len(loss.subs), "retry", delay)
+			select {
+			case <-time.After(delay):
+			case <-c.closing:
+				return
+			}
+			if delay *= 2; delay > config.MaxBackoff {
+				delay = config.MaxBackoff
+			}
+		}
+	}
+}
+
+// restore replaces the lost connection, unless a call did so in the meantime, and
+// re-establishes the subscriptions on the new one. Successfully restored and failed
+// subscriptions are removed from the loss.
+func (c *Client) restore(loss *connLoss) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+	defer cancel()
+
+	// Take the write lock, which guards the connection.
+	select {
+	case c.reqInit <- new(requestOp):
+	case <-c.closing:
+		return ErrClientQuit
+	}
+	var err error
+	if c.writeConn == nil || c.writeConn == jsonWriter(loss.codec) {
+		c.writeConn = nil
+		err = c.reconnect(ctx)
+	}
+	c.reqSent <- err
+	if err != nil {
+		return err
+	}
+	log.Debug("RPC client restoring subscriptions", "count", len(loss.subs))
+	for len(loss.subs) > 0 {
+		sub := loss.subs[0]
+		select {
+		case <-sub.quit:
+			loss.subs = loss.subs[1:]
+			continue
+		default:
+		}
+		if err := c.resubscribe(ctx, sub); err != nil {
+			if _, ok := err.(Error); !ok {
+				return err // connection trouble, retry later
+			}
+			// The server refused the subscription, it can't be restored.
+			sub.quitWithError(err, false)
+		} else {
+			sub.reportGap(&SubscriptionGapError{Err: loss.err, Disconnected: loss.time, Resubscribed: time.Now()})
+		}
+		loss.subs = loss.subs[1:]
+	}
+	return nil
+}
+
+// resubscribe re-establishes a subscription with its original arguments.
+func (c *Client) resubscribe(ctx context.Context, sub *ClientSubscription) error {
+	msg, err := c.newMessage(sub.namespace+subscribeMethodSuffix, sub.args...)
+	if err != nil {
+		return err
+	}
+	op := &requestOp{
+		ids:  []json.RawMessage{msg.ID},
+		resp: make(chan *jsonrpcMessage),
+		sub:  sub,
+	}
+	if err := c.send(ctx, op, msg); err != nil {
+		return err
+	}
+	_, err = op.wait(ctx, c)
+	return err
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 The go-grosh Authors
+// This file is part of the go-grosh library.
+//
+// The go-grosh library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-grosh library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-grosh library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyDialer connects clients to an in-process server and allows breaking the
+// connection and refusing new ones.
+type flakyDialer struct {
+	server *Server
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	refuse  int // number of connection attempts to refuse
+	dialed  int
+	refused int
+}
+
+func (d *flakyDialer) dial(ctx context.Context) (ServerCodec, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dialed++
+	if d.refuse > 0 {
+		d.refuse--
+		d.refused++
+		return nil, errors.New("connection refused")
+	}
+	p1, p2 := net.Pipe()
+	d.conns = append(d.conns, p1)
+	go d.server.ServeCodec(NewJSONCodec(p1), OptionMethodInvocation|OptionSubscriptions)
+	return NewJSONCodec(p2), nil
+}
+
+// drop breaks all connections and refuses the given number of reconnects.
+func (d *flakyDialer) drop(refuse int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = nil
+	d.refuse = refuse
+}
+
+func TestClientReconnectSubscription(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	dialer := &flakyDialer{server: server}
+	client, err := newClient(context.Background(), dialer.dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.EnableReconnect(ReconnectConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	ch := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "nftest", ch, "someSubscription", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(values ...int) {
+		t.Helper()
+		for _, want := range values {
+			select {
+			case have := <-ch:
+				if have != want {
+					t.Fatalf("wrong notification: have %d, want %d", have, want)
+				}
+			case err := <-sub.Err():
+				t.Fatalf("subscription ended: %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for notification %d", want)
+			}
+		}
+	}
+	expect(0, 1)
+
+	// Break the connection and refuse a few attempts, the subscription must be
+	// re-established once the server is reachable again.
+	dialer.drop(3)
+	select {
+	case err := <-sub.Gaps():
+		gap, ok := err.(*SubscriptionGapError)
+		if !ok {
+			t.Fatalf("wrong gap error type %T", err)
+		}
+		if gap.Err == nil || !gap.Resubscribed.After(gap.Disconnected) {
+			t.Fatalf("wrong gap: %v", gap)
+		}
+	case err := <-sub.Err():
+		t.Fatalf("subscription ended: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not re-established")
+	}
+	expect(0, 1)
+
+	dialer.mu.Lock()
+	refused := dialer.refused
+	dialer.mu.Unlock()
+	if refused != 3 {
+		t.Fatalf("wrong number of refused attempts: have %d, want 3", refused)
+	}
+	// Calls use the new connection.
+	var result int
+	if err := client.Call(&result, "nftest_echo", 11); err != nil || result != 11 {
+		t.Fatalf("call after reconnect failed: %v, %d", err, result)
+	}
+	// Closing the client ends the subscription without error.
+	client.Close()
+	select {
+	case err := <-sub.Err():
+		if err != nil {
+			t.Fatalf("unexpected subscription error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not ended by close")
+	}
+}
+
+func TestClientReconnectClosedWhileDown(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	dialer := &flakyDialer{server: server}
+	client, err := newClient(context.Background(), dialer.dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.EnableReconnect(ReconnectConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+
+	sub, err := client.Subscribe(context.Background(), "nftest", make(chan int), "someSubscription", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer.drop(1 << 30)
+	time.Sleep(50 * time.Millisecond)
+	client.Close()
+
+	select {
+	case err := <-sub.Err():
+		if err != nil {
+			t.Fatalf("unexpected subscription error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not ended by close")
+	}
+}
+
+func TestReconnectConfigSanitize(t *testing.T) {
+	tests := []struct {
+		config, want ReconnectConfig
+	}{
+		{ReconnectConfig{}, DefaultReconnectConfig},
+		{ReconnectConfig{MinBackoff: time.Second, MaxBackoff: time.Minute}, ReconnectConfig{MinBackoff: time.Second, MaxBackoff: time.Minute}},
+		{ReconnectConfig{MinBackoff: time.Second}, ReconnectConfig{MinBackoff: time.Second, MaxBackoff: DefaultReconnectConfig.MaxBackoff}},
+		{ReconnectConfig{MinBackoff: time.Hour}, ReconnectConfig{MinBackoff: time.Hour, MaxBackoff: time.Hour}},
+	}
+	for i, test := range tests {
+		if have := test.config.sanitize(); have != test.want {
+			t.Errorf("test %d: have %+v, want %+v", i, have, test.want)
+		}
+	}
+}
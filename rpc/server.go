@@ -46,6 +46,7 @@ type Server struct {
 	idgen    func() ID
 	run      int32
 	codecs   mapset.Set
+	limits   *serverLimits
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -58,6 +59,12 @@ func NewServer() *Server {
 	return server
 }
 
+// SetLimits configures the resource limits of the server. It must be called before
+// the server starts serving requests.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = newServerLimits(limits)
+}
+
 // RegisterName creates a service for the given receiver type under the given name. When no
 // methods on the given receiver match the criteria to be either a RPC method or a
 // subscription an error is returned. Otherwise a new service is created and added to the
@@ -83,7 +90,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, s.limits)
 	<-codec.Closed()
 	c.Close()
 }
@@ -97,7 +104,7 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 		return
 	}
 
-	h := newHandler(ctx, codec, s.idgen, &s.services)
+	h := newHandler(ctx, codec, s.idgen, &s.services, s.limits)
 	h.allowSubscribe = false
 	defer h.close(io.EOF, nil)
 
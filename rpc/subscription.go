@@ -96,6 +96,8 @@ type Notifier struct {
 	buffer       []json.RawMessage
 	callReturned bool
 	activated    bool
+	closed       bool  // set when the subscription was ended by Close or Fail
+	closeErr     error // sent to the client when the subscription was ended by Fail
 }
 
 // CreateSubscription returns a new subscription that is coupled to the
@@ -131,6 +133,9 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 	} else if n.sub.ID != id {
 		panic("Notify with wrong ID")
 	}
+	if n.closed {
+		return ErrSubscriptionNotFound
+	}
 	if n.activated {
 		return n.send(n.sub, enc)
 	}
@@ -138,6 +143,50 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 	return nil
 }
 
+// Close ends the subscription from the server side. Notifications sent before Close
+// are still delivered. The subscription is removed like after an unsubscribe request,
+// so the Err channel of the subscription is closed, further notifications fail and the
+// client gets an error when it tries to unsubscribe.
+func (n *Notifier) Close(id ID) {
+	n.close(id, nil)
+}
+
+// Fail is like Close, but also sends err to the client in a final notification. Note
+// that this notification is an extension of the pub/sub protocol, see the package
+// documentation.
+func (n *Notifier) Fail(id ID, err error) error {
+	return n.close(id, err)
+}
+
+func (n *Notifier) close(id ID, err error) error {
+	n.mu.Lock()
+	if n.sub == nil {
+		n.mu.Unlock()
+		panic("can't Close before subscription is created")
+	} else if n.sub.ID != id {
+		n.mu.Unlock()
+		panic("Close with wrong ID")
+	}
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed, n.closeErr = true, err
+	if !n.activated {
+		// Inactive subscriptions are ended by activate, after the buffered notifications.
+		n.mu.Unlock()
+		return nil
+	}
+	var werr error
+	if err != nil {
+		werr = n.sendError(n.sub, err)
+	}
+	n.mu.Unlock()
+
+	n.h.removeSubscription(id)
+	return werr
+}
+
 // Closed returns a channel that is closed when the RPC connection is closed.
 // Deprecated: use subscription error channel
 func (n *Notifier) Closed() <-chan interface{} {
@@ -158,15 +207,25 @@ func (n *Notifier) takeSubscription() *Subscription {
 // the subscription ID is sent to the client.
 func (n *Notifier) activate() error {
 	n.mu.Lock()
-	defer n.mu.Unlock()
-
 	for _, data := range n.buffer {
 		if err := n.send(n.sub, data); err != nil {
+			n.mu.Unlock()
 			return err
 		}
 	}
 	n.activated = true
-	return nil
+	closed := n.closed
+	var err error
+	if n.closeErr != nil {
+		err = n.sendError(n.sub, n.closeErr)
+	}
+	n.mu.Unlock()
+
+	// The subscription may have been closed before it was activated.
+	if closed {
+		n.h.removeSubscription(n.sub.ID)
+	}
+	return err
 }
 
 func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
@@ -179,6 +238,16 @@ func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
 	})
 }
 
+func (n *Notifier) sendError(sub *Subscription, err error) error {
+	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Error: newJSONError(err)})
+	ctx := context.Background()
+	return n.h.conn.Write(ctx, &jsonrpcMessage{
+		Version: vsn,
+		Method:  n.namespace + notificationMethodSuffix,
+		Params:  params,
+	})
+}
+
 // A Subscription is created by a notifier and tight to that notifier. The client can use
 // this subscription to wait for an unsubscribe request for the client, see Err().
 type Subscription struct {
@@ -204,24 +273,33 @@ type ClientSubscription struct {
 	etype     reflect.Type
 	channel   reflect.Value
 	namespace string
-	subid     string
+	args      []interface{} // subscribe arguments, kept to re-establish the subscription
 	in        chan json.RawMessage
+	failed    chan error // receives the error of a subscription ended by Notifier.Fail
+
+	idLock  sync.Mutex
+	subid   string // server side ID, changes when the subscription is re-established
+	started bool   // whether forward is running
 
 	quitOnce sync.Once     // ensures quit is closed once
 	quit     chan struct{} // quit is closed when the subscription exits
 	errOnce  sync.Once     // ensures err is closed once
 	err      chan error
+	gaps     chan error // receives a *SubscriptionGapError after resubscription
 }
 
-func newClientSubscription(c *Client, namespace string, channel reflect.Value) *ClientSubscription {
+func newClientSubscription(c *Client, namespace string, channel reflect.Value, args []interface{}) *ClientSubscription {
 	sub := &ClientSubscription{
 		client:    c,
 		namespace: namespace,
+		args:      args,
 		etype:     channel.Type().Elem(),
 		channel:   channel,
 		quit:      make(chan struct{}),
 		err:       make(chan error, 1),
+		gaps:      make(chan error, 1),
 		in:        make(chan json.RawMessage),
+		failed:    make(chan error),
 	}
 	return sub
 }
@@ -238,6 +316,14 @@ func (sub *ClientSubscription) Err() <-chan error {
 	return sub.err
 }
 
+// Gaps returns a channel receiving a *SubscriptionGapError whenever a client in
+// reconnecting mode re-established the subscription after losing its connection.
+// Notifications sent by the server while the connection was down are lost. Gaps
+// that aren't received in time are merged into the next one.
+func (sub *ClientSubscription) Gaps() <-chan error {
+	return sub.gaps
+}
+
 // Unsubscribe unsubscribes the notification and closes the error channel.
 // It can safely be called more than once.
 func (sub *ClientSubscription) Unsubscribe() {
@@ -263,6 +349,38 @@ func (sub *ClientSubscription) quitWithError(err error, unsubscribeServer bool)
 	})
 }
 
+// setID updates the server side ID of the subscription. It reports whether this is
+// the first ID, i.e. whether the subscription needs to be started.
+func (sub *ClientSubscription) setID(id string) bool {
+	sub.idLock.Lock()
+	defer sub.idLock.Unlock()
+
+	sub.subid = id
+	if sub.started {
+		return false
+	}
+	sub.started = true
+	return true
+}
+
+// id returns the current server side ID of the subscription.
+func (sub *ClientSubscription) id() string {
+	sub.idLock.Lock()
+	defer sub.idLock.Unlock()
+
+	return sub.subid
+}
+
+// reportGap delivers a gap notification, merging it with an undelivered one.
+func (sub *ClientSubscription) reportGap(gap *SubscriptionGapError) {
+	select {
+	case old := <-sub.gaps:
+		gap.Disconnected = old.(*SubscriptionGapError).Disconnected
+	default:
+	}
+	sub.gaps <- gap
+}
+
 func (sub *ClientSubscription) deliver(result json.RawMessage) (ok bool) {
 	select {
 	case sub.in <- result:
@@ -272,6 +390,15 @@ func (sub *ClientSubscription) deliver(result json.RawMessage) (ok bool) {
 	}
 }
 
+// fail ends the subscription with an error sent by the server. Results delivered
+// before are still sent on the channel.
+func (sub *ClientSubscription) fail(err error) {
+	select {
+	case sub.failed <- err:
+	case <-sub.quit:
+	}
+}
+
 func (sub *ClientSubscription) start() {
 	sub.quitWithError(sub.forward())
 }
@@ -280,19 +407,25 @@ func (sub *ClientSubscription) forward() (err error, unsubscribeServer bool) {
 	cases := []reflect.SelectCase{
 		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.quit)},
 		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.in)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.failed)},
 		{Dir: reflect.SelectSend, Chan: sub.channel},
 	}
 	buffer := list.New()
 	defer buffer.Init()
+	var failErr error
 	for {
+		if failErr != nil && buffer.Len() == 0 {
+			// The server ended the subscription and everything was sent.
+			return failErr, false
+		}
 		var chosen int
 		var recv reflect.Value
 		if buffer.Len() == 0 {
 			// Idle, omit send case.
-			chosen, recv, _ = reflect.Select(cases[:2])
+			chosen, recv, _ = reflect.Select(cases[:3])
 		} else {
 			// Non-empty buffer, send the first queued item.
-			cases[2].Send = reflect.ValueOf(buffer.Front().Value)
+			cases[3].Send = reflect.ValueOf(buffer.Front().Value)
 			chosen, recv, _ = reflect.Select(cases)
 		}
 
@@ -308,8 +441,12 @@ func (sub *ClientSubscription) forward() (err error, unsubscribeServer bool) {
 				return ErrSubscriptionQueueOverflow, true
 			}
 			buffer.PushBack(val)
-		case 2: // sub.channel<-
-			cases[2].Send = reflect.Value{} // Don't hold onto the value.
+		case 2: // <-sub.failed
+			// Stop receiving, the remaining items are still sent.
+			failErr = recv.Interface().(error)
+			cases[1].Chan, cases[2].Chan = reflect.Value{}, reflect.Value{}
+		case 3: // sub.channel<-
+			cases[3].Send = reflect.Value{} // Don't hold onto the value.
 			buffer.Remove(buffer.Front())
 		}
 	}
@@ -323,5 +460,5 @@ func (sub *ClientSubscription) unmarshal(result json.RawMessage) (interface{}, e
 
 func (sub *ClientSubscription) requestUnsubscribe() error {
 	var result interface{}
-	return sub.client.Call(&result, sub.namespace+unsubscribeMethodSuffix, sub.subid)
+	return sub.client.Call(&result, sub.namespace+unsubscribeMethodSuffix, sub.id())
 }
@@ -77,6 +77,13 @@ func (s *testService) Sleep(ctx context.Context, duration time.Duration) {
 	time.Sleep(duration)
 }
 
+func (s *testService) ResponseBudget(ctx context.Context) int {
+	if budget, ok := ResponseBudget(ctx); ok {
+		return budget
+	}
+	return -1
+}
+
 func (s *testService) Rets() (string, error) {
 	return "", nil
 }
@@ -163,6 +170,42 @@ func (s *notificationTestService) SomeSubscription(ctx context.Context, n, val i
 	return subscription, nil
 }
 
+// ClosingSubscription sends n notifications and then closes the subscription.
+func (s *notificationTestService) ClosingSubscription(ctx context.Context, n int) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	go func() {
+		for i := 0; i < n; i++ {
+			notifier.Notify(subscription.ID, i)
+		}
+		notifier.Close(subscription.ID)
+		<-subscription.Err()
+		if s.unsubscribed != nil {
+			s.unsubscribed <- string(subscription.ID)
+		}
+	}()
+	return subscription, nil
+}
+
+// FailingSubscription sends n notifications and then ends the subscription with an error.
+func (s *notificationTestService) FailingSubscription(ctx context.Context, n int) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	go func() {
+		for i := 0; i < n; i++ {
+			notifier.Notify(subscription.ID, i)
+		}
+		notifier.Fail(subscription.ID, &limitExceededError{"too many notifications"})
+	}()
+	return subscription, nil
+}
+
 // HangSubscription blocks on s.unblockHangSubscription before sending anything.
 func (s *notificationTestService) HangSubscription(ctx context.Context, val int) (*Subscription, error) {
 	notifier, supported := NotifierFromContext(ctx)
@@ -18,10 +18,12 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"strings"
 
+	"github.com/groshproject/grosh-core/common"
 	"github.com/groshproject/grosh-core/common/hexutil"
 )
 
@@ -105,3 +107,80 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 func (bn BlockNumber) Int64() int64 {
 	return (int64)(bn)
 }
+
+// BlockNumberOrHash selects a block either by number (including the "latest",
+// "earliest" and "pending" tags) or by hash. When selecting by hash, the block can
+// be required to be part of the canonical chain.
+type BlockNumberOrHash struct {
+	BlockNumber      *BlockNumber `json:"blockNumber,omitempty"`
+	BlockHash        *common.Hash `json:"blockHash,omitempty"`
+	RequireCanonical bool         `json:"requireCanonical,omitempty"`
+}
+
+// UnmarshalJSON parses the given JSON fragment into a BlockNumberOrHash. It supports:
+//   - a block number or tag string, as accepted by BlockNumber
+//   - a 32 byte hex encoded block hash string
+//   - an object with either a "blockNumber" or a "blockHash" field, and optionally
+//     "requireCanonical" along with the hash
+func (bnh *BlockNumberOrHash) UnmarshalJSON(data []byte) error {
+	type erased BlockNumberOrHash
+	var obj erased
+	if err := json.Unmarshal(data, &obj); err == nil {
+		if obj.BlockNumber != nil && obj.BlockHash != nil {
+			return fmt.Errorf("cannot specify both blockHash and blockNumber, choose one or the other")
+		}
+		if obj.BlockNumber == nil && obj.BlockHash == nil {
+			return fmt.Errorf("either blockHash or blockNumber must be specified")
+		}
+		if obj.BlockNumber != nil && obj.RequireCanonical {
+			return fmt.Errorf("requireCanonical can only be used with blockHash")
+		}
+		*bnh = BlockNumberOrHash(obj)
+		return nil
+	}
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	if len(input) == 66 {
+		var hash common.Hash
+		if err := hash.UnmarshalText([]byte(input)); err != nil {
+			return err
+		}
+		*bnh = BlockNumberOrHashWithHash(hash, false)
+		return nil
+	}
+	var number BlockNumber
+	if err := number.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*bnh = BlockNumberOrHashWithNumber(number)
+	return nil
+}
+
+// Number returns the selected block number, if the block is selected by number.
+func (bnh *BlockNumberOrHash) Number() (BlockNumber, bool) {
+	if bnh.BlockNumber != nil {
+		return *bnh.BlockNumber, true
+	}
+	return BlockNumber(0), false
+}
+
+// Hash returns the selected block hash, if the block is selected by hash.
+func (bnh *BlockNumberOrHash) Hash() (common.Hash, bool) {
+	if bnh.BlockHash != nil {
+		return *bnh.BlockHash, true
+	}
+	return common.Hash{}, false
+}
+
+// BlockNumberOrHashWithNumber selects a block by number.
+func BlockNumberOrHashWithNumber(number BlockNumber) BlockNumberOrHash {
+	return BlockNumberOrHash{BlockNumber: &number}
+}
+
+// BlockNumberOrHashWithHash selects a block by hash, optionally requiring it to
+// be canonical.
+func BlockNumberOrHashWithHash(hash common.Hash, canonical bool) BlockNumberOrHash {
+	return BlockNumberOrHash{BlockHash: &hash, RequireCanonical: canonical}
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/groshproject/grosh-core/common"
 	"github.com/groshproject/grosh-core/common/math"
 )
 
@@ -64,3 +65,50 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestBlockNumberOrHashJSONUnmarshal(t *testing.T) {
+	hash := common.HexToHash("0x1122334455667788990011223344556677889900112233445566778899001122")
+	tests := []struct {
+		input    string
+		mustFail bool
+		expected BlockNumberOrHash
+	}{
+		0:  {`"0x1"`, false, BlockNumberOrHashWithNumber(1)},
+		1:  {`"latest"`, false, BlockNumberOrHashWithNumber(LatestBlockNumber)},
+		2:  {`"pending"`, false, BlockNumberOrHashWithNumber(PendingBlockNumber)},
+		3:  {`"` + hash.Hex() + `"`, false, BlockNumberOrHashWithHash(hash, false)},
+		4:  {`{"blockNumber":"0x12"}`, false, BlockNumberOrHashWithNumber(18)},
+		5:  {`{"blockHash":"` + hash.Hex() + `"}`, false, BlockNumberOrHashWithHash(hash, false)},
+		6:  {`{"blockHash":"` + hash.Hex() + `","requireCanonical":true}`, false, BlockNumberOrHashWithHash(hash, true)},
+		7:  {`{"blockNumber":"0x1","blockHash":"` + hash.Hex() + `"}`, true, BlockNumberOrHash{}},
+		8:  {`{"blockNumber":"0x1","requireCanonical":true}`, true, BlockNumberOrHash{}},
+		9:  {`{}`, true, BlockNumberOrHash{}},
+		10: {`"0x11"` + `2`, true, BlockNumberOrHash{}},
+		11: {`"0x112233445566778899001122334455667788990011223344556677889900112g"`, true, BlockNumberOrHash{}},
+		12: {`"someString"`, true, BlockNumberOrHash{}},
+		13: {`1`, true, BlockNumberOrHash{}},
+	}
+
+	for i, test := range tests {
+		var bnh BlockNumberOrHash
+		err := json.Unmarshal([]byte(test.input), &bnh)
+		if test.mustFail && err == nil {
+			t.Errorf("Test %d should fail", i)
+			continue
+		}
+		if !test.mustFail && err != nil {
+			t.Errorf("Test %d should pass but got err: %v", i, err)
+			continue
+		}
+		if test.mustFail {
+			continue
+		}
+		haveNum, haveIsNum := bnh.Number()
+		wantNum, wantIsNum := test.expected.Number()
+		haveHash, haveIsHash := bnh.Hash()
+		wantHash, wantIsHash := test.expected.Hash()
+		if haveNum != wantNum || haveIsNum != wantIsNum || haveHash != wantHash || haveIsHash != wantIsHash || bnh.RequireCanonical != test.expected.RequireCanonical {
+			t.Errorf("Test %d got unexpected value, want %+v, got %+v", i, test.expected, bnh)
+		}
+	}
+}
@@ -130,6 +130,12 @@ func (e wsHandshakeError) Error() string {
 // The context is used for the initial connection establishment. It does not
 // affect subsequent interactions with the client.
 func DialWebsocket(ctx context.Context, endpoint, origin string) (*Client, error) {
+	return dialWebsocket(ctx, endpoint, origin, nil)
+}
+
+// dialWebsocket creates a websocket client. If setHeaders is non-nil, it is called
+// to add headers to the handshake request whenever the client connects.
+func dialWebsocket(ctx context.Context, endpoint, origin string, setHeaders func(http.Header)) (*Client, error) {
 	endpoint, header, err := wsClientHeaders(endpoint, origin)
 	if err != nil {
 		return nil, err
@@ -140,6 +146,10 @@ func DialWebsocket(ctx context.Context, endpoint, origin string) (*Client, error
 		WriteBufferPool: wsBufferPool,
 	}
 	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
+		if setHeaders != nil {
+			header = header.Clone()
+			setHeaders(header)
+		}
 		conn, resp, err := dialer.DialContext(ctx, endpoint, header)
 		if err != nil {
 			hErr := wsHandshakeError{err: err}
@@ -171,5 +181,7 @@ func wsClientHeaders(endpoint, origin string) (string, http.Header, error) {
 
 func newWebsocketCodec(conn *websocket.Conn) ServerCodec {
 	conn.SetReadLimit(maxRequestContentLength)
-	return newCodec(conn, conn.WriteJSON, conn.ReadJSON)
+	codec := newCodec(conn, conn.WriteJSON, conn.ReadJSON).(*jsonCodec)
+	codec.remoteAddr = conn.RemoteAddr().String()
+	return codec
 }